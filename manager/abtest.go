@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+)
+
+// A/B test modes
+const (
+	abModeSplit = "split" // Each job runs with a single variant, assigned round-robin
+	abModeBoth  = "both"  // A sample of jobs runs with every variant
+)
+
+// PromptVariant is a named prompt template used for A/B testing
+type PromptVariant struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+}
+
+// ABTestConfig describes how prompt variants are applied to a batch
+type ABTestConfig struct {
+	Variants   []PromptVariant `json:"variants"`
+	Mode       string          `json:"mode,omitempty"`        // "split" (default) or "both"
+	SampleSize int             `json:"sample_size,omitempty"` // Jobs that run every variant in "both" mode
+}
+
+// VariantStats holds the aggregated results for a single prompt variant
+type VariantStats struct {
+	Variant             string  `json:"variant"`
+	Jobs                int     `json:"jobs"`
+	Failed              int     `json:"failed"`
+	AverageCompleteness float64 `json:"average_completeness"`
+	TotalTokens         int     `json:"total_tokens"`
+	TotalCost           float64 `json:"total_cost"`
+	CostPerJob          float64 `json:"cost_per_job"`
+}
+
+// VariantReport compares prompt variants across a batch
+type VariantReport struct {
+	Variants []VariantStats `json:"variants"`
+	Best     string         `json:"best,omitempty"` // Highest completeness, cheapest on ties
+}
+
+// variantSample is a single observation fed into the comparison report
+type variantSample struct {
+	variant      string
+	failed       bool
+	completeness float64
+	tokens       int
+	cost         float64
+}
+
+// enabled reports whether the config defines an actual A/B test
+func (c ABTestConfig) enabled() bool {
+	return len(c.Variants) >= 2
+}
+
+// variantsFor returns the variants a job at the given index should run with.
+// An empty result means the default prompt is used.
+func (c ABTestConfig) variantsFor(index int) []PromptVariant {
+	if !c.enabled() {
+		return nil
+	}
+	if c.Mode == abModeBoth && index < c.SampleSize {
+		return c.Variants
+	}
+	return []PromptVariant{c.Variants[index%len(c.Variants)]}
+}
+
+// assignVariants splits batch jobs between the configured prompt variants.
+// Jobs sampled in "both" mode are duplicated once per variant. Rows left
+// out by batch sampling run no variant and are kept once.
+func assignVariants(jobs []BatchJob, config ABTestConfig) []BatchJob {
+	assigned := make([]BatchJob, 0, len(jobs))
+	i := 0
+	for _, job := range jobs {
+		if job.Status == statusSkippedBySampling {
+			assigned = append(assigned, job)
+			continue
+		}
+		for _, variant := range config.variantsFor(i) {
+			j := job
+			j.PromptVariant = variant.Name
+			j.promptTemplate = variant.Template
+			assigned = append(assigned, j)
+		}
+		i++
+	}
+	return assigned
+}
+
+// extractionCompleteness returns the fraction of product fields that were found.
+// Free-text results count as complete unless they are "NO_MATCH".
+func extractionCompleteness(result interface{}) float64 {
+	switch r := result.(type) {
+	case nil:
+		return 0
+	case string:
+		if r == "" || r == "NO_MATCH" {
+			return 0
+		}
+		return 1
+	case map[string]interface{}:
+		fields := []string{"name", "model_number", "serial_number", "warranty_info", "user_manual", "other_documents"}
+		found := 0
+		for _, field := range fields {
+			switch v := r[field].(type) {
+			case string:
+				if v != "" && v != "NO_MATCH" {
+					found++
+				}
+			case []string:
+				if len(v) > 0 {
+					found++
+				}
+			case []interface{}:
+				if len(v) > 0 {
+					found++
+				}
+			}
+		}
+		return float64(found) / float64(len(fields))
+	}
+	return 0
+}
+
+// buildVariantReport aggregates per-variant completeness and cost
+func buildVariantReport(samples []variantSample) VariantReport {
+	byVariant := make(map[string]*VariantStats)
+	completeness := make(map[string]float64)
+	var names []string
+
+	for _, s := range samples {
+		stats, ok := byVariant[s.variant]
+		if !ok {
+			stats = &VariantStats{Variant: s.variant}
+			byVariant[s.variant] = stats
+			names = append(names, s.variant)
+		}
+		stats.Jobs++
+		stats.TotalTokens += s.tokens
+		stats.TotalCost += s.cost
+		if s.failed {
+			stats.Failed++
+			continue
+		}
+		completeness[s.variant] += s.completeness
+	}
+	sort.Strings(names)
+
+	report := VariantReport{Variants: make([]VariantStats, 0, len(names))}
+	for _, name := range names {
+		stats := byVariant[name]
+		if succeeded := stats.Jobs - stats.Failed; succeeded > 0 {
+			stats.AverageCompleteness = completeness[name] / float64(succeeded)
+		}
+		if stats.Jobs > 0 {
+			stats.CostPerJob = stats.TotalCost / float64(stats.Jobs)
+		}
+		report.Variants = append(report.Variants, *stats)
+	}
+
+	for i, stats := range report.Variants {
+		if i == 0 {
+			report.Best = stats.Variant
+			continue
+		}
+		best := byVariant[report.Best]
+		if stats.AverageCompleteness > best.AverageCompleteness ||
+			(stats.AverageCompleteness == best.AverageCompleteness && stats.CostPerJob < best.CostPerJob) {
+			report.Best = stats.Variant
+		}
+	}
+	return report
+}
@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestAssignVariantsSplit(t *testing.T) {
+	config := ABTestConfig{Variants: []PromptVariant{{Name: "a"}, {Name: "b"}}}
+	jobs := []BatchJob{{URL: "u1"}, {URL: "u2"}, {URL: "u3"}}
+
+	assigned := assignVariants(jobs, config)
+	if len(assigned) != 3 {
+		t.Fatalf("expected 3 jobs, got %d", len(assigned))
+	}
+	want := []string{"a", "b", "a"}
+	for i, job := range assigned {
+		if job.PromptVariant != want[i] {
+			t.Errorf("job %d: expected variant %q, got %q", i, want[i], job.PromptVariant)
+		}
+	}
+}
+
+func TestAssignVariantsBothSample(t *testing.T) {
+	config := ABTestConfig{
+		Variants:   []PromptVariant{{Name: "a"}, {Name: "b"}},
+		Mode:       abModeBoth,
+		SampleSize: 1,
+	}
+	jobs := []BatchJob{{URL: "u1"}, {URL: "u2"}}
+
+	assigned := assignVariants(jobs, config)
+	if len(assigned) != 3 {
+		t.Fatalf("expected sampled job to run every variant, got %d jobs", len(assigned))
+	}
+	if assigned[0].URL != "u1" || assigned[1].URL != "u1" {
+		t.Errorf("expected first job to be duplicated, got %q and %q", assigned[0].URL, assigned[1].URL)
+	}
+}
+
+func TestExtractionCompleteness(t *testing.T) {
+	tests := []struct {
+		name   string
+		result interface{}
+		want   float64
+	}{
+		{"nil", nil, 0},
+		{"no match", "NO_MATCH", 0},
+		{"text", "some answer", 1},
+		{"half product", map[string]interface{}{
+			"name":            "Widget",
+			"model_number":    "W-1",
+			"serial_number":   "NO_MATCH",
+			"warranty_info":   "2 years",
+			"user_manual":     []string{},
+			"other_documents": []interface{}{},
+		}, 0.5},
+	}
+	for _, tt := range tests {
+		if got := extractionCompleteness(tt.result); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestBuildVariantReport(t *testing.T) {
+	report := buildVariantReport([]variantSample{
+		{variant: "b", completeness: 1, tokens: 200, cost: 0.2},
+		{variant: "a", completeness: 0.5, tokens: 100, cost: 0.1},
+		{variant: "a", failed: true, tokens: 50, cost: 0.05},
+	})
+
+	if len(report.Variants) != 2 {
+		t.Fatalf("expected 2 variants, got %d", len(report.Variants))
+	}
+	a := report.Variants[0]
+	if a.Variant != "a" || a.Jobs != 2 || a.Failed != 1 || a.TotalTokens != 150 {
+		t.Errorf("unexpected stats for variant a: %+v", a)
+	}
+	if a.AverageCompleteness != 0.5 {
+		t.Errorf("expected failed jobs to be excluded from completeness, got %v", a.AverageCompleteness)
+	}
+	if report.Best != "b" {
+		t.Errorf("expected best variant b, got %q", report.Best)
+	}
+}
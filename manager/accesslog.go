@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Access logging is configured from the environment:
+//
+//	ACCESS_LOG         "off" disables it
+//	ACCESS_LOG_SAMPLE  fraction of successful requests logged, 0 to 1 (default 1);
+//	                   requests answered with 4xx or 5xx are always logged
+var (
+	accessLogEnabled = os.Getenv("ACCESS_LOG") != "off"
+	accessLogSample  = parseSampleRate(os.Getenv("ACCESS_LOG_SAMPLE"))
+)
+
+func parseSampleRate(value string) float64 {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 1
+	}
+	return rate
+}
+
+// AccessLogEntry is one structured access log line
+type AccessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	LatencyMs int64     `json:"latency_ms"`
+	Bytes     int64     `json:"bytes"`
+	ClientIP  string    `json:"client_ip"`
+	APIKeyID  string    `json:"api_key_id,omitempty"`
+}
+
+// statusRecorder captures the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Hijack lets WebSocket upgrades through the recorder
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// apiKeyID identifies the caller's key without logging it: the first 8 bytes
+// of its SHA-256, from X-API-Key or a bearer token
+func apiKeyID(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// accessLog writes one JSON line per request; it runs after proxyHeaders so
+// the client IP is the real one
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accessLogEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.status < 400 && accessLogSample < 1 && rand.Float64() >= accessLogSample {
+			return
+		}
+		entry, _ := json.Marshal(AccessLogEntry{
+			Time:      started,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Status:    recorder.status,
+			LatencyMs: time.Since(started).Milliseconds(),
+			Bytes:     recorder.bytes,
+			ClientIP:  clientIP(r),
+			APIKeyID:  apiKeyID(r),
+		})
+		log.Printf("access %s", entry)
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var adaptiveInterval = time.Second * 15 // How often the worker level is re-evaluated
+
+// AdaptiveConfig scales a batch's workers between Min and Max based on how
+// jobs and the host are behaving
+type AdaptiveConfig struct {
+	Enabled         bool    `json:"enabled"`
+	Min             int     `json:"min"`
+	Max             int     `json:"max"`
+	MaxErrorRate    float64 `json:"max_error_rate,omitempty"`    // Fraction of failed jobs that triggers a scale down, default 0.2
+	TargetLatencyMs int64   `json:"target_latency_ms,omitempty"` // Average job latency above which workers are reduced, 0 to ignore
+	MaxLoadPerCPU   float64 `json:"max_load_per_cpu,omitempty"`  // 1-minute load average per CPU above which workers are reduced, 0 to ignore
+	MaxMemoryMB     int     `json:"max_memory_mb,omitempty"`     // Heap size above which workers are reduced, 0 to ignore
+}
+
+// validate checks the worker bounds
+func (c AdaptiveConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Min < 1 || c.Max < c.Min {
+		return fmt.Errorf("adaptive concurrency needs 1 <= min <= max, got min %d max %d", c.Min, c.Max)
+	}
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		return fmt.Errorf("adaptive max_error_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// adaptiveLimiter caps the number of jobs a batch runs at once and moves the
+// cap up additively while jobs are healthy and halves it under pressure
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	config   AdaptiveConfig
+	limit    int
+	inFlight int
+
+	// Observations since the last adjustment
+	jobs    int
+	errors  int
+	latency time.Duration
+}
+
+func newAdaptiveLimiter(config AdaptiveConfig) *adaptiveLimiter {
+	if config.MaxErrorRate == 0 {
+		config.MaxErrorRate = 0.2
+	}
+	l := &adaptiveLimiter{config: config, limit: config.Min}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until a worker slot is free
+func (l *adaptiveLimiter) acquire() {
+	l.mu.Lock()
+	for l.inFlight >= l.limit {
+		l.cond.Wait()
+	}
+	l.inFlight++
+	l.mu.Unlock()
+}
+
+// release frees a worker slot and records the job outcome
+func (l *adaptiveLimiter) release(latency time.Duration, failed bool) {
+	l.mu.Lock()
+	l.inFlight--
+	l.jobs++
+	l.latency += latency
+	if failed {
+		l.errors++
+	}
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+// level returns the current worker cap
+func (l *adaptiveLimiter) level() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// run re-evaluates the worker cap until ctx is done, reporting each change
+func (l *adaptiveLimiter) run(ctx context.Context, onChange func(int)) {
+	ticker := time.NewTicker(adaptiveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if level, changed := l.adjust(hostPressure(l.config)); changed {
+				onChange(level)
+			}
+		}
+	}
+}
+
+// adjust applies one AIMD step from the observations since the last call
+func (l *adaptiveLimiter) adjust(underPressure bool) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous := l.limit
+	if l.jobs > 0 {
+		errorRate := float64(l.errors) / float64(l.jobs)
+		avgLatency := l.latency / time.Duration(l.jobs)
+		slow := l.config.TargetLatencyMs > 0 && avgLatency.Milliseconds() > l.config.TargetLatencyMs
+
+		if underPressure || slow || errorRate > l.config.MaxErrorRate {
+			l.limit /= 2
+		} else if l.inFlight >= l.limit {
+			// Only grow while the current slots are actually in use
+			l.limit++
+		}
+	} else if underPressure {
+		l.limit /= 2
+	}
+
+	if l.limit < l.config.Min {
+		l.limit = l.config.Min
+	}
+	if l.limit > l.config.Max {
+		l.limit = l.config.Max
+	}
+	l.jobs, l.errors, l.latency = 0, 0, 0
+
+	if l.limit > previous {
+		l.cond.Broadcast()
+	}
+	return l.limit, l.limit != previous
+}
+
+// hostPressure reports whether memory or CPU load exceed the configured limits
+func hostPressure(config AdaptiveConfig) bool {
+	if config.MaxMemoryMB > 0 {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > uint64(config.MaxMemoryMB)<<20 {
+			return true
+		}
+	}
+	if config.MaxLoadPerCPU > 0 {
+		if load, ok := loadAverage(); ok && load/float64(runtime.NumCPU()) > config.MaxLoadPerCPU {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAverage returns the 1-minute load average where the OS exposes it
+func loadAverage() (float64, bool) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Conflict resolution rules for consolidating several sources
+const (
+	resolveMostCommon  = "most_common"  // Value reported by the most sources wins
+	resolveFirstSource = "first_source" // Value from the earliest source in the batch wins
+)
+
+// scalarProductFields are merged by conflict resolution, list fields are unioned
+var (
+	scalarProductFields = []string{"name", "model_number", "serial_number", "warranty_info"}
+	listProductFields   = []string{"user_manual", "other_documents", "additional_info"}
+)
+
+// extractionSource is one URL's extraction for a model
+type extractionSource struct {
+	URL    string
+	Result interface{}
+	Rank   int // source_rank, 1 is most authoritative, 0 if unranked
+}
+
+// FieldCandidate is one of several differing values found for a field
+type FieldCandidate struct {
+	Value   string   `json:"value"`
+	Sources []string `json:"sources"`
+}
+
+// ModelRecord is the consolidated extraction for a single model number
+type ModelRecord struct {
+	ModelNumber string                      `json:"model_number"`
+	Fields      map[string]string           `json:"fields"`
+	Lists       map[string][]string         `json:"lists"`
+	Sources     []string                    `json:"sources"`
+	Conflicts   map[string][]FieldCandidate `json:"conflicts,omitempty"`
+}
+
+// mergeModelSources consolidates extractions from several URLs into one record
+func mergeModelSources(modelNumber string, sources []extractionSource, rule string) ModelRecord {
+	record := ModelRecord{
+		ModelNumber: modelNumber,
+		Fields:      make(map[string]string),
+		Lists:       make(map[string][]string),
+		Conflicts:   make(map[string][]FieldCandidate),
+	}
+
+	// Visit authoritative sources first so they win ties and "first_source"
+	sources = append([]extractionSource(nil), sources...)
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Rank != 0 && (sources[j].Rank == 0 || sources[i].Rank < sources[j].Rank)
+	})
+
+	candidates := make(map[string][]FieldCandidate)
+	for _, source := range sources {
+		info, ok := source.Result.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		record.Sources = append(record.Sources, source.URL)
+
+		for _, field := range scalarProductFields {
+			value, ok := info[field].(string)
+			if !ok || value == "" || value == "NO_MATCH" {
+				continue
+			}
+			candidates[field] = addCandidate(candidates[field], value, source.URL)
+		}
+		for _, field := range listProductFields {
+			record.Lists[field] = append(record.Lists[field], stringList(info[field])...)
+		}
+	}
+
+	for _, field := range scalarProductFields {
+		found := candidates[field]
+		if len(found) == 0 {
+			record.Fields[field] = "NO_MATCH"
+			continue
+		}
+		record.Fields[field] = resolveConflict(found, rule).Value
+		if len(found) > 1 {
+			record.Conflicts[field] = found
+		}
+	}
+	for _, field := range listProductFields {
+		record.Lists[field] = removeDuplicates(record.Lists[field])
+	}
+	return record
+}
+
+// addCandidate records a value for a field, grouping values that differ only in case or spacing
+func addCandidate(candidates []FieldCandidate, value, source string) []FieldCandidate {
+	key := normalizeForMatch(value)
+	for i := range candidates {
+		if normalizeForMatch(candidates[i].Value) == key {
+			candidates[i].Sources = append(candidates[i].Sources, source)
+			return candidates
+		}
+	}
+	return append(candidates, FieldCandidate{Value: strings.TrimSpace(value), Sources: []string{source}})
+}
+
+// resolveConflict picks a winning candidate according to rule
+func resolveConflict(candidates []FieldCandidate, rule string) FieldCandidate {
+	if rule == resolveFirstSource {
+		return candidates[0]
+	}
+	// Most sources wins; candidates are in rank order, so ties go to the best-ranked source
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if len(c.Sources) > len(best.Sources) {
+			best = c
+		}
+	}
+	return best
+}
+
+// consolidateByModel groups finished jobs by model number and merges each group
+func consolidateByModel(jobs []BatchJob, rule string) []ModelRecord {
+	byModel := make(map[string][]extractionSource)
+	var models []string
+	for _, job := range jobs {
+		if !jobSucceeded(job.Status) {
+			continue
+		}
+		if _, ok := byModel[job.ModelNumber]; !ok {
+			models = append(models, job.ModelNumber)
+		}
+		byModel[job.ModelNumber] = append(byModel[job.ModelNumber], extractionSource{URL: job.URL, Result: job.extraction, Rank: job.SourceRank})
+	}
+	sort.Strings(models)
+
+	records := make([]ModelRecord, 0, len(models))
+	for _, model := range models {
+		records = append(records, mergeModelSources(model, byModel[model], rule))
+	}
+	return records
+}
+
+// saveModelRecord writes a consolidated record next to the model's per-URL results
+func saveModelRecord(baseDir string, record ModelRecord) error {
+	resultsDir := filepath.Join(modelDirFor(baseDir, record.ModelNumber), "results")
+	data, err := json.MarshalIndent(record, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal consolidated record: %v", err)
+	}
+	if err := writeFileAtomic(filepath.Join(resultsDir, "consolidated.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write consolidated record: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	maxArchiveFiles      = 500            // Entries extracted from a single archive
+	maxArchiveBytes      = int64(1 << 30) // Uncompressed bytes extracted from a single archive
+	maxArchiveEntryBytes = int64(256 << 20)
+)
+
+// ExtractedFile is a file unpacked from a downloaded archive
+type ExtractedFile struct {
+	Archive    string  `json:"archive"`
+	Path       string  `json:"path"`
+	Size       int64   `json:"size"`
+	Type       string  `json:"type"` // Document classification of the entry
+	Confidence float64 `json:"confidence"`
+}
+
+// isArchive reports whether path is a ZIP file, by extension or magic number
+func isArchive(path string) bool {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return string(magic) == "PK\x03\x04"
+}
+
+// expandArchive extracts a ZIP into a sibling "<name>_extracted" directory.
+// Entries that would escape the directory are skipped, and extraction stops
+// once the file count or size limits are reached. Nested archives are left packed.
+func expandArchive(archivePath string) ([]ExtractedFile, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	defer reader.Close()
+
+	destDir := strings.TrimSuffix(archivePath, filepath.Ext(archivePath)) + "_extracted"
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+
+	var extracted []ExtractedFile
+	var total int64
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		if len(extracted) >= maxArchiveFiles {
+			log.Printf("Archive %s: stopped after %d files", archivePath, maxArchiveFiles)
+			break
+		}
+
+		target, ok := archiveTarget(destDir, entry.Name)
+		if !ok {
+			log.Printf("Archive %s: skipping unsafe entry %q", archivePath, entry.Name)
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			log.Printf("Archive %s: skipping non-regular entry %q", archivePath, entry.Name)
+			continue
+		}
+
+		limit := maxArchiveBytes - total
+		if limit > maxArchiveEntryBytes {
+			limit = maxArchiveEntryBytes
+		}
+		size, err := extractEntry(entry, target, limit)
+		total += size
+		if err != nil {
+			return extracted, fmt.Errorf("failed to extract %q from %s: %w", entry.Name, archivePath, err)
+		}
+
+		docType, confidence := classifyByName(entry.Name, "")
+		extracted = append(extracted, ExtractedFile{
+			Archive:    archivePath,
+			Path:       target,
+			Size:       size,
+			Type:       docType,
+			Confidence: confidence,
+		})
+	}
+
+	if err := writeArchiveContents(destDir, extracted); err != nil {
+		return extracted, err
+	}
+	return extracted, nil
+}
+
+// archiveTarget resolves an entry name inside destDir, rejecting absolute
+// paths and ".." components (zip-slip)
+func archiveTarget(destDir, name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", false
+	}
+	target := filepath.Join(destDir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return target, true
+}
+
+// extractEntry copies one entry to target, failing if it exceeds limit bytes
+func extractEntry(entry *zip.File, target string, limit int64) (int64, error) {
+	if limit <= 0 || entry.UncompressedSize64 > uint64(limit) {
+		return 0, fmt.Errorf("entry exceeds size limit")
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	src, err := entry.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	// The declared size can lie, so enforce the limit on the bytes actually written
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > limit {
+		os.Remove(target)
+		err = fmt.Errorf("entry exceeds size limit")
+	}
+	return n, err
+}
+
+// writeArchiveContents lists the extracted files next to them as contents.json
+func writeArchiveContents(destDir string, files []ExtractedFile) error {
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive contents: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(destDir, "contents.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write archive contents: %w", err)
+	}
+	return nil
+}
+
+// expandDownloadedArchives unpacks any archives among the downloaded files,
+// adding the extracted files to the same link's list
+func expandDownloadedArchives(downloads map[string][]string) []ExtractedFile {
+	var all []ExtractedFile
+	for link, files := range downloads {
+		for _, file := range files {
+			if !isArchive(file) {
+				continue
+			}
+			extracted, err := expandArchive(file)
+			if err != nil {
+				log.Printf("Failed to expand archive from %s: %v", link, err)
+			}
+			for _, f := range extracted {
+				downloads[link] = append(downloads[link], f.Path)
+			}
+			all = append(all, extracted...)
+		}
+	}
+	return all
+}
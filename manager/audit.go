@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audited operator actions
+const (
+	auditUpload      = "upload"
+	auditImport      = "import"
+	auditArchive     = "archive"
+	auditCancel      = "cancel"
+	auditRetry       = "retry_failed"
+	auditDelete      = "delete"
+	auditStopFeed    = "stop_feed"
+	auditMaintenance = "maintenance"
+	auditExpire      = "expire" // Batch removed by the collector after inactivity
+)
+
+// auditFile is the append-only audit trail below the data directory
+const auditFile = "audit.jsonl"
+
+// defaultAuditLimit caps the entries GET /audit returns without ?limit
+const defaultAuditLimit = 500
+
+// AuditEntry records one operator action. Entries are only ever appended.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	BatchID  string    `json:"batch_id,omitempty"`
+	Actor    string    `json:"actor"`               // "jwt:<subject>", "key:<key ID>", "anonymous" or "system"
+	ClientIP string    `json:"client_ip,omitempty"` // Empty for actions the server takes itself
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// auditLog appends entries to <dataDir>/audit.jsonl
+type auditLog struct {
+	mu sync.Mutex
+}
+
+var audit = &auditLog{}
+
+func auditPath() string {
+	return filepath.Join(dataDir, auditFile)
+}
+
+// record appends an action taken through the API
+func (a *auditLog) record(r *http.Request, action, batchID, detail string) {
+	a.append(AuditEntry{Action: action, BatchID: batchID, Actor: auditActor(r), ClientIP: clientIP(r), Detail: detail})
+}
+
+// recordSystem appends an action the server took on its own
+func (a *auditLog) recordSystem(action, batchID, detail string) {
+	a.append(AuditEntry{Action: action, BatchID: batchID, Actor: "system", Detail: detail})
+}
+
+func (a *auditLog) append(entry AuditEntry) {
+	entry.Time = time.Now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		log.Printf("Failed to write audit entry for %s: %v", entry.Action, err)
+		return
+	}
+	f, err := os.OpenFile(auditPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		log.Printf("Failed to write audit entry for %s: %v", entry.Action, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit entry for %s: %v", entry.Action, err)
+	}
+}
+
+// auditActor identifies the caller: the user named by a trusted proxy, the
+// subject of a JWT bearer token whose signature checks out, else the ID of
+// its API key. Claims of tokens that cannot be verified are never recorded.
+func auditActor(r *http.Request) string {
+	if user := trustedUser(r); user != "" {
+		return "user:" + user
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		if subject := verifiedJWTSubject(strings.TrimPrefix(auth, "Bearer "), time.Now()); subject != "" {
+			return "jwt:" + subject
+		}
+	}
+	if id := apiKeyID(r); id != "" {
+		return "key:" + id
+	}
+	return "anonymous"
+}
+
+// verifiedJWTSubject returns the "sub" claim of an HS256 JWT signed with the
+// jwt_signing_key secret that is valid at now, or "" for any other token
+func verifiedJWTSubject(token string, now time.Time) string {
+	key := secrets.get(secretJWTKey)
+	parts := strings.Split(token, ".")
+	if key == "" || len(parts) != 3 {
+		return ""
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if decodeJWTPart(parts[0], &header) != nil || header.Algorithm != "HS256" {
+		return ""
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, hmacSHA256([]byte(key), parts[0]+"."+parts[1])) {
+		return ""
+	}
+	var claims struct {
+		Subject   string `json:"sub"`
+		Expires   *int64 `json:"exp"`
+		NotBefore *int64 `json:"nbf"`
+	}
+	if decodeJWTPart(parts[1], &claims) != nil {
+		return ""
+	}
+	if claims.Expires != nil && now.Unix() >= *claims.Expires {
+		return ""
+	}
+	if claims.NotBefore != nil && now.Unix() < *claims.NotBefore {
+		return ""
+	}
+	return claims.Subject
+}
+
+// decodeJWTPart decodes a base64url JSON segment of a JWT into v
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// auditFilter selects entries for GET /audit
+type auditFilter struct {
+	action  string
+	batchID string
+	actor   string
+	since   time.Time
+	limit   int
+}
+
+func (f auditFilter) matches(entry AuditEntry) bool {
+	return (f.action == "" || entry.Action == f.action) &&
+		(f.batchID == "" || entry.BatchID == f.batchID) &&
+		(f.actor == "" || entry.Actor == f.actor) &&
+		!entry.Time.Before(f.since)
+}
+
+// read returns the newest entries matching filter, newest first
+func (a *auditLog) read(filter auditFilter) ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.Open(auditPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var matched []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || !filter.matches(entry) {
+			continue
+		}
+		matched = append(matched, entry)
+		if len(matched) > filter.limit {
+			matched = matched[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, len(matched))
+	for i, entry := range matched {
+		entries[len(matched)-1-i] = entry
+	}
+	return entries, nil
+}
+
+// handleAudit returns operator actions, newest first. ?action=, ?batch_id=
+// and ?actor= filter them, ?since= takes an RFC 3339 time and ?limit= caps
+// the entries returned (500 by default).
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := auditFilter{
+		action:  query.Get("action"),
+		batchID: query.Get("batch_id"),
+		actor:   query.Get("actor"),
+		limit:   defaultAuditLimit,
+	}
+	if value := query.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		filter.since = since
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		filter.limit = limit
+	}
+
+	entries, err := audit.read(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read audit trail: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Where a page's category path was read from, most trusted first
+const (
+	categoryFromJSONLD      = "json_ld_breadcrumb"
+	categoryFromBreadcrumb  = "breadcrumb"
+	categoryFromProductData = "product_category"
+)
+
+const maxCategoryDepth = 10
+
+var (
+	// Separators between crumbs, which some sites put in their own text nodes
+	crumbSeparatorPattern = regexp.MustCompile(`^[>/|»›→·•\\\-–—:]+$`)
+	// Categories written as one string, e.g. "Tools > Power Tools > Drills"
+	categorySplitPattern = regexp.MustCompile(`\s*(?:>|/|»|›|→|\|)\s*`)
+	// Crumbs linking to the site's start page
+	homeCrumbs = map[string]bool{"home": true, "homepage": true, "start": true, "startseite": true, "accueil": true, "inicio": true, "home page": true, "shop": true}
+)
+
+// breadcrumbTracker collects the text of the first element marked as a
+// breadcrumb trail while a page is streamed: an element whose class, id or
+// aria-label mentions "breadcrumb", or a microdata BreadcrumbList
+type breadcrumbTracker struct {
+	tag    string // Element the trail is in; nesting of the same tag is counted
+	depth  int
+	crumbs []string
+	done   bool
+}
+
+func (t *breadcrumbTracker) start(token html.Token) {
+	if t.done {
+		return
+	}
+	if t.depth > 0 {
+		if token.Data == t.tag && token.Type == html.StartTagToken {
+			t.depth++
+		}
+		return
+	}
+	if token.Type != html.StartTagToken || !isBreadcrumbElement(token) {
+		return
+	}
+	t.tag, t.depth = token.Data, 1
+}
+
+func (t *breadcrumbTracker) end(token html.Token, page *pageContent) {
+	if t.depth == 0 || token.Data != t.tag {
+		return
+	}
+	t.depth--
+	if t.depth == 0 {
+		t.done = true
+		page.Breadcrumbs = t.crumbs
+	}
+}
+
+func (t *breadcrumbTracker) text(text string) {
+	if t.depth > 0 && len(t.crumbs) < maxCategoryDepth*2 && !crumbSeparatorPattern.MatchString(text) {
+		t.crumbs = append(t.crumbs, text)
+	}
+}
+
+// isBreadcrumbElement reports whether a start tag opens a breadcrumb trail
+func isBreadcrumbElement(token html.Token) bool {
+	for _, key := range []string{"class", "id", "aria-label"} {
+		if strings.Contains(strings.ToLower(attr(token, key)), "breadcrumb") {
+			return true
+		}
+	}
+	return strings.HasSuffix(strings.TrimRight(attr(token, "itemtype"), "/"), "schema.org/BreadcrumbList")
+}
+
+// extractCategoryPath returns the page's category hierarchy from the most
+// trusted source that has one: a JSON-LD BreadcrumbList, the breadcrumb trail
+// in the markup, or the product's own category. The start page and the
+// product itself are left out of the path.
+func extractCategoryPath(page *pageContent, structured *StructuredProduct, modelNumber string) ([]string, string) {
+	productName := ""
+	if structured != nil {
+		productName = structured.Name
+	}
+	candidates := []struct {
+		crumbs []string
+		source string
+	}{
+		{jsonLDBreadcrumbs(page.JSONLD), categoryFromJSONLD},
+		{page.Breadcrumbs, categoryFromBreadcrumb},
+		{productCategory(page), categoryFromProductData},
+	}
+	for _, candidate := range candidates {
+		if path := cleanCategoryPath(candidate.crumbs, productName, page.Title, modelNumber); len(path) > 0 {
+			return path, candidate.source
+		}
+	}
+	return nil, ""
+}
+
+// jsonLDBreadcrumbs returns the item names of the first BreadcrumbList in the
+// page's JSON-LD, in position order
+func jsonLDBreadcrumbs(blocks []string) []string {
+	for _, block := range blocks {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(block), &doc); err != nil {
+			continue
+		}
+		list := findJSONLDType(doc, "BreadcrumbList")
+		if list == nil {
+			continue
+		}
+		items, _ := list["itemListElement"].([]interface{})
+		type crumb struct {
+			position float64
+			name     string
+		}
+		var crumbs []crumb
+		for i, raw := range items {
+			item, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := scalarText(item["name"])
+			if nested, ok := item["item"].(map[string]interface{}); ok && name == "" {
+				name = scalarText(nested["name"])
+			}
+			position, err := strconv.ParseFloat(scalarText(item["position"]), 64)
+			if err != nil {
+				position = float64(i + 1)
+			}
+			crumbs = append(crumbs, crumb{position, name})
+		}
+		sort.SliceStable(crumbs, func(i, j int) bool { return crumbs[i].position < crumbs[j].position })
+		names := make([]string, 0, len(crumbs))
+		for _, c := range crumbs {
+			names = append(names, c.name)
+		}
+		if len(names) > 0 {
+			return names
+		}
+	}
+	return nil
+}
+
+// findJSONLDType returns the first object of the given @type in a JSON-LD
+// document, looking inside lists and @graph
+func findJSONLDType(doc interface{}, schemaType string) map[string]interface{} {
+	switch v := doc.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if found := findJSONLDType(item, schemaType); found != nil {
+				return found
+			}
+		}
+	case map[string]interface{}:
+		for _, t := range listText(v["@type"]) {
+			if strings.EqualFold(schemaEnum(t), schemaType) {
+				return v
+			}
+		}
+		for _, key := range []string{"@graph", "breadcrumb", "mainEntity"} {
+			if found := findJSONLDType(v[key], schemaType); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// productCategory splits the category a Product's JSON-LD or the
+// product:category meta tag gives as one string
+func productCategory(page *pageContent) []string {
+	category := ""
+	for _, block := range page.JSONLD {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(block), &doc); err != nil {
+			continue
+		}
+		if product := findJSONLDProduct(doc); product != nil {
+			if category = scalarText(product["category"]); category != "" {
+				break
+			}
+		}
+	}
+	if category == "" {
+		category = page.Meta["product:category"]
+	}
+	if category == "" || strings.HasPrefix(category, "http") {
+		return nil
+	}
+	return categorySplitPattern.Split(category, -1)
+}
+
+// cleanCategoryPath trims the crumbs and drops empty ones, separators,
+// repeats, the start page and a final crumb naming the product itself
+func cleanCategoryPath(crumbs []string, productName, title, modelNumber string) []string {
+	var path []string
+	for _, crumb := range crumbs {
+		crumb = strings.Join(strings.Fields(crumb), " ")
+		if crumb == "" || crumbSeparatorPattern.MatchString(crumb) {
+			continue
+		}
+		if len(path) > 0 && strings.EqualFold(path[len(path)-1], crumb) {
+			continue
+		}
+		path = append(path, crumb)
+	}
+	if len(path) > 0 && homeCrumbs[strings.ToLower(path[0])] {
+		path = path[1:]
+	}
+	if n := len(path); n > 0 {
+		last := path[n-1]
+		if (modelNumber != "" && mentionsModel(last, modelNumber)) ||
+			(productName != "" && strings.EqualFold(last, productName)) ||
+			(len(last) > 3 && title != "" && strings.HasPrefix(strings.ToLower(title), strings.ToLower(last))) {
+			path = path[:n-1]
+		}
+	}
+	if len(path) > maxCategoryDepth {
+		path = path[:maxCategoryDepth]
+	}
+	return path
+}
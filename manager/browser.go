@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Pages whose domain script lists interactions are rendered in the headless
+// browser named by CHROME_PATH and driven over the Chrome DevTools Protocol
+const (
+	browserStartTimeout = time.Second * 10
+	browserLoadTimeout  = time.Second * 30
+	defaultWaitForMs    = 10000
+	browserPollInterval = time.Millisecond * 100
+)
+
+// browserTarget checks a URL the browser is about to open against the SSRF
+// policy. The browser fetches pages itself, so it is also pointed at a
+// policyProxy; see browserArgs.
+func browserTarget(ctx context.Context, pageURL string) (string, error) {
+	target, err := url.Parse(pageURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return "", fmt.Errorf("cannot open %q in the browser: not an http(s) URL", pageURL)
+	}
+	if err := ssrfPolicy.validateURL(ctx, pageURL); err != nil {
+		return "", fmt.Errorf("browser request for %s refused: %w", pageURL, err)
+	}
+	return target.String(), nil
+}
+
+// browserArgs are the flags every headless browser run starts with. Loopback
+// is proxied too, rather than Chrome's default of connecting directly.
+func browserArgs(proxy string) []string {
+	return []string{"--headless", "--disable-gpu", "--hide-scrollbars",
+		"--proxy-server=http://" + proxy, "--proxy-bypass-list=<-loopback>"}
+}
+
+// renderInteractive opens pageURL in the browser, runs the script's
+// interactions and returns the resulting document's HTML. The HTML is saved
+// as the page's snapshot, so replays see the same content.
+func (s *SiteScraper) renderInteractive(ctx context.Context, pageURL string, actions []ScriptAction) (*pageContent, error) {
+	chrome := os.Getenv(chromePathEnv)
+	if chrome == "" {
+		return nil, fmt.Errorf("%s is not set; interactions need a browser", chromePathEnv)
+	}
+	target, err := browserTarget(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	proxy, stop, err := startPolicyProxy(ssrfPolicy, scrapeTransport)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	profile, err := os.MkdirTemp("", "scraper-browser-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser profile: %w", err)
+	}
+	defer os.RemoveAll(profile)
+
+	args := append(browserArgs(proxy), "--remote-debugging-port=0", "--user-data-dir="+profile, "about:blank")
+	cmd := exec.CommandContext(ctx, chrome, args...)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start browser: %w", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	page, err := connectDevTools(ctx, profile, s.limits.pageBytes())
+	if err != nil {
+		return nil, err
+	}
+	defer page.close()
+
+	started := time.Now()
+	if _, err := page.call(ctx, "Page.navigate", map[string]interface{}{"url": target}); err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", pageURL, err)
+	}
+	if err := page.waitUntil(ctx, `document.readyState === "complete"`, browserLoadTimeout); err != nil {
+		return nil, fmt.Errorf("%s did not finish loading: %w", pageURL, err)
+	}
+	for i, action := range actions {
+		if err := page.run(ctx, action); err != nil {
+			return nil, fmt.Errorf("interaction %d (%s) on %s: %w", i, action.Action, pageURL, err)
+		}
+	}
+
+	var html string
+	if err := page.evaluate(ctx, "document.documentElement.outerHTML", &html); err != nil {
+		return nil, fmt.Errorf("failed to read %s from the browser: %w", pageURL, err)
+	}
+	content, err := streamHTML(strings.NewReader(html), s.limits.pageBytes(), s.limits.contentBytes())
+	domainStats.record(pageURL, time.Since(started), int64(len(html)), err != nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rendered %s: %w", pageURL, err)
+	}
+	s.saveRendered(pageURL, html)
+	return content, nil
+}
+
+// saveRendered stores rendered HTML as the page's snapshot; a failed snapshot
+// never fails the scrape
+func (s *SiteScraper) saveRendered(pageURL, html string) {
+	snapshot, commit, err := s.snapshotWriter(pageURL)
+	if err != nil {
+		log.Printf("Snapshot disabled for %s: %v", pageURL, err)
+		return
+	}
+	defer snapshot.Close()
+	if _, err := snapshot.WriteString(html); err != nil {
+		os.Remove(snapshot.Name())
+		log.Printf("Failed to save snapshot for %s: %v", pageURL, err)
+		return
+	}
+	if err := commit(); err != nil {
+		log.Printf("Failed to save snapshot for %s: %v", pageURL, err)
+	} else if err := s.redactor.redactFile(s.snapshotPath(pageURL)); err != nil {
+		log.Printf("Failed to redact snapshot for %s: %v", pageURL, err)
+	}
+}
+
+// devToolsPage is a DevTools Protocol session with one browser tab. Calls are
+// made one at a time; events the browser sends in between are skipped.
+type devToolsPage struct {
+	conn   *websocket.Conn
+	nextID int
+}
+
+// connectDevTools waits for the browser started with profile to announce its
+// debugging port, then attaches to its first tab
+func connectDevTools(ctx context.Context, profile string, maxMessage int64) (*devToolsPage, error) {
+	deadline := time.Now().Add(browserStartTimeout)
+	var port string
+	for port == "" {
+		if f, err := os.Open(filepath.Join(profile, "DevToolsActivePort")); err == nil {
+			scanner := bufio.NewScanner(f)
+			if scanner.Scan() {
+				port = strings.TrimSpace(scanner.Text())
+			}
+			f.Close()
+		}
+		if port != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("browser did not start within %s", browserStartTimeout)
+		}
+		if err := pause(ctx, browserPollInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	// The debugging endpoint is the browser's own loopback port
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:"+port+"/json/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list browser tabs: %w", err)
+	}
+	defer resp.Body.Close()
+	var targets []struct {
+		Type                 string `json:"type"`
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
+		return nil, fmt.Errorf("failed to list browser tabs: %w", err)
+	}
+	for _, target := range targets {
+		if target.Type != "page" {
+			continue
+		}
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, target.WebSocketDebuggerURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach to the browser tab: %w", err)
+		}
+		// Room for the page's HTML plus the protocol's JSON escaping
+		conn.SetReadLimit(maxMessage*2 + 1<<20)
+		return &devToolsPage{conn: conn}, nil
+	}
+	return nil, fmt.Errorf("browser has no open tab")
+}
+
+func (p *devToolsPage) close() {
+	p.conn.Close()
+}
+
+// call sends one command and returns its result
+func (p *devToolsPage) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	p.nextID++
+	id := p.nextID
+	// A hung browser must not hold the job past its own deadline
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(browserLoadTimeout)
+	}
+	p.conn.SetWriteDeadline(deadline)
+	p.conn.SetReadDeadline(deadline)
+	if err := p.conn.WriteJSON(map[string]interface{}{"id": id, "method": method, "params": params}); err != nil {
+		return nil, err
+	}
+	for {
+		var msg struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := p.conn.ReadJSON(&msg); err != nil {
+			return nil, err
+		}
+		if msg.ID != id {
+			continue
+		}
+		if msg.Error != nil {
+			return nil, fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		return msg.Result, nil
+	}
+}
+
+// evaluate runs a JavaScript expression in the page and decodes its value into out
+func (p *devToolsPage) evaluate(ctx context.Context, expression string, out interface{}) error {
+	raw, err := p.call(ctx, "Runtime.evaluate", map[string]interface{}{
+		"expression":    expression,
+		"returnByValue": true,
+		"awaitPromise":  true,
+	})
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return err
+	}
+	if result.ExceptionDetails != nil {
+		return fmt.Errorf("script error: %s", result.ExceptionDetails.Text)
+	}
+	return json.Unmarshal(result.Result.Value, out)
+}
+
+// waitUntil polls a JavaScript condition until it holds or timeout passes
+func (p *devToolsPage) waitUntil(ctx context.Context, condition string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var ok bool
+		if err := p.evaluate(ctx, "Boolean("+condition+")", &ok); err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("gave up after %s", timeout)
+		}
+		if err := pause(ctx, browserPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// run performs one scripted interaction
+func (p *devToolsPage) run(ctx context.Context, action ScriptAction) error {
+	selector, _ := json.Marshal(action.Selector)
+	switch action.Action {
+	case scriptClick:
+		var clicked bool
+		expression := fmt.Sprintf(`(() => { const el = document.querySelector(%s); if (!el) return false; el.click(); return true })()`, selector)
+		if err := p.evaluate(ctx, expression, &clicked); err != nil {
+			return err
+		}
+		if !clicked {
+			return fmt.Errorf("no element matches %s", action.Selector)
+		}
+		return nil
+	case scriptWaitFor:
+		timeout := action.TimeoutMs
+		if timeout <= 0 {
+			timeout = defaultWaitForMs
+		}
+		return p.waitUntil(ctx, fmt.Sprintf("document.querySelector(%s) !== null", selector), time.Duration(timeout)*time.Millisecond)
+	case scriptWait:
+		return pause(ctx, time.Duration(action.TimeoutMs)*time.Millisecond)
+	}
+	return fmt.Errorf("unsupported action %q", action.Action)
+}
+
+// pause waits for d or until ctx is done
+func pause(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DomainBudgetUsage is one domain's request count for the current day
+type DomainBudgetUsage struct {
+	Domain string `json:"domain"`
+	Used   int    `json:"used"`
+	Limit  int    `json:"limit,omitempty"` // 0 for no limit
+}
+
+// domainBudget enforces daily per-domain request limits across all batches.
+// Counts are persisted so restarts and separate uploads share the same budget.
+type domainBudget struct {
+	mu           sync.Mutex
+	limits       map[string]int
+	defaultLimit int
+	day          string         // UTC date the counts belong to
+	counts       map[string]int // domain -> requests today
+	loaded       bool
+}
+
+// Budgets protect sites that every team's batches share, so they are set
+// for the deployment and batches only charge against them:
+//
+//	DAILY_DOMAIN_BUDGET  requests per domain per day, 0 (default) for no limit
+//	DOMAIN_BUDGETS       per-domain limits, e.g. "example.com=5000,shop.example.org=200"
+var crawlBudget = newDomainBudget(os.Getenv("DOMAIN_BUDGETS"), envInt("DAILY_DOMAIN_BUDGET", 0))
+
+func newDomainBudget(limits string, defaultLimit int) *domainBudget {
+	b := &domainBudget{counts: make(map[string]int)}
+	b.configure(parseDomainBudgets(limits), defaultLimit)
+	return b
+}
+
+// parseDomainBudgets reads "domain=limit" pairs separated by commas
+func parseDomainBudgets(s string) map[string]int {
+	limits := make(map[string]int)
+	for _, pair := range splitList(s) {
+		domain, value, ok := strings.Cut(pair, "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || limit < 0 {
+			log.Printf("Ignoring invalid DOMAIN_BUDGETS entry %q", pair)
+			continue
+		}
+		limits[strings.TrimSpace(domain)] = limit
+	}
+	return limits
+}
+
+// budgetFile is where the daily counts are persisted
+func budgetFile() string {
+	return filepath.Join(dataDir, "domain_budget.json")
+}
+
+// configure replaces the limits; a zero default leaves unlisted domains
+// unlimited. Called at startup only, from the environment or a profile.
+func (b *domainBudget) configure(limits map[string]int, defaultLimit int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limits = make(map[string]int, len(limits))
+	for domain, limit := range limits {
+		b.limits[budgetDomain(domain)] = limit
+	}
+	b.defaultLimit = defaultLimit
+}
+
+// setDefault changes the limit for domains without one of their own
+func (b *domainBudget) setDefault(limit int) {
+	b.mu.Lock()
+	b.defaultLimit = limit
+	b.mu.Unlock()
+}
+
+// budgetDomain normalizes a host so www. variants share a budget
+func budgetDomain(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+// limitFor returns the daily limit for a domain, 0 for none
+func (b *domainBudget) limitFor(domain string) int {
+	if limit, ok := b.limits[domain]; ok {
+		return limit
+	}
+	return b.defaultLimit
+}
+
+// reserve counts one request against the domain of rawURL, returning false
+// when the domain's budget for today is used up
+func (b *domainBudget) reserve(rawURL string) bool {
+	domain := budgetDomain(jobDomain(rawURL))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+
+	limit := b.limitFor(domain)
+	if limit > 0 && b.counts[domain] >= limit {
+		return false
+	}
+	b.counts[domain]++
+	b.save()
+	return true
+}
+
+// rollover loads persisted counts once and resets them when the day changes
+func (b *domainBudget) rollover() {
+	today := time.Now().UTC().Format("2006-01-02")
+	if !b.loaded {
+		b.loaded = true
+		var stored struct {
+			Day    string         `json:"day"`
+			Counts map[string]int `json:"counts"`
+		}
+		if data, err := os.ReadFile(budgetFile()); err == nil && json.Unmarshal(data, &stored) == nil && stored.Day == today {
+			b.day, b.counts = stored.Day, stored.Counts
+		}
+	}
+	if b.day != today || b.counts == nil {
+		b.day = today
+		b.counts = make(map[string]int)
+	}
+}
+
+// save persists the current counts; failures only cost accuracy after a restart
+func (b *domainBudget) save() {
+	data, err := json.Marshal(map[string]interface{}{"day": b.day, "counts": b.counts})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		return
+	}
+	if err := writeFileAtomic(budgetFile(), data, 0644); err != nil {
+		log.Printf("Failed to persist domain budget: %v", err)
+	}
+}
+
+// usage returns today's counts and limits for every domain seen or limited
+func (b *domainBudget) usage() []DomainBudgetUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+
+	domains := make(map[string]bool)
+	for domain := range b.counts {
+		domains[domain] = true
+	}
+	for domain := range b.limits {
+		domains[domain] = true
+	}
+	out := make([]DomainBudgetUsage, 0, len(domains))
+	for domain := range domains {
+		out = append(out, DomainBudgetUsage{Domain: domain, Used: b.counts[domain], Limit: b.limitFor(domain)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out
+}
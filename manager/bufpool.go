@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+)
+
+// maxPooledBuffer keeps one oversized page from pinning memory in the pool
+const maxPooledBuffer = 4 << 20
+
+// bufferPool reuses byte buffers for request bodies, response bodies, prompts
+// and JSON encoding across workers, so long runs do not regrow a buffer per job
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool. Its bytes must no longer be referenced.
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// encodeJSON writes v into a pooled buffer, indented when indent is set, with
+// the same bytes json.Marshal or json.MarshalIndent would produce. The caller
+// hands the buffer back with putBuffer once done with it.
+func encodeJSON(v interface{}, indent string) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	enc := json.NewEncoder(buf)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(v); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	// Encode terminates the value with a newline, Marshal does not
+	buf.Truncate(buf.Len() - 1)
+	return buf, nil
+}
+
+// readPooled reads r to EOF into a pooled buffer
+func readPooled(r io.Reader) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	if _, err := buf.ReadFrom(r); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// fillTemplate substitutes each {placeholder} in template, given as
+// placeholder/value pairs, building the result in a pooled buffer so the
+// chunk text is copied once rather than once per placeholder
+func fillTemplate(template string, pairs ...string) string {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	for len(template) > 0 {
+		at, which := -1, -1
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if idx := strings.Index(template, pairs[i]); idx >= 0 && (at < 0 || idx < at) {
+				at, which = idx, i
+			}
+		}
+		if at < 0 {
+			buf.WriteString(template)
+			break
+		}
+		buf.WriteString(template[:at])
+		buf.WriteString(pairs[which+1])
+		template = template[at+len(pairs[which]):]
+	}
+	return buf.String()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// benchResult is a parse response of the size a typical product page produces
+func benchResult() *ParseResponse {
+	links := make([]string, 200)
+	for i := range links {
+		links[i] = "https://example.com/support/manuals/widget-" + strings.Repeat("x", i%20) + ".pdf"
+	}
+	return &ParseResponse{
+		RawContent: strings.Repeat("Widget 3000 product description with specifications. ", 2000),
+		GeminiResult: map[string]interface{}{
+			"name":            "Widget 3000",
+			"model_number":    "WG-3000",
+			"other_documents": links,
+		},
+	}
+}
+
+func TestEncodeJSONMatchesMarshal(t *testing.T) {
+	result := benchResult()
+	for _, indent := range []string{"", "    "} {
+		want, _ := json.MarshalIndent(result, "", indent)
+		if indent == "" {
+			want, _ = json.Marshal(result)
+		}
+		got, err := encodeJSON(result, indent)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("encodeJSON(%q) differs from json.Marshal output", indent)
+		}
+		putBuffer(got)
+	}
+}
+
+func TestFillTemplateMatchesReplaceAll(t *testing.T) {
+	template := "Describe {parse_description}.\n\n{dom_content}\n\nOnly {parse_description}, no {other}."
+	want := strings.ReplaceAll(strings.ReplaceAll(template, "{dom_content}", "page text"), "{parse_description}", "the product")
+	if got := fillTemplate(template, "{dom_content}", "page text", "{parse_description}", "the product"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func BenchmarkMarshalResult(b *testing.B) {
+	result := benchResult()
+	b.Run("MarshalIndent", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.MarshalIndent(result, "", "    "); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, err := encodeJSON(result, "    ")
+			if err != nil {
+				b.Fatal(err)
+			}
+			putBuffer(buf)
+		}
+	})
+}
+
+func BenchmarkReadBody(b *testing.B) {
+	body := []byte(strings.Repeat(`{"candidates":[{"content":{"parts":[{"text":"widget"}]}}]}`, 5000))
+	b.Run("ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := io.ReadAll(bytes.NewReader(body)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, err := readPooled(bytes.NewReader(body))
+			if err != nil {
+				b.Fatal(err)
+			}
+			putBuffer(buf)
+		}
+	})
+}
+
+func BenchmarkChunkPrompt(b *testing.B) {
+	template := "Analyze the following website content.\n\nWebsite Content: {dom_content}\n\nQuery: {parse_description}"
+	chunk := strings.Repeat("Widget 3000 specifications and downloads. ", 3000)
+	b.Run("ReplaceAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = strings.ReplaceAll(strings.ReplaceAll(template, "{dom_content}", chunk), "{parse_description}", "extract product information")
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = fillTemplate(template, "{dom_content}", chunk, "{parse_description}", "extract product information")
+		}
+	})
+}
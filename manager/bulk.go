@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statusCancelled is the status of a batch an operator cancelled, and of its
+// jobs that had not finished by then
+const statusCancelled = "cancelled"
+
+// statusDeleted is what the collector remembers of a deleted batch
+const statusDeleted = "deleted"
+
+// errBatchCancelled is the cause a cancelled batch's context is cancelled with
+var errBatchCancelled = errors.New("batch was cancelled")
+
+// Actions POST /batches/bulk can take on each batch
+const (
+	bulkCancel      = "cancel"
+	bulkRetryFailed = "retry-failed"
+	bulkDelete      = "delete"
+	bulkArchive     = "archive"
+)
+
+// maxBulkBatches caps the batches one bulk request may name
+const maxBulkBatches = 500
+
+// batchActionError is a failed action on one batch with the status a
+// single-batch request answers it with
+type batchActionError struct {
+	status  int
+	message string
+}
+
+func (e *batchActionError) Error() string {
+	return e.message
+}
+
+func batchActionErrorf(status int, format string, args ...interface{}) error {
+	return &batchActionError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// writeBatchActionError answers a request with a failed batch action
+func writeBatchActionError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var actionErr *batchActionError
+	if errors.As(err, &actionErr) {
+		status = actionErr.status
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// batchDone reports whether a batch has stopped processing for good
+func batchDone(status string) bool {
+	return status == "completed" || status == statusCancelled
+}
+
+// cancel marks a job the batch's cancellation stopped
+func (job *BatchJob) cancel() {
+	job.Status = statusCancelled
+	job.Error = errBatchCancelled.Error()
+	job.ErrorCode = errCodeCancelled
+}
+
+// cancel stops the batch. One still waiting for a processing slot is taken
+// off the queue; a running one starts no more jobs, and the jobs already
+// running are stopped. Its results so far are exported as usual.
+func (bp *BatchProcess) cancel() (string, error) {
+	queued := scheduler.remove(bp)
+
+	bp.mu.Lock()
+	status := bp.Status
+	switch {
+	case batchDone(status):
+		bp.mu.Unlock()
+		return "", batchActionErrorf(http.StatusConflict, "Batch is already %s", status)
+	case queued:
+		cancelled := 0
+		for i := range bp.Jobs {
+			if !jobFinished(bp.Jobs[i].Status) {
+				bp.Jobs[i].cancel()
+				cancelled++
+			}
+		}
+		bp.Status = statusCancelled
+		bp.QueuePosition = 0
+		bp.EndTime = time.Now()
+		bp.mu.Unlock()
+		bp.notifyClients()
+		bp.publishEvent(eventBatchStage)
+		log.Printf("Batch %s: cancelled before it started", bp.ID)
+		return fmt.Sprintf("%d jobs cancelled before starting", cancelled), nil
+	case bp.stop == nil:
+		bp.mu.Unlock()
+		return "", batchActionErrorf(http.StatusConflict, "Batch is starting; try again")
+	}
+	bp.stop(errBatchCancelled)
+	bp.mu.Unlock()
+	log.Printf("Batch %s: cancelled while %s", bp.ID, status)
+	return "cancelled while " + status, nil
+}
+
+// retryFailed queues the batch again to rerun its failed, timed out and
+// cancelled jobs. The jobs that succeeded keep their results.
+func (bp *BatchProcess) retryFailed() (string, error) {
+	bp.mu.Lock()
+	if !batchDone(bp.Status) {
+		status := bp.Status
+		bp.mu.Unlock()
+		return "", batchActionErrorf(http.StatusConflict, "Batch is still %s", status)
+	}
+	if !bp.ImportedAt.IsZero() {
+		bp.mu.Unlock()
+		return "", batchActionErrorf(http.StatusConflict, "Imported batches are read-only")
+	}
+	retry := make(map[int]bool)
+	for i := range bp.Jobs {
+		job := &bp.Jobs[i]
+		switch job.Status {
+		case "failed", "timed_out", statusCancelled:
+		default:
+			continue
+		}
+		// Jobs discovery found no page for have nothing to retry
+		if job.URL == "" {
+			continue
+		}
+		job.Status = "pending"
+		job.Error = ""
+		job.ErrorCode = ""
+		job.Progress = 0
+		job.DurationMs = 0
+		delete(bp.finishedSet, job.Index)
+		retry[job.Index] = true
+	}
+	if len(retry) == 0 {
+		bp.mu.Unlock()
+		return "", batchActionErrorf(http.StatusConflict, "Batch has no failed jobs to retry")
+	}
+	bp.retry = retry
+	bp.Status = "queued"
+	bp.Progress = 0
+	bp.EndTime = time.Time{}
+	bp.mu.Unlock()
+
+	scheduler.submit(bp)
+	bp.notifyClients()
+	log.Printf("Batch %s: retrying %d failed jobs", bp.ID, len(retry))
+	return fmt.Sprintf("%d jobs retried", len(retry)), nil
+}
+
+// delete removes a batch that is not processing, along with its artifacts in
+// the data directory. Per-model output shared with other batches is kept.
+func (bp *BatchProcess) delete() (string, error) {
+	queued := scheduler.remove(bp)
+	bp.mu.Lock()
+	if bp.Status == statusDeleted {
+		bp.mu.Unlock()
+		return "", batchActionErrorf(http.StatusGone, "Batch was deleted")
+	}
+	if !queued && !batchDone(bp.Status) {
+		status := bp.Status
+		bp.mu.Unlock()
+		return "", batchActionErrorf(http.StatusConflict, "Batch is still %s; cancel it first", status)
+	}
+	bp.Status = statusDeleted
+	bp.clients = nil
+	bp.jobEvents = nil
+	bp.jobLogs = nil
+	bp.mu.Unlock()
+	stopFeedWatch(bp.ID)
+
+	// Artifacts go while the ID is still registered, so an import of the
+	// same batch cannot restore files that are then removed
+	artifacts, _ := filepath.Glob(filepath.Join(bp.DataDir, bp.ID+"_*"))
+	removed := 0
+	for _, path := range artifacts {
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Batch %s: failed to remove %s: %v", bp.ID, path, err)
+			continue
+		}
+		removed++
+	}
+
+	batchGC.mu.Lock()
+	batchGC.expired[bp.ID] = expiredBatch{status: statusDeleted, expiredAt: time.Now()}
+	batchGC.mu.Unlock()
+	processes.remove(bp.ID)
+	documentIndex.removeBatch(bp.ID)
+	feed.publish(bp.ID)
+	log.Printf("Batch %s: deleted with %d artifacts", bp.ID, removed)
+	return fmt.Sprintf("%d artifacts removed", removed), nil
+}
+
+// BulkRequest is the body of POST /batches/bulk
+type BulkRequest struct {
+	BatchIDs []string `json:"batch_ids"`
+	Action   string   `json:"action"` // cancel, retry-failed, delete or archive
+}
+
+// BulkOutcome is the result of the action on one batch
+type BulkOutcome struct {
+	BatchID string `json:"batch_id"`
+	OK      bool   `json:"ok"`
+	// Status the single-batch request would have answered with
+	Status      int    `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Detail      string `json:"detail,omitempty"`       // e.g. the jobs retried or the archive location
+	BatchStatus string `json:"batch_status,omitempty"` // Status of the batch afterwards
+}
+
+// BulkResponse reports the outcome for every batch in a bulk request
+type BulkResponse struct {
+	Action    string        `json:"action"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BulkOutcome `json:"results"`
+}
+
+// handleBulkAction applies one action to many batches, so operators need not
+// script a request per batch. Every batch gets its own outcome; one failing
+// does not stop the others, and the response is 200 unless the request itself
+// is invalid. Each action taken is audited.
+func handleBulkAction(w http.ResponseWriter, r *http.Request) {
+	var body BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(body.BatchIDs) == 0 {
+		http.Error(w, "batch_ids must list at least one batch", http.StatusBadRequest)
+		return
+	}
+	if len(body.BatchIDs) > maxBulkBatches {
+		http.Error(w, fmt.Sprintf("At most %d batches per request", maxBulkBatches), http.StatusBadRequest)
+		return
+	}
+
+	var apply func(*BatchProcess) (string, error)
+	var auditAction string
+	switch body.Action {
+	case bulkCancel:
+		apply, auditAction = (*BatchProcess).cancel, auditCancel
+	case bulkRetryFailed:
+		apply, auditAction = (*BatchProcess).retryFailed, auditRetry
+	case bulkDelete:
+		apply, auditAction = (*BatchProcess).delete, auditDelete
+	case bulkArchive:
+		apply = func(bp *BatchProcess) (string, error) {
+			archive, err := bp.archive(r.Context())
+			return archive.Location, err
+		}
+		auditAction = auditArchive
+	default:
+		http.Error(w, "action must be cancel, retry-failed, delete or archive", http.StatusBadRequest)
+		return
+	}
+
+	response := BulkResponse{Action: body.Action, Results: make([]BulkOutcome, 0, len(body.BatchIDs))}
+	seen := make(map[string]bool, len(body.BatchIDs))
+	for _, batchID := range body.BatchIDs {
+		outcome := BulkOutcome{BatchID: batchID, Status: http.StatusOK}
+		process, exists := processes.get(batchID)
+		switch {
+		case seen[batchID]:
+			outcome.Status, outcome.Error = http.StatusBadRequest, "Batch is listed more than once"
+		case !exists:
+			outcome.Status, outcome.Error = http.StatusNotFound, "Batch not found"
+		default:
+			detail, err := apply(process)
+			if err != nil {
+				outcome.Status, outcome.Error = http.StatusInternalServerError, err.Error()
+				var actionErr *batchActionError
+				if errors.As(err, &actionErr) {
+					outcome.Status = actionErr.status
+				}
+				break
+			}
+			outcome.Detail = detail
+			audit.record(r, auditAction, batchID, "bulk: "+detail)
+			process.mu.Lock()
+			outcome.BatchStatus = process.Status
+			process.mu.Unlock()
+		}
+		seen[batchID] = true
+
+		outcome.OK = outcome.Error == ""
+		if outcome.OK {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+		response.Results = append(response.Results, outcome)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
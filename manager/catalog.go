@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The internal catalog is read from a CSV file with sku, model_number, name and
+// optional brand columns, or queried per product from an API that answers
+// GET ?model_number=&name= with a JSON list of entries of the same shape.
+var (
+	catalogCSVPath  = os.Getenv("CATALOG_CSV")
+	catalogAPIURL   = os.Getenv("CATALOG_API_URL")
+	catalogAPIToken = os.Getenv("CATALOG_API_TOKEN")
+)
+
+const defaultCatalogMinScore = 0.8
+
+// CatalogEntry is one product of the internal catalog
+type CatalogEntry struct {
+	SKU         string `json:"sku"`
+	ModelNumber string `json:"model_number"`
+	Name        string `json:"name"`
+	Brand       string `json:"brand,omitempty"`
+}
+
+// CatalogLink records which catalog product a job's extraction was matched to.
+// Unmatched links keep the closest candidate, if any, for review.
+type CatalogLink struct {
+	Matched     bool    `json:"matched"`
+	SKU         string  `json:"sku,omitempty"`
+	ModelNumber string  `json:"model_number,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Score       float64 `json:"score"`
+}
+
+// catalogLinker is a post-extract hook attaching internal SKUs to results
+type catalogLinker struct {
+	entries  []CatalogEntry // Loaded from CATALOG_CSV; nil when the API is queried
+	apiURL   string
+	client   *http.Client
+	minScore float64
+}
+
+// AfterExtract matches the extracted product against the catalog and adds
+// internal_sku to the result when a match scores at least minScore
+func (c *catalogLinker) AfterExtract(ctx context.Context, job *BatchJob, result interface{}) (interface{}, error) {
+	info, ok := result.(map[string]interface{})
+	if !ok {
+		return result, nil
+	}
+	modelNumber := firstNonEmpty(scalarText(info["model_number"]), job.ModelNumber)
+	name := scalarText(info["name"])
+
+	candidates := c.entries
+	if c.apiURL != "" {
+		var err error
+		if candidates, err = c.query(ctx, modelNumber, name); err != nil {
+			// A catalog outage leaves the product unmatched rather than failing the job
+			log.Printf("Catalog lookup for model %s failed: %v", modelNumber, err)
+		}
+	}
+
+	link := &CatalogLink{}
+	for _, entry := range candidates {
+		if score := catalogScore(entry, modelNumber, name); score > link.Score {
+			link = &CatalogLink{SKU: entry.SKU, ModelNumber: entry.ModelNumber, Name: entry.Name, Score: roundTo(score, 3)}
+		}
+	}
+	link.Matched = link.SKU != "" && link.Score >= c.minScore
+	job.Catalog = link
+	if link.Matched {
+		info["internal_sku"] = link.SKU
+	}
+	return info, nil
+}
+
+// query asks the catalog API for candidates of one product
+func (c *catalogLinker) query(ctx context.Context, modelNumber, name string) ([]CatalogEntry, error) {
+	u, err := url.Parse(c.apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CATALOG_API_URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("model_number", modelNumber)
+	query.Set("name", name)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if catalogAPIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+catalogAPIToken)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("catalog returned status %d", resp.StatusCode)
+	}
+
+	var entries []CatalogEntry
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode catalog response: %v", err)
+	}
+	return entries, nil
+}
+
+// loadCatalogCSV reads catalog entries from a CSV file with a header row
+func loadCatalogCSV(path string) ([]CatalogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog header: %v", err)
+	}
+	skuIdx := getColumnIndex(headers, "sku")
+	if skuIdx == -1 {
+		return nil, fmt.Errorf("catalog has no sku column")
+	}
+	modelIdx, nameIdx, brandIdx := getColumnIndex(headers, "model_number"), getColumnIndex(headers, "name"), getColumnIndex(headers, "brand")
+	column := func(record []string, idx int) string {
+		if idx == -1 || idx >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[idx])
+	}
+
+	var entries []CatalogEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog: %v", err)
+		}
+		entry := CatalogEntry{
+			SKU:         column(record, skuIdx),
+			ModelNumber: column(record, modelIdx),
+			Name:        column(record, nameIdx),
+			Brand:       column(record, brandIdx),
+		}
+		if entry.SKU != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// catalogScore rates how well an entry matches an extracted model number and
+// name, from 0 to 1. Model numbers are compared without case or separators
+// and weigh most; names are compared by shared words.
+func catalogScore(entry CatalogEntry, modelNumber, name string) float64 {
+	modelScore := -1.0
+	if entry.ModelNumber != "" && modelNumber != "" {
+		modelScore = editSimilarity(matchKey(entry.ModelNumber), matchKey(modelNumber))
+	}
+	nameScore := -1.0
+	if entry.Name != "" && name != "" {
+		nameScore = wordOverlap(entry.Brand+" "+entry.Name, name)
+	}
+
+	switch {
+	case modelScore == 1 && nameScore >= 0:
+		return 0.9 + 0.1*nameScore // Identical model numbers link even when names are worded differently
+	case modelScore >= 0 && nameScore >= 0:
+		return 0.7*modelScore + 0.3*nameScore
+	case modelScore >= 0:
+		return modelScore
+	case nameScore >= 0:
+		return nameScore * 0.9 // A name alone is never a certain match
+	}
+	return 0
+}
+
+// matchKey lowercases a model number and drops separators
+func matchKey(s string) string {
+	return stripSeparators(strings.ToLower(strings.TrimSpace(s)))
+}
+
+// editSimilarity is 1 minus the Levenshtein distance relative to the longer string
+func editSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(min(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// wordOverlap is the share of the extracted name's words found in the catalog name
+func wordOverlap(catalogName, name string) float64 {
+	catalogWords := make(map[string]bool)
+	for _, word := range strings.Fields(normalizeForMatch(catalogName)) {
+		catalogWords[word] = true
+	}
+	words := strings.Fields(normalizeForMatch(name))
+	if len(words) == 0 {
+		return 0
+	}
+	shared := 0
+	for _, word := range words {
+		if catalogWords[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(words))
+}
+
+// writeUnmatchedCSV lists the completed jobs no catalog product was linked to
+func writeUnmatchedCSV(path string, jobs []BatchJob) (int, error) {
+	rows := [][]string{{"model_number", "url", "name", "closest_sku", "score"}}
+	for _, job := range jobs {
+		if !jobSucceeded(job.Status) || job.Catalog == nil || job.Catalog.Matched {
+			continue
+		}
+		info, _ := job.extraction.(map[string]interface{})
+		rows = append(rows, []string{
+			job.ModelNumber,
+			job.URL,
+			scalarText(info["name"]),
+			job.Catalog.SKU,
+			strconv.FormatFloat(job.Catalog.Score, 'f', -1, 64),
+		})
+	}
+	if len(rows) == 1 {
+		return 0, nil
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	writer := csv.NewWriter(buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return 0, err
+	}
+	return len(rows) - 1, writeFileAtomic(path, buf.Bytes(), 0644)
+}
+
+func init() {
+	if catalogCSVPath == "" && catalogAPIURL == "" {
+		return
+	}
+	linker := &catalogLinker{
+		apiURL:   catalogAPIURL,
+		client:   &http.Client{Timeout: time.Second * 10},
+		minScore: defaultCatalogMinScore,
+	}
+	if value := os.Getenv("CATALOG_MIN_SCORE"); value != "" {
+		if score, err := strconv.ParseFloat(value, 64); err == nil && score > 0 && score <= 1 {
+			linker.minScore = score
+		} else {
+			log.Printf("Ignoring invalid CATALOG_MIN_SCORE %q", value)
+		}
+	}
+	if catalogAPIURL == "" {
+		entries, err := loadCatalogCSV(catalogCSVPath)
+		if err != nil {
+			log.Printf("Catalog linking disabled: %v", err)
+			return
+		}
+		linker.entries = entries
+		log.Printf("Catalog linking enabled with %d products from %s", len(entries), catalogCSVPath)
+	}
+	RegisterHook(linker)
+}
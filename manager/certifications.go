@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Where a certification was found
+const (
+	certFromText     = "text"
+	certFromImage    = "image" // A logo's alt text, title or file name
+	certFromDocument = "document"
+)
+
+// Certification is a regulatory or compliance mark the page claims for the
+// product, under its normalized name
+type Certification struct {
+	Name      string   `json:"name"` // e.g. "CE", "FCC", "ENERGY STAR"
+	Sources   []string `json:"sources"`
+	Evidence  string   `json:"evidence,omitempty"` // Text around the first mention
+	Documents []string `json:"documents,omitempty"`
+}
+
+// certificationMark describes how one mark is recognized. mention matches
+// unambiguous wording in running text; token matches the bare mark, which is
+// only trusted in logo names and in text that is about certifications.
+type certificationMark struct {
+	name    string
+	mention *regexp.Regexp
+	token   *regexp.Regexp
+}
+
+var (
+	certificationMarks = []certificationMark{
+		{"CE", regexp.MustCompile(`\bCE[ -]?(mark(ed|ing)?|certifi\w*|complian\w*|conform\w*|approved)\b|(?i:conformit[eé] europ[eé]enne)`), markToken("ce")},
+		{"UKCA", regexp.MustCompile(`\bUKCA\b`), markToken("ukca")},
+		{"FCC", regexp.MustCompile(`\bFCC\b`), markToken("fcc")},
+		{"UL", regexp.MustCompile(`\b(c?UL(us)?[ -]?(listed|certified|recogni[sz]ed)|UL \d{2,4}|cULus)\b`), markToken("c?ul(us)?")},
+		{"ETL", regexp.MustCompile(`\b(c?ETL(us)?[ -]?(listed|certified)|cETLus)\b`), markToken("c?etl(us)?")},
+		{"CSA", regexp.MustCompile(`\bCSA[ -]?(certified|approved|listed|C22(\.\d)?)\b`), markToken("csa")},
+		{"RoHS", regexp.MustCompile(`(?i)\bRoHS\b`), markToken("rohs")},
+		{"REACH", regexp.MustCompile(`\bREACH[ -]?(compliant|regulation|SVHC)\b`), markToken("reach")},
+		{"WEEE", regexp.MustCompile(`\bWEEE\b`), markToken("weee")},
+		{"ENERGY STAR", regexp.MustCompile(`(?i)\benergy[ -]?star\b`), markToken("energy[ _-]?star")},
+		{"TÜV", regexp.MustCompile(`(?i)\b(TÜV|TUEV)\b|\bTUV (Rheinland|SÜD|SUD|Nord|certified)\b`), markToken("t[üu]e?v")},
+	}
+	// Text that lists certifications, in which bare marks count
+	certificationContext = regexp.MustCompile(`(?i)(certif|complian|conform|approval|approved|standards?|marks?\b|regulatory|listed)`)
+	// Declarations of conformity are made for the CE (and UKCA) marking
+	conformityDeclaration = regexp.MustCompile(`(?i)(declaration[ _-]of[ _-]conformity|konformit[äa]tserkl[äa]rung|\beu[ _-]?doc\b)`)
+)
+
+// markToken matches a mark as a whole word, ignoring case, so "ce-logo.svg"
+// and "FCC approved" match but "price" does not
+func markToken(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(^|[^a-z0-9])(` + pattern + `)([^a-z0-9]|$)`)
+}
+
+// detectCertifications finds the certification marks a page mentions in its
+// text or shows as logos, and links each to the certificate documents that
+// name it. Marks named only by a document are included as well.
+func detectCertifications(page *pageContent, documents []DocumentLink) []Certification {
+	var certs []Certification
+	index := make(map[string]int)
+	add := func(name, source, evidence string) int {
+		i, ok := index[name]
+		if !ok {
+			i = len(certs)
+			index[name] = i
+			certs = append(certs, Certification{Name: name, Evidence: evidence})
+		}
+		for _, s := range certs[i].Sources {
+			if s == source {
+				return i
+			}
+		}
+		certs[i].Sources = append(certs[i].Sources, source)
+		return i
+	}
+
+	for _, text := range page.Texts {
+		inContext := certificationContext.MatchString(text)
+		for _, mark := range certificationMarks {
+			loc := mark.mention.FindStringIndex(text)
+			if loc == nil && inContext {
+				if m := mark.token.FindStringSubmatchIndex(text); m != nil && isUpperMark(text[m[4]:m[5]]) {
+					loc = m[4:6]
+				}
+			}
+			if loc != nil {
+				add(mark.name, certFromText, snippetAround(text, loc[0], loc[1]))
+			}
+		}
+	}
+
+	for _, image := range page.ImageLabels {
+		label := image.Text + " " + linkFileName(image.Href)
+		for _, mark := range certificationMarks {
+			if mark.token.MatchString(label) {
+				add(mark.name, certFromImage, "")
+			}
+		}
+	}
+	for _, src := range page.Images {
+		name := linkFileName(src)
+		for _, mark := range certificationMarks {
+			if mark.token.MatchString(name) {
+				add(mark.name, certFromImage, "")
+			}
+		}
+	}
+
+	for _, doc := range documents {
+		described := doc.Text + " " + linkFileName(doc.URL)
+		named := false
+		for _, mark := range certificationMarks {
+			if mark.token.MatchString(described) {
+				named = true
+				i := add(mark.name, certFromDocument, "")
+				certs[i].Documents = appendUnique(certs[i].Documents, doc.URL)
+			}
+		}
+		if !named && conformityDeclaration.MatchString(described) {
+			i := add("CE", certFromDocument, "")
+			certs[i].Documents = appendUnique(certs[i].Documents, doc.URL)
+		}
+	}
+	return certs
+}
+
+// isUpperMark reports whether a bare mark in running text is written in
+// capitals, as marks are. "RoHS" and "TÜV" are matched by their mention
+// pattern instead.
+func isUpperMark(mark string) bool {
+	if strings.HasPrefix(mark, "c") && len(mark) > 2 {
+		mark = mark[1:] // cUL, cETLus
+	}
+	return mark == strings.ToUpper(mark)
+}
+
+// linkFileName returns the file name of an image or document URL, which
+// often names the logo or certificate it is
+func linkFileName(src string) string {
+	if u, err := url.Parse(src); err == nil {
+		src = u.Path
+	}
+	return path.Base(src)
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// certificationNames returns the names of the certifications, in page order
+func certificationNames(certs []Certification) []string {
+	names := make([]string, len(certs))
+	for i, cert := range certs {
+		names[i] = cert.Name
+	}
+	return names
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of jobs derived from another job
+const (
+	jobKindProductPage    = "product_page"    // Product found on a listing in spawn mode
+	jobKindDocumentMirror = "document_mirror" // Copy of a document linked from the parent's page
+)
+
+const (
+	defaultChildDepth     = 2
+	defaultChildrenPerJob = 200
+)
+
+// ChildJobConfig controls the jobs a finished job may add to its batch
+type ChildJobConfig struct {
+	// Add a job that downloads each document linked from a scraped page
+	MirrorDocuments bool `json:"mirror_documents"`
+	MaxDepth        int  `json:"max_depth"`      // Generations below the uploaded rows, 2 by default
+	MaxPerParent    int  `json:"max_per_parent"` // Children added for one job, 200 by default
+}
+
+func (c ChildJobConfig) maxDepth() int {
+	if c.MaxDepth > 0 {
+		return c.MaxDepth
+	}
+	return defaultChildDepth
+}
+
+func (c ChildJobConfig) maxPerParent() int {
+	if c.MaxPerParent > 0 {
+		return c.MaxPerParent
+	}
+	return defaultChildrenPerJob
+}
+
+// child returns a pending job derived from job, inheriting its batch settings
+func (job BatchJob) child(kind, targetURL, modelNumber string) BatchJob {
+	parent := job.Index
+	return BatchJob{
+		ModelNumber:      modelNumber,
+		URL:              targetURL,
+		Kind:             kind,
+		Parent:           &parent,
+		Depth:            job.Depth + 1,
+		Status:           "pending",
+		ParseDescription: job.ParseDescription,
+		PromptVariant:    job.PromptVariant,
+		promptTemplate:   job.promptTemplate,
+		exportConfig:     job.exportConfig,
+		outputSchema:     job.outputSchema,
+		outputLanguage:   job.outputLanguage,
+		normalization:    job.normalization,
+		replay:           job.replay,
+		redaction:        job.redaction,
+		redactor:         job.redactor,
+		llm:              job.llm,
+		earlyExit:        job.earlyExit,
+		locale:           job.locale,
+		offer:            job.offer,
+		media:            job.media,
+		pageLimits:       job.pageLimits,
+		maxResponse:      job.maxResponse,
+		childJobs:        job.childJobs,
+		Metadata:         job.Metadata,
+	}
+}
+
+// spawnChildren returns the jobs derived from a finished job: the products of
+// a listing parsed in spawn mode and, when enabled, a mirror of each linked
+// document. URLs in known are skipped and the rest are added to it.
+func (bp *BatchProcess) spawnChildren(ctx context.Context, parent BatchJob, known map[string]bool) []BatchJob {
+	if parent.Status != "completed" || parent.Depth >= parent.childJobs.maxDepth() {
+		return nil
+	}
+
+	var children []BatchJob
+	add := func(kind, targetURL, modelNumber string) bool {
+		if known[targetURL] || len(children) >= parent.childJobs.maxPerParent() {
+			return false
+		}
+		if err := ssrfPolicy.validateURL(ctx, targetURL); err != nil {
+			log.Printf("Batch %s: not spawning %s: %v", bp.ID, targetURL, err)
+			return false
+		}
+		known[targetURL] = true
+		children = append(children, parent.child(kind, targetURL, modelNumber))
+		return true
+	}
+
+	if parent.Listing != nil && parent.Listing.Mode == paginationSpawn {
+		for _, productURL := range parent.Listing.ProductURLs {
+			// Each product gets its own results directory under the listing's model
+			add(jobKindProductPage, productURL, parent.ModelNumber+"_"+urlKey(productURL))
+		}
+	}
+	if parent.childJobs.MirrorDocuments && parent.Kind != jobKindDocumentMirror {
+		for _, documentURL := range parent.documents {
+			if add(jobKindDocumentMirror, documentURL, parent.ModelNumber) {
+				children[len(children)-1].title = parent.docTitles[documentURL]
+			}
+		}
+	}
+	return children
+}
+
+// addChildren appends spawned jobs to the batch, numbering them after the
+// existing ones and linking them from their parents
+func (bp *BatchProcess) addChildren(jobs []BatchJob) []BatchJob {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	byIndex := make(map[int]int, len(bp.Jobs))
+	for i := range bp.Jobs {
+		byIndex[bp.Jobs[i].Index] = i
+	}
+	for i := range jobs {
+		jobs[i].Index = len(bp.Jobs)
+		if jobs[i].Parent != nil {
+			if pos, ok := byIndex[*jobs[i].Parent]; ok {
+				bp.Jobs[pos].Children = append(bp.Jobs[pos].Children, jobs[i].Index)
+			}
+		}
+		bp.Jobs = append(bp.Jobs, jobs[i])
+	}
+	return jobs
+}
+
+// mirrorDocument downloads the job's document next to the parent's results,
+// named from its link text and URL by assetFileName. Documents are held in
+// memory while screened and written, so the per-job memory cap applies.
+func (job *BatchJob) mirrorDocument(ctx context.Context, baseDir string) error {
+	limit := job.pageLimits.documentBytes()
+	if job.responseLimit() < limit {
+		limit = job.responseLimit()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, job.URL, nil)
+	if err != nil {
+		return newJobError(errCodeInternal, "failed to create request: %v", err)
+	}
+	resp, err := sharedScrapeClient(timeout).Do(req)
+	if err != nil {
+		return newJobError(networkErrorCode(err), "failed to download document: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		job.blocked = isBlockStatus(resp.StatusCode)
+		return newJobError(fmt.Sprintf("http_%dxx", resp.StatusCode/100), "document download returned status %d", resp.StatusCode)
+	}
+	job.beat()
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	n, err := buf.ReadFrom(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return newJobError(networkErrorCode(err), "failed to read document: %v", err)
+	}
+	if n > limit {
+		return newJobError(errCodeProcessing, "document exceeds %d bytes", limit)
+	}
+	job.BytesDownloaded = n
+
+	quarantine, err := screenDownload(ctx, buf.Bytes(), job.URL, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return newJobError(errCodeScan, "failed to scan document: %v", err)
+	}
+	if quarantine != nil {
+		return job.quarantine(baseDir, buf.Bytes(), quarantine)
+	}
+
+	dir := filepath.Join(modelDirFor(baseDir, job.ModelNumber), "documents")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return newJobError(errCodeIO, "failed to create documents directory: %v", err)
+	}
+	target := filepath.Join(dir, assetFileName(job.title, job.URL))
+	if err := writeFileAtomic(target, buf.Bytes(), 0644); err != nil {
+		return newJobError(errCodeIO, "failed to write document: %v", err)
+	}
+	job.MirrorPath = target
+	// Indexed for search once the job finishes, like a page's text
+	job.content = documentText(buf.Bytes(), job.URL, searchTextBytes)
+	return nil
+}
+
+// documentExtension keeps a document's extension for the mirrored copy
+func documentExtension(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if len(ext) > 6 {
+		return ""
+	}
+	return ext
+}
+
+// JobNode is a job with the jobs derived from it, for the status tree view
+type JobNode struct {
+	Index       int       `json:"index"`
+	Kind        string    `json:"kind,omitempty"`
+	URL         string    `json:"url"`
+	ModelNumber string    `json:"model_number"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Descendants int       `json:"descendants,omitempty"`
+	Finished    int       `json:"finished"` // Finished jobs in this subtree, the job included
+	Children    []JobNode `json:"children,omitempty"`
+}
+
+// jobFinished reports whether a job has reached a final status
+func jobFinished(status string) bool {
+	switch status {
+	case "completed", "failed", "timed_out", "low_quality", "not_modified", statusNotFound, statusSkippedBySampling, statusCancelled:
+		return true
+	}
+	return false
+}
+
+// jobSucceeded reports whether a job has a result, extracted now or reused
+// from an earlier run because the page was not modified
+func jobSucceeded(status string) bool {
+	return status == "completed" || status == "not_modified"
+}
+
+// jobTree nests derived jobs under their parents; uploaded rows are the roots.
+// The caller holds bp.mu.
+func (bp *BatchProcess) jobTree() []JobNode {
+	byIndex := make(map[int]*BatchJob, len(bp.Jobs))
+	for i := range bp.Jobs {
+		byIndex[bp.Jobs[i].Index] = &bp.Jobs[i]
+	}
+
+	var build func(job *BatchJob) JobNode
+	build = func(job *BatchJob) JobNode {
+		node := JobNode{
+			Index:       job.Index,
+			Kind:        job.Kind,
+			URL:         job.URL,
+			ModelNumber: job.ModelNumber,
+			Status:      job.Status,
+			Error:       job.Error,
+		}
+		if jobFinished(job.Status) {
+			node.Finished = 1
+		}
+		for _, index := range job.Children {
+			if child, ok := byIndex[index]; ok {
+				childNode := build(child)
+				node.Descendants += 1 + childNode.Descendants
+				node.Finished += childNode.Finished
+				node.Children = append(node.Children, childNode)
+			}
+		}
+		return node
+	}
+
+	var roots []JobNode
+	for i := range bp.Jobs {
+		if bp.Jobs[i].Parent == nil {
+			roots = append(roots, build(&bp.Jobs[i]))
+		}
+	}
+	return roots
+}
+
+// writeJobTree responds with a batch's jobs nested under the jobs that spawned them
+func writeJobTree(w http.ResponseWriter, process *BatchProcess) {
+	process.mu.Lock()
+	response := map[string]interface{}{
+		"batch_id": process.ID,
+		"status":   process.Status,
+		"progress": process.Progress,
+		"jobs":     process.jobTree(),
+	}
+	process.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
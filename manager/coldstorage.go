@@ -0,0 +1,386 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Batch archives are uploaded with a plain HTTP PUT to ARCHIVE_STORE_URL +
+// "/<batch id>.zip", which fits S3-compatible buckets behind a signing proxy,
+// GCS and Azure containers alike. Without it archives stay under dataDir/archives.
+var (
+	archiveStoreURL   = strings.TrimSuffix(os.Getenv("ARCHIVE_STORE_URL"), "/")
+	archiveStoreToken = os.Getenv("ARCHIVE_STORE_TOKEN")
+
+	maxBatchArchiveBytes = int64(10 << 30) // Archive accepted for import
+	maxBatchArchiveFiles = 100000
+)
+
+// Entries of a batch archive
+const (
+	archiveBatchEntry     = "batch.json"
+	archiveArtifactPrefix = "artifacts/"
+	archiveKeyPrefix      = "keys/"
+)
+
+// BatchArchive describes a stored batch archive
+type BatchArchive struct {
+	BatchID   string    `json:"batch_id"`
+	Location  string    `json:"location"` // Object URL, or local path without a store
+	Files     int       `json:"files"`
+	Bytes     int64     `json:"bytes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// archivesDir is where archives are built and, without a store, kept
+func archivesDir() string {
+	return filepath.Join(dataDir, "archives")
+}
+
+// writeBatchArchive bundles the batch state and every artifact into a ZIP.
+// Artifacts are copied as stored, so encrypted batches stay encrypted and
+// carry their wrapped data key for an instance sharing the master key.
+func (bp *BatchProcess) writeBatchArchive(path string) (int, error) {
+	state, err := bp.snapshot()
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal batch: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	zw := zip.NewWriter(f)
+	files, err := bp.addArchiveEntries(zw, state)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return files, err
+}
+
+func (bp *BatchProcess) addArchiveEntries(zw *zip.Writer, state []byte) (int, error) {
+	w, err := zw.Create(archiveBatchEntry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(state); err != nil {
+		return 0, err
+	}
+	files := 1
+
+	for _, root := range bp.batchArtifactRoots() {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(bp.DataDir, path)
+			if err != nil {
+				return err
+			}
+			if err := addArchiveFile(zw, archiveArtifactPrefix+filepath.ToSlash(rel), path); err != nil {
+				return fmt.Errorf("failed to archive %s: %w", rel, err)
+			}
+			files++
+			return nil
+		})
+		if err != nil {
+			return files, err
+		}
+	}
+
+	if bp.encryptionKey != nil {
+		if err := addArchiveFile(zw, archiveKeyPrefix+bp.ID+".key", keyFile(bp.ID)); err != nil {
+			return files, fmt.Errorf("failed to archive data key: %w", err)
+		}
+		files++
+	}
+	return files, nil
+}
+
+// addArchiveFile copies the file at path into the archive under name
+func addArchiveFile(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// uploadArchive PUTs the archive to the object store and returns its URL
+func uploadArchive(ctx context.Context, batchID, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	objectURL := archiveStoreURL + "/" + batchID + ".zip"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/zip")
+	if archiveStoreToken != "" {
+		req.Header.Set("Authorization", "Bearer "+archiveStoreToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("archive upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("archive upload failed (status %d): %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return objectURL, nil
+}
+
+// handleArchiveBatch bundles a finished batch and uploads it to cold storage
+func handleArchiveBatch(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	process, exists := processes.get(batchID)
+	if !exists {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	archive, err := process.archive(r.Context())
+	if err != nil {
+		writeBatchActionError(w, err)
+		return
+	}
+	audit.record(r, auditArchive, batchID, archive.Location)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(archive)
+}
+
+// archive bundles the finished batch and uploads it when an object store is
+// configured. Errors are *batchActionError.
+func (bp *BatchProcess) archive(ctx context.Context) (BatchArchive, error) {
+	bp.mu.Lock()
+	status := bp.Status
+	bp.mu.Unlock()
+	if !batchDone(status) {
+		return BatchArchive{}, batchActionErrorf(http.StatusConflict, "Only finished batches can be archived")
+	}
+
+	if err := os.MkdirAll(archivesDir(), 0755); err != nil {
+		return BatchArchive{}, batchActionErrorf(http.StatusInternalServerError, "Failed to create archive directory")
+	}
+	path := filepath.Join(archivesDir(), bp.ID+".zip")
+	files, err := bp.writeBatchArchive(path)
+	if err != nil {
+		log.Printf("Batch %s: failed to build archive: %v", bp.ID, err)
+		return BatchArchive{}, batchActionErrorf(http.StatusInternalServerError, "Failed to build archive")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return BatchArchive{}, batchActionErrorf(http.StatusInternalServerError, "Failed to build archive")
+	}
+
+	archive := BatchArchive{BatchID: bp.ID, Location: path, Files: files, Bytes: info.Size(), CreatedAt: time.Now().UTC()}
+	if archiveStoreURL != "" {
+		location, err := uploadArchive(ctx, bp.ID, path)
+		if err != nil {
+			log.Printf("Batch %s: %v", bp.ID, err)
+			return BatchArchive{}, batchActionErrorf(http.StatusBadGateway, "%v", err)
+		}
+		os.Remove(path)
+		archive.Location = location
+	}
+	log.Printf("Batch %s: archived %d files (%d bytes) to %s", bp.ID, files, archive.Bytes, archive.Location)
+	return archive, nil
+}
+
+// handleImportBatch restores an archived batch for investigation. The archive
+// is either the request body or, with ?batch_id=, fetched from the object store.
+// Imported batches are read-only: their jobs are not run again.
+func handleImportBatch(w http.ResponseWriter, r *http.Request) {
+	tmp, err := os.CreateTemp("", "batch-import-*.zip")
+	if err != nil {
+		http.Error(w, "Failed to stage archive", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	source := io.Reader(r.Body)
+	if id := r.URL.Query().Get("batch_id"); id != "" {
+		if archiveStoreURL == "" {
+			http.Error(w, "No archive store configured", http.StatusBadRequest)
+			return
+		}
+		body, err := fetchArchive(r, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer body.Close()
+		source = body
+	}
+	n, err := io.Copy(tmp, io.LimitReader(source, maxBatchArchiveBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read archive", http.StatusBadRequest)
+		return
+	}
+	if n > maxBatchArchiveBytes {
+		http.Error(w, "Archive too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	process, err := importBatchArchive(tmp.Name())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Batch %s: imported from archive", process.ID)
+	audit.record(r, auditImport, process.ID, r.URL.Query().Get("batch_id"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	process.mu.Lock()
+	defer process.mu.Unlock()
+	json.NewEncoder(w).Encode(process)
+}
+
+// fetchArchive downloads a batch archive from the object store
+func fetchArchive(r *http.Request, batchID string) (io.ReadCloser, error) {
+	if strings.ContainsAny(batchID, "/\\") || strings.Contains(batchID, "..") {
+		return nil, fmt.Errorf("invalid batch ID")
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, archiveStoreURL+"/"+batchID+".zip", nil)
+	if err != nil {
+		return nil, err
+	}
+	if archiveStoreToken != "" {
+		req.Header.Set("Authorization", "Bearer "+archiveStoreToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("archive download failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("archive download failed (status %d)", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// importBatchArchive unpacks an archive below this instance's data directory
+// and registers the batch it contains
+func importBatchArchive(path string) (*BatchProcess, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+	defer reader.Close()
+
+	var process *BatchProcess
+	for _, entry := range reader.File {
+		if entry.Name != archiveBatchEntry {
+			continue
+		}
+		src, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %w", err)
+		}
+		process = &BatchProcess{}
+		err = json.NewDecoder(io.LimitReader(src, maxArchiveEntryBytes)).Decode(process)
+		src.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", archiveBatchEntry, err)
+		}
+	}
+	if process == nil || process.ID == "" {
+		return nil, fmt.Errorf("archive has no %s", archiveBatchEntry)
+	}
+	if strings.ContainsAny(process.ID, "/\\") || strings.Contains(process.ID, "..") {
+		return nil, fmt.Errorf("invalid batch ID %q", process.ID)
+	}
+	// Held until the batch is registered, so a concurrent import of the same
+	// batch cannot restore over these files
+	release, ok := processes.reserve(process.ID)
+	if !ok {
+		return nil, fmt.Errorf("batch %s already exists", process.ID)
+	}
+	defer release()
+
+	// Restore artifacts below the local data directory, whatever it was at the source
+	process.DataDir = dataDir
+	var total int64
+	files := 0
+	for _, entry := range reader.File {
+		var target string
+		var ok bool
+		switch {
+		case strings.HasPrefix(entry.Name, archiveArtifactPrefix):
+			target, ok = archiveTarget(process.DataDir, strings.TrimPrefix(entry.Name, archiveArtifactPrefix))
+		case entry.Name == archiveKeyPrefix+process.ID+".key":
+			if err := os.MkdirAll(filepath.Dir(keyFile(process.ID)), 0700); err != nil {
+				return nil, fmt.Errorf("failed to create key directory: %w", err)
+			}
+			target, ok = keyFile(process.ID), true
+		default:
+			continue
+		}
+		if !ok || !entry.Mode().IsRegular() {
+			log.Printf("Batch %s: skipping unsafe archive entry %q", process.ID, entry.Name)
+			continue
+		}
+		if files >= maxBatchArchiveFiles {
+			return nil, fmt.Errorf("archive has more than %d files", maxBatchArchiveFiles)
+		}
+
+		limit := maxBatchArchiveBytes - total
+		if limit > maxArchiveEntryBytes {
+			limit = maxArchiveEntryBytes
+		}
+		size, err := extractEntry(entry, target, limit)
+		total += size
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore %q: %w", entry.Name, err)
+		}
+		if strings.HasPrefix(entry.Name, archiveKeyPrefix) {
+			os.Chmod(target, 0600)
+		}
+		files++
+	}
+
+	process.ImportedAt = time.Now().UTC()
+	processes.put(process)
+	return process, nil
+}
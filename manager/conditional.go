@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// errNotModified is returned by the scraper when the server answered a
+// conditional request with 304 Not Modified
+var errNotModified = errors.New("page not modified since the last scrape")
+
+// PageValidators are the cache validators a page was served with. The job
+// store keeps them per model and URL with the result version they produced.
+type PageValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Version      string `json:"version,omitempty"` // Result version scraped with these validators
+}
+
+func (v *PageValidators) empty() bool {
+	return v == nil || (v.ETag == "" && v.LastModified == "")
+}
+
+// validatorsFrom reads the validators of a response
+func validatorsFrom(header http.Header) *PageValidators {
+	v := &PageValidators{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+	if v.empty() {
+		return nil
+	}
+	return v
+}
+
+// setConditional makes req conditional on the page having changed
+func (v *PageValidators) setConditional(req *http.Request) {
+	if v.empty() {
+		return
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// validatorsPath is where the job store keeps a URL's validators, next to its result versions
+func validatorsPath(modelDir, rawURL string) string {
+	return filepath.Join(versionsDir(modelDir, rawURL), "validators.json")
+}
+
+// loadValidators returns the stored validators for (model, URL), or nil when
+// there are none or the result they produced is gone, since a 304 could then
+// not be answered with a prior result
+func loadValidators(modelDir, rawURL string) (*PageValidators, error) {
+	data, err := os.ReadFile(validatorsPath(modelDir, rawURL))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var v PageValidators
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("invalid validators for %s: %v", rawURL, err)
+	}
+	if v.empty() || !versionIDPattern.MatchString(v.Version) {
+		return nil, nil
+	}
+	if _, err := os.Stat(filepath.Join(versionsDir(modelDir, rawURL), v.Version+".json")); err != nil {
+		return nil, nil
+	}
+	return &v, nil
+}
+
+// saveValidators records the validators a result version was scraped with
+func saveValidators(modelDir, rawURL string, v *PageValidators) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(validatorsPath(modelDir, rawURL), data, 0644)
+}
+
+// loadPriorResult reads the result version a 304 refers to. Usage figures are
+// cleared, as reusing the result cost neither tokens nor page bytes.
+func loadPriorResult(modelDir, rawURL string, v *PageValidators) (ParseResponse, error) {
+	var prior ParseResponse
+	data, err := readArtifact(filepath.Join(versionsDir(modelDir, rawURL), v.Version+".json"))
+	if err != nil {
+		return prior, fmt.Errorf("failed to read prior result: %v", err)
+	}
+	if err := json.Unmarshal(data, &prior); err != nil {
+		return prior, fmt.Errorf("failed to decode prior result: %v", err)
+	}
+	prior.Status = "success"
+	prior.TokensUsed, prior.Cost, prior.BytesDownloaded = 0, 0, 0
+	prior.Validators = v
+	return prior, nil
+}
+
+// validatorsPath returns where the scraper keeps a page's validators, next to its snapshot
+func (s *SiteScraper) validatorsPath(pageURL string) string {
+	return filepath.Join(s.downloadDir, "snapshots", urlKey(pageURL)+".validators.json")
+}
+
+// saveValidators stores a page's validators next to its snapshot, removing
+// stale ones when the page no longer sends any
+func (s *SiteScraper) saveValidators(pageURL string, v *PageValidators) error {
+	if v.empty() {
+		if err := os.Remove(s.validatorsPath(pageURL)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.validatorsPath(pageURL), data, 0644)
+}
+
+// storedValidators returns the validators saved with the page's snapshot. They
+// are only sent while the snapshot exists, so an unchanged page stays replayable.
+func (s *SiteScraper) storedValidators(pageURL string) *PageValidators {
+	if _, err := os.Stat(s.snapshotPath(pageURL)); err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(s.validatorsPath(pageURL))
+	if err != nil {
+		return nil
+	}
+	var v PageValidators
+	if json.Unmarshal(data, &v) != nil {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Supported connector types
+const (
+	connectorREST = "rest"
+	connectorSFTP = "sftp"
+)
+
+// ProductRecord is one completed job, with keys already mapped to the target system's fields
+type ProductRecord map[string]interface{}
+
+// Connector delivers a batch's completed product records to a downstream system
+type Connector interface {
+	Name() string
+	Deliver(ctx context.Context, batchID string, records []ProductRecord) error
+}
+
+// ConnectorConfig configures one downstream delivery
+type ConnectorConfig struct {
+	Type string `json:"type"` // "rest" or "sftp"
+	Name string `json:"name,omitempty"`
+
+	// REST
+	URL    string `json:"url,omitempty"`
+	Method string `json:"method,omitempty"` // Defaults to POST
+	// "secret:<name>" values are read from the secret provider, for secrets
+	// CONNECTOR_TARGETS_FILE binds to the URL
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// SFTP, to a host and user listed in CONNECTOR_TARGETS_FILE
+	Host      string `json:"host,omitempty"` // host or host:port
+	User      string `json:"user,omitempty"`
+	KeyFile   string `json:"key_file,omitempty"` // Must match the target's key when given
+	RemoteDir string `json:"remote_dir,omitempty"`
+
+	// Target field -> source column, using the wide export's column names
+	// ("model_number", "url", "specs.weight", "meta.sku", ...). All columns
+	// are sent unchanged when empty.
+	Mapping map[string]string `json:"mapping,omitempty"`
+}
+
+// validate checks that the connector has what its type needs
+func (c ConnectorConfig) validate() error {
+	switch c.Type {
+	case connectorREST:
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return fmt.Errorf("rest connector needs an http(s) url")
+		}
+		allowed := connectorTargets.restSecrets(c.URL)
+		for key, value := range c.Headers {
+			if _, err := resolveSecretRef(value, allowed); err != nil {
+				return fmt.Errorf("rest connector header %s: %v", key, err)
+			}
+		}
+	case connectorSFTP:
+		if c.Host == "" || c.User == "" {
+			return fmt.Errorf("sftp connector needs host and user")
+		}
+		for field, value := range map[string]string{"host": c.Host, "user": c.User, "key_file": c.KeyFile, "remote_dir": c.RemoteDir} {
+			if err := checkSFTPArg(field, value); err != nil {
+				return err
+			}
+		}
+		if _, err := connectorTargets.sftpTarget(c); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported connector type: %s", c.Type)
+	}
+	return nil
+}
+
+// name identifies the connector in delivery reports
+func (c ConnectorConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if c.Type == connectorREST {
+		return c.Type + ":" + c.URL
+	}
+	return c.Type + ":" + c.Host
+}
+
+// newConnector builds the connector for a validated config
+func newConnector(c ConnectorConfig) Connector {
+	if c.Type == connectorSFTP {
+		return &sftpConnector{config: c}
+	}
+	// Delivery URLs come from uploads, so they get the same SSRF checks as scraping
+	return &restConnector{config: c, client: sharedScrapeClient(time.Minute)}
+}
+
+// ConnectorTargets are the delivery destinations a deployment allows, read
+// from CONNECTOR_TARGETS_FILE:
+//
+//	{"sftp": [{"host": "drop.example.com:22", "user": "scraper",
+//	           "key_file": "/etc/scraper/drop_ed25519"}],
+//	 "rest": [{"url_prefix": "https://pim.example.com/api/",
+//	           "secrets": ["pim_api_token"]}]}
+//
+// SFTP connectors can only name a listed host and user, and always use the
+// target's key, so an upload cannot pick arbitrary accounts or server keys.
+// REST connectors may post anywhere the SSRF policy allows, but their
+// headers resolve only the secrets bound to the URL they post to.
+type ConnectorTargets struct {
+	SFTP []SFTPTarget `json:"sftp"`
+	REST []RESTTarget `json:"rest"`
+}
+
+// RESTTarget binds secrets to the URLs they may be sent to
+type RESTTarget struct {
+	URLPrefix string   `json:"url_prefix"`
+	Secrets   []string `json:"secrets"`
+}
+
+// SFTPTarget is one host and account batches may deliver to over SFTP
+type SFTPTarget struct {
+	Host    string `json:"host"`
+	User    string `json:"user"`
+	KeyFile string `json:"key_file,omitempty"` // Empty to use the account's default key
+}
+
+var connectorTargets = loadConnectorTargets(os.Getenv("CONNECTOR_TARGETS_FILE"))
+
+func loadConnectorTargets(path string) ConnectorTargets {
+	var targets ConnectorTargets
+	if path == "" {
+		return targets
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Ignoring CONNECTOR_TARGETS_FILE: %v", err)
+		return targets
+	}
+	if err := json.Unmarshal(data, &targets); err != nil {
+		log.Printf("Ignoring CONNECTOR_TARGETS_FILE: %v", err)
+		return ConnectorTargets{}
+	}
+	return targets
+}
+
+// sftpTarget returns the deployment's target for an SFTP connector
+func (t ConnectorTargets) sftpTarget(c ConnectorConfig) (SFTPTarget, error) {
+	for _, target := range t.SFTP {
+		if !strings.EqualFold(target.Host, c.Host) || target.User != c.User {
+			continue
+		}
+		if c.KeyFile != "" && c.KeyFile != target.KeyFile {
+			return SFTPTarget{}, fmt.Errorf("sftp connector key_file is not the key configured for %s@%s", c.User, c.Host)
+		}
+		return target, nil
+	}
+	return SFTPTarget{}, fmt.Errorf("sftp target %s@%s is not configured for this deployment", c.User, c.Host)
+}
+
+// restSecrets returns the names of the secrets that may be sent to rawURL.
+// Scheme and host must match a target exactly and the path must start with
+// the target's, so a prefix of "https://pim.example.com" does not also match
+// "https://pim.example.com.attacker.net".
+func (t ConnectorTargets) restSecrets(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	var allowed []string
+	for _, target := range t.REST {
+		prefix, err := url.Parse(target.URLPrefix)
+		if err != nil || !strings.EqualFold(prefix.Scheme, u.Scheme) || !strings.EqualFold(prefix.Host, u.Host) ||
+			!strings.HasPrefix(u.EscapedPath(), prefix.EscapedPath()) {
+			continue
+		}
+		allowed = append(allowed, target.Secrets...)
+	}
+	return allowed
+}
+
+// checkSFTPArg rejects values that sftp could read as an option or that could
+// break out of a batch-file command
+func checkSFTPArg(field, value string) error {
+	if strings.HasPrefix(value, "-") {
+		return fmt.Errorf("sftp connector %s must not start with '-'", field)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) || r == '"' {
+			return fmt.Errorf("sftp connector %s contains a control character or quote", field)
+		}
+	}
+	return nil
+}
+
+// DeliveryResult reports what a connector did with a batch
+type DeliveryResult struct {
+	Connector string `json:"connector"`
+	Records   int    `json:"records"`
+	Error     string `json:"error,omitempty"`
+}
+
+// productRecords flattens completed jobs and applies the field mapping
+func productRecords(jobs []BatchJob, mapping map[string]string, config ExportConfig) []ProductRecord {
+	records := make([]ProductRecord, 0, len(jobs))
+	for _, job := range jobs {
+		if !jobSucceeded(job.Status) {
+			continue
+		}
+		columns := make(map[string]string)
+		flattenResult("", job.extraction, config, columns)
+		for key, value := range job.Metadata {
+			columns[metadataPrefix+key] = value
+		}
+		columns["model_number"] = job.ModelNumber
+		columns["url"] = job.URL
+
+		record := make(ProductRecord)
+		if len(mapping) == 0 {
+			for column, value := range columns {
+				record[column] = value
+			}
+		}
+		for target, source := range mapping {
+			record[target] = columns[source]
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// restConnector sends every record of a batch in one JSON request
+type restConnector struct {
+	config ConnectorConfig
+	client *http.Client
+}
+
+func (c *restConnector) Name() string { return c.config.name() }
+
+func (c *restConnector) Deliver(ctx context.Context, batchID string, records []ProductRecord) error {
+	body, err := json.Marshal(map[string]interface{}{"batch_id": batchID, "records": records})
+	if err != nil {
+		return fmt.Errorf("failed to marshal records: %v", err)
+	}
+	method := c.config.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	allowed := connectorTargets.restSecrets(c.config.URL)
+	for key, value := range c.config.Headers {
+		resolved, err := resolveSecretRef(value, allowed)
+		if err != nil {
+			return fmt.Errorf("header %s: %v", key, err)
+		}
+		req.Header.Set(key, resolved)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("endpoint returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// sftpConnector drops the records as a JSON Lines file using the system sftp
+// client in batch mode, so no SSH library has to be linked in
+type sftpConnector struct {
+	config ConnectorConfig
+}
+
+func (c *sftpConnector) Name() string { return c.config.name() }
+
+func (c *sftpConnector) Deliver(ctx context.Context, batchID string, records []ProductRecord) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to encode record: %v", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp("", batchID+"-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to stage records: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to stage records: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to stage records: %v", err)
+	}
+
+	// Checked again here, as the config may predate the deployment's targets
+	if err := c.config.validate(); err != nil {
+		return err
+	}
+	target, err := connectorTargets.sftpTarget(c.config)
+	if err != nil {
+		return err
+	}
+
+	// Upload under a temporary name and rename, so the drop never sees a
+	// partial file. Paths are quoted; validation rules out quotes and newlines.
+	remote := path.Join(c.config.RemoteDir, batchID+".jsonl")
+	commands := fmt.Sprintf("put \"%s\" \"%s.part\"\nrename \"%s.part\" \"%s\"\n", tmp.Name(), remote, remote, remote)
+
+	host, port := target.Host, ""
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host, port = host[:i], host[i+1:]
+	}
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if port != "" {
+		args = append(args, "-P", port)
+	}
+	if target.KeyFile != "" {
+		args = append(args, "-i", target.KeyFile)
+	}
+	args = append(args, "--", target.User+"@"+host)
+
+	cmd := exec.CommandContext(ctx, "sftp", args...)
+	cmd.Stdin = strings.NewReader(commands)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sftp upload failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// deliver sends the batch's completed records through every configured connector
+func (bp *BatchProcess) deliver() {
+	if len(bp.connectors) == 0 {
+		return
+	}
+	bp.mu.Lock()
+	jobs := append([]BatchJob(nil), bp.Jobs...)
+	bp.mu.Unlock()
+
+	results := make([]DeliveryResult, 0, len(bp.connectors))
+	for _, config := range bp.connectors {
+		connector := newConnector(config)
+		mapped := productRecords(jobs, config.Mapping, bp.export)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		err := connector.Deliver(ctx, bp.ID, mapped)
+		cancel()
+
+		result := DeliveryResult{Connector: connector.Name(), Records: len(mapped)}
+		if err != nil {
+			result.Error = err.Error()
+			log.Printf("Batch %s: delivery to %s failed: %v", bp.ID, connector.Name(), err)
+		}
+		results = append(results, result)
+	}
+
+	bp.mu.Lock()
+	bp.Deliveries = results
+	bp.mu.Unlock()
+}
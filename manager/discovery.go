@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported search providers for URL discovery
+const (
+	providerBing    = "bing"
+	providerSerper  = "serper"
+	providerSearxNG = "searxng"
+)
+
+// DiscoveryConfig enables generating jobs for rows that only have a model number
+type DiscoveryConfig struct {
+	Provider      string `json:"provider"`       // "bing", "serper" or "searxng"
+	Endpoint      string `json:"endpoint"`       // Required for searxng, optional override otherwise
+	MaxResults    int    `json:"max_results"`    // Candidate pages kept per model number
+	QueryTemplate string `json:"query_template"` // "{model_number}" is replaced, defaults to a manual/spec query
+}
+
+// searchProvider returns candidate page URLs for a query
+type searchProvider interface {
+	Search(ctx context.Context, query string, limit int) ([]string, error)
+}
+
+// enabled reports whether a discovery provider was configured
+func (c DiscoveryConfig) enabled() bool {
+	return c.Provider != ""
+}
+
+// validate checks that the provider is known and has what it needs
+func (c DiscoveryConfig) validate() error {
+	switch c.Provider {
+	case "", providerBing, providerSerper:
+		return nil
+	case providerSearxNG:
+		if c.Endpoint == "" {
+			return fmt.Errorf("discovery provider searxng requires an endpoint")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported discovery provider: %s", c.Provider)
+}
+
+// query builds the search query for a model number
+func (c DiscoveryConfig) query(modelNumber string) string {
+	template := c.QueryTemplate
+	if template == "" {
+		template = `"{model_number}" manual specifications`
+	}
+	return strings.ReplaceAll(template, "{model_number}", modelNumber)
+}
+
+func (c DiscoveryConfig) maxResults() int {
+	if c.MaxResults <= 0 {
+		return 3
+	}
+	return c.MaxResults
+}
+
+// newSearchProvider builds the configured provider; the API key is the
+// search_api_key secret (SEARCH_API_KEY with the default provider)
+func newSearchProvider(c DiscoveryConfig) (searchProvider, error) {
+	client := &http.Client{Timeout: time.Second * 30}
+	apiKey := secrets.get(secretSearchKey)
+
+	switch c.Provider {
+	case providerBing:
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = "https://api.bing.microsoft.com/v7.0/search"
+		}
+		return &bingSearch{client: client, endpoint: endpoint, apiKey: apiKey}, nil
+	case providerSerper:
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = "https://google.serper.dev/search"
+		}
+		return &serperSearch{client: client, endpoint: endpoint, apiKey: apiKey}, nil
+	case providerSearxNG:
+		return &searxngSearch{client: client, endpoint: strings.TrimSuffix(c.Endpoint, "/")}, nil
+	}
+	return nil, fmt.Errorf("unsupported discovery provider: %s", c.Provider)
+}
+
+type bingSearch struct {
+	client   *http.Client
+	endpoint string
+	apiKey   string
+}
+
+func (s *bingSearch) Search(ctx context.Context, query string, limit int) ([]string, error) {
+	params := url.Values{"q": {query}, "count": {fmt.Sprint(limit)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", s.apiKey)
+
+	var response struct {
+		WebPages struct {
+			Value []struct {
+				URL string `json:"url"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := doSearchRequest(s.client, req, &response); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, page := range response.WebPages.Value {
+		urls = append(urls, page.URL)
+	}
+	return urls, nil
+}
+
+type serperSearch struct {
+	client   *http.Client
+	endpoint string
+	apiKey   string
+}
+
+func (s *serperSearch) Search(ctx context.Context, query string, limit int) ([]string, error) {
+	payload, err := json.Marshal(map[string]interface{}{"q": query, "num": limit})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(string(payload)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-KEY", s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	var response struct {
+		Organic []struct {
+			Link string `json:"link"`
+		} `json:"organic"`
+	}
+	if err := doSearchRequest(s.client, req, &response); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, result := range response.Organic {
+		urls = append(urls, result.Link)
+	}
+	return urls, nil
+}
+
+type searxngSearch struct {
+	client   *http.Client
+	endpoint string
+}
+
+func (s *searxngSearch) Search(ctx context.Context, query string, limit int) ([]string, error) {
+	params := url.Values{"q": {query}, "format": {"json"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Results []struct {
+			URL string `json:"url"`
+		} `json:"results"`
+	}
+	if err := doSearchRequest(s.client, req, &response); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, result := range response.Results {
+		urls = append(urls, result.URL)
+	}
+	return urls, nil
+}
+
+// doSearchRequest executes a search API call and decodes its JSON response
+func doSearchRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("search request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("search API returned status %d: %s", resp.StatusCode, string(body))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode search response: %v", err)
+	}
+	return nil
+}
+
+// discoverURLs searches for a model number and returns valid, allowed candidate pages
+func discoverURLs(ctx context.Context, provider searchProvider, config DiscoveryConfig, modelNumber string) ([]string, error) {
+	limit := config.maxResults()
+	// Ask for extra results since some will be filtered out
+	candidates, err := provider.Search(ctx, config.query(modelNumber), limit*2)
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, candidate := range candidates {
+		normalized, err := validateAndNormalizeURL(candidate)
+		if err != nil {
+			continue
+		}
+		if err := ssrfPolicy.validateURL(ctx, normalized); err != nil {
+			log.Printf("Discovery: skipping %s for model %s: %v", normalized, modelNumber, err)
+			continue
+		}
+		urls = append(urls, normalized)
+		if len(urls) == limit {
+			break
+		}
+	}
+	return removeDuplicates(urls), nil
+}
+
+// runDiscovery replaces jobs without a URL by one job per discovered candidate page
+func (bp *BatchProcess) runDiscovery(ctx context.Context, config DiscoveryConfig) {
+	provider, err := newSearchProvider(config)
+	if err != nil {
+		log.Printf("Discovery disabled for batch %s: %v", bp.ID, err)
+		return
+	}
+
+	bp.mu.Lock()
+	jobs := bp.Jobs
+	bp.mu.Unlock()
+
+	expanded := make([]BatchJob, 0, len(jobs))
+	for _, job := range jobs {
+		if job.URL != "" || job.Status == statusSkippedBySampling {
+			expanded = append(expanded, job)
+			continue
+		}
+
+		urls, err := discoverURLs(ctx, provider, config, job.ModelNumber)
+		if err != nil || len(urls) == 0 {
+			job.Status = "failed"
+			job.ErrorCode = errCodeDiscovery
+			job.Error = "no candidate pages found"
+			if err != nil {
+				job.Error = fmt.Sprintf("discovery failed: %v", err)
+			}
+			expanded = append(expanded, job)
+			continue
+		}
+
+		for _, u := range urls {
+			discovered := job
+			discovered.URL = u
+			discovered.Discovered = true
+			expanded = append(expanded, discovered)
+		}
+		log.Printf("Discovery: found %d candidate pages for model %s", len(urls), job.ModelNumber)
+	}
+
+	bp.mu.Lock()
+	for i := range expanded {
+		expanded[i].Index = i
+	}
+	bp.Jobs = expanded
+	bp.mu.Unlock()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+var (
+	minFreeDiskBytes  uint64 = 1 << 30 // Default free space below which downloads pause: 1 GiB
+	diskCheckInterval        = time.Second * 30
+)
+
+// waitForDiskSpace blocks while free space under dir is below minFree, the
+// batch's threshold or minFreeDiskBytes. onLow is called once when the pause
+// starts so callers can alert clients.
+func waitForDiskSpace(ctx context.Context, dir string, minFree uint64, onLow func(free uint64)) error {
+	alerted := false
+	for {
+		free, err := freeDiskSpace(dir)
+		if err != nil {
+			// Never block processing because the check itself is unavailable
+			log.Printf("Disk space check failed for %s: %v", dir, err)
+			return nil
+		}
+		if free >= minFree {
+			if alerted {
+				log.Printf("Disk space recovered for %s (%d MB free), resuming", dir, free>>20)
+			}
+			return nil
+		}
+
+		if !alerted {
+			log.Printf("Low disk space for %s: %d MB free, below %d MB threshold; pausing downloads", dir, free>>20, minFree>>20)
+			if onLow != nil {
+				onLow(free)
+			}
+			alerted = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(diskCheckInterval):
+		}
+	}
+}
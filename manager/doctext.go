@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPDFStreamBytes caps what one decompressed PDF stream may expand to
+const maxPDFStreamBytes = 16 << 20
+
+// documentText extracts the searchable text of a document downloaded from
+// rawURL, at most limit bytes of it. PDF and DOCX files are read; other
+// formats give "".
+func documentText(data []byte, rawURL string, limit int) string {
+	var text string
+	switch documentExtension(rawURL) {
+	case ".pdf":
+		text = pdfText(data, limit)
+	case ".docx":
+		text = docxText(data, limit)
+	default:
+		return ""
+	}
+	return truncateUTF8(text, limit)
+}
+
+// docxText reads the paragraphs of a Word document's main part
+func docxText(data []byte, limit int) string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ""
+	}
+	for _, entry := range archive.File {
+		if entry.Name != "word/document.xml" {
+			continue
+		}
+		f, err := entry.Open()
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+
+		var b strings.Builder
+		decoder := xml.NewDecoder(io.LimitReader(f, maxPDFStreamBytes))
+		inText := false
+		for b.Len() < limit {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				inText = t.Name.Local == "t"
+			case xml.EndElement:
+				inText = false
+				if t.Name.Local == "p" {
+					b.WriteByte('\n')
+				}
+			case xml.CharData:
+				if inText {
+					b.Write(t)
+				}
+			}
+		}
+		return b.String()
+	}
+	return ""
+}
+
+// pdfText pulls the strings shown by a PDF's text operators out of its
+// uncompressed and Flate-compressed content streams. Text in fonts with a
+// custom encoding comes out garbled or not at all, which only costs recall.
+func pdfText(data []byte, limit int) string {
+	var b strings.Builder
+	rest := data
+	for b.Len() < limit {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		dict := rest[:start]
+		if i := bytes.LastIndex(dict, []byte("<<")); i >= 0 {
+			dict = dict[i:]
+		}
+		body := rest[start+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		rest = body[end+len("endstream"):]
+		content := body[:end]
+
+		switch {
+		case bytes.Contains(dict, []byte("/FlateDecode")):
+			r, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			decoded, _ := io.ReadAll(io.LimitReader(r, maxPDFStreamBytes))
+			r.Close()
+			content = decoded
+		case bytes.Contains(dict, []byte("/Filter")):
+			continue // Images and other encodings hold no text
+		}
+		if bytes.Contains(content, []byte("BT")) {
+			pdfShowText(content, &b)
+		}
+	}
+	return b.String()
+}
+
+// pdfShowText appends the strings of a content stream's Tj, TJ, ' and "
+// operators to b, a line per text object
+func pdfShowText(content []byte, b *strings.Builder) {
+	var shown []string // Strings since the last operator
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteral(content[i:])
+			shown = append(shown, s)
+			i += n
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return
+			}
+			shown = append(shown, pdfHex(content[i+1:i+end]))
+			i += end + 1
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFOperatorByte(c):
+			start := i
+			for i < len(content) && isPDFOperatorByte(content[i]) {
+				i++
+			}
+			switch string(content[start:i]) {
+			case "Tj", "TJ", "'", "\"":
+				for _, s := range shown {
+					b.WriteString(s)
+				}
+				b.WriteByte(' ')
+			case "ET":
+				b.WriteByte('\n')
+			}
+			shown = shown[:0]
+		default:
+			i++
+		}
+	}
+}
+
+// isPDFOperatorByte reports whether c can be part of an operator name
+func isPDFOperatorByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '\'' || c == '"' || c == '*'
+}
+
+// pdfLiteral decodes the literal string at the start of s, returning it and
+// the bytes it took up
+func pdfLiteral(s []byte) (string, int) {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out), i + 1
+			}
+			out = append(out, c)
+		case '\\':
+			i++
+			if i >= len(s) {
+				break
+			}
+			switch e := s[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r', 't', 'b', 'f':
+				out = append(out, ' ')
+			case '\r', '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+						v = v*8 + int(s[i]-'0')
+						i++
+					}
+					i--
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return pdfString(out), len(s)
+}
+
+// pdfHex decodes a hex string's digits
+func pdfHex(digits []byte) string {
+	clean := bytes.Map(func(r rune) rune {
+		if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return r
+		}
+		return -1
+	}, digits)
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	decoded := make([]byte, len(clean)/2)
+	if _, err := hex.Decode(decoded, clean); err != nil {
+		return ""
+	}
+	return pdfString(decoded)
+}
+
+// pdfString converts string bytes to text: UTF-16 when marked with a byte
+// order mark, otherwise Latin-1, which covers PDFDocEncoding's letters
+func pdfString(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		var b strings.Builder
+		for i := 2; i+1 < len(raw); i += 2 {
+			b.WriteRune(rune(raw[i])<<8 | rune(raw[i+1]))
+		}
+		return b.String()
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	var b strings.Builder
+	for _, c := range raw {
+		b.WriteRune(rune(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Document types assigned to linked files
+const (
+	docUserManual  = "user_manual"
+	docDatasheet   = "datasheet"
+	docWarranty    = "warranty"
+	docBrochure    = "brochure"
+	docCertificate = "certificate" // Declarations of conformity and test certificates
+	docOther       = "other"
+)
+
+// documentTypeOrder ranks document types, most useful first
+var documentTypeOrder = map[string]int{
+	docUserManual:  0,
+	docDatasheet:   1,
+	docWarranty:    2,
+	docBrochure:    3,
+	docCertificate: 4,
+	docOther:       5,
+}
+
+// documentKeywords are matched against a link's file name and anchor text
+var documentKeywords = map[string][]string{
+	docUserManual:  {"manual", "user guide", "userguide", "user_guide", "owners", "owner's", "instructions", "operating", "handbook", "bedienungsanleitung", "mode d'emploi"},
+	docDatasheet:   {"datasheet", "data sheet", "data_sheet", "spec sheet", "specsheet", "specifications", "technical data"},
+	docWarranty:    {"warranty", "guarantee", "garantie"},
+	docBrochure:    {"brochure", "catalog", "catalogue", "flyer", "leaflet"},
+	docCertificate: {"declaration of conformity", "declaration_of_conformity", "conformity", "konformit", "certificate", "certification", "compliance", "rohs"},
+}
+
+// Confidence below which the LLM is asked to classify a document
+const documentLLMThreshold = 0.6
+
+// DocumentLink is a classified link to a downloadable document
+type DocumentLink struct {
+	URL        string  `json:"url"`
+	Type       string  `json:"type"`
+	Confidence float64 `json:"confidence"`
+	Text       string  `json:"text,omitempty"`   // Anchor text on the page
+	Method     string  `json:"method,omitempty"` // "filename" or "llm"
+}
+
+// UnmarshalJSON also accepts a bare URL string, as produced before links were classified
+func (d *DocumentLink) UnmarshalJSON(data []byte) error {
+	var link string
+	if err := json.Unmarshal(data, &link); err == nil {
+		*d = DocumentLink{URL: link, Type: docOther}
+		return nil
+	}
+	type plain DocumentLink
+	return json.Unmarshal(data, (*plain)(d))
+}
+
+// classifyByName guesses a document's type from its file name and anchor text
+func classifyByName(link, text string) (string, float64) {
+	name := link
+	if u, err := url.Parse(link); err == nil {
+		name = path.Base(u.Path)
+	}
+	name = strings.ToLower(name)
+	text = strings.ToLower(text)
+
+	best, confidence := docOther, 0.0
+	for _, docType := range []string{docUserManual, docDatasheet, docWarranty, docBrochure, docCertificate} {
+		for _, keyword := range documentKeywords[docType] {
+			score := 0.0
+			if strings.Contains(name, keyword) {
+				score = 0.8
+			}
+			if strings.Contains(text, keyword) {
+				score = max(score, 0.7)
+				if strings.Contains(name, keyword) {
+					score = 0.95
+				}
+			}
+			if score > confidence {
+				best, confidence = docType, score
+			}
+		}
+	}
+	return best, confidence
+}
+
+const documentClassifyPrompt = `
+		Classify each of the following product documents as one of:
+		user_manual, datasheet, warranty, brochure, certificate, other.
+
+		Documents (file name and link text):
+		{documents}
+
+		Respond with a single JSON object mapping each document URL to its type.
+		Return only the JSON object.
+	`
+
+// classifyDocuments types every document link on a page. File name heuristics
+// are used first; documents they cannot place confidently are sent to the LLM
+// together, using the file name and link text as the document's opening context.
+func (p *UnifiedParser) classifyDocuments(ctx context.Context, links []string, anchors []pageLink) ([]DocumentLink, int) {
+	anchorText := make(map[string]string)
+	base, _ := url.Parse(p.siteScraper.baseURL)
+	for _, anchor := range anchors {
+		if ref, err := url.Parse(anchor.Href); err == nil && base != nil {
+			anchorText[base.ResolveReference(ref).String()] = anchor.Text
+		}
+	}
+
+	docs := make([]DocumentLink, 0, len(links))
+	var uncertain []int
+	for _, link := range links {
+		docType, confidence := classifyByName(link, anchorText[link])
+		docs = append(docs, DocumentLink{URL: link, Type: docType, Confidence: confidence, Text: anchorText[link], Method: "filename"})
+		if confidence < documentLLMThreshold {
+			uncertain = append(uncertain, len(docs)-1)
+		}
+	}
+
+	tokensUsed := 0
+	if len(uncertain) > 0 && p.client != nil {
+		types, tokens, err := p.classifyWithLLM(ctx, docs, uncertain)
+		tokensUsed = tokens
+		if err != nil {
+			log.Printf("Document classification by LLM failed: %v", err)
+		}
+		for _, i := range uncertain {
+			if docType, ok := types[docs[i].URL]; ok {
+				docs[i].Type = docType
+				docs[i].Confidence = documentLLMThreshold
+				docs[i].Method = "llm"
+			}
+		}
+	}
+
+	rankDocuments(docs)
+	return docs, tokensUsed
+}
+
+// classifyWithLLM asks the model for the type of the documents at the given indexes
+func (p *UnifiedParser) classifyWithLLM(ctx context.Context, docs []DocumentLink, indexes []int) (map[string]string, int, error) {
+	var list strings.Builder
+	for _, i := range indexes {
+		fmt.Fprintf(&list, "\t\t- %s (link text: %q)\n", docs[i].URL, docs[i].Text)
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: strings.ReplaceAll(documentClassifyPrompt, "{documents}", list.String()),
+	}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("classification request failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, resp.Usage.TotalTokens, fmt.Errorf("empty classification response")
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal([]byte(stripCodeFence(resp.Choices[0].Message.Content)), &raw); err != nil {
+		return nil, resp.Usage.TotalTokens, fmt.Errorf("invalid classification response: %w", err)
+	}
+	types := make(map[string]string, len(raw))
+	for link, docType := range raw {
+		if _, known := documentTypeOrder[docType]; known {
+			types[link] = docType
+		}
+	}
+	return types, resp.Usage.TotalTokens, nil
+}
+
+// rankDocuments orders documents by type usefulness, then confidence
+func rankDocuments(docs []DocumentLink) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		if documentTypeOrder[docs[i].Type] != documentTypeOrder[docs[j].Type] {
+			return documentTypeOrder[docs[i].Type] < documentTypeOrder[docs[j].Type]
+		}
+		return docs[i].Confidence > docs[j].Confidence
+	})
+}
+
+// documentTitles maps document URLs to their anchor text, for naming downloads
+func documentTitles(links []DocumentLink) map[string]string {
+	titles := make(map[string]string, len(links))
+	for _, link := range links {
+		if link.Text != "" {
+			titles[link.URL] = link.Text
+		}
+	}
+	return titles
+}
+
+// documentURLs returns the URLs of classified documents, in rank order
+func documentURLs(docs []DocumentLink) []string {
+	urls := make([]string, len(docs))
+	for i, doc := range docs {
+		urls[i] = doc.URL
+	}
+	return urls
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DomainStats holds live counters for a single target domain
+type DomainStats struct {
+	Domain           string    `json:"domain"`
+	Requests         int64     `json:"requests"`
+	Failures         int64     `json:"failures"`
+	Blocks           int64     `json:"blocks"`
+	BytesDownloaded  int64     `json:"bytes_downloaded"`
+	AverageLatencyMs int64     `json:"average_latency_ms"`
+	LastRequest      time.Time `json:"last_request"`
+
+	totalLatency time.Duration
+}
+
+// domainStatsRegistry aggregates request outcomes per domain across all batches
+type domainStatsRegistry struct {
+	mu      sync.Mutex
+	domains map[string]*DomainStats
+}
+
+var domainStats = &domainStatsRegistry{domains: make(map[string]*DomainStats)}
+
+// isBlockStatus reports whether a status code usually means the site is refusing us
+func isBlockStatus(status int) bool {
+	return status == http.StatusForbidden || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// record adds one request outcome for the domain of rawURL
+func (r *domainStatsRegistry) record(rawURL string, latency time.Duration, bytes int64, failed bool, blocked bool) {
+	domain := jobDomain(rawURL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.domains[domain]
+	if !ok {
+		stats = &DomainStats{Domain: domain}
+		r.domains[domain] = stats
+	}
+	stats.Requests++
+	stats.totalLatency += latency
+	stats.BytesDownloaded += bytes
+	stats.LastRequest = time.Now()
+	if failed {
+		stats.Failures++
+	}
+	if blocked {
+		stats.Blocks++
+	}
+}
+
+// snapshot returns a copy of all counters, busiest domains first
+func (r *domainStatsRegistry) snapshot() []DomainStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]DomainStats, 0, len(r.domains))
+	for _, stats := range r.domains {
+		s := *stats
+		if s.Requests > 0 {
+			s.AverageLatencyMs = (s.totalLatency / time.Duration(s.Requests)).Milliseconds()
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Domain < out[j].Domain
+	})
+	return out
+}
+
+// handleDomainStats returns live per-domain counters
+func handleDomainStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domains": domainStats.snapshot(),
+		"budgets": crawlBudget.usage(),
+	})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The master key wraps every batch's data key. It is read from
+// ARTIFACT_MASTER_KEY (base64) or from the file named by
+// ARTIFACT_MASTER_KEY_FILE, where a KMS agent or secrets driver can place it.
+const (
+	masterKeyEnv     = "ARTIFACT_MASTER_KEY"
+	masterKeyFileEnv = "ARTIFACT_MASTER_KEY_FILE"
+)
+
+// encryptedMagic starts every encrypted artifact, followed by the key ID
+// length, the key ID, the nonce and the AES-GCM ciphertext
+var encryptedMagic = []byte("LSENC1")
+
+var errNoMasterKey = errors.New("artifact encryption requires " + masterKeyEnv + " or " + masterKeyFileEnv)
+
+// masterKey loads the 32-byte key that wraps batch data keys
+func masterKey() ([]byte, error) {
+	encoded := os.Getenv(masterKeyEnv)
+	if path := os.Getenv(masterKeyFileEnv); encoded == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key: %w", err)
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+	if encoded == "" {
+		return nil, errNoMasterKey
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// gcmSeal encrypts plaintext with key, prefixing the random nonce
+func gcmSeal(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// gcmOpen reverses gcmSeal
+func gcmOpen(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// batchKey is the data key a batch encrypts its artifacts with
+type batchKey struct {
+	id  string
+	key []byte
+}
+
+// keyFile is where a batch's data key is stored, wrapped by the master key
+func keyFile(id string) string {
+	return filepath.Join(dataDir, "keys", id+".key")
+}
+
+// newBatchKey creates and stores a data key for a batch
+func newBatchKey(id string) (*batchKey, error) {
+	master, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := gcmSeal(master, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile(id)), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := writeFileAtomic(keyFile(id), wrapped, 0600); err != nil {
+		return nil, fmt.Errorf("failed to store data key: %w", err)
+	}
+	return &batchKey{id: id, key: key}, nil
+}
+
+// loadBatchKey unwraps a stored data key
+func loadBatchKey(id string) (*batchKey, error) {
+	master, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := os.ReadFile(keyFile(id))
+	if err != nil {
+		return nil, fmt.Errorf("no data key for %s: %w", id, err)
+	}
+	key, err := gcmOpen(master, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key for %s: %w", id, err)
+	}
+	return &batchKey{id: id, key: key}, nil
+}
+
+// encryptionRegistry maps output paths to the key of the batch writing them
+type encryptionRegistry struct {
+	mu       sync.Mutex
+	prefixes map[string]*batchKey
+	loaded   map[string]*batchKey // Data keys already unwrapped for reading
+}
+
+var artifactKeys = &encryptionRegistry{prefixes: make(map[string]*batchKey), loaded: make(map[string]*batchKey)}
+
+// register encrypts every file whose path starts with prefix; directories
+// are registered with a trailing separator
+func (r *encryptionRegistry) register(prefix string, key *batchKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prefixes[prefix] = key
+	r.loaded[key.id] = key
+}
+
+// unregister stops encrypting below prefix unless another batch took it over
+func (r *encryptionRegistry) unregister(prefix string, key *batchKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.prefixes[prefix] == key {
+		delete(r.prefixes, prefix)
+	}
+}
+
+// keyFor returns the key of the longest registered prefix of path
+func (r *encryptionRegistry) keyFor(path string) *batchKey {
+	path = filepath.Clean(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var match string
+	var key *batchKey
+	for prefix, k := range r.prefixes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(match) {
+			match, key = prefix, k
+		}
+	}
+	return key
+}
+
+// seal encrypts data when path belongs to an encrypted batch
+func (r *encryptionRegistry) seal(path string, data []byte) ([]byte, error) {
+	key := r.keyFor(path)
+	if key == nil {
+		return data, nil
+	}
+	sealed, err := gcmSeal(key.key, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt %s: %w", filepath.Base(path), err)
+	}
+	header := append(append([]byte{}, encryptedMagic...), byte(len(key.id)))
+	return append(append(header, key.id...), sealed...), nil
+}
+
+// open decrypts data written by seal; plaintext is returned unchanged
+func (r *encryptionRegistry) open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return data, nil
+	}
+	rest := data[len(encryptedMagic):]
+	if len(rest) == 0 || len(rest) < 1+int(rest[0]) {
+		return nil, errors.New("corrupt encrypted artifact")
+	}
+	id := string(rest[1 : 1+int(rest[0])])
+
+	r.mu.Lock()
+	key, ok := r.loaded[id]
+	r.mu.Unlock()
+	if !ok {
+		var err error
+		if key, err = loadBatchKey(id); err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		r.loaded[id] = key
+		r.mu.Unlock()
+	}
+	return gcmOpen(key.key, rest[1+int(rest[0]):])
+}
+
+// readArtifact reads a stored artifact, decrypting it if necessary
+func readArtifact(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return artifactKeys.open(data)
+}
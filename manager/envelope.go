@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/websocket"
+)
+
+// apiVersion is the version of the enveloped API served below /v1
+const apiVersion = "v1"
+
+// Field naming of enveloped responses. Handlers write snake_case; camelCase
+// is converted from it, keys of maps such as job metadata included.
+const (
+	namingSnake = "snake"
+	namingCamel = "camel"
+)
+
+// Response field naming is configured from the environment and per request:
+//
+//	API_FIELD_NAMING  "snake" (default) or "camel"; a request overrides it
+//	                  with ?naming= or the X-Field-Naming header
+var defaultFieldNaming = parseFieldNaming(os.Getenv("API_FIELD_NAMING"), namingSnake)
+
+func parseFieldNaming(value, fallback string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case namingSnake, "snake_case":
+		return namingSnake
+	case namingCamel, "camelcase":
+		return namingCamel
+	}
+	return fallback
+}
+
+// Envelope is the shape of every JSON response below /v1
+type Envelope struct {
+	Data  interface{}    `json:"data"`
+	Error *EnvelopeError `json:"error"`
+	Meta  EnvelopeMeta   `json:"meta"`
+}
+
+// EnvelopeError describes a failed request
+type EnvelopeError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"` // The status text in snake_case, e.g. "not_found"
+	Message string `json:"message"`
+	// The JSON body the endpoint answered with, e.g. a CSV validation report
+	Details interface{} `json:"details,omitempty"`
+}
+
+// EnvelopeMeta describes the response itself
+type EnvelopeMeta struct {
+	APIVersion string    `json:"api_version"`
+	Naming     string    `json:"naming"`
+	Time       time.Time `json:"time"`
+}
+
+// envelopeWriter buffers JSON responses and error messages so they can be
+// wrapped once the handler returns. Other responses, such as CSV downloads
+// and NDJSON streams, are passed through as they are written.
+type envelopeWriter struct {
+	http.ResponseWriter
+	status   int
+	buffered bool
+	body     bytes.Buffer
+}
+
+func (w *envelopeWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	contentType := w.Header().Get("Content-Type")
+	w.buffered = strings.HasPrefix(contentType, "application/json") ||
+		(status >= 400 && (contentType == "" || strings.HasPrefix(contentType, "text/plain")))
+	if !w.buffered {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *envelopeWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buffered {
+		return w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *envelopeWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && !w.buffered {
+		flusher.Flush()
+	}
+}
+
+// envelope wraps the JSON responses and errors of the routes below /v1 in
+// {data, error, meta}, with fields named as the request asks
+func envelope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(apiVersionHeader, apiVersion)
+		if websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		requested := r.URL.Query().Get("naming")
+		if requested == "" {
+			requested = r.Header.Get("X-Field-Naming")
+		}
+		naming := defaultFieldNaming
+		if requested != "" {
+			if naming = parseFieldNaming(requested, ""); naming == "" {
+				writeEnvelope(w, http.StatusBadRequest, nil, &EnvelopeError{Message: "naming must be snake or camel"}, namingSnake)
+				return
+			}
+		}
+
+		recorder := &envelopeWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if !recorder.buffered {
+			return
+		}
+
+		var body interface{}
+		isJSON := strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/json")
+		if isJSON && recorder.body.Len() > 0 {
+			decoder := json.NewDecoder(bytes.NewReader(recorder.body.Bytes()))
+			decoder.UseNumber()
+			if err := decoder.Decode(&body); err != nil {
+				isJSON, body = false, recorder.body.String()
+			}
+		}
+		if recorder.status < 400 {
+			writeEnvelope(w, recorder.status, body, nil, naming)
+			return
+		}
+		apiErr := &EnvelopeError{Message: strings.TrimSpace(recorder.body.String())}
+		if isJSON {
+			apiErr.Message, apiErr.Details = "", body
+			if fields, ok := body.(map[string]interface{}); ok {
+				apiErr.Message, _ = fields["error"].(string)
+			}
+		}
+		writeEnvelope(w, recorder.status, nil, apiErr, naming)
+	})
+}
+
+// writeEnvelope writes an enveloped response with the given status
+func writeEnvelope(w http.ResponseWriter, status int, data interface{}, apiErr *EnvelopeError, naming string) {
+	if apiErr != nil {
+		apiErr.Status = status
+		apiErr.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(status)
+		}
+	}
+	var out interface{} = Envelope{
+		Data:  data,
+		Error: apiErr,
+		Meta:  EnvelopeMeta{APIVersion: apiVersion, Naming: naming, Time: time.Now().UTC()},
+	}
+	if naming == namingCamel {
+		// Round-trip through a generic value so struct fields are renamed too
+		raw, _ := json.Marshal(out)
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var generic interface{}
+		decoder.Decode(&generic)
+		out = camelKeys(generic)
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(out)
+}
+
+// camelKeys renames the object keys in a decoded JSON value to camelCase
+func camelKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			renamed[snakeToCamel(key)] = camelKeys(item)
+		}
+		return renamed
+	case []interface{}:
+		for i, item := range v {
+			v[i] = camelKeys(item)
+		}
+		return v
+	}
+	return value
+}
+
+// snakeToCamel turns "batch_id" into "batchId". Keys that are not
+// snake_case identifiers, such as URLs used as keys, are left alone.
+func snakeToCamel(key string) string {
+	if !strings.Contains(key, "_") {
+		return key
+	}
+	for _, r := range key {
+		if r != '_' && !unicode.IsLower(r) && !unicode.IsDigit(r) {
+			return key
+		}
+	}
+	parts := strings.Split(strings.Trim(key, "_"), "_")
+	var b strings.Builder
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		if i > 0 {
+			b.WriteString(strings.ToUpper(part[:1]))
+			part = part[1:]
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goldenAnswers holds expected field values, keyed by URL and by model number
+type goldenAnswers struct {
+	byURL   map[string]map[string]string
+	byModel map[string]map[string]string
+	fields  []string
+}
+
+// FieldScore is the precision and recall of one field against the golden answers
+type FieldScore struct {
+	Field          string  `json:"field"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	Accuracy       float64 `json:"accuracy"` // Fraction of compared jobs where the value matched exactly
+	compared       int
+	correct        int
+}
+
+// EvaluationReport compares a batch's extractions with the golden answers
+type EvaluationReport struct {
+	JobsEvaluated int          `json:"jobs_evaluated"`
+	JobsMissing   int          `json:"jobs_missing"` // Answers with no successful job
+	Accuracy      float64      `json:"accuracy"`
+	Fields        []FieldScore `json:"fields"`
+}
+
+// parseAnswersCSV reads an answers file with a url and/or model_number column
+// and one column per expected field. List values are pipe-delimited.
+func parseAnswersCSV(r io.Reader) (*goldenAnswers, error) {
+	reader := csv.NewReader(r)
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read answers header: %v", err)
+	}
+
+	urlIdx, modelIdx := -1, -1
+	answers := &goldenAnswers{byURL: make(map[string]map[string]string), byModel: make(map[string]map[string]string)}
+	for i, header := range headers {
+		switch normalizeHeader(header) {
+		case "url":
+			urlIdx = i
+		case "model_number":
+			modelIdx = i
+		default:
+			answers.fields = append(answers.fields, normalizeHeader(header))
+		}
+	}
+	if urlIdx == -1 && modelIdx == -1 {
+		return nil, fmt.Errorf("answers file needs a url or model_number column")
+	}
+	if len(answers.fields) == 0 {
+		return nil, fmt.Errorf("answers file has no field columns")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read answers: %v", err)
+		}
+		expected := make(map[string]string)
+		for i, header := range headers {
+			if i != urlIdx && i != modelIdx && i < len(record) {
+				expected[normalizeHeader(header)] = strings.TrimSpace(record[i])
+			}
+		}
+		if urlIdx != -1 && urlIdx < len(record) && record[urlIdx] != "" {
+			if normalized, err := validateAndNormalizeURL(record[urlIdx]); err == nil {
+				answers.byURL[normalized] = expected
+				continue
+			}
+		}
+		if modelIdx != -1 && modelIdx < len(record) && record[modelIdx] != "" {
+			answers.byModel[record[modelIdx]] = expected
+		}
+	}
+	return answers, nil
+}
+
+// lookup returns the expected values for a job, matching by URL first
+func (a *goldenAnswers) lookup(job BatchJob) (map[string]string, string, bool) {
+	if expected, ok := a.byURL[job.URL]; ok {
+		return expected, "url:" + job.URL, true
+	}
+	if expected, ok := a.byModel[job.ModelNumber]; ok {
+		return expected, "model:" + job.ModelNumber, true
+	}
+	return nil, "", false
+}
+
+// evaluate scores every successful job that has golden answers
+func (a *goldenAnswers) evaluate(jobs []BatchJob) EvaluationReport {
+	scores := make(map[string]*FieldScore, len(a.fields))
+	for _, field := range a.fields {
+		scores[field] = &FieldScore{Field: field}
+	}
+
+	matched := make(map[string]bool)
+	report := EvaluationReport{}
+	for _, job := range jobs {
+		expected, key, ok := a.lookup(job)
+		if !ok || !jobSucceeded(job.Status) || matched[key] {
+			continue
+		}
+		matched[key] = true
+		report.JobsEvaluated++
+
+		actual := make(map[string]string)
+		flattenResult("", job.extraction, ExportConfig{ListMode: listModePipe}, actual)
+		for _, field := range a.fields {
+			scores[field].add(expected[field], actual[field])
+		}
+	}
+	report.JobsMissing = len(a.byURL) + len(a.byModel) - len(matched)
+
+	compared, correct := 0, 0
+	for _, field := range a.fields {
+		score := scores[field]
+		score.finish()
+		compared += score.compared
+		correct += score.correct
+		report.Fields = append(report.Fields, *score)
+	}
+	sort.Slice(report.Fields, func(i, j int) bool { return report.Fields[i].Field < report.Fields[j].Field })
+	if compared > 0 {
+		report.Accuracy = float64(correct) / float64(compared)
+	}
+	return report
+}
+
+// add compares one expected value with the extracted one. List values are
+// compared item by item; scalars count a mismatch as both a false positive and a false negative.
+func (s *FieldScore) add(expected, actual string) {
+	expectedItems := answerItems(expected)
+	actualItems := answerItems(actual)
+	if len(expectedItems) == 0 && len(actualItems) == 0 {
+		return
+	}
+	s.compared++
+
+	remaining := make(map[string]bool, len(expectedItems))
+	for _, item := range expectedItems {
+		remaining[item] = true
+	}
+	exact := len(expectedItems) == len(actualItems)
+	for _, item := range actualItems {
+		if remaining[item] {
+			s.TruePositives++
+			delete(remaining, item)
+		} else {
+			s.FalsePositives++
+			exact = false
+		}
+	}
+	s.FalseNegatives += len(remaining)
+	if exact && len(remaining) == 0 {
+		s.correct++
+	}
+}
+
+// finish computes the ratios once all jobs have been added
+func (s *FieldScore) finish() {
+	if s.TruePositives+s.FalsePositives > 0 {
+		s.Precision = float64(s.TruePositives) / float64(s.TruePositives+s.FalsePositives)
+	}
+	if s.TruePositives+s.FalseNegatives > 0 {
+		s.Recall = float64(s.TruePositives) / float64(s.TruePositives+s.FalseNegatives)
+	}
+	if s.compared > 0 {
+		s.Accuracy = float64(s.correct) / float64(s.compared)
+	}
+}
+
+// answerItems splits a pipe-delimited value into normalized items, dropping empty ones
+func answerItems(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "|") {
+		item = normalizeForMatch(item)
+		if item != "" && item != "no_match" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// evaluate scores the finished batch against its golden answers and writes
+// <DataDir>/<batchID>_evaluation.json
+func (bp *BatchProcess) evaluate() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if bp.answers == nil {
+		return
+	}
+
+	report := bp.answers.evaluate(bp.Jobs)
+	bp.Evaluation = &report
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal evaluation for batch %s: %v", bp.ID, err)
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(bp.DataDir, bp.ID+"_evaluation.json"), data, 0644); err != nil {
+		log.Printf("Failed to write evaluation for batch %s: %v", bp.ID, err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Lifecycle event types
+const (
+	eventBatchCreated   = "batch_created"
+	eventBatchStage     = "batch_stage"
+	eventBatchCompleted = "batch_completed"
+	eventJobStarted     = "job_started"
+	eventJobCompleted   = "job_completed"
+	eventJobFailed      = "job_failed"
+)
+
+// Events are produced to Kafka through a REST proxy (Confluent REST Proxy
+// or compatible), configured with KAFKA_REST_URL and KAFKA_TOPIC
+const (
+	kafkaRESTURLEnv = "KAFKA_REST_URL"
+	kafkaTopicEnv   = "KAFKA_TOPIC"
+	defaultTopic    = "scraper.lifecycle"
+	eventBuffer     = 1000
+	eventBatchSize  = 100
+	eventFlushDelay = time.Second
+)
+
+// LifecycleEvent describes one batch or job state change
+type LifecycleEvent struct {
+	Type        string      `json:"type"`
+	BatchID     string      `json:"batch_id"`
+	JobIndex    *int        `json:"job_index,omitempty"`
+	ModelNumber string      `json:"model_number,omitempty"`
+	URL         string      `json:"url,omitempty"`
+	Status      string      `json:"status"`
+	Error       string      `json:"error,omitempty"`
+	ErrorCode   string      `json:"error_code,omitempty"`
+	Result      interface{} `json:"result,omitempty"` // Extraction of a completed job
+	Time        time.Time   `json:"time"`
+}
+
+// eventPublisher buffers events and produces them in batches; events are
+// dropped rather than slowing down scraping when the proxy falls behind
+type eventPublisher struct {
+	endpoint string
+	events   chan LifecycleEvent
+	client   *http.Client
+}
+
+var lifecycleEvents = newEventPublisher()
+
+// newEventPublisher returns a publisher, disabled when no proxy is configured
+func newEventPublisher() *eventPublisher {
+	base := strings.TrimRight(os.Getenv(kafkaRESTURLEnv), "/")
+	if base == "" {
+		return &eventPublisher{}
+	}
+	topic := os.Getenv(kafkaTopicEnv)
+	if topic == "" {
+		topic = defaultTopic
+	}
+	p := &eventPublisher{
+		endpoint: base + "/topics/" + topic,
+		events:   make(chan LifecycleEvent, eventBuffer),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	go p.run()
+	return p
+}
+
+// publish queues an event without blocking
+func (p *eventPublisher) publish(event LifecycleEvent) {
+	if p.events == nil {
+		return
+	}
+	event.Time = time.Now()
+	select {
+	case p.events <- event:
+	default:
+		log.Printf("Event buffer full, dropping %s event for batch %s", event.Type, event.BatchID)
+	}
+}
+
+// publishEvent publishes a batch-level event with the current status
+func (bp *BatchProcess) publishEvent(eventType string) {
+	bp.mu.Lock()
+	status := bp.Status
+	bp.mu.Unlock()
+	lifecycleEvents.publish(LifecycleEvent{Type: eventType, BatchID: bp.ID, Status: status})
+}
+
+// publishJobEvent publishes a job-level event
+func (bp *BatchProcess) publishJobEvent(eventType string, job BatchJob) {
+	index := job.Index
+	event := LifecycleEvent{
+		Type:        eventType,
+		BatchID:     bp.ID,
+		JobIndex:    &index,
+		ModelNumber: job.ModelNumber,
+		URL:         job.URL,
+		Status:      job.Status,
+		Error:       job.Error,
+		ErrorCode:   job.ErrorCode,
+	}
+	if eventType == eventJobCompleted {
+		event.Result = job.extraction
+	}
+	lifecycleEvents.publish(event)
+}
+
+// run sends queued events every eventFlushDelay or once eventBatchSize are waiting
+func (p *eventPublisher) run() {
+	ticker := time.NewTicker(eventFlushDelay)
+	defer ticker.Stop()
+
+	var pending []LifecycleEvent
+	for {
+		select {
+		case event := <-p.events:
+			pending = append(pending, event)
+			if len(pending) < eventBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(pending) == 0 {
+				continue
+			}
+		}
+		if err := p.send(pending); err != nil {
+			log.Printf("Failed to publish %d lifecycle events: %v", len(pending), err)
+		}
+		pending = nil
+	}
+}
+
+// send produces events keyed by batch ID, so each batch's events stay ordered
+func (p *eventPublisher) send(events []LifecycleEvent) error {
+	type record struct {
+		Key   string         `json:"key"`
+		Value LifecycleEvent `json:"value"`
+	}
+	records := make([]record, len(events))
+	for i, event := range events {
+		records[i] = record{Key: event.BatchID, Value: event}
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Post(p.endpoint, "application/vnd.kafka.json.v2+json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("REST proxy returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported export formats
+const (
+	exportCSV     = "csv"
+	exportJSON    = "json"
+	exportWideCSV = "wide_csv" // One flattened row per job for the whole batch
+)
+
+// List flattening modes for the wide export
+const (
+	listModeColumns = "columns" // user_manual_1, user_manual_2, ...
+	listModePipe    = "pipe"    // a single "a|b|c" cell
+)
+
+// ExportConfig selects the file formats written for each job's results
+type ExportConfig struct {
+	Formats      []string `json:"formats"`
+	ListMode     string   `json:"list_mode,omitempty"`      // Wide export list handling, "columns" (default) or "pipe"
+	MaxListItems int      `json:"max_list_items,omitempty"` // Cap on numbered list columns, 0 for no limit
+}
+
+// formats returns the configured formats, defaulting to CSV
+func (c ExportConfig) formats() []string {
+	if len(c.Formats) == 0 {
+		return []string{exportCSV}
+	}
+	return c.Formats
+}
+
+// validate rejects formats we cannot write
+func (c ExportConfig) validate() error {
+	for _, format := range c.Formats {
+		if format != exportCSV && format != exportJSON && format != exportWideCSV {
+			return fmt.Errorf("unsupported export format: %s", format)
+		}
+	}
+	if c.ListMode != "" && c.ListMode != listModeColumns && c.ListMode != listModePipe {
+		return fmt.Errorf("unsupported list_mode: %s", c.ListMode)
+	}
+	return nil
+}
+
+// wants reports whether format is enabled
+func (c ExportConfig) wants(format string) bool {
+	for _, f := range c.formats() {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+var imageMatchHeader = []string{"url", "confidence", "context", "local_path", "width", "height"}
+
+// writeImageMatches writes image matches in every configured format
+func writeImageMatches(resultsDir string, matches []ImageMatch, config ExportConfig, metadata map[string]string) error {
+	for _, format := range config.formats() {
+		switch format {
+		case exportCSV:
+			data, err := imageMatchesCSV(matches, metadata)
+			if err != nil {
+				return err
+			}
+			if err := writeFileAtomic(filepath.Join(resultsDir, "image_matches.csv"), data, 0644); err != nil {
+				return fmt.Errorf("failed to write image matches CSV: %v", err)
+			}
+		case exportJSON:
+			data, err := json.MarshalIndent(matches, "", "    ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal image matches: %v", err)
+			}
+			if err := writeFileAtomic(filepath.Join(resultsDir, "image_matches.json"), data, 0644); err != nil {
+				return fmt.Errorf("failed to write image matches JSON: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// imageMatchesCSV renders image matches as CSV with a header row
+func imageMatchesCSV(matches []ImageMatch, metadata map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	header, _ := appendMetadata(append([]string{}, imageMatchHeader...), nil, metadata)
+	if err := writer.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %v", err)
+	}
+	for _, match := range matches {
+		record := []string{
+			match.URL,
+			strconv.FormatFloat(match.Confidence, 'f', 4, 64),
+			match.Context,
+			match.LocalPath,
+			formatDimension(match.Width),
+			formatDimension(match.Height),
+		}
+		_, record = appendMetadata(nil, record, metadata)
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("failed to write CSV record: %v", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to flush CSV: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// formatDimension leaves unknown dimensions empty rather than writing 0
+func formatDimension(v int) string {
+	if v <= 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
+// flattenResult turns a nested extraction into flat column/value pairs.
+// Nested objects use dotted names; lists become numbered columns or pipe-delimited cells.
+func flattenResult(prefix string, value interface{}, config ExportConfig, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenResult(name, child, config, out)
+		}
+	case []string, []interface{}:
+		items := flattenList(v)
+		if config.ListMode == listModePipe {
+			out[prefix] = strings.Join(items, "|")
+			return
+		}
+		if config.MaxListItems > 0 && len(items) > config.MaxListItems {
+			items = items[:config.MaxListItems]
+		}
+		for i, item := range items {
+			out[fmt.Sprintf("%s_%d", prefix, i+1)] = item
+		}
+	case nil:
+		if prefix != "" {
+			out[prefix] = ""
+		}
+	default:
+		if prefix == "" {
+			prefix = "result"
+		}
+		out[prefix] = formatCell(v)
+	}
+}
+
+// flattenList renders list items as cells; objects inside lists are kept as JSON
+func flattenList(value interface{}) []string {
+	var items []string
+	switch v := value.(type) {
+	case []string:
+		items = append(items, v...)
+	case []interface{}:
+		for _, item := range v {
+			items = append(items, formatCell(item))
+		}
+	}
+	return items
+}
+
+// wideBaseColumns always lead the wide export, in this order
+var wideBaseColumns = []string{"model_number", "url", "status", "error"}
+
+// writeWideCSV exports every job of a batch as one flattened row
+func writeWideCSV(path string, jobs []BatchJob, config ExportConfig) error {
+	rows := make([]map[string]string, 0, len(jobs))
+	columnSet := make(map[string]bool)
+
+	for _, job := range jobs {
+		row := make(map[string]string)
+		flattenResult("", job.extraction, config, row)
+		for column := range row {
+			columnSet[column] = true
+		}
+		row["model_number"] = job.ModelNumber
+		row["url"] = job.URL
+		row["status"] = job.Status
+		row["error"] = job.Error
+		for key, value := range job.Metadata {
+			column := metadataPrefix + key
+			row[column] = value
+			columnSet[column] = true
+		}
+		for field, value := range job.Normalized {
+			column := "normalized." + field
+			row[column] = value.Normalized
+			columnSet[column] = true
+		}
+		if job.Warranty != nil {
+			row["warranty.duration_months"] = strconv.Itoa(job.Warranty.DurationMonths)
+			row["warranty.type"] = job.Warranty.Type
+			columnSet["warranty.duration_months"] = true
+			columnSet["warranty.type"] = true
+		}
+		if len(job.CategoryPath) > 0 {
+			row["category_path"] = strings.Join(job.CategoryPath, " > ")
+			columnSet["category_path"] = true
+		}
+		if len(job.MediaLinks) > 0 {
+			urls := make([]string, len(job.MediaLinks))
+			for i, link := range job.MediaLinks {
+				urls[i] = link.URL
+			}
+			row["media_links"] = strings.Join(urls, " ")
+			columnSet["media_links"] = true
+		}
+		if len(job.Certifications) > 0 {
+			row["certifications"] = strings.Join(certificationNames(job.Certifications), ", ")
+			columnSet["certifications"] = true
+		}
+		if job.Support != nil {
+			if len(job.Support.Phones) > 0 {
+				row["support.phone"] = job.Support.Phones[0].Number
+				columnSet["support.phone"] = true
+			}
+			if len(job.Support.Emails) > 0 {
+				row["support.email"] = job.Support.Emails[0]
+				columnSet["support.email"] = true
+			}
+		}
+		if job.Offer != nil {
+			if job.Offer.Price != nil {
+				row["offer.price"] = strconv.FormatFloat(*job.Offer.Price, 'f', -1, 64)
+			}
+			row["offer.currency"] = job.Offer.Currency
+			row["offer.availability"] = job.Offer.Availability
+			columnSet["offer.price"] = true
+			columnSet["offer.currency"] = true
+			columnSet["offer.availability"] = true
+		}
+		if job.Lifecycle != nil {
+			row["lifecycle.status"] = job.Lifecycle.Status
+			row["lifecycle.successor"] = job.Lifecycle.Successor
+			columnSet["lifecycle.status"] = true
+			columnSet["lifecycle.successor"] = true
+		}
+		for field, value := range job.Dates {
+			column := "dates." + field
+			row[column] = value.ISO
+			columnSet[column] = true
+		}
+		rows = append(rows, row)
+	}
+
+	for _, column := range wideBaseColumns {
+		delete(columnSet, column)
+	}
+	extra := make([]string, 0, len(columnSet))
+	for column := range columnSet {
+		extra = append(extra, column)
+	}
+	sortColumns(extra)
+	header := append(append([]string{}, wideBaseColumns...), extra...)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, column := range header {
+			record[i] = row[column]
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write wide CSV: %v", err)
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write wide CSV: %v", err)
+	}
+	return nil
+}
+
+// sortColumns orders columns alphabetically, keeping numbered list columns in numeric order
+func sortColumns(columns []string) {
+	sort.Slice(columns, func(i, j int) bool {
+		ai, an := splitListColumn(columns[i])
+		bi, bn := splitListColumn(columns[j])
+		if ai != bi {
+			return ai < bi
+		}
+		return an < bn
+	})
+}
+
+// splitListColumn splits "user_manual_12" into ("user_manual", 12)
+func splitListColumn(column string) (string, int) {
+	idx := strings.LastIndex(column, "_")
+	if idx == -1 {
+		return column, 0
+	}
+	n, err := strconv.Atoi(column[idx+1:])
+	if err != nil {
+		return column, 0
+	}
+	return column[:idx], n
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultFeedEntries     = 100
+	defaultFeedPollMinutes = 30
+)
+
+// Columns of the rows a feed is turned into; the last three become job metadata
+var feedColumns = []string{"url", "model_number", "entry_title", "entry_id", "published"}
+
+// FeedConfig takes a batch's rows from an RSS or Atom feed instead of a CSV
+type FeedConfig struct {
+	URL string `json:"url"`
+	// Regular expression applied to entry titles; its first group, or the whole
+	// match, is the model number. The full title is used otherwise.
+	ModelPattern string `json:"model_pattern,omitempty"`
+	MaxEntries   int    `json:"max_entries"` // Entries taken from one read of the feed, 100 by default
+	// Keep polling the feed and start a batch for every newly published entry
+	Watch       bool `json:"watch"`
+	PollMinutes int  `json:"poll_minutes"` // 30 by default
+}
+
+// FeedSource records where a feed batch's rows came from
+type FeedSource struct {
+	URL       string    `json:"url"`
+	Watching  bool      `json:"watching,omitempty"`
+	LastPoll  time.Time `json:"last_poll,omitempty"`
+	Origin    string    `json:"origin,omitempty"`     // Batch whose watcher started this one
+	FollowUps []string  `json:"follow_ups,omitempty"` // Batches started for entries published later
+}
+
+func (c FeedConfig) enabled() bool {
+	return c.URL != ""
+}
+
+func (c FeedConfig) validate() error {
+	if !c.enabled() {
+		if c.Watch {
+			return fmt.Errorf("feed watch needs a feed url")
+		}
+		return nil
+	}
+	if _, err := validateAndNormalizeURL(c.URL); err != nil {
+		return fmt.Errorf("invalid feed url: %w", err)
+	}
+	if c.ModelPattern != "" {
+		if _, err := regexp.Compile(c.ModelPattern); err != nil {
+			return fmt.Errorf("invalid model_pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c FeedConfig) maxEntries() int {
+	if c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	return defaultFeedEntries
+}
+
+func (c FeedConfig) pollInterval() time.Duration {
+	if c.PollMinutes > 0 {
+		return time.Duration(c.PollMinutes) * time.Minute
+	}
+	return defaultFeedPollMinutes * time.Minute
+}
+
+// modelNumber derives an entry's model number from its title
+func (c FeedConfig) modelNumber(entry feedEntry) string {
+	if c.ModelPattern != "" {
+		re, _ := regexp.Compile(c.ModelPattern) // Checked by validate
+		if match := re.FindStringSubmatch(entry.Title); match != nil {
+			if len(match) > 1 && match[1] != "" {
+				return strings.TrimSpace(match[1])
+			}
+			return strings.TrimSpace(match[0])
+		}
+	}
+	return firstNonEmpty(entry.Title, entry.ID)
+}
+
+// feedEntry is an RSS item or Atom entry
+type feedEntry struct {
+	Title     string
+	Link      string
+	ID        string
+	Published string
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"date"` // Dublin Core, used by RSS 1.0
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+// feedDocument matches RSS 2.0 (<rss><channel>), RSS 1.0 (<rdf:RDF>) and Atom (<feed>)
+type feedDocument struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// parseFeed returns a feed's entries in document order
+func parseFeed(r io.Reader) ([]feedEntry, error) {
+	var doc feedDocument
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil // Feeds in other charsets are read as UTF-8
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	var entries []feedEntry
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss", "rdf":
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			entries = append(entries, feedEntry{
+				Title:     strings.TrimSpace(item.Title),
+				Link:      strings.TrimSpace(item.Link),
+				ID:        strings.TrimSpace(item.GUID),
+				Published: strings.TrimSpace(firstNonEmpty(item.PubDate, item.Date)),
+			})
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			link := ""
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			entries = append(entries, feedEntry{
+				Title:     strings.TrimSpace(entry.Title),
+				Link:      strings.TrimSpace(link),
+				ID:        strings.TrimSpace(entry.ID),
+				Published: strings.TrimSpace(firstNonEmpty(entry.Published, entry.Updated)),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed: <%s>", doc.XMLName.Local)
+	}
+	return entries, nil
+}
+
+// fetchFeed reads the configured feed, keeping at most maxEntries entries
+func fetchFeed(ctx context.Context, config FeedConfig) ([]feedEntry, error) {
+	feedURL, err := validateAndNormalizeURL(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed url: %w", err)
+	}
+	if err := ssrfPolicy.validateURL(ctx, feedURL); err != nil {
+		return nil, fmt.Errorf("feed url not allowed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create feed request: %w", err)
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	resp, err := sharedScrapeClient(timeout).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+
+	entries, err := parseFeed(io.LimitReader(resp.Body, maxHTMLBytes))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > config.maxEntries() {
+		entries = entries[:config.maxEntries()]
+	}
+	return entries, nil
+}
+
+// rowReader yields CSV-shaped records, from an upload or a feed
+type rowReader interface {
+	Read() ([]string, error)
+}
+
+// feedReader presents feed entries as CSV rows, header first
+type feedReader struct {
+	rows [][]string
+}
+
+func newFeedReader(entries []feedEntry, config FeedConfig) *feedReader {
+	rows := [][]string{feedColumns}
+	for _, entry := range entries {
+		rows = append(rows, []string{entry.Link, config.modelNumber(entry), entry.Title, entry.ID, entry.Published})
+	}
+	return &feedReader{rows: rows}
+}
+
+func (f *feedReader) Read() ([]string, error) {
+	if len(f.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := f.rows[0]
+	f.rows = f.rows[1:]
+	return row, nil
+}
+
+// feedWatchers holds the cancel function of every batch watching its feed
+var feedWatchers = struct {
+	mu     sync.Mutex
+	cancel map[string]context.CancelFunc
+}{cancel: make(map[string]context.CancelFunc)}
+
+// watchFeed polls a batch's feed and starts a follow-up batch for the entries
+// that appear later. Follow-ups copy the settings of template, the batch's
+// first job, and of the batch itself. Entries in seen are never scraped again.
+func (bp *BatchProcess) watchFeed(config FeedConfig, abTest ABTestConfig, template BatchJob, seen map[string]bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	feedWatchers.mu.Lock()
+	feedWatchers.cancel[bp.ID] = cancel
+	feedWatchers.mu.Unlock()
+
+	bp.mu.Lock()
+	bp.Feed.Watching = true
+	bp.mu.Unlock()
+	log.Printf("Batch %s: watching feed %s every %s", bp.ID, config.URL, config.pollInterval())
+
+	go func() {
+		ticker := time.NewTicker(config.pollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			bp.pollFeed(ctx, config, abTest, template, seen)
+		}
+	}()
+}
+
+// pollFeed reads the feed once and queues a batch for its new entries
+func (bp *BatchProcess) pollFeed(ctx context.Context, config FeedConfig, abTest ABTestConfig, template BatchJob, seen map[string]bool) {
+	entries, err := fetchFeed(ctx, config)
+	bp.mu.Lock()
+	bp.Feed.LastPoll = time.Now()
+	bp.mu.Unlock()
+	if err != nil {
+		log.Printf("Batch %s: feed poll failed: %v", bp.ID, err)
+		return
+	}
+
+	var jobs []BatchJob
+	for _, entry := range entries {
+		entryURL, err := validateAndNormalizeURL(entry.Link)
+		if err != nil || seen[entryURL] {
+			continue
+		}
+		seen[entryURL] = true
+		modelNumber := config.modelNumber(entry)
+		if modelNumber == "" {
+			continue
+		}
+		if err := ssrfPolicy.validateURL(ctx, entryURL); err != nil {
+			log.Printf("Batch %s: skipping feed entry %s: %v", bp.ID, entryURL, err)
+			continue
+		}
+		job := template
+		job.ModelNumber = modelNumber
+		job.URL = entryURL
+		job.Metadata = rowMetadata(feedColumns, []string{entryURL, modelNumber, entry.Title, entry.ID, entry.Published})
+		jobs = append(jobs, job)
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	if abTest.enabled() {
+		jobs = assignVariants(jobs, abTest)
+	}
+	for i := range jobs {
+		jobs[i].Index = i
+	}
+	next, err := bp.successor(jobs)
+	if err != nil {
+		log.Printf("Batch %s: failed to start follow-up batch: %v", bp.ID, err)
+		return
+	}
+
+	bp.mu.Lock()
+	bp.Feed.FollowUps = append(bp.Feed.FollowUps, next.ID)
+	bp.mu.Unlock()
+
+	processes.put(next)
+	log.Printf("Batch %s: %d new feed entries queued as batch %s", bp.ID, len(jobs), next.ID)
+	scheduler.submit(next)
+	next.publishEvent(eventBatchCreated)
+}
+
+// successor returns a pending batch of jobs that shares this batch's settings
+func (bp *BatchProcess) successor(jobs []BatchJob) (*BatchProcess, error) {
+	next := &BatchProcess{
+		ID:                 fmt.Sprintf("batch_%d", time.Now().UnixNano()),
+		Jobs:               jobs,
+		Status:             "pending",
+		DataDir:            bp.DataDir,
+		Priority:           bp.Priority,
+		Window:             bp.Window,
+		Owner:              bp.Owner,
+		StartTime:          time.Now(),
+		GroupByModel:       bp.GroupByModel,
+		ConflictResolution: bp.ConflictResolution,
+		Feed:               &FeedSource{URL: bp.Feed.URL, Origin: bp.ID},
+		export:             bp.export,
+		discovery:          bp.discovery,
+		sourceRanking:      bp.sourceRanking,
+		adaptive:           bp.adaptive,
+		connectors:         bp.connectors,
+		minFreeDisk:        bp.minFreeDisk,
+		jobHardLimit:       bp.jobHardLimit,
+		clients:            make([]chan bool, 0, 10),
+	}
+	if bp.memory != nil {
+		next.memory = newMemoryBudget(bp.memory.limit, bp.memory.perJob)
+	}
+	if bp.encryptionKey != nil {
+		key, err := newBatchKey(next.ID)
+		if err != nil {
+			return nil, err
+		}
+		next.encryptionKey = key
+	}
+	return next, nil
+}
+
+// stopFeedWatch stops a batch's feed watcher, reporting whether one was running
+func stopFeedWatch(batchID string) bool {
+	feedWatchers.mu.Lock()
+	cancel, ok := feedWatchers.cancel[batchID]
+	delete(feedWatchers.cancel, batchID)
+	feedWatchers.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// handleStopFeedWatch stops polling a batch's feed; batches already started keep running
+func handleStopFeedWatch(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	process, exists := processes.get(batchID)
+	if !exists {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	if !stopFeedWatch(batchID) {
+		http.Error(w, "Batch is not watching a feed", http.StatusConflict)
+		return
+	}
+
+	process.mu.Lock()
+	process.Feed.Watching = false
+	source := *process.Feed
+	process.mu.Unlock()
+	log.Printf("Batch %s: stopped watching feed %s", batchID, source.URL)
+	audit.record(r, auditStopFeed, batchID, source.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(source)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxSlugLength  = 60 // Characters kept from a title, leaving room for the hash and extension
+	fileHashLength = 8  // Hex digits of the URL hash appended to every name
+)
+
+// assetFileName names a downloaded document or image: the slugified title,
+// or the URL's basename when there is none, followed by a short hash of the
+// URL and the URL's extension. Different URLs get different names even when
+// their titles match, and the name is valid on Windows as well as Unix.
+func assetFileName(title, sourceURL string) string {
+	ext := documentExtension(sourceURL)
+	slug := slugify(title)
+	if slug == "" {
+		slug = slugify(strings.TrimSuffix(urlBasename(sourceURL), ext))
+	}
+	if slug == "" {
+		slug = "file"
+	}
+	sum := sha256.Sum256([]byte(sourceURL))
+	return slug + "-" + hex.EncodeToString(sum[:])[:fileHashLength] + sanitizeExtension(ext)
+}
+
+// latinFolds spells common accented letters in ASCII so titles in European
+// languages keep readable slugs
+var latinFolds = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss",
+	"à", "a", "á", "a", "â", "a", "ã", "a", "å", "a", "À", "A", "Á", "A", "Â", "A",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "È", "E", "É", "E", "Ê", "E",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ò", "o", "ó", "o", "ô", "o", "õ", "o", "ø", "o",
+	"ù", "u", "ú", "u", "û", "u", "ñ", "n", "Ñ", "N", "ç", "c", "Ç", "C",
+)
+
+// slugify lowercases the ASCII letters and digits of s and replaces every
+// run of other characters with a single hyphen
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range latinFolds.Replace(s) {
+		if b.Len() >= maxSlugLength {
+			break
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// sanitizeExtension keeps an extension only if it is a dot and alphanumerics
+func sanitizeExtension(ext string) string {
+	for i, r := range ext {
+		if i == 0 && r == '.' {
+			continue
+		}
+		if r >= unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return ""
+		}
+	}
+	return strings.ToLower(ext)
+}
+
+// urlBasename returns the last path segment of a URL
+func urlBasename(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	base := path.Base(u.Path)
+	if base == "/" || base == "." {
+		return ""
+	}
+	return base
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// duplicateWindow is how long an uploaded job list is remembered. It is set for
+// the deployment with DUPLICATE_WINDOW_MINUTES.
+var duplicateWindow = time.Duration(envInt("DUPLICATE_WINDOW_MINUTES", 10)) * time.Minute
+
+// recentBatch records when a fingerprint was last uploaded
+type recentBatch struct {
+	batchID    string
+	uploadedAt time.Time
+}
+
+var (
+	recentBatches   = make(map[string]recentBatch)
+	recentBatchesMu sync.Mutex
+)
+
+// batchFingerprint hashes the normalized job list so that row order,
+// letter case and surrounding whitespace do not affect the result
+func batchFingerprint(jobs []BatchJob) string {
+	lines := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		description := ""
+		if job.ParseDescription != nil {
+			description = strings.TrimSpace(*job.ParseDescription)
+		}
+		lines = append(lines, strings.Join([]string{
+			strings.ToLower(strings.TrimSpace(job.ModelNumber)),
+			strings.ToLower(strings.TrimSpace(job.URL)),
+			description,
+		}, "\t"))
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// findRecentBatch returns the ID of a batch with the same fingerprint uploaded within the window
+func findRecentBatch(fingerprint string) (string, bool) {
+	recentBatchesMu.Lock()
+	defer recentBatchesMu.Unlock()
+
+	// Drop expired entries while we hold the lock
+	for fp, batch := range recentBatches {
+		if time.Since(batch.uploadedAt) > duplicateWindow {
+			delete(recentBatches, fp)
+		}
+	}
+
+	batch, ok := recentBatches[fingerprint]
+	return batch.batchID, ok
+}
+
+// rememberBatch records a fingerprint for duplicate detection
+func rememberBatch(fingerprint, batchID string) {
+	recentBatchesMu.Lock()
+	defer recentBatchesMu.Unlock()
+	recentBatches[fingerprint] = recentBatch{batchID: batchID, uploadedAt: time.Now()}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// batchInactivityTimeout is how long a batch may go without a state change
+	// or a client before it is expired, set with BATCH_INACTIVITY_MINUTES
+	batchInactivityTimeout = time.Duration(envInt("BATCH_INACTIVITY_MINUTES", 24*60)) * time.Minute
+	batchGCInterval        = time.Minute * 5
+)
+
+// expiredBatch is what remains of a batch removed by the collector
+type expiredBatch struct {
+	status    string // Status when it was removed
+	expiredAt time.Time
+}
+
+// batchCollector removes stale batches from memory. Batches that never
+// started are expired; finished batches nobody watches are evicted, their
+// artifacts staying on disk. Running batches are never touched.
+type batchCollector struct {
+	mu      sync.Mutex
+	expired map[string]expiredBatch
+}
+
+var batchGC = &batchCollector{expired: make(map[string]expiredBatch)}
+
+// touch records activity on the batch; the caller holds bp.mu
+func (bp *BatchProcess) touch() {
+	bp.LastActivity = time.Now()
+}
+
+// idleSince returns when the batch last changed or was looked at; the caller holds bp.mu
+func (bp *BatchProcess) idleSince() time.Time {
+	if bp.LastActivity.After(bp.StartTime) {
+		return bp.LastActivity
+	}
+	return bp.StartTime
+}
+
+// stale reports whether the collector may remove the batch, and the status
+// it ends in; the caller holds bp.mu
+func (bp *BatchProcess) stale(now time.Time) (string, bool) {
+	if len(bp.clients) > 0 || now.Sub(bp.idleSince()) < batchInactivityTimeout {
+		return "", false
+	}
+	switch bp.Status {
+	case "pending", "queued", "scheduled":
+		return "expired", true
+	case "completed", statusCancelled:
+		return "evicted", true
+	}
+	return "", false
+}
+
+// run collects stale batches until the process exits
+func (c *batchCollector) run() {
+	ticker := time.NewTicker(batchGCInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		c.collect(now)
+	}
+}
+
+// collect removes every stale batch and forgets tombstones older than the timeout
+func (c *batchCollector) collect(now time.Time) {
+	for _, bp := range processes.snapshot() {
+		id := bp.ID
+		bp.mu.Lock()
+		status, ok := bp.stale(now)
+		if ok {
+			bp.Status = status
+			bp.clients = nil
+			bp.jobEvents = nil
+			bp.jobLogs = nil
+		}
+		bp.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		scheduler.remove(bp)
+		stopFeedWatch(id)
+		processes.remove(id)
+		documentIndex.removeBatch(id)
+		feed.publish(id)
+
+		c.mu.Lock()
+		c.expired[id] = expiredBatch{status: status, expiredAt: now}
+		c.mu.Unlock()
+		log.Printf("Batch %s %s after %s without activity", id, status, batchInactivityTimeout)
+		audit.recordSystem(auditExpire, id, status)
+	}
+
+	c.mu.Lock()
+	for id, batch := range c.expired {
+		if now.Sub(batch.expiredAt) > batchInactivityTimeout {
+			delete(c.expired, id)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// notFound answers a request for a batch that is not in memory, telling
+// clients when the collector removed it rather than it never existing
+func (c *batchCollector) notFound(w http.ResponseWriter, batchID string) {
+	c.mu.Lock()
+	batch, ok := c.expired[batchID]
+	c.mu.Unlock()
+	if !ok {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	if batch.status == statusDeleted {
+		http.Error(w, "Batch was deleted", http.StatusGone)
+		return
+	}
+	if batch.status == "evicted" {
+		http.Error(w, "Batch finished and was evicted from memory after inactivity; its results remain on disk", http.StatusGone)
+		return
+	}
+	http.Error(w, "Batch expired before it started processing", http.StatusGone)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// geminiEndpoint is the Generative Language API base URL
+var geminiEndpoint = "https://generativelanguage.googleapis.com/v1beta"
+
+// geminiClient calls the Gemini generateContent API directly and adapts it to
+// the chatCompleter interface, so the rest of the parser stays provider-neutral
+type geminiClient struct {
+	apiKey func() string // Current key, read per request so rotation takes effect
+	http   *http.Client
+}
+
+func newGeminiClient(apiKey func() string) *geminiClient {
+	return &geminiClient{apiKey: apiKey, http: &http.Client{Timeout: 2 * time.Minute}}
+}
+
+type geminiPart struct {
+	Text       string            `json:"text,omitempty"`
+	InlineData *geminiInlineData `json:"inlineData,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float32 `json:"temperature,omitempty"`
+	TopP            *float32 `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// geminiParts converts an OpenAI-style message, including data: URL images, to Gemini parts
+func geminiParts(message openai.ChatCompletionMessage) ([]geminiPart, error) {
+	if len(message.MultiContent) == 0 {
+		return []geminiPart{{Text: message.Content}}, nil
+	}
+	parts := make([]geminiPart, 0, len(message.MultiContent))
+	for _, part := range message.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			parts = append(parts, geminiPart{Text: part.Text})
+		case openai.ChatMessagePartTypeImageURL:
+			mimeType, data, ok := parseDataURL(part.ImageURL.URL)
+			if !ok {
+				return nil, fmt.Errorf("gemini images must be data: URLs")
+			}
+			parts = append(parts, geminiPart{InlineData: &geminiInlineData{MimeType: mimeType, Data: data}})
+		}
+	}
+	return parts, nil
+}
+
+// parseDataURL splits "data:image/png;base64,...." into its MIME type and payload
+func parseDataURL(url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), data, true
+}
+
+// CreateChatCompletion sends the conversation to Gemini
+func (c *geminiClient) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	var body geminiRequest
+	for _, message := range request.Messages {
+		parts, err := geminiParts(message)
+		if err != nil {
+			return openai.ChatCompletionResponse{}, err
+		}
+		switch message.Role {
+		case openai.ChatMessageRoleSystem:
+			body.SystemInstruction = &geminiContent{Parts: parts}
+		case openai.ChatMessageRoleAssistant:
+			body.Contents = append(body.Contents, geminiContent{Role: "model", Parts: parts})
+		default:
+			body.Contents = append(body.Contents, geminiContent{Role: "user", Parts: parts})
+		}
+	}
+	if request.Temperature != 0 || request.TopP != 0 || request.MaxTokens > 0 || len(request.Stop) > 0 {
+		config := &geminiGenerationConfig{MaxOutputTokens: request.MaxTokens, StopSequences: request.Stop}
+		if request.Temperature != 0 {
+			config.Temperature = &request.Temperature
+		}
+		if request.TopP != 0 {
+			config.TopP = &request.TopP
+		}
+		body.GenerationConfig = config
+	}
+	data, err := encodeJSON(body, "")
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer putBuffer(data)
+
+	url := fmt.Sprintf("%s/models/%s:generateContent", geminiEndpoint, request.Model)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data.Bytes()))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", c.apiKey())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer resp.Body.Close()
+	raw, err := readPooled(resp.Body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer putBuffer(raw)
+
+	var out geminiResponse
+	if err := json.Unmarshal(raw.Bytes(), &out); err != nil {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("invalid gemini response (status %d): %w", resp.StatusCode, err)
+	}
+	if out.Error != nil {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("gemini error (status %d): %s", resp.StatusCode, out.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK || len(out.Candidates) == 0 {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("gemini returned no candidates (status %d)", resp.StatusCode)
+	}
+
+	var text strings.Builder
+	for _, part := range out.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return openai.ChatCompletionResponse{
+		Model: request.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text.String()},
+			FinishReason: openai.FinishReason(strings.ToLower(out.Candidates[0].FinishReason)),
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     out.UsageMetadata.PromptTokenCount,
+			CompletionTokens: out.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      out.UsageMetadata.TotalTokenCount,
+		},
+	}, nil
+}
+
+// Screenshots are rendered with a headless Chrome or Chromium binary,
+// named by CHROME_PATH, since the scraper itself does not render pages
+const chromePathEnv = "CHROME_PATH"
+
+// screenshotPath returns where a page's rendered screenshot is kept
+func (s *SiteScraper) screenshotPath(pageURL string) string {
+	return filepath.Join(s.downloadDir, "snapshots", urlKey(pageURL)+".png")
+}
+
+// screenshot renders pageURL to PNG, reusing the saved one when replaying.
+// Chrome fetches the page itself, so the URL is checked against the SSRF
+// policy first and everything the page loads goes through a policyProxy.
+func (s *SiteScraper) screenshot(ctx context.Context, pageURL string) ([]byte, error) {
+	path := s.screenshotPath(pageURL)
+	if s.replay {
+		return os.ReadFile(path)
+	}
+	chrome := os.Getenv(chromePathEnv)
+	if chrome == "" {
+		return nil, fmt.Errorf("%s is not set", chromePathEnv)
+	}
+	target, err := browserTarget(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	proxy, stop, err := startPolicyProxy(ssrfPolicy, scrapeTransport)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+	args := append(browserArgs(proxy), "--window-size=1280,4000", "--screenshot="+path, target)
+	cmd := exec.CommandContext(ctx, chrome, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("screenshot failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.ReadFile(path)
+}
+
+// imagePart embeds a PNG in a chat message as a data: URL
+func imagePart(png []byte) openai.ChatMessagePart {
+	return openai.ChatMessagePart{
+		Type:     openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)},
+	}
+}
@@ -3,12 +3,9 @@ module manager
 go 1.23.2
 
 require (
+	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/websocket v1.5.3
 	github.com/sashabaranov/go-openai v1.35.6
 	golang.org/x/net v0.31.0
 	golang.org/x/sync v0.9.0
 )
-
-require (
-	github.com/gorilla/mux v1.8.1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
-)
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Grounding statuses
+const (
+	groundingVerified   = "verified"
+	groundingUnverified = "unverified"
+)
+
+var (
+	digitsPattern   = regexp.MustCompile(`\d+`)
+	durationPattern = regexp.MustCompile(`(?i)\b(day|week|month|year)s?\b`)
+)
+
+// checkGrounding verifies that extracted product values literally appear in the
+// scraped content. Keys match those of the provenance map.
+func checkGrounding(result interface{}, content string) map[string]string {
+	info, ok := result.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	normalizedContent := normalizeForMatch(content)
+	grounding := make(map[string]string)
+
+	for _, field := range []string{"name", "model_number", "serial_number"} {
+		if value, ok := info[field].(string); ok && value != "NO_MATCH" && value != "" {
+			grounding[field] = groundingStatus(isGroundedText(normalizedContent, value))
+		}
+	}
+
+	if value, ok := info["warranty_info"].(string); ok && value != "NO_MATCH" && value != "" {
+		grounding["warranty_info"] = groundingStatus(isGroundedDuration(normalizedContent, value))
+	}
+
+	for _, field := range []string{"user_manual", "other_documents"} {
+		for _, link := range stringList(info[field]) {
+			grounding[field+":"+link] = groundingStatus(isGroundedURL(content, link))
+		}
+	}
+	return grounding
+}
+
+// unverifiedFields returns the sorted keys flagged as unverified
+func unverifiedFields(grounding map[string]string) []string {
+	var fields []string
+	for field, status := range grounding {
+		if status == groundingUnverified {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func groundingStatus(grounded bool) string {
+	if grounded {
+		return groundingVerified
+	}
+	return groundingUnverified
+}
+
+// normalizeForMatch lowercases and collapses whitespace
+func normalizeForMatch(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// isGroundedText matches the value directly, or ignoring separators for identifiers like "AB-123 X"
+func isGroundedText(normalizedContent, value string) bool {
+	normalizedValue := normalizeForMatch(value)
+	if strings.Contains(normalizedContent, normalizedValue) {
+		return true
+	}
+	return strings.Contains(stripSeparators(normalizedContent), stripSeparators(normalizedValue))
+}
+
+// isGroundedDuration accepts paraphrased warranty text as long as every number
+// and duration unit it mentions is present in the source.
+func isGroundedDuration(normalizedContent, value string) bool {
+	if isGroundedText(normalizedContent, value) {
+		return true
+	}
+	numbers := digitsPattern.FindAllString(value, -1)
+	units := durationPattern.FindAllStringSubmatch(value, -1)
+	if len(numbers) == 0 && len(units) == 0 {
+		return false
+	}
+	for _, n := range numbers {
+		if !regexp.MustCompile(`\b` + n + `\b`).MatchString(normalizedContent) {
+			return false
+		}
+	}
+	for _, unit := range units {
+		if !strings.Contains(normalizedContent, strings.ToLower(unit[1])) {
+			return false
+		}
+	}
+	return true
+}
+
+// isGroundedURL checks for the full URL, its path, or at least its file name in the raw content
+func isGroundedURL(content, link string) bool {
+	if strings.Contains(content, link) {
+		return true
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Path == "" {
+		return false
+	}
+	if strings.Contains(content, u.Path) {
+		return true
+	}
+	base := path.Base(u.Path)
+	return base != "/" && base != "." && strings.Contains(content, base)
+}
+
+func stripSeparators(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_', '.', '/':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// stringList converts the list shapes produced by the LLM merge into []string
+func stringList(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		var out []string
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		if list != "" && list != "NO_MATCH" {
+			return []string{list}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// withParser points processURL at a fake parser answering every request with response
+func withParser(t *testing.T, response ParseResponse) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	previous := parserURL
+	parserURL = server.URL
+	t.Cleanup(func() { parserURL = previous })
+}
+
+// savedResult reads the parse_results.json processURL wrote for a model
+func savedResult(t *testing.T, baseDir, modelNumber string) ParseResponse {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(modelDirFor(baseDir, modelNumber), "results", "parse_results.json"))
+	if err != nil {
+		t.Fatalf("reading saved result: %v", err)
+	}
+	var saved ParseResponse
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("decoding saved result: %v", err)
+	}
+	return saved
+}
+
+func TestProcessURLFlagsUngroundedValues(t *testing.T) {
+	withParser(t, ParseResponse{
+		Status: "success",
+		GeminiResult: map[string]interface{}{
+			"name":          "Widget Pro",
+			"model_number":  "AB-123",
+			"warranty_info": "5 years",
+		},
+		RawContent: "The Widget Pro (model AB 123) comes with a 2 year warranty.",
+	})
+
+	baseDir := t.TempDir()
+	job := BatchJob{URL: "https://example.com/widget", ModelNumber: "AB-123"}
+	if err := job.processURL(context.Background(), baseDir); err != nil {
+		t.Fatalf("processURL: %v", err)
+	}
+
+	want := []string{"warranty_info"}
+	if !reflect.DeepEqual(job.UnverifiedFields, want) {
+		t.Errorf("job unverified fields = %v, want %v", job.UnverifiedFields, want)
+	}
+	saved := savedResult(t, baseDir, "AB-123")
+	if !reflect.DeepEqual(saved.UnverifiedFields, want) {
+		t.Errorf("saved unverified fields = %v, want %v", saved.UnverifiedFields, want)
+	}
+	if saved.Grounding["model_number"] != groundingVerified || saved.Grounding["warranty_info"] != groundingUnverified {
+		t.Errorf("saved grounding = %v", saved.Grounding)
+	}
+}
+
+func TestProcessURLKeepsParserGrounding(t *testing.T) {
+	withParser(t, ParseResponse{
+		Status:           "success",
+		GeminiResult:     map[string]interface{}{"name": "Widget Pro"},
+		Grounding:        map[string]string{"name": groundingUnverified},
+		UnverifiedFields: []string{"name"},
+		RawContent:       "Widget Pro",
+	})
+
+	baseDir := t.TempDir()
+	job := BatchJob{URL: "https://example.com/widget", ModelNumber: "AB-124"}
+	if err := job.processURL(context.Background(), baseDir); err != nil {
+		t.Fatalf("processURL: %v", err)
+	}
+
+	saved := savedResult(t, baseDir, "AB-124")
+	if !reflect.DeepEqual(saved.UnverifiedFields, []string{"name"}) || saved.Grounding["name"] != groundingUnverified {
+		t.Errorf("parser's grounding was not kept: %v %v", saved.Grounding, saved.UnverifiedFields)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// defaultHeaderAliases maps column names used in non-English uploads to the
+// columns the pipeline reads. HEADER_ALIASES_FILE, a JSON object of the same
+// shape, extends it for a deployment and the upload's header_aliases for one
+// batch.
+var defaultHeaderAliases = map[string][]string{
+	"url": {
+		"url-adresse", "webadresse", "internetadresse", "link", // German
+		"adresse url", "lien", // French
+		"enlace", "dirección url", // Spanish
+		"indirizzo", "collegamento", // Italian
+		"webadres", "koppeling", // Dutch
+		"page url", "product url",
+	},
+	"model_number": {
+		"modellnummer", "modell-nr", "modellnr", "modell", "typennummer", // German
+		"numéro de modèle", "numero de modele", "modèle", "référence modèle", // French
+		"número de modelo", "numero de modelo", "modelo", // Spanish
+		"numero di modello", "numero modello", "modello", // Italian
+		"modelnummer", "typenummer", // Dutch
+		"model", "model no", "model nr", "model #",
+	},
+	"parse_description": {
+		"beschreibung", "descripción", "descrizione", "omschrijving",
+	},
+}
+
+// deploymentHeaderAliases is the default table extended from HEADER_ALIASES_FILE
+var deploymentHeaderAliases = loadHeaderAliases(os.Getenv("HEADER_ALIASES_FILE"))
+
+func loadHeaderAliases(path string) map[string][]string {
+	if path == "" {
+		return defaultHeaderAliases
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Ignoring HEADER_ALIASES_FILE: %v", err)
+		return defaultHeaderAliases
+	}
+	var extra map[string][]string
+	if err := json.Unmarshal(data, &extra); err != nil {
+		log.Printf("Ignoring HEADER_ALIASES_FILE: %v", err)
+		return defaultHeaderAliases
+	}
+	return mergeHeaderAliases(defaultHeaderAliases, extra)
+}
+
+// mergeHeaderAliases returns base with the aliases of extra added
+func mergeHeaderAliases(base, extra map[string][]string) map[string][]string {
+	merged := make(map[string][]string, len(base)+len(extra))
+	for column, aliases := range base {
+		merged[column] = append([]string(nil), aliases...)
+	}
+	for column, aliases := range extra {
+		column = normalizeHeader(column)
+		merged[column] = append(merged[column], aliases...)
+	}
+	return merged
+}
+
+// aliasKey compares header names without case, surrounding space or the
+// separators spreadsheet users vary: "Modell-Nr." matches "modell nr"
+func aliasKey(header string) string {
+	header = normalizeHeader(header)
+	header = strings.NewReplacer("_", " ", "-", " ", ".", " ", ":", " ").Replace(header)
+	return strings.Join(strings.Fields(header), " ")
+}
+
+// canonicalHeaders renames an upload's headers to the columns the pipeline
+// reads. The explicit mapping of upload header to column wins; otherwise a
+// header matching an alias takes the alias's column, unless the upload also
+// has that column under its own name. Other headers are kept as they are.
+func canonicalHeaders(headers []string, mapping map[string]string, aliases map[string][]string) ([]string, error) {
+	byAlias := make(map[string]string)
+	for column, names := range aliases {
+		for _, name := range names {
+			byAlias[aliasKey(name)] = column
+		}
+	}
+	byMapping := make(map[string]string, len(mapping))
+	for header, column := range mapping {
+		byMapping[aliasKey(header)] = normalizeHeader(column)
+	}
+	present := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		present[normalizeHeader(header)] = true
+	}
+
+	renamed := make([]string, len(headers))
+	source := make(map[string]string) // Column to the upload header it was taken from
+	for i, header := range headers {
+		renamed[i] = header
+		column, mapped := byMapping[aliasKey(header)]
+		if !mapped {
+			alias, ok := byAlias[aliasKey(header)]
+			if !ok || present[alias] {
+				if name := normalizeHeader(header); aliases[name] != nil || isMappingTarget(mapping, name) {
+					column = name // A pipeline column under its own name
+				} else {
+					continue
+				}
+			} else {
+				column = alias
+			}
+		}
+		if previous, ok := source[column]; ok {
+			return nil, fmt.Errorf("columns %q and %q both map to %s", previous, header, column)
+		}
+		source[column] = header
+		if column != normalizeHeader(header) {
+			renamed[i] = column
+		}
+	}
+	return renamed, nil
+}
+
+func isMappingTarget(mapping map[string]string, column string) bool {
+	for _, target := range mapping {
+		if normalizeHeader(target) == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PreScrapeHook runs before a job's page is requested. It may rewrite
+// job.URL or job.Metadata; returning an error fails the job.
+type PreScrapeHook interface {
+	BeforeScrape(ctx context.Context, job *BatchJob) error
+}
+
+// PostExtractHook runs after extraction and schema validation. It receives
+// the extracted result and returns the (possibly enriched) result to keep.
+type PostExtractHook interface {
+	AfterExtract(ctx context.Context, job *BatchJob, result interface{}) (interface{}, error)
+}
+
+// PreExportHook runs once per batch before batch-level exports are written
+type PreExportHook interface {
+	BeforeExport(ctx context.Context, bp *BatchProcess) error
+}
+
+// hookRegistry holds the hooks registered at startup
+type hookRegistry struct {
+	mu          sync.RWMutex
+	preScrape   []PreScrapeHook
+	postExtract []PostExtractHook
+	preExport   []PreExportHook
+}
+
+var hooks = &hookRegistry{}
+
+// RegisterHook adds a hook implementing one or more of the hook interfaces.
+// Deployments call it from an init function in their own file, so custom
+// logic can be added without changing the pipeline.
+func RegisterHook(hook interface{}) error {
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+
+	registered := false
+	if h, ok := hook.(PreScrapeHook); ok {
+		hooks.preScrape = append(hooks.preScrape, h)
+		registered = true
+	}
+	if h, ok := hook.(PostExtractHook); ok {
+		hooks.postExtract = append(hooks.postExtract, h)
+		registered = true
+	}
+	if h, ok := hook.(PreExportHook); ok {
+		hooks.preExport = append(hooks.preExport, h)
+		registered = true
+	}
+	if !registered {
+		return fmt.Errorf("%T implements no hook interface", hook)
+	}
+	return nil
+}
+
+// beforeScrape runs every pre-scrape hook in registration order
+func (r *hookRegistry) beforeScrape(ctx context.Context, job *BatchJob) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, hook := range r.preScrape {
+		if err := hook.BeforeScrape(ctx, job); err != nil {
+			return newJobError(errCodeHook, "pre-scrape hook %T: %v", hook, err)
+		}
+	}
+	return nil
+}
+
+// afterExtract passes the result through every post-extract hook in registration order
+func (r *hookRegistry) afterExtract(ctx context.Context, job *BatchJob, result interface{}) (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, hook := range r.postExtract {
+		var err error
+		if result, err = hook.AfterExtract(ctx, job, result); err != nil {
+			return result, newJobError(errCodeHook, "post-extract hook %T: %v", hook, err)
+		}
+	}
+	return result, nil
+}
+
+// beforeExport runs every pre-export hook, stopping at the first error
+func (r *hookRegistry) beforeExport(ctx context.Context, bp *BatchProcess) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, hook := range r.preExport {
+		if err := hook.BeforeExport(ctx, bp); err != nil {
+			return fmt.Errorf("pre-export hook %T: %v", hook, err)
+		}
+	}
+	return nil
+}
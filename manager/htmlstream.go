@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	maxHTMLBytes    int64 = 32 << 20 // Raw HTML read from a single page before the download is cut off
+	maxContentBytes       = 2 << 20  // Extracted text kept from a single page
+	maxJSONLDBytes        = 1 << 20  // JSON-LD kept from a single page
+)
+
+// PageLimits are a batch's caps on what is read from each page. Zero fields
+// take the defaults above.
+type PageLimits struct {
+	MaxPageBytes    int64 `json:"max_page_bytes,omitempty"`
+	MaxContentBytes int   `json:"max_content_bytes,omitempty"`
+
+	// Download pre-checks, see precheck.go
+	DisableHeadCheck bool  `json:"disable_head_check,omitempty"`
+	SkipOversize     bool  `json:"skip_oversize,omitempty"`
+	MaxDocumentBytes int64 `json:"max_document_bytes,omitempty"`
+}
+
+// pageLimits converts an upload's size settings to the limits its jobs carry
+func (c Config) pageLimits() PageLimits {
+	return PageLimits{
+		MaxPageBytes:     int64(c.MaxPageMB) << 20,
+		MaxContentBytes:  c.MaxContentKB << 10,
+		DisableHeadCheck: c.DisableHeadCheck,
+		SkipOversize:     c.SkipOversizePages,
+		MaxDocumentBytes: int64(c.MaxDocumentMB) << 20,
+	}
+}
+
+// pageBytes is the raw HTML read from a page before the download is cut off
+func (l PageLimits) pageBytes() int64 {
+	if l.MaxPageBytes > 0 {
+		return l.MaxPageBytes
+	}
+	return maxHTMLBytes
+}
+
+// contentBytes is the extracted text kept from a page
+func (l PageLimits) contentBytes() int {
+	if l.MaxContentBytes > 0 {
+		return l.MaxContentBytes
+	}
+	return maxContentBytes
+}
+
+// truncationMarker is appended to a page's text when a size cap was hit
+const truncationMarker = "[... content truncated ...]"
+
+// pageLink is an anchor found while tokenizing a page
+type pageLink struct {
+	Href string
+	Text string
+	Rel  string // e.g. "next" on pagination links
+	// Related-products section the anchor is in, a relation constant
+	Relation string
+}
+
+// pageContent is what a streamed page is reduced to. The raw HTML is never held in memory.
+type pageContent struct {
+	Title  string     // Text of the <title> element
+	Texts  []string   // Visible text nodes in document order
+	Links  []pageLink // Anchors in document order
+	Images []string   // img src attributes
+	// Images with alt or title text, which names logos such as certification marks
+	ImageLabels []pageLink
+	// Sources of iframes, videos and other embedded players, named by their title attribute
+	Embeds    []pageLink
+	Truncated bool
+	HTMLBytes int64
+
+	// Structured data embedded in the page: JSON-LD blocks, OpenGraph and
+	// product meta tags, and microdata properties (first value of each)
+	JSONLD    []string
+	Meta      map[string]string
+	Microdata map[string]string
+	// An itemtype of schema.org Product was seen, so microdata describes a product
+	ProductMicrodata bool
+	// Password inputs on the page, a sign of a login form
+	PasswordFields int
+	// ETag and Last-Modified the page was served with
+	Validators *PageValidators
+	// Data and spec tables; their cells are in Texts as well
+	Tables []PageTable
+	// Text of the page's breadcrumb trail, separators left out
+	Breadcrumbs []string
+}
+
+// text joins the page's text nodes
+func (c *pageContent) text() string {
+	return strings.Join(c.Texts, " ")
+}
+
+// groundingText returns the text plus every link target, for checking extracted values against the page
+func (c *pageContent) groundingText() string {
+	var b strings.Builder
+	b.WriteString(c.text())
+	for _, link := range c.Links {
+		b.WriteString("\n")
+		b.WriteString(link.Href)
+	}
+	return b.String()
+}
+
+// countingReader tracks how many bytes were consumed from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamHTML tokenizes HTML from r without building a DOM, keeping at most
+// maxHTML bytes of input and maxText bytes of visible text
+func streamHTML(r io.Reader, maxHTML int64, maxText int) (*pageContent, error) {
+	counter := &countingReader{r: io.LimitReader(r, maxHTML+1)}
+	tokenizer := html.NewTokenizer(counter)
+	page := &pageContent{}
+
+	textBytes := 0
+	skipDepth := 0 // Inside <script>, <style> or <noscript>
+	var anchor *pageLink
+	var anchorText strings.Builder
+	inJSONLD := false
+	jsonLDBytes := 0
+	itemprop := "" // Microdata property waiting for its text
+	inTitle := false
+	var tables tableStack
+	var crumbs breadcrumbTracker
+	var sections sectionTracker
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			page.HTMLBytes = counter.n
+			if err := tokenizer.Err(); err != io.EOF {
+				return page, fmt.Errorf("failed to tokenize HTML: %w", err)
+			}
+			if counter.n > maxHTML {
+				page.HTMLBytes = maxHTML
+				page.truncate()
+			}
+			return page, nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			page.collectStructured(token, &itemprop)
+			tables.tag(token, page, len(page.Texts))
+			crumbs.start(token)
+			sections.start(token)
+			switch token.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript:
+				if token.Type == html.StartTagToken {
+					skipDepth++
+					inJSONLD = token.DataAtom == atom.Script && strings.EqualFold(attr(token, "type"), "application/ld+json")
+				}
+			case atom.A:
+				if href := attr(token, "href"); href != "" {
+					anchor = &pageLink{Href: href, Rel: attr(token, "rel"), Relation: sections.relation()}
+					anchorText.Reset()
+				}
+			case atom.Link:
+				// <link rel="next"> in the head marks paginated listings
+				if rel, href := attr(token, "rel"), attr(token, "href"); href != "" && strings.EqualFold(rel, "next") {
+					page.Links = append(page.Links, pageLink{Href: href, Rel: rel})
+				}
+			case atom.Img:
+				if src := attr(token, "src"); src != "" {
+					page.Images = append(page.Images, src)
+				}
+				if label := strings.TrimSpace(attr(token, "alt") + " " + attr(token, "title")); label != "" {
+					page.ImageLabels = append(page.ImageLabels, pageLink{Href: attr(token, "src"), Text: label})
+				}
+			case atom.Iframe, atom.Video, atom.Source, atom.Embed, atom.Object:
+				src := attr(token, "src")
+				if token.DataAtom == atom.Object {
+					src = attr(token, "data")
+				}
+				if src != "" {
+					page.Embeds = append(page.Embeds, pageLink{Href: src, Text: attr(token, "title")})
+				}
+			case atom.Title:
+				inTitle = token.Type == html.StartTagToken && page.Title == ""
+			case atom.Input:
+				if strings.EqualFold(attr(token, "type"), "password") {
+					page.PasswordFields++
+				}
+			}
+
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			tables.tag(token, page, len(page.Texts))
+			crumbs.end(token, page)
+			sections.end(token)
+			switch token.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript:
+				if skipDepth > 0 {
+					skipDepth--
+				}
+				inJSONLD = false
+			case atom.Title:
+				inTitle = false
+			case atom.A:
+				if anchor != nil {
+					anchor.Text = strings.TrimSpace(anchorText.String())
+					page.Links = append(page.Links, *anchor)
+					anchor = nil
+				}
+			}
+
+		case html.TextToken:
+			if skipDepth > 0 {
+				if inJSONLD && jsonLDBytes < maxJSONLDBytes {
+					block := string(tokenizer.Text())
+					jsonLDBytes += len(block)
+					page.JSONLD = append(page.JSONLD, block)
+				}
+				continue
+			}
+			text := strings.TrimSpace(string(tokenizer.Text()))
+			if text == "" {
+				continue
+			}
+			if inTitle {
+				page.Title = text
+			}
+			if itemprop != "" {
+				page.setMicrodata(itemprop, text)
+				itemprop = ""
+			}
+			tables.text(text)
+			crumbs.text(text)
+			sections.text(text)
+			if anchor != nil && anchorText.Len() < 200 {
+				anchorText.WriteString(text)
+				anchorText.WriteString(" ")
+			}
+			if page.Truncated {
+				continue
+			}
+			if textBytes+len(text) > maxText {
+				page.truncate()
+				continue
+			}
+			textBytes += len(text)
+			page.Texts = append(page.Texts, text)
+		}
+	}
+}
+
+// collectStructured records meta tags and microdata properties from a start
+// tag. A property without a value attribute takes the next text node.
+func (c *pageContent) collectStructured(token html.Token, itemprop *string) {
+	if token.DataAtom == atom.Meta {
+		key := attr(token, "property")
+		if key == "" {
+			key = attr(token, "name")
+		}
+		key = strings.ToLower(key)
+		if content := attr(token, "content"); content != "" && (strings.HasPrefix(key, "og:") || strings.HasPrefix(key, "product:")) {
+			if c.Meta == nil {
+				c.Meta = make(map[string]string)
+			}
+			if _, exists := c.Meta[key]; !exists {
+				c.Meta[key] = content
+			}
+		}
+	}
+
+	if itemType := attr(token, "itemtype"); strings.HasSuffix(strings.TrimRight(itemType, "/"), "schema.org/Product") {
+		c.ProductMicrodata = true
+	}
+	prop := attr(token, "itemprop")
+	if prop == "" || hasAttr(token, "itemscope") {
+		return
+	}
+	for _, key := range []string{"content", "href", "src"} {
+		if value := attr(token, key); value != "" {
+			c.setMicrodata(prop, value)
+			return
+		}
+	}
+	*itemprop = prop
+}
+
+// setMicrodata keeps the first value seen for a microdata property
+func (c *pageContent) setMicrodata(prop, value string) {
+	if c.Microdata == nil {
+		c.Microdata = make(map[string]string)
+	}
+	if _, exists := c.Microdata[prop]; !exists {
+		c.Microdata[prop] = value
+	}
+}
+
+// hasAttr reports whether the tag carries the attribute, even without a value
+func hasAttr(token html.Token, key string) bool {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate marks the page as cut short, adding the marker to its text once
+func (c *pageContent) truncate() {
+	if c.Truncated {
+		return
+	}
+	c.Truncated = true
+	c.Texts = append(c.Texts, truncationMarker)
+}
+
+// attr returns the value of the named attribute
+func attr(token html.Token, key string) string {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var jobLogLines = 200 // Log lines kept per job; older lines are dropped
+
+// JobLogLine is one line of a job's log
+type JobLogLine struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// jobLog is a ring buffer of one job's log lines. It is shared by the copies
+// of the job passed between workers, so it has its own lock.
+type jobLog struct {
+	mu      sync.Mutex
+	lines   []JobLogLine
+	next    int // Slot the next line is written to once the buffer is full
+	dropped int // Lines overwritten since the job started
+}
+
+func (l *jobLog) add(message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	line := JobLogLine{Time: time.Now(), Message: message}
+	if len(l.lines) < jobLogLines {
+		l.lines = append(l.lines, line)
+		return
+	}
+	l.lines[l.next] = line
+	l.next = (l.next + 1) % len(l.lines)
+	l.dropped++
+}
+
+// snapshot returns the kept lines, oldest first, and how many were dropped
+func (l *jobLog) snapshot() ([]JobLogLine, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := make([]JobLogLine, 0, len(l.lines))
+	lines = append(lines, l.lines[l.next:]...)
+	lines = append(lines, l.lines[:l.next]...)
+	return lines, l.dropped
+}
+
+// logf writes a line to the server log, prefixed with the job's index, and to
+// the job's own log when it has one
+func (job *BatchJob) logf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Printf("Job %d: %s", job.Index, message)
+	if job.log != nil {
+		job.log.add(message)
+	}
+}
+
+// jobLog returns the log of the job at index, creating it on first use
+func (bp *BatchProcess) jobLog(index int) *jobLog {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if bp.jobLogs == nil {
+		bp.jobLogs = make(map[int]*jobLog)
+	}
+	l, ok := bp.jobLogs[index]
+	if !ok {
+		l = &jobLog{}
+		bp.jobLogs[index] = l
+	}
+	return l
+}
+
+// handleJobLogs returns the log lines of one job: retries, stage transitions
+// and warnings. ?format=text returns them as plain text, one per line.
+func handleJobLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	batchID := vars["batch_id"]
+	process, exists := processes.get(batchID)
+	if !exists {
+		batchGC.notFound(w, batchID)
+		return
+	}
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		http.Error(w, "Invalid job index", http.StatusBadRequest)
+		return
+	}
+
+	process.mu.Lock()
+	if index < 0 || index >= len(process.Jobs) {
+		process.mu.Unlock()
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	job := process.Jobs[index]
+	l := process.jobLogs[index]
+	process.mu.Unlock()
+
+	var lines []JobLogLine
+	var dropped int
+	if l != nil {
+		lines, dropped = l.snapshot()
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		var b strings.Builder
+		if dropped > 0 {
+			fmt.Fprintf(&b, "(%d earlier lines dropped)\n", dropped)
+		}
+		for _, line := range lines {
+			fmt.Fprintf(&b, "%s %s\n", line.Time.Format(time.RFC3339Nano), line.Message)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(b.String()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Index   int          `json:"index"`
+		URL     string       `json:"url"`
+		Status  string       `json:"status"`
+		Dropped int          `json:"dropped,omitempty"`
+		Lines   []JobLogLine `json:"lines"`
+	}{job.Index, job.URL, job.Status, dropped, lines})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// languageNames expands common ISO 639-1 codes so the prompt names the language explicitly
+var languageNames = map[string]string{
+	"en": "English",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"sv": "Swedish",
+	"ja": "Japanese",
+	"zh": "Chinese",
+	"ko": "Korean",
+}
+
+// languageName returns a readable language name for a code or name
+func languageName(language string) string {
+	language = strings.TrimSpace(language)
+	if name, ok := languageNames[strings.ToLower(language)]; ok {
+		return name
+	}
+	return language
+}
+
+// withOutputLanguage appends an instruction to answer free-text fields in
+// language, leaving identifiers, URLs and JSON keys untouched
+func withOutputLanguage(prompt, language string) string {
+	if strings.TrimSpace(language) == "" {
+		return prompt
+	}
+	return prompt + fmt.Sprintf(`
+		Write every free-text value (such as warranty information and descriptions) in %s,
+		translating from the page's language if needed. Do not translate JSON keys, model
+		numbers, serial numbers, URLs or "NO_MATCH".
+	`, languageName(language))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lifecycle statuses of a scraped product
+const (
+	lifecycleCurrent      = "current"
+	lifecycleDiscontinued = "discontinued"
+	lifecycleReplaced     = "replaced" // Discontinued with a named successor
+)
+
+// Where a lifecycle status was read from, most trusted first
+const (
+	lifecycleFromExtraction = "extraction"
+	lifecycleFromStructured = "structured_data"
+	lifecycleFromPageText   = "page_text"
+)
+
+// ProductLifecycle says whether the page marks the product as current,
+// discontinued or replaced, with the successor model when the page names one
+type ProductLifecycle struct {
+	Status    string `json:"status"`
+	Successor string `json:"successor,omitempty"`
+	Source    string `json:"source,omitempty"`   // Empty for current products, which carry no marker
+	Evidence  string `json:"evidence,omitempty"` // The text the status was read from
+}
+
+var (
+	discontinuedMarkerPattern = regexp.MustCompile(`(?i)\b(discontinued|end[ -]of[ -]life|\bEOL\b|no longer (manufactured|produced|made|in production|sold|supported)|out of production|obsolete)\b`)
+	// The successor must look like a model number: a token with a digit in it
+	successorPattern       = regexp.MustCompile(`(?i:replaced by|superseded by|succeeded by|successor(?: model| product)?(?: is)?:?|replacement(?: model| product)?(?: is)?:?|new(?:er)? (?:model|version)(?: is)?:?)\s+(?:the\s+)?(?:new\s+)?(?:model\s+)?([A-Za-z0-9][A-Za-z0-9\-./]*\d[A-Za-z0-9\-./]*)`)
+	lifecycleFieldKeywords = []string{"lifecycle", "discontinued", "successor", "replacement", "replaced_by", "superseded"}
+)
+
+// detectLifecycle reads the product's lifecycle from the extraction, the
+// page's structured data and the beginning of its text, in that order.
+// Products without any marker are current.
+func detectLifecycle(extraction interface{}, structured *StructuredProduct, text, modelNumber string) *ProductLifecycle {
+	if lifecycle := lifecycleFromFields(extraction, modelNumber); lifecycle != nil {
+		return lifecycle
+	}
+	if structured != nil && strings.EqualFold(structured.Availability, "Discontinued") {
+		lifecycle := &ProductLifecycle{Status: lifecycleDiscontinued, Source: lifecycleFromStructured, Evidence: structured.Availability}
+		// The page may still name the successor in its text
+		if successor, evidence := findSuccessor(leadingText(text, shortPageChars*4), modelNumber); successor != "" {
+			lifecycle.Status, lifecycle.Successor, lifecycle.Evidence = lifecycleReplaced, successor, evidence
+		}
+		return lifecycle
+	}
+	if lifecycle := lifecycleFromText(leadingText(text, shortPageChars*4), lifecycleFromPageText, modelNumber); lifecycle != nil {
+		return lifecycle
+	}
+	return &ProductLifecycle{Status: lifecycleCurrent}
+}
+
+// lifecycleFromFields looks for lifecycle fields in the extraction, such as
+// the lifecycle_status and successor_model the default prompt asks for
+func lifecycleFromFields(extraction interface{}, modelNumber string) *ProductLifecycle {
+	info, ok := extraction.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	fields := make([]string, 0, len(info))
+	for field := range info {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var texts []string
+	for _, field := range fields {
+		raw, ok := info[field].(string)
+		if !ok || raw == "" || raw == "NO_MATCH" {
+			continue
+		}
+		lower := strings.ToLower(field)
+		for _, keyword := range lifecycleFieldKeywords {
+			if !strings.Contains(lower, keyword) {
+				continue
+			}
+			// A bare model number in a successor field names the successor
+			if strings.Contains(lower, "successor") || strings.Contains(lower, "replace") || strings.Contains(lower, "superseded") {
+				if model := strings.TrimSpace(raw); isModelToken(model) && !sameModel(model, modelNumber) {
+					return &ProductLifecycle{Status: lifecycleReplaced, Successor: model, Source: lifecycleFromExtraction, Evidence: raw}
+				}
+			}
+			texts = append(texts, raw)
+			break
+		}
+	}
+	for _, raw := range texts {
+		if strings.EqualFold(strings.TrimSpace(raw), lifecycleCurrent) || strings.EqualFold(strings.TrimSpace(raw), "active") {
+			return &ProductLifecycle{Status: lifecycleCurrent, Source: lifecycleFromExtraction, Evidence: raw}
+		}
+		if lifecycle := lifecycleFromText(raw, lifecycleFromExtraction, modelNumber); lifecycle != nil {
+			return lifecycle
+		}
+		// "replaced" without a successor says no more than discontinued
+		if strings.EqualFold(strings.TrimSpace(raw), lifecycleReplaced) {
+			return &ProductLifecycle{Status: lifecycleDiscontinued, Source: lifecycleFromExtraction, Evidence: raw}
+		}
+	}
+	return nil
+}
+
+// lifecycleFromText finds a successor or discontinuation marker in text
+func lifecycleFromText(text, source, modelNumber string) *ProductLifecycle {
+	if successor, evidence := findSuccessor(text, modelNumber); successor != "" {
+		return &ProductLifecycle{Status: lifecycleReplaced, Successor: successor, Source: source, Evidence: evidence}
+	}
+	if loc := discontinuedMarkerPattern.FindStringIndex(text); loc != nil {
+		return &ProductLifecycle{Status: lifecycleDiscontinued, Source: source, Evidence: snippetAround(text, loc[0], loc[1])}
+	}
+	return nil
+}
+
+// findSuccessor returns the model named as the product's successor, skipping
+// mentions of the product itself
+func findSuccessor(text, modelNumber string) (string, string) {
+	for _, match := range successorPattern.FindAllStringSubmatchIndex(text, -1) {
+		successor := strings.TrimRight(text[match[2]:match[3]], ".-/")
+		if isModelToken(successor) && !sameModel(successor, modelNumber) {
+			return successor, snippetAround(text, match[0], match[1])
+		}
+	}
+	return "", ""
+}
+
+// isModelToken reports whether s looks like a single model number
+func isModelToken(s string) bool {
+	return s != "" && len(s) <= 40 && !strings.ContainsAny(s, " \t\n") && strings.ContainsAny(s, "0123456789")
+}
+
+// sameModel compares model numbers the way mentionsModel does
+func sameModel(a, b string) bool {
+	return b != "" && strings.EqualFold(modelNumberStrip.Replace(a), modelNumberStrip.Replace(b))
+}
+
+// snippetAround returns the match with a little context, for the evidence field
+func snippetAround(text string, start, end int) string {
+	const context = 60
+	from, to := max(0, start-context), min(len(text), end+context)
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+	return strings.TrimSpace(text[from:to])
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// DiscoveredLink is an anchor found on a scraped page, whether or not it was followed
+type DiscoveredLink struct {
+	PageURL  string `json:"page_url"`
+	URL      string `json:"url"`
+	Text     string `json:"text,omitempty"`
+	Internal bool   `json:"internal"` // Same host as the page
+	Document bool   `json:"document"` // Looks like a downloadable document
+	Followed bool   `json:"followed"` // Was downloaded or scraped as part of this job
+}
+
+// LinkCounts summarizes the links discovered on a page
+type LinkCounts struct {
+	Total     int `json:"total"`
+	Internal  int `json:"internal"`
+	External  int `json:"external"`
+	Documents int `json:"documents"`
+	Followed  int `json:"followed"`
+}
+
+// collectLinks resolves a page's anchors against its URL, dropping fragments,
+// non-HTTP schemes and duplicates. Links in followed are marked as followed.
+func collectLinks(pageURL string, anchors []pageLink, followed []string) []DiscoveredLink {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	followedSet := make(map[string]bool, len(followed))
+	for _, link := range followed {
+		followedSet[link] = true
+	}
+
+	seen := make(map[string]bool)
+	var links []DiscoveredLink
+	for _, anchor := range anchors {
+		ref, err := url.Parse(anchor.Href)
+		if err != nil {
+			continue
+		}
+		resolved := base.ResolveReference(ref)
+		resolved.Fragment = ""
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			continue
+		}
+		target := resolved.String()
+		if target == base.String() || seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		links = append(links, DiscoveredLink{
+			PageURL:  pageURL,
+			URL:      target,
+			Text:     anchor.Text,
+			Internal: strings.EqualFold(resolved.Host, base.Host),
+			Document: hasSuffix(strings.ToLower(resolved.Path), documentExtensions),
+			Followed: followedSet[target],
+		})
+	}
+	return links
+}
+
+// documentExtensions marks links that point at downloadable documents
+var documentExtensions = []string{".pdf", ".docx", ".doc", ".zip"}
+
+// countLinks tallies discovered links for the result summary
+func countLinks(links []DiscoveredLink) LinkCounts {
+	counts := LinkCounts{Total: len(links)}
+	for _, link := range links {
+		if link.Internal {
+			counts.Internal++
+		} else {
+			counts.External++
+		}
+		if link.Document {
+			counts.Documents++
+		}
+		if link.Followed {
+			counts.Followed++
+		}
+	}
+	return counts
+}
+
+// writeLinksJSONL writes one discovered link per line to links.jsonl in dir
+func writeLinksJSONL(dir string, links []DiscoveredLink) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, link := range links {
+		if err := encoder.Encode(link); err != nil {
+			return fmt.Errorf("failed to encode link: %v", err)
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "links.jsonl"), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write links: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// LLMParams tunes the model's sampling for every extraction request. Unset
+// fields keep the provider's defaults.
+type LLMParams struct {
+	Temperature  *float32 `json:"temperature,omitempty"`
+	TopP         *float32 `json:"top_p,omitempty"`
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	Stop         []string `json:"stop,omitempty"`
+	SystemPrompt string   `json:"system_prompt,omitempty"`
+}
+
+// validate rejects values the providers would refuse
+func (p LLMParams) validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if p.TopP != nil && (*p.TopP < 0 || *p.TopP > 1) {
+		return fmt.Errorf("top_p must be between 0 and 1")
+	}
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if len(p.Stop) > 4 {
+		return fmt.Errorf("at most 4 stop sequences are supported")
+	}
+	return nil
+}
+
+// set reports whether any parameter differs from the provider defaults
+func (p LLMParams) set() bool {
+	return p.Temperature != nil || p.TopP != nil || p.MaxTokens > 0 || len(p.Stop) > 0 || p.SystemPrompt != ""
+}
+
+// chatRequest builds a request for the configured model with the configured parameters
+func (p *UnifiedParser) chatRequest(messages ...openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	params := p.config.LLM
+	if params.SystemPrompt != "" {
+		messages = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: params.SystemPrompt}}, messages...)
+	}
+	req := openai.ChatCompletionRequest{
+		Model:     p.config.ModelName,
+		Messages:  messages,
+		MaxTokens: params.MaxTokens,
+		Stop:      params.Stop,
+	}
+	if params.Temperature != nil {
+		// The client omits a zero temperature, which would fall back to the default of 1
+		req.Temperature = max(*params.Temperature, math.SmallestNonzeroFloat32)
+	}
+	if params.TopP != nil {
+		req.TopP = max(*params.TopP, math.SmallestNonzeroFloat32)
+	}
+	return req
+}
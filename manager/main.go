@@ -1,506 +1,1731 @@
-package main
-
-import (
-	"encoding/csv"
-	"encoding/json"
-	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
-)
-
-// Global variables for configuration
-var (
-	numWorkers = 5                 // Default number of workers
-	timeout    = time.Second * 180 // Default timeout
-	processes  = make(map[string]*BatchProcess)
-	upgrader   = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for development
-		},
-	}
-)
-
-// BatchJob represents a single URL processing job
-type BatchJob struct {
-	ModelNumber      string  `json:"model_number"`
-	URL              string  `json:"url"`
-	Status           string  `json:"status"`
-	Error            string  `json:"error,omitempty"`
-	Progress         int     `json:"progress"`
-	ParseDescription *string `json:"parse_description,omitempty"`
-}
-
-// BatchProcess represents the entire batch processing request
-type BatchProcess struct {
-	ID        string      `json:"id"`
-	Jobs      []BatchJob  `json:"jobs"`
-	Status    string      `json:"status"`
-	Progress  int         `json:"progress"`
-	StartTime time.Time   `json:"start_time"`
-	EndTime   time.Time   `json:"end_time,omitempty"`
-	mu        sync.Mutex  // For thread-safe updates
-	clients   []chan bool // For WebSocket updates
-}
-
-type ParseRequest struct {
-	URL              string  `json:"url"`
-	ModelNumber      string  `json:"model_number"`
-	ParseDescription *string `json:"parse_description,omitempty"`
-	MinConfidence    float64 `json:"min_confidence,omitempty"`
-	ShowAllImages    bool    `json:"show_all_images,omitempty"`
-}
-
-type ImageMatch struct {
-	URL        string  `json:"url"`
-	Confidence float64 `json:"confidence"`
-	Context    string  `json:"context"`
-}
-
-type ParseResponse struct {
-	SiteID          string                 `json:"site_id"`
-	ContentAnalysis map[string]interface{} `json:"content_analysis"`
-	ImageMatches    []ImageMatch           `json:"image_matches"`
-	DownloadedFiles []string               `json:"downloaded_files"`
-	PDFLinks        []string               `json:"pdf_links"`
-	GeminiResult    interface{}            `json:"gemini_result"`
-	Status          string                 `json:"status"`
-	Error           string                 `json:"error,omitempty"`
-}
-
-// processURL processes a single URL and integrates with Python functions
-func (job *BatchJob) processURL(baseDir string) error {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout, // Using the global timeout value
-	}
-
-	// Create model number directory
-	modelDir := filepath.Join(baseDir, job.ModelNumber)
-	if err := os.MkdirAll(modelDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %v", err)
-	}
-
-	// Prepare request data
-	request := ParseRequest{
-		URL:           job.URL,
-		ModelNumber:   job.ModelNumber,
-		MinConfidence: 0.7,
-		ShowAllImages: false,
-	}
-
-	// Add optional parse description if provided
-	if job.ParseDescription != nil && *job.ParseDescription != "" {
-		request.ParseDescription = job.ParseDescription
-	}
-
-	// Convert request to JSON
-	jsonData, err := json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %v", err)
-	}
-
-	// Retry configuration
-	maxRetries := 3
-	retryDelay := time.Second * 5
-	var resp *http.Response
-	var lastErr error
-
-	// Retry loop for HTTP requests
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			time.Sleep(retryDelay)
-			log.Printf("Retrying request (attempt %d/%d) for URL: %s", attempt+1, maxRetries, job.URL)
-		}
-
-		// Make request to Python service
-		resp, err = client.Post("http://your-python-service/parse", "application/json", strings.NewReader(string(jsonData)))
-		if err == nil {
-			break
-		}
-		lastErr = err
-		log.Printf("Request failed (attempt %d/%d): %v", attempt+1, maxRetries, err)
-	}
-
-	if resp == nil {
-		return fmt.Errorf("failed after %d attempts: %v", maxRetries, lastErr)
-	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %v", err)
-	}
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		var errorResp struct {
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(body, &errorResp); err != nil {
-			return fmt.Errorf("server error (status %d): %s", resp.StatusCode, string(body))
-		}
-		return fmt.Errorf("server error (status %d): %s", resp.StatusCode, errorResp.Error)
-	}
-
-	// Parse response
-	var parseResponse ParseResponse
-	if err := json.Unmarshal(body, &parseResponse); err != nil {
-		return fmt.Errorf("failed to parse response: %v", err)
-	}
-
-	// Handle successful response
-	if parseResponse.Status != "success" {
-		return fmt.Errorf("processing failed: %s", parseResponse.Error)
-	}
-
-	// Process and save results
-	if err := job.saveResults(modelDir, &parseResponse); err != nil {
-		return fmt.Errorf("failed to save results: %v", err)
-	}
-
-	// Log success with details
-	log.Printf("Successfully processed URL %s for model %s:", job.URL, job.ModelNumber)
-	log.Printf("- Site ID: %s", parseResponse.SiteID)
-	log.Printf("- Downloaded Files: %d", len(parseResponse.DownloadedFiles))
-	log.Printf("- PDF Links: %d", len(parseResponse.PDFLinks))
-	log.Printf("- Image Matches: %d", len(parseResponse.ImageMatches))
-
-	return nil
-}
-
-// saveResults handles saving the parsed results to the appropriate location
-func (job *BatchJob) saveResults(modelDir string, result *ParseResponse) error {
-	resultsDir := filepath.Join(modelDir, "results")
-	if err := os.MkdirAll(resultsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create results directory: %v", err)
-	}
-
-	// Save main results as JSON
-	resultsFile := filepath.Join(resultsDir, "parse_results.json")
-	resultData, err := json.MarshalIndent(result, "", "    ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal results: %v", err)
-	}
-
-	if err := os.WriteFile(resultsFile, resultData, 0644); err != nil {
-		return fmt.Errorf("failed to write results file: %v", err)
-	}
-
-	// Save image matches to separate file
-	if len(result.ImageMatches) > 0 {
-		imagesFile := filepath.Join(resultsDir, "image_matches.csv")
-		imageData, err := json.MarshalIndent(result.ImageMatches, "", "    ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal image matches: %v", err)
-		}
-		if err := os.WriteFile(imagesFile, imageData, 0644); err != nil {
-			return fmt.Errorf("failed to write image matches file: %v", err)
-		}
-	}
-
-	// Save PDF links to text file
-	if len(result.PDFLinks) > 0 {
-		pdfFile := filepath.Join(resultsDir, "pdf_links.txt")
-		pdfData := strings.Join(result.PDFLinks, "\n")
-		if err := os.WriteFile(pdfFile, []byte(pdfData), 0644); err != nil {
-			return fmt.Errorf("failed to write PDF links file: %v", err)
-		}
-	}
-	return nil
-}
-
-type Config struct {
-	MaxConcurrent int `json:"max_concurrent"`
-	Timeout       int `json:"timeout"`
-}
-
-// handleFileUpload processes the uploaded CSV file
-func handleFileUpload(w http.ResponseWriter, r *http.Request) {
-	// Parse the multipart form
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "File too large", http.StatusBadRequest)
-		return
-	}
-
-	// Get config file from form if provided
-	configFile, _, err := r.FormFile("config")
-	if err == nil {
-		defer configFile.Close()
-		var config Config
-		if err := json.NewDecoder(configFile).Decode(&config); err == nil {
-			// Update worker pool size if provided
-			if config.MaxConcurrent > 0 {
-				numWorkers = config.MaxConcurrent
-			}
-			// Update timeout if provided
-			if config.Timeout > 0 {
-				// Convert seconds to duration
-				timeout = time.Duration(config.Timeout) * time.Second
-			}
-		}
-	}
-
-	// Get the CSV file
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Failed to retrieve the file", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// Process CSV
-	reader := csv.NewReader(file)
-	// Skip header
-	headers, err := reader.Read()
-	if err != nil {
-		http.Error(w, "Failed to read CSV header", http.StatusBadRequest)
-		return
-	}
-
-	// Validate required columns
-	requiredColumns := map[string]int{
-		"url":          -1,
-		"model_number": -1,
-	}
-
-	for i, header := range headers {
-		header = strings.ToLower(strings.TrimSpace(header))
-		if _, exists := requiredColumns[header]; exists {
-			requiredColumns[header] = i
-		}
-	}
-
-	// Check if all required columns are present
-	for column, idx := range requiredColumns {
-		if idx == -1 {
-			http.Error(w, fmt.Sprintf("Missing required column: %s", column), http.StatusBadRequest)
-			return
-		}
-	}
-
-	// Create new batch process
-	batchID := fmt.Sprintf("batch_%d", time.Now().UnixNano())
-	process := &BatchProcess{
-		ID:        batchID,
-		Status:    "pending",
-		StartTime: time.Now(),
-		clients:   make([]chan bool, 0, 10), // Initialize with 0 length and capacity of 10
-		Jobs:      make([]BatchJob, 0),      // Initialize empty jobs slice
-	}
-
-	// Read and process each record
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			http.Error(w, "Error reading CSV file", http.StatusBadRequest)
-			return
-		}
-
-		// Create job from CSV record
-		job := BatchJob{
-			ModelNumber: record[requiredColumns["model_number"]],
-			URL:         record[requiredColumns["url"]],
-			Status:      "pending",
-			Progress:    0,
-		}
-
-		// Optional: Parse description if present
-		descriptionIdx := getColumnIndex(headers, "parse_description")
-		if descriptionIdx != -1 && descriptionIdx < len(record) {
-			description := record[descriptionIdx]
-			if description != "" {
-				job.ParseDescription = &description
-			}
-		}
-		process.Jobs = append(process.Jobs, job)
-	}
-
-	// Validate that we have at least one job
-	if len(process.Jobs) == 0 {
-		http.Error(w, "No valid jobs found in the CSV file", http.StatusBadRequest)
-		return
-	}
-
-	// Store the process
-	processes[process.ID] = process
-
-	// Start processing in a goroutine
-	go process.startProcessing() // Added this line to start processing
-
-	// Return the batch ID
-	response := map[string]string{
-		"batch_id": process.ID,
-		"status":   "pending",
-		"message":  fmt.Sprintf("Successfully queued %d jobs", len(process.Jobs)),
-	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-// getColumnIndex helper function to find column index by name
-func getColumnIndex(headers []string, columnName string) int {
-	for i, header := range headers {
-		if strings.EqualFold(strings.TrimSpace(header), columnName) { // Using EqualFold instead of ToLower
-			return i
-		}
-	}
-	return -1
-}
-
-// updateJob updates a job in the batch process
-
-func (bp *BatchProcess) updateJob(updatedJob BatchJob) {
-	bp.mu.Lock()
-	defer bp.mu.Unlock()
-	// Find and update the job
-	for i := range bp.Jobs {
-		if bp.Jobs[i].URL == updatedJob.URL && bp.Jobs[i].ModelNumber == updatedJob.ModelNumber {
-			bp.Jobs[i] = updatedJob
-			break
-		}
-	}
-}
-
-// notifyClients sends updates to all connected WebSocket clients
-func (bp *BatchProcess) notifyClients() {
-	bp.mu.Lock()
-	defer bp.mu.Unlock()
-
-	for _, client := range bp.clients {
-		select {
-		case client <- true:
-			// Successfully sent update
-		default:
-			// Channel is full or closed, skip
-		}
-	}
-}
-
-// startProcessing handles the batch processing with a worker pool
-func (bp *BatchProcess) startProcessing() {
-	bp.Status = "processing"
-
-	jobs := make(chan BatchJob, len(bp.Jobs))
-	results := make(chan BatchJob, len(bp.Jobs))
-	var wg sync.WaitGroup
-
-	// Start workers
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for job := range jobs {
-				// Process job
-				err := job.processURL("./data")
-				if err != nil {
-					job.Status = "failed"
-					job.Error = err.Error()
-				} else {
-					job.Status = "completed"
-					job.Progress = 100
-				}
-				results <- job
-			}
-		}()
-	}
-
-	// Send jobs to workers
-	go func() {
-		for _, job := range bp.Jobs {
-			jobs <- job
-		}
-		close(jobs)
-	}()
-
-	// Process results
-	go func() {
-		completed := 0
-		total := len(bp.Jobs)
-		for job := range results {
-			completed++
-			bp.updateJob(job)
-			bp.Progress = (completed * 100) / total
-			bp.notifyClients()
-
-			if completed == total {
-				close(results)
-				bp.Status = "completed"
-				bp.EndTime = time.Now()
-				bp.notifyClients()
-			}
-		}
-	}()
-
-	wg.Wait()
-}
-
-// handleWebSocket handles WebSocket connections for real-time updates
-func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	batchID := vars["batch_id"]
-	process, exists := processes[batchID]
-	if !exists {
-		http.Error(w, "Batch not found", http.StatusNotFound)
-		return
-	}
-
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
-		return
-	}
-	defer conn.Close()
-
-	updates := make(chan bool)
-	process.mu.Lock()
-	process.clients = append(process.clients, updates)
-	process.mu.Unlock()
-
-	defer func() {
-		process.mu.Lock()
-		for i, ch := range process.clients {
-			if ch == updates {
-				process.clients = append(process.clients[:i], process.clients[i+1:]...)
-				break
-			}
-		}
-		process.mu.Unlock()
-		close(updates)
-	}()
-
-	// Send initial state
-	if err := conn.WriteJSON(process); err != nil {
-		return
-	}
-
-	// Listen for updates
-	for range updates {
-		if err := conn.WriteJSON(process); err != nil {
-			return
-		}
-	}
-}
-func main() {
-	router := mux.NewRouter()
-
-	// Routes
-	router.HandleFunc("/upload", handleFileUpload).Methods("POST")
-	router.HandleFunc("/ws", handleWebSocket)
-
-	// Start server
-	log.Printf("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
-}
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"manager/pool"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Global variables for configuration
+var (
+	numWorkers = 5                 // Default number of workers
+	timeout    = time.Second * 180 // Default timeout
+	dataDir    = "./data"          // Default output directory, shared with the parser
+	upgrader   = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true // Allow all origins for development
+		},
+	}
+)
+
+// BatchJob represents a single URL processing job
+type BatchJob struct {
+	Index            int               `json:"index"`
+	ModelNumber      string            `json:"model_number"`
+	URL              string            `json:"url"`
+	Status           string            `json:"status"`
+	Error            string            `json:"error,omitempty"`
+	Progress         int               `json:"progress"`
+	ParseDescription *string           `json:"parse_description,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`    // Extra CSV columns, echoed in every result
+	Discovered       bool              `json:"discovered,omitempty"`  // URL was found by the discovery stage
+	SourceRank       int               `json:"source_rank,omitempty"` // 1 is the most authoritative URL for the model
+	SourceScore      int               `json:"source_score,omitempty"`
+
+	// Prompt A/B testing
+	PromptVariant  string `json:"prompt_variant,omitempty"`
+	promptTemplate string
+
+	exportConfig   ExportConfig
+	outputSchema   OutputSchema
+	outputLanguage string
+	replay         bool
+	redaction      RedactionConfig
+	redactor       *redactor
+	llm            LLMParams
+	earlyExit      EarlyExitConfig
+	locale         LocaleConfig
+	pagination     PaginationConfig
+	quality        QualityConfig
+	offer          OfferConfig
+	media          MediaConfig
+	pageLimits     PageLimits
+	maxResponse    int64 // Parser response held in memory; zero for the default
+	conditional    bool  // Re-scrape mode: send the stored validators with the request
+	notModified    bool  // The page was unchanged and the prior result reused
+	simulation     *SimulationConfig
+	normalization  NormalizationConfig
+	extraction     interface{} // LLM result, kept for per-model consolidation
+	blocked        bool        // Target site refused the request
+	Completeness   float64     `json:"completeness,omitempty"`
+	TokensUsed     int         `json:"tokens_used,omitempty"`
+	Cost           float64     `json:"cost,omitempty"`
+
+	SchemaErrors []string `json:"schema_errors,omitempty"`
+	// Extracted values that could not be found in the scraped page
+	UnverifiedFields []string `json:"unverified_fields,omitempty"`
+
+	// Extracted values with units and prices converted, keyed by field
+	Normalized map[string]NormalizedValue `json:"normalized,omitempty"`
+	// Warranty duration and type, and ISO 8601 dates, read from the extracted text
+	Warranty *ParsedWarranty       `json:"warranty,omitempty"`
+	Dates    map[string]ParsedDate `json:"dates,omitempty"`
+	// Whether the page marks the product as current, discontinued or replaced
+	Lifecycle *ProductLifecycle `json:"lifecycle,omitempty"`
+	// Typed price, currency and stock availability
+	Offer *ProductOffer `json:"offer,omitempty"`
+	// Category hierarchy from the breadcrumb trail, broadest first
+	CategoryPath []string `json:"category_path,omitempty"`
+	// Related products, accessories and replacement parts the page links to
+	Related []RelatedProduct `json:"related,omitempty"`
+	// Install guides, demos and other videos the page links to or embeds
+	MediaLinks []MediaLink `json:"media_links,omitempty"`
+	// Support phone numbers, emails, warranty-claim pages and service-center locators
+	Support *SupportInfo `json:"support,omitempty"`
+	// Regulatory and compliance marks such as CE, FCC and ENERGY STAR
+	Certifications []Certification `json:"certifications,omitempty"`
+	// Internal catalog product the extraction was linked to, when catalog linking is enabled
+	Catalog *CatalogLink `json:"catalog,omitempty"`
+	// Quality of the scraped page; low-quality pages end in status "low_quality"
+	Quality *PageQuality `json:"quality,omitempty"`
+
+	// Statistics for the batch summary
+	ErrorCode       string      `json:"error_code,omitempty"`
+	DurationMs      int64       `json:"duration_ms,omitempty"`
+	BytesDownloaded int64       `json:"bytes_downloaded,omitempty"`
+	LinkCounts      *LinkCounts `json:"link_counts,omitempty"`
+
+	// Locale the page was requested with, when the job set one
+	Locale *EffectiveLocale `json:"locale,omitempty"`
+
+	// Pages and products crawled when the URL was a product listing
+	Listing *ListingResult `json:"listing,omitempty"`
+
+	// Jobs derived from other jobs point at their parent by index
+	Kind       string `json:"kind,omitempty"` // Empty for uploaded rows, otherwise a jobKind constant
+	Parent     *int   `json:"parent,omitempty"`
+	Children   []int  `json:"children,omitempty"`
+	Depth      int    `json:"depth,omitempty"`
+	MirrorPath string `json:"mirror_path,omitempty"` // Where a document mirror job saved its copy
+	// Why a mirrored document was quarantined instead of saved
+	Quarantine *Quarantine `json:"quarantine,omitempty"`
+	childJobs  ChildJobConfig
+	documents  []string          // Document URLs found on the page, for mirror jobs
+	docTitles  map[string]string // Anchor text of those documents, by URL
+	title      string            // Anchor text a mirrored document was linked with
+	images     []string          // Matched image URLs, for the shared asset report
+
+	LastHeartbeat time.Time `json:"last_heartbeat,omitempty"`
+	heartbeat     func()
+	content       string  // Page text, held only until the job is indexed for search
+	log           *jobLog // Lines served by the job logs endpoint; nil outside a batch
+}
+
+// BatchProcess represents the entire batch processing request
+type BatchProcess struct {
+	ID       string          `json:"id"`
+	Jobs     []BatchJob      `json:"jobs"`
+	Status   string          `json:"status"`
+	Progress int             `json:"progress"`
+	DataDir  string          `json:"data_dir"`
+	Priority int             `json:"priority"`
+	Window   *ScheduleWindow `json:"window,omitempty"`
+	// Caller who uploaded the batch, as recorded in the audit log; the
+	// batch feed only shows a caller their own batches
+	Owner string `json:"owner,omitempty"`
+	// 1-based position among batches waiting for a processing slot, 0 once started
+	QueuePosition int `json:"queue_position,omitempty"`
+	// Current number of workers when adaptive concurrency is enabled
+	Concurrency int       `json:"concurrency,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time,omitempty"`
+	// Last state change or client request; idle batches are collected
+	LastActivity time.Time `json:"last_activity,omitempty"`
+
+	VariantReport *VariantReport    `json:"variant_report,omitempty"`
+	Summary       *BatchSummary     `json:"summary,omitempty"`
+	SharedAssets  []SharedAsset     `json:"shared_assets,omitempty"` // Documents and images several models link to
+	Evaluation    *EvaluationReport `json:"evaluation,omitempty"`    // Accuracy against uploaded golden answers
+	Deliveries    []DeliveryResult  `json:"deliveries,omitempty"`    // Outcome of each downstream connector
+	// Set on batches restored from an archive; their jobs are not run again
+	ImportedAt time.Time `json:"imported_at,omitempty"`
+	// Set on batches whose rows came from an RSS or Atom feed
+	Feed *FeedSource `json:"feed,omitempty"`
+	// Streamed uploads: rows are still being read while set, and the
+	// validation report is kept on the batch as it grows
+	Streaming  bool              `json:"streaming,omitempty"`
+	Validation *ValidationReport `json:"validation,omitempty"`
+	stream     *rowStream
+	// Set on batches run with simulate=true; their results are synthetic
+	Simulated bool `json:"simulated,omitempty"`
+	// Set on batches that process only a sample of their rows
+	Sampling *SamplingConfig `json:"sampling,omitempty"`
+
+	// Per-model consolidation of jobs sharing a model number
+	GroupByModel       bool          `json:"group_by_model"`
+	ConflictResolution string        `json:"conflict_resolution,omitempty"`
+	Consolidated       []ModelRecord `json:"consolidated,omitempty"`
+
+	export        ExportConfig
+	discovery     DiscoveryConfig
+	sourceRanking SourceRankingConfig
+	adaptive      AdaptiveConfig
+	answers       *goldenAnswers
+	encryptionKey *batchKey // Set when artifacts are encrypted at rest
+	connectors    []ConnectorConfig
+	memory        *memoryBudget           // nil when the batch's working set is not capped
+	minFreeDisk   uint64                  // Free space below which the batch pauses
+	jobHardLimit  time.Duration           // Wall-clock limit for each job; zero for the default
+	stop          context.CancelCauseFunc // Cancels the batch while it processes
+	retry         map[int]bool            // Indexes of the failed jobs a retry runs again
+
+	mu      sync.Mutex  // For thread-safe updates
+	clients []chan bool // For WebSocket updates
+
+	// Number of the latest job event; reconnecting clients resume from it
+	Sequence    int64 `json:"sequence"`
+	jobEvents   []JobEvent
+	jobLogs     map[int]*jobLog // Per-job log lines, by job index
+	finished    []int           // Job indexes in the order they finished, for the results stream
+	finishedSet map[int]bool
+	rate        completionRate // Finished jobs over time, for progress rollups
+
+	watchdog *jobWatchdog
+}
+
+type ParseRequest struct {
+	URL              string            `json:"url"`
+	ModelNumber      string            `json:"model_number"`
+	ParseDescription *string           `json:"parse_description,omitempty"`
+	MinConfidence    float64           `json:"min_confidence,omitempty"`
+	ShowAllImages    bool              `json:"show_all_images,omitempty"`
+	PromptVariant    string            `json:"prompt_variant,omitempty"`
+	PromptTemplate   string            `json:"prompt_template,omitempty"`
+	OutputSchema     OutputSchema      `json:"output_schema,omitempty"`
+	OutputLanguage   string            `json:"output_language,omitempty"`
+	Replay           bool              `json:"replay,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	Redaction        *RedactionConfig  `json:"redaction,omitempty"`
+	LLM              *LLMParams        `json:"llm,omitempty"` // Overrides of the parser's model parameters
+	EarlyExit        *EarlyExitConfig  `json:"early_exit,omitempty"`
+	Locale           *LocaleConfig     `json:"locale,omitempty"`
+	Pagination       *PaginationConfig `json:"pagination,omitempty"`
+	Quality          *QualityConfig    `json:"quality,omitempty"`
+	Offer            *OfferConfig      `json:"offer,omitempty"`
+	Media            *MediaConfig      `json:"media,omitempty"`
+	PageLimits       *PageLimits       `json:"page_limits,omitempty"`
+	Conditional      *PageValidators   `json:"conditional,omitempty"` // Fetch the page only if it changed since these
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type ImageMatch struct {
+	URL        string  `json:"url"`
+	Confidence float64 `json:"confidence"`
+	Context    string  `json:"context"`
+	LocalPath  string  `json:"local_path,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+}
+
+type ParseResponse struct {
+	SiteID           string                     `json:"site_id"`
+	ContentAnalysis  map[string]interface{}     `json:"content_analysis"`
+	ImageMatches     []ImageMatch               `json:"image_matches"`
+	DownloadedFiles  []string                   `json:"downloaded_files"`
+	PDFLinks         []DocumentLink             `json:"pdf_links"`
+	GeminiResult     interface{}                `json:"gemini_result"`
+	Status           string                     `json:"status"`
+	Error            string                     `json:"error,omitempty"`
+	TokensUsed       int                        `json:"tokens_used,omitempty"`
+	Cost             float64                    `json:"cost,omitempty"`
+	Provenance       map[string]FieldProvenance `json:"provenance,omitempty"`
+	Grounding        map[string]string          `json:"grounding,omitempty"`         // "verified" or "unverified" per extracted value
+	UnverifiedFields []string                   `json:"unverified_fields,omitempty"` // Values not found in the scraped page
+	BytesDownloaded  int64                      `json:"bytes_downloaded,omitempty"`
+	SourceRank       int                        `json:"source_rank,omitempty"`
+	Truncated        bool                       `json:"truncated,omitempty"`
+	Links            []DiscoveredLink           `json:"links,omitempty"`
+	LinkCounts       *LinkCounts                `json:"link_counts,omitempty"`
+	RawContent       string                     `json:"raw_content,omitempty"` // Page text, used for search indexing
+	Locale           *EffectiveLocale           `json:"locale,omitempty"`
+	Listing          *ListingResult             `json:"listing,omitempty"`
+	Quality          *PageQuality               `json:"quality,omitempty"`
+	Lifecycle        *ProductLifecycle          `json:"lifecycle,omitempty"`
+	Offer            *ProductOffer              `json:"offer,omitempty"`
+	CategoryPath     []string                   `json:"category_path,omitempty"`
+	Related          []RelatedProduct           `json:"related,omitempty"`
+	MediaLinks       []MediaLink                `json:"media_links,omitempty"`
+	Support          *SupportInfo               `json:"support,omitempty"`
+	Certifications   []Certification            `json:"certifications,omitempty"`
+	Validators       *PageValidators            `json:"validators,omitempty"` // ETag and Last-Modified the page was served with
+	Metadata         map[string]string          `json:"metadata,omitempty"`
+}
+
+// processURL processes a single URL and integrates with Python functions
+func (job *BatchJob) processURL(ctx context.Context, baseDir string) error {
+	job.beat()
+
+	// Document mirrors are plain downloads, not pages for the parser
+	if job.Kind == jobKindDocumentMirror {
+		return job.mirrorDocument(ctx, baseDir)
+	}
+
+	// Let deployment hooks rewrite the URL before anything is requested
+	originalURL := job.URL
+	if err := hooks.beforeScrape(ctx, job); err != nil {
+		return err
+	}
+	if job.URL != originalURL {
+		job.logf("URL rewritten by hook to %s", job.URL)
+		if err := ssrfPolicy.validateURL(ctx, job.URL); err != nil {
+			return newJobError(errCodeHook, "rewritten URL rejected: %v", err)
+		}
+	}
+
+	// Create HTTP client with timeout; simulations and the profile may mock the parser
+	client := parserClient(job.simulation)
+
+	// Create model number directory
+	modelDir := modelDirFor(baseDir, job.ModelNumber)
+	if err := os.MkdirAll(modelDir, 0755); err != nil {
+		return newJobError(errCodeIO, "failed to create directory: %v", err)
+	}
+
+	// Prepare request data
+	request := ParseRequest{
+		URL:           job.URL,
+		ModelNumber:   job.ModelNumber,
+		MinConfidence: 0.7,
+		ShowAllImages: false,
+		Metadata:      job.Metadata,
+	}
+
+	// Add optional parse description if provided
+	if job.ParseDescription != nil && *job.ParseDescription != "" {
+		request.ParseDescription = job.ParseDescription
+	}
+
+	// In re-scrape mode, have the page fetched only if it changed since the stored result
+	var validators *PageValidators
+	if job.conditional && !job.replay {
+		var err error
+		if validators, err = loadValidators(modelDir, job.URL); err != nil {
+			job.logf("Warning: ignoring stored validators: %v", err)
+		}
+		request.Conditional = validators
+	}
+
+	// Ask for exactly the batch's output fields
+	if len(job.outputSchema) > 0 {
+		request.OutputSchema = job.outputSchema
+		request.PromptTemplate = buildSchemaPrompt(job.outputSchema)
+	}
+
+	// Add prompt variant when the batch is running an A/B test
+	if job.PromptVariant != "" {
+		request.PromptVariant = job.PromptVariant
+		request.PromptTemplate = job.promptTemplate
+	}
+
+	// Re-run against the parser's saved snapshots instead of the live pages
+	request.Replay = job.replay
+
+	// Per-batch model parameters
+	if job.llm.set() {
+		request.LLM = &job.llm
+	}
+
+	// Trade completeness for cost on pages with many chunks
+	if job.earlyExit.Enabled {
+		request.EarlyExit = &job.earlyExit
+	}
+
+	// Request the page's regional variant
+	if job.locale.enabled() {
+		request.Locale = &job.locale
+	}
+
+	// Crawl listing pages for their products
+	if job.pagination.active() {
+		request.Pagination = &job.pagination
+	}
+
+	// Tune or disable the detection of error pages and login walls
+	if job.quality != (QualityConfig{}) {
+		request.Quality = &job.quality
+	}
+
+	// Tune or disable the price and availability extractor
+	if job.offer != (OfferConfig{}) {
+		request.Offer = &job.offer
+	}
+
+	// Narrow down or disable video link collection
+	if !job.media.isZero() {
+		request.Media = &job.media
+	}
+
+	// Read more or less of each page than the parser's defaults
+	if job.pageLimits != (PageLimits{}) {
+		request.PageLimits = &job.pageLimits
+	}
+
+	// Have the parser redact what it stores as well
+	if job.redaction.enabled() {
+		request.Redaction = &job.redaction
+	}
+
+	// Per-domain request headers from the domain's script
+	if script := domainScripts.forURL(job.URL); script != nil {
+		request.Headers = script.Headers
+	}
+
+	// Ask for free-text fields in the batch's language
+	if job.outputLanguage != "" {
+		request.OutputLanguage = job.outputLanguage
+		if request.PromptTemplate != "" {
+			request.PromptTemplate = withOutputLanguage(request.PromptTemplate, job.outputLanguage)
+		}
+	}
+
+	// Convert request to JSON
+	jsonData, err := encodeJSON(request, "")
+	if err != nil {
+		return newJobError(errCodeInternal, "failed to marshal request: %v", err)
+	}
+	defer putBuffer(jsonData)
+
+	// Retry configuration
+	maxRetries := 3
+	retryDelay := time.Second * 5
+	var resp *http.Response
+	var lastErr error
+
+	// Retry loop for HTTP requests
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return newJobError(errCodeTimeout, "cancelled while retrying: %v", context.Cause(ctx))
+			case <-time.After(retryDelay):
+			}
+			job.beat()
+			job.logf("Retrying request (attempt %d/%d) for URL: %s", attempt+1, maxRetries, job.URL)
+		}
+
+		// Make request to Python service
+		req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, parserURL, bytes.NewReader(jsonData.Bytes()))
+		if reqErr != nil {
+			return newJobError(errCodeInternal, "failed to create request: %v", reqErr)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err = client.Do(req)
+		if err == nil {
+			break
+		}
+		lastErr = err
+		job.logf("Request failed (attempt %d/%d): %v", attempt+1, maxRetries, err)
+	}
+
+	if resp == nil {
+		return newJobError(networkErrorCode(lastErr), "failed after %d attempts: %v", maxRetries, lastErr)
+	}
+	defer resp.Body.Close()
+
+	job.beat()
+
+	// Check status code; error bodies are small, so only their start is read
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var errorResp struct {
+			Error string `json:"error"`
+		}
+		code := fmt.Sprintf("http_%dxx", resp.StatusCode/100)
+		job.blocked = isBlockStatus(resp.StatusCode)
+		if err := json.Unmarshal(body, &errorResp); err != nil {
+			return newJobError(code, "server error (status %d): %s", resp.StatusCode, string(body))
+		}
+		return newJobError(code, "server error (status %d): %s", resp.StatusCode, errorResp.Error)
+	}
+
+	// Decode the response while reading it, instead of buffering the whole
+	// body first, and refuse responses above the per-job cap
+	responseLimit := job.responseLimit()
+	counter := &countingReader{r: io.LimitReader(resp.Body, responseLimit+1)}
+	var parseResponse ParseResponse
+	if err := json.NewDecoder(counter).Decode(&parseResponse); err != nil {
+		if counter.n > responseLimit {
+			return newJobError(errCodeProcessing, "%v (%d bytes)", errResponseTooLarge, responseLimit)
+		}
+		return newJobError(errCodeParse, "failed to parse response: %v", err)
+	}
+
+	// An unchanged page reuses the result it produced last time
+	if parseResponse.Status == "not_modified" {
+		if validators == nil {
+			return newJobError(errCodeProcessing, "parser reported not_modified for an unconditional request")
+		}
+		if parseResponse, err = loadPriorResult(modelDir, job.URL, validators); err != nil {
+			return newJobError(errCodeIO, "%v", err)
+		}
+		job.notModified = true
+		job.logf("Not modified since result version %s, reusing it", validators.Version)
+	}
+
+	// Handle successful response
+	if parseResponse.Status != "success" {
+		return newJobError(errCodeProcessing, "processing failed: %s", parseResponse.Error)
+	}
+
+	// Soft 404s, error pages, login walls and empty pages were not extracted
+	job.Quality = parseResponse.Quality
+	if job.Quality != nil && job.Quality.NotFound != nil {
+		return newJobError(errCodeNotFound, "%s", job.Quality.describe())
+	}
+	if job.Quality != nil && job.Quality.LowQuality {
+		job.blocked = slices.Contains(job.Quality.Reasons, qualityBotChallenge)
+		return newJobError(errCodeLowQuality, "%s", job.Quality.describe())
+	}
+
+	job.beat()
+
+	// Validate the extraction against the batch's output schema
+	if len(job.outputSchema) > 0 {
+		info, _ := parseResponse.GeminiResult.(map[string]interface{})
+		parseResponse.GeminiResult, job.SchemaErrors = applySchema(info, job.outputSchema)
+		for _, schemaErr := range job.SchemaErrors {
+			job.logf("Warning: schema: %s", schemaErr)
+		}
+	}
+
+	// Let deployment hooks enrich the extraction before it is saved
+	if parseResponse.GeminiResult, err = hooks.afterExtract(ctx, job, parseResponse.GeminiResult); err != nil {
+		return err
+	}
+
+	// Check values against the page when the parser did not, before the
+	// page text is redacted
+	if parseResponse.Grounding == nil && parseResponse.RawContent != "" {
+		parseResponse.Grounding = checkGrounding(parseResponse.GeminiResult, parseResponse.RawContent)
+		parseResponse.UnverifiedFields = unverifiedFields(parseResponse.Grounding)
+	}
+	if len(parseResponse.UnverifiedFields) > 0 {
+		job.logf("Warning: not found in the page: %s", strings.Join(parseResponse.UnverifiedFields, ", "))
+	}
+
+	// Strip personal data before anything is written to disk
+	parseResponse.RawContent = job.redactor.redact(parseResponse.RawContent)
+	parseResponse.GeminiResult = job.redactor.redactRawOutput(parseResponse.GeminiResult)
+
+	// Process and save results
+	parseResponse.SourceRank = job.SourceRank
+	parseResponse.Metadata = job.Metadata
+	if err := job.saveResults(modelDir, &parseResponse); err != nil {
+		return newJobError(errCodeIO, "failed to save results: %v", err)
+	}
+
+	// Record extraction metrics for the variant report
+	job.Completeness = extractionCompleteness(parseResponse.GeminiResult)
+	job.TokensUsed = parseResponse.TokensUsed
+	job.Cost = parseResponse.Cost
+	job.BytesDownloaded = counter.n + parseResponse.BytesDownloaded
+	job.LinkCounts = parseResponse.LinkCounts
+	job.Locale = parseResponse.Locale
+	job.Listing = parseResponse.Listing
+	job.documents = documentURLs(parseResponse.PDFLinks)
+	job.docTitles = documentTitles(parseResponse.PDFLinks)
+	job.images = imageURLs(parseResponse.ImageMatches)
+	if job.LinkCounts == nil && len(parseResponse.Links) > 0 {
+		counts := countLinks(parseResponse.Links)
+		job.LinkCounts = &counts
+	}
+	job.extraction = parseResponse.GeminiResult
+	job.Normalized = normalizeExtraction(parseResponse.GeminiResult, job.normalization)
+	job.Warranty, job.Dates = parseFieldValues(parseResponse.GeminiResult)
+	job.Lifecycle = parseResponse.Lifecycle
+	job.Offer = parseResponse.Offer
+	job.CategoryPath = parseResponse.CategoryPath
+	job.Related = parseResponse.Related
+	job.MediaLinks = parseResponse.MediaLinks
+	job.Support = parseResponse.Support
+	job.Certifications = parseResponse.Certifications
+	job.UnverifiedFields = parseResponse.UnverifiedFields
+	job.content = parseResponse.RawContent
+
+	// Log success with details
+	job.logf("Successfully processed URL %s for model %s:", job.URL, job.ModelNumber)
+	debugf("- Site ID: %s", parseResponse.SiteID)
+	debugf("- Downloaded Files: %d", len(parseResponse.DownloadedFiles))
+	debugf("- PDF Links: %d", len(parseResponse.PDFLinks))
+	debugf("- Image Matches: %d", len(parseResponse.ImageMatches))
+
+	return nil
+}
+
+// beat reports progress to the watchdog, if one is attached
+func (job *BatchJob) beat() {
+	if job.heartbeat != nil {
+		job.heartbeat()
+	}
+}
+
+// saveResults handles saving the parsed results to the appropriate location
+func (job *BatchJob) saveResults(modelDir string, result *ParseResponse) error {
+	resultsDir := filepath.Join(modelDir, "results")
+	if err := os.MkdirAll(resultsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create results directory: %v", err)
+	}
+
+	// Save main results as JSON
+	resultsFile := filepath.Join(resultsDir, "parse_results.json")
+	resultData, err := encodeJSON(result, "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %v", err)
+	}
+	defer putBuffer(resultData)
+
+	if err := writeFileAtomic(resultsFile, resultData.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write results file: %v", err)
+	}
+
+	// Keep every historical result rather than only the latest. A reused
+	// result is already stored as a version.
+	if !job.notModified {
+		version, err := saveResultVersion(modelDir, job.URL, resultData.Bytes())
+		if err != nil {
+			return err
+		}
+		if job.conditional && !result.Validators.empty() {
+			validators := *result.Validators
+			validators.Version = version
+			if err := saveValidators(modelDir, job.URL, &validators); err != nil {
+				job.logf("Warning: failed to store validators: %v", err)
+			}
+		}
+	}
+
+	// Save image matches to separate files in the configured formats
+	if len(result.ImageMatches) > 0 {
+		if err := writeImageMatches(resultsDir, result.ImageMatches, job.exportConfig, job.Metadata); err != nil {
+			return err
+		}
+	}
+
+	// Export exactly the batch's declared columns
+	if len(job.outputSchema) > 0 {
+		if err := writeSchemaCSV(resultsDir, job.outputSchema, result.GeminiResult, job.Metadata); err != nil {
+			return err
+		}
+	}
+
+	// Save PDF links to text file
+	if len(result.PDFLinks) > 0 {
+		pdfFile := filepath.Join(resultsDir, "pdf_links.txt")
+		pdfData := strings.Join(documentURLs(result.PDFLinks), "\n")
+		if err := writeFileAtomic(pdfFile, []byte(pdfData), 0644); err != nil {
+			return fmt.Errorf("failed to write PDF links file: %v", err)
+		}
+	}
+
+	// Save every discovered link for follow-up batches
+	if len(result.Links) > 0 {
+		if err := writeLinksJSONL(resultsDir, result.Links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Config struct {
+	MaxConcurrent int          `json:"max_concurrent"`
+	Timeout       int          `json:"timeout"`
+	ABTest        ABTestConfig `json:"ab_test"`
+	Export        ExportConfig `json:"export"`
+
+	// Merge the results of all URLs sharing a model number
+	GroupByModel       bool   `json:"group_by_model"`
+	ConflictResolution string `json:"conflict_resolution"`
+
+	// Search for candidate pages for rows without a URL
+	Discovery DiscoveryConfig `json:"discovery"`
+	// Higher priority batches run first and make lower ones yield between jobs
+	Priority int `json:"priority"`
+	// Only process this batch inside the given daily window
+	Window *ScheduleWindow `json:"window"`
+	// Fields to extract and export for every job
+	OutputSchema OutputSchema `json:"output_schema"`
+	// Language for extracted free-text fields, e.g. "de" or "German"
+	OutputLanguage string `json:"output_language"`
+	// Default page locale; the CSV's "locale" and "country" columns override it per row
+	Locale LocaleConfig `json:"locale"`
+	// Follow pagination on product listing pages and parse or spawn the products found
+	Pagination PaginationConfig `json:"pagination"`
+	// Detection of error pages, login walls and near-empty pages, which are
+	// marked low_quality instead of being extracted, and of soft 404s, which
+	// are marked not_found
+	Quality QualityConfig `json:"quality"`
+	// Read the price and stock availability into typed fields, optionally asking the LLM
+	Offer OfferConfig `json:"offer"`
+	// Collect YouTube, Vimeo and other video links, optionally only those matching keywords
+	Media MediaConfig `json:"media"`
+	// Take rows from an RSS or Atom feed instead of the uploaded CSV, optionally watching it
+	Feed FeedConfig `json:"feed"`
+	// Jobs finished jobs may add to the batch: listing products and document mirrors
+	ChildJobs ChildJobConfig `json:"child_jobs"`
+	// Convert units and currencies in extracted values, keeping the raw values
+	Normalization NormalizationConfig `json:"normalization"`
+	// Run the pipeline on fake results with synthetic latencies
+	Simulation SimulationConfig `json:"simulation"`
+	// Upload header to column, e.g. {"Produktseite": "url"}; applied before the aliases
+	ColumnMapping map[string]string `json:"column_mapping"`
+	// Extra header names per column, added to the built-in multi-language aliases
+	HeaderAliases map[string][]string `json:"header_aliases"`
+	// Re-run extraction against saved HTML snapshots instead of the network
+	Replay bool `json:"replay"`
+	// Re-scrape mode: send the ETag and Last-Modified stored for each URL and
+	// reuse the prior result when the page answers 304 Not Modified
+	ConditionalGet bool `json:"conditional_get"`
+	// Temperature, top_p, max_tokens, stop sequences and system prompt for this batch
+	LLM LLMParams `json:"llm"`
+	// Stop sending a page's chunks to the LLM once the required fields are found
+	EarlyExit EarlyExitConfig `json:"early_exit"`
+	// Patterns removed from stored page text, snapshots and raw LLM output
+	Redaction RedactionConfig `json:"redaction"`
+	// Prefer official manufacturer pages when a model has several URLs
+	SourceRanking SourceRankingConfig `json:"source_ranking"`
+
+	// Output directory for this batch, relative to the deployment's data directory
+	DataDir string `json:"data_dir"`
+	// Hard wall-clock limit, in seconds, for a single job
+	JobHardLimit int `json:"job_hard_limit"`
+	// No longer accepted: flushing result files to disk is set for the
+	// deployment with FSYNC_WRITES
+	FsyncWrites bool `json:"fsync_writes"`
+	// Free disk space, in MB, below which downloads are paused
+	MinFreeDiskMB int `json:"min_free_disk_mb"`
+	// Raw HTML, in MB, read from a single page before it is truncated
+	MaxPageMB int `json:"max_page_mb"`
+	// Extracted text, in KB, kept from a single page before it is truncated
+	MaxContentKB int `json:"max_content_kb"`
+	// Skip the HEAD size and type check before downloads
+	DisableHeadCheck bool `json:"disable_head_check"`
+	// Skip pages declared larger than max_page_mb instead of truncating them
+	SkipOversizePages bool `json:"skip_oversize_pages"`
+	// Documents, in MB, declared larger than this are not downloaded
+	MaxDocumentMB int `json:"max_document_mb"`
+	// Parser response, in MB, a single job may hold in memory
+	MaxJobMemoryMB int `json:"max_job_memory_mb"`
+	// Combined working set, in MB, of a batch's running jobs; jobs wait for room
+	MaxBatchMemoryMB int `json:"max_batch_memory_mb"`
+
+	// No longer accepted: WebSocket keepalive is set for the deployment with
+	// WS_PING_INTERVAL_SECONDS and WS_WRITE_TIMEOUT_SECONDS
+	WSPingInterval int `json:"ws_ping_interval"`
+	WSWriteTimeout int `json:"ws_write_timeout"`
+
+	// No longer accepted: the duplicate window is set for the deployment with
+	// DUPLICATE_WINDOW_MINUTES
+	DuplicateWindow int `json:"duplicate_window"`
+	// No longer accepted: the inactivity after which the collector removes
+	// batches is set for the deployment with BATCH_INACTIVITY_MINUTES
+	InactivityTimeout int `json:"inactivity_timeout"`
+	// No longer accepted: the batches allowed to process at once are set for
+	// the deployment with MAX_BATCHES or its profile
+	MaxBatches int `json:"max_batches"`
+	// Scale workers with error rate, latency and host load instead of max_concurrent
+	Adaptive AdaptiveConfig `json:"adaptive"`
+	// Downstream systems completed product records are delivered to
+	Connectors []ConnectorConfig `json:"connectors"`
+	// Encrypt this batch's artifacts with AES-GCM under a key wrapped by the master key
+	EncryptArtifacts bool `json:"encrypt_artifacts"`
+	// No longer accepted: daily per-domain budgets are set for the deployment
+	// with DAILY_DOMAIN_BUDGET and DOMAIN_BUDGETS, and batches charge against them
+	DailyDomainBudget int            `json:"daily_domain_budget"`
+	DomainBudgets     map[string]int `json:"domain_budgets"`
+}
+
+// deploymentSettings lists the fields an upload set that are now configured
+// for the whole deployment; uploads setting any of them are rejected
+func (c Config) deploymentSettings() []string {
+	var set []string
+	if c.FsyncWrites {
+		set = append(set, "fsync_writes")
+	}
+	if c.MaxBatches > 0 {
+		set = append(set, "max_batches")
+	}
+	if c.WSPingInterval > 0 {
+		set = append(set, "ws_ping_interval")
+	}
+	if c.WSWriteTimeout > 0 {
+		set = append(set, "ws_write_timeout")
+	}
+	if c.InactivityTimeout > 0 {
+		set = append(set, "inactivity_timeout")
+	}
+	if c.DuplicateWindow > 0 {
+		set = append(set, "duplicate_window")
+	}
+	if c.DailyDomainBudget > 0 {
+		set = append(set, "daily_domain_budget")
+	}
+	if len(c.DomainBudgets) > 0 {
+		set = append(set, "domain_budgets")
+	}
+	return set
+}
+
+// handleFileUpload processes the uploaded CSV file
+func handleFileUpload(w http.ResponseWriter, r *http.Request) {
+	if maintenance.rejectUpload(w) {
+		return
+	}
+
+	// Parse the multipart form
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, "File too large", http.StatusBadRequest)
+		return
+	}
+
+	// Get config file from form if provided
+	var config Config
+	configFile, _, err := r.FormFile("config")
+	if err == nil {
+		defer configFile.Close()
+		if err := json.NewDecoder(configFile).Decode(&config); err == nil {
+			// Update worker pool size if provided
+			if config.MaxConcurrent > 0 {
+				numWorkers = config.MaxConcurrent
+			}
+			// Update timeout if provided
+			if config.Timeout > 0 {
+				// Convert seconds to duration
+				timeout = time.Duration(config.Timeout) * time.Second
+			}
+		}
+	}
+
+	if config.ConflictResolution != "" && config.ConflictResolution != resolveMostCommon && config.ConflictResolution != resolveFirstSource {
+		http.Error(w, fmt.Sprintf("Unsupported conflict_resolution: %s", config.ConflictResolution), http.StatusBadRequest)
+		return
+	}
+	if err := config.Normalization.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Adaptive.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Window.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.LLM.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Locale.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Pagination.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Quality.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Simulation.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Feed.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	redactor, err := config.Redaction.compile()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if set := config.deploymentSettings(); len(set) > 0 {
+		http.Error(w, fmt.Sprintf("%s: set for the deployment, not per upload", strings.Join(set, ", ")), http.StatusBadRequest)
+		return
+	}
+	batchDir, err := batchDataDir(config.DataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, connector := range config.Connectors {
+		if err := connector.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if config.EncryptArtifacts {
+		if _, err := masterKey(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := config.OutputSchema.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Discovery.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Export.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Optional golden answers turn the batch into an accuracy evaluation
+	var answers *goldenAnswers
+	if answersFile, _, err := r.FormFile("answers"); err == nil {
+		defer answersFile.Close()
+		if answers, err = parseAnswersCSV(answersFile); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// With stream=true, a large CSV is spooled to disk and its rows are read
+	// while the batch runs. Discovery and feeds need every row up front.
+	stream := r.FormValue("stream") == "true"
+	if stream && (config.Discovery.enabled() || config.Feed.enabled()) {
+		http.Error(w, "stream=true cannot be combined with discovery or a feed", http.StatusBadRequest)
+		return
+	}
+
+	// sample_count and sample_percent process a subset of the rows
+	sampling, err := samplingFromForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// With simulate=true the pipeline runs on fake scrape and LLM results.
+	// Discovery would still query the search API, so it is not simulated.
+	if r.FormValue("simulate") == "true" {
+		config.Simulation.Enabled = true
+	}
+	if config.Simulation.Enabled && config.Discovery.enabled() {
+		http.Error(w, "simulate=true cannot be combined with discovery", http.StatusBadRequest)
+		return
+	}
+	closeSpool := func() {}
+	streamStarted := false
+	defer func() {
+		if !streamStarted {
+			closeSpool()
+		}
+	}()
+
+	// Rows come from the uploaded CSV, or from the feed when one is configured
+	var reader rowReader
+	if config.Feed.enabled() {
+		entries, err := fetchFeed(r.Context(), config.Feed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		reader = newFeedReader(entries, config.Feed)
+	} else {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Failed to retrieve the file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if stream {
+			spool, err := spoolUpload(file)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			closeSpool = func() {
+				spool.Close()
+				os.Remove(spool.Name())
+			}
+			reader = csv.NewReader(spool)
+		} else {
+			reader = csv.NewReader(file)
+		}
+	}
+
+	// Process CSV
+	// Skip header
+	headers, err := reader.Read()
+	if err != nil {
+		http.Error(w, "Failed to read CSV header", http.StatusBadRequest)
+		return
+	}
+
+	// Rename mapped and localized headers, e.g. "Modellnummer", to the columns read below
+	aliases := mergeHeaderAliases(deploymentHeaderAliases, config.HeaderAliases)
+	if headers, err = canonicalHeaders(headers, config.ColumnMapping, aliases); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate required columns
+	requiredColumns := map[string]int{
+		"url":          -1,
+		"model_number": -1,
+	}
+
+	for i, header := range headers {
+		header = normalizeHeader(header)
+		if _, exists := requiredColumns[header]; exists {
+			requiredColumns[header] = i
+		}
+	}
+
+	// Check if all required columns are present. The URL column may be
+	// omitted when a discovery stage will find pages for each model.
+	for column, idx := range requiredColumns {
+		if idx == -1 && !(column == "url" && config.Discovery.enabled()) {
+			http.Error(w, fmt.Sprintf("Missing required column: %s", column), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Create new batch process
+	batchID := fmt.Sprintf("batch_%d", time.Now().UnixNano())
+	process := &BatchProcess{
+		ID:        batchID,
+		DataDir:   dataDir,
+		Owner:     auditActor(r),
+		Status:    "pending",
+		StartTime: time.Now(),
+		clients:   make([]chan bool, 0, 10), // Initialize with 0 length and capacity of 10
+		Jobs:      make([]BatchJob, 0),      // Initialize empty jobs slice
+	}
+	if config.Simulation.Enabled {
+		// Keep fake results apart from real ones
+		process.DataDir = filepath.Join(dataDir, "simulations")
+		process.Simulated = true
+	}
+
+	// Read and process each record, collecting every invalid row. With
+	// strict=false invalid rows are skipped instead of rejecting the batch.
+	// With stream=true rows are read while the batch runs instead.
+	builder := newRowBuilder(config, headers, requiredColumns["url"], requiredColumns["model_number"], redactor)
+	report := &ValidationReport{Strict: r.FormValue("strict") != "false"}
+	if stream {
+		report.Strict = false
+		report.capped = true
+		process.Validation = report
+		process.stream = &rowStream{reader: reader, builder: builder, abTest: config.ABTest, sampler: newRowSampler(sampling), close: closeSpool}
+		process.Streaming = true
+	} else {
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, "Error reading CSV file", http.StatusBadRequest)
+				return
+			}
+			if job, ok := builder.build(r.Context(), record, report); ok {
+				process.Jobs = append(process.Jobs, job)
+			}
+		}
+
+		report.Accepted = len(process.Jobs)
+		report.Skipped = report.Rows - report.Accepted
+		if len(report.Errors) > 0 && report.Strict {
+			writeRowErrors(w, report)
+			return
+		}
+
+		// Validate that we have at least one job
+		if len(process.Jobs) == 0 {
+			http.Error(w, "No valid jobs found in the CSV file", http.StatusBadRequest)
+			return
+		}
+
+		// Rows outside the sample are recorded but not run
+		if sampling != nil {
+			report.SkippedBySampling = newRowSampler(sampling).sample(process.Jobs)
+			if report.SkippedBySampling == len(process.Jobs) {
+				http.Error(w, "The sample selects none of the valid rows", http.StatusBadRequest)
+				return
+			}
+			process.Validation = report
+		}
+	}
+	process.Sampling = sampling
+
+	process.adaptive = config.Adaptive
+	process.answers = answers
+	process.Priority = config.Priority
+	process.Window = config.Window
+	process.export = config.Export
+	process.discovery = config.Discovery
+	process.sourceRanking = config.SourceRanking
+	process.connectors = config.Connectors
+	process.memory = newMemoryBudget(int64(config.MaxBatchMemoryMB)<<20, jobMemoryEstimate(config.responseLimit(), config.pageLimits().contentBytes()))
+	process.GroupByModel = config.GroupByModel
+	process.ConflictResolution = config.ConflictResolution
+
+	// Apply the per-batch output directory and disk space threshold
+	if config.DataDir != "" {
+		process.DataDir = batchDir
+	}
+	process.minFreeDisk = minFreeDiskBytes
+	if config.MinFreeDiskMB > 0 {
+		process.minFreeDisk = uint64(config.MinFreeDiskMB) << 20
+	}
+	process.jobHardLimit = time.Duration(config.JobHardLimit) * time.Second
+
+	// Link to the existing batch instead of launching a duplicate run,
+	// unless the client explicitly asks to force a new one. Replays are
+	// meant to re-run a known job list, so they are never duplicates.
+	fingerprint := batchFingerprint(process.Jobs)
+	if r.FormValue("force") != "true" && !config.Replay && !stream && !config.Simulation.Enabled && sampling == nil {
+		if existingID, ok := findRecentBatch(fingerprint); ok {
+			response := map[string]string{
+				"batch_id": existingID,
+				"status":   "duplicate",
+				"message":  fmt.Sprintf("Identical job list was uploaded within the last %s; pass force=true to run it again", duplicateWindow),
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	// Follow-up batches for later feed entries start from the first job's settings
+	var feedTemplate BatchJob
+	if config.Feed.Watch {
+		feedTemplate = process.Jobs[0]
+	}
+
+	// Split jobs between prompt variants
+	if config.ABTest.enabled() {
+		process.Jobs = assignVariants(process.Jobs, config.ABTest)
+	}
+
+	// Number jobs after variant assignment so each has a stable index
+	for i := range process.Jobs {
+		process.Jobs[i].Index = i
+	}
+
+	// Give the batch its own data key, wrapped by the master key
+	if config.EncryptArtifacts {
+		if process.encryptionKey, err = newBatchKey(process.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if config.Feed.enabled() {
+		process.Feed = &FeedSource{URL: config.Feed.URL}
+	}
+
+	// Store the process
+	processes.put(process)
+	if !stream {
+		rememberBatch(fingerprint, process.ID)
+	}
+
+	// Start processing in a goroutine
+	if stream {
+		log.Printf("Batch %s uploaded from %s, streaming its rows", process.ID, clientIP(r))
+		audit.record(r, auditUpload, process.ID, "streaming upload")
+	} else {
+		log.Printf("Batch %s uploaded from %s with %d jobs", process.ID, clientIP(r), len(process.Jobs))
+		audit.record(r, auditUpload, process.ID, fmt.Sprintf("%d jobs", len(process.Jobs)))
+	}
+	streamStarted = true
+	scheduler.submit(process)
+	process.publishEvent(eventBatchCreated)
+
+	if config.Feed.Watch {
+		seen := make(map[string]bool, len(process.Jobs))
+		for _, job := range process.Jobs {
+			seen[job.URL] = true
+		}
+		process.watchFeed(config.Feed, config.ABTest, feedTemplate, seen)
+	}
+
+	// Return the batch ID, with the validation report when rows were skipped or flagged
+	response := map[string]interface{}{
+		"batch_id": process.ID,
+		"status":   "pending",
+		"message":  fmt.Sprintf("Successfully queued %d jobs", len(process.Jobs)),
+	}
+	if stream {
+		// The report grows as rows are read, so it is only served with the batch status
+		response["message"] = "Streaming jobs from the upload; see the batch status for progress and validation"
+	} else if report.hasIssues() {
+		response["validation"] = report
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// normalizeHeader lowercases a CSV header and strips surrounding whitespace and any BOM
+func normalizeHeader(header string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))
+}
+
+// getColumnIndex helper function to find column index by name
+func getColumnIndex(headers []string, columnName string) int {
+	for i, header := range headers {
+		if strings.EqualFold(strings.TrimSpace(header), columnName) { // Using EqualFold instead of ToLower
+			return i
+		}
+	}
+	return -1
+}
+
+// updateJob updates a job in the batch process
+
+func (bp *BatchProcess) updateJob(updatedJob BatchJob) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	// Jobs are usually stored at their index; ranking may have reordered them
+	if i := updatedJob.Index; i < len(bp.Jobs) && bp.Jobs[i].Index == i {
+		bp.recordFinished(updatedJob)
+		bp.Jobs[i] = updatedJob
+		bp.recordJobEvent(updatedJob)
+		return
+	}
+	// Find and update the job
+	for i := range bp.Jobs {
+		if bp.Jobs[i].Index == updatedJob.Index {
+			bp.recordFinished(updatedJob)
+			bp.Jobs[i] = updatedJob
+			bp.recordJobEvent(updatedJob)
+			break
+		}
+	}
+}
+
+// notifyClients sends updates to all connected WebSocket clients
+func (bp *BatchProcess) notifyClients() {
+	feed.publish(bp.ID)
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.touch()
+
+	for _, client := range bp.clients {
+		select {
+		case client <- true:
+			// Successfully sent update
+		default:
+			// Channel is full or closed, skip
+		}
+	}
+}
+
+// startProcessing handles the batch processing with a worker pool
+func (bp *BatchProcess) startProcessing() {
+	// Cancelled with errBatchCancelled when an operator cancels the batch
+	run, stop := context.WithCancelCause(context.Background())
+	defer stop(nil)
+	bp.mu.Lock()
+	bp.stop = stop
+	retry := bp.retry
+	bp.retry = nil
+	bp.mu.Unlock()
+
+	// Find candidate pages for jobs that only have a model number. A retry
+	// keeps the pages found the first time.
+	if bp.discovery.enabled() && retry == nil {
+		bp.mu.Lock()
+		bp.Status = "discovering"
+		bp.mu.Unlock()
+		bp.notifyClients()
+		bp.publishEvent(eventBatchStage)
+		bp.runDiscovery(run, bp.discovery)
+	}
+
+	// Rank candidate URLs per model and scrape the most authoritative ones first.
+	// When grouping, each model's URLs are kept adjacent so they are scraped together.
+	bp.mu.Lock()
+	rankSources(bp.Jobs, bp.sourceRanking)
+	sort.SliceStable(bp.Jobs, func(i, j int) bool {
+		if bp.GroupByModel && bp.Jobs[i].ModelNumber != bp.Jobs[j].ModelNumber {
+			return bp.Jobs[i].ModelNumber < bp.Jobs[j].ModelNumber
+		}
+		return bp.Jobs[i].SourceRank < bp.Jobs[j].SourceRank
+	})
+	bp.Status = "processing"
+	bp.mu.Unlock()
+	bp.publishEvent(eventBatchStage)
+
+	// Seal everything written for this batch while it runs
+	seal := func(jobs []BatchJob) {}
+	if bp.encryptionKey != nil {
+		prefixes := []string{filepath.Join(bp.DataDir, bp.ID) + "_"}
+		seal = func(jobs []BatchJob) {
+			for _, job := range jobs {
+				prefixes = append(prefixes, modelDirFor(bp.DataDir, job.ModelNumber)+string(filepath.Separator))
+				artifactKeys.register(prefixes[len(prefixes)-1], bp.encryptionKey)
+			}
+		}
+		artifactKeys.register(prefixes[0], bp.encryptionKey)
+		defer func() {
+			for _, prefix := range prefixes {
+				artifactKeys.unregister(prefix, bp.encryptionKey)
+			}
+		}()
+	}
+
+	// Cancelled once every job has finished, stopping the background helpers
+	ctx, cancel := context.WithCancel(run)
+	defer cancel()
+
+	// Start the watchdog for stuck jobs
+	bp.mu.Lock()
+	bp.watchdog = newJobWatchdog(bp.jobHardLimit)
+	bp.mu.Unlock()
+	go bp.watchdog.run(ctx)
+
+	// With adaptive concurrency, start the maximum number of workers and let
+	// the limiter decide how many of them may run a job at once
+	workers := numWorkers
+	var limiter *adaptiveLimiter
+	if bp.adaptive.Enabled {
+		workers = bp.adaptive.Max
+		limiter = newAdaptiveLimiter(bp.adaptive)
+		bp.mu.Lock()
+		bp.Concurrency = limiter.level()
+		bp.mu.Unlock()
+		go limiter.run(ctx, func(level int) {
+			log.Printf("Batch %s: adaptive concurrency now %d", bp.ID, level)
+			bp.mu.Lock()
+			bp.Concurrency = level
+			bp.mu.Unlock()
+			bp.notifyClients()
+		})
+	}
+
+	bp.mu.Lock()
+	var queue []BatchJob
+	for _, job := range bp.Jobs {
+		if job.Status != statusSkippedBySampling && (retry == nil || retry[job.Index]) {
+			queue = append(queue, job)
+		}
+	}
+	known := make(map[string]bool, len(bp.Jobs))
+	for _, job := range bp.Jobs {
+		known[job.URL] = true
+	}
+	bp.mu.Unlock()
+
+	// Jobs run in rounds: the children spawned by one round's jobs run in the
+	// next, until no more are spawned. Children count towards the total as
+	// soon as their parent finishes, so progress covers all known work.
+	completed, total := 0, len(queue)
+	var spawned []BatchJob
+	onDone := func(job BatchJob) {
+		known[job.URL] = true
+		children := bp.spawnChildren(ctx, job, known)
+		spawned = append(spawned, children...)
+		bp.mu.Lock()
+		completed++
+		total += len(children)
+		bp.Progress = (completed * 100) / total
+		bp.mu.Unlock()
+	}
+
+	// A streamed upload is the first round, read while its jobs run. Its
+	// total grows with every row read.
+	if bp.stream != nil {
+		bp.runStream(ctx, workers, limiter, func(job BatchJob) {
+			seal([]BatchJob{job})
+			bp.mu.Lock()
+			total++
+			bp.mu.Unlock()
+		}, onDone)
+		queue = bp.addChildren(spawned)
+	}
+
+	for len(queue) > 0 {
+		seal(queue)
+		spawned = nil
+		bp.runRound(ctx, workers, limiter, queue, onDone)
+		queue = bp.addChildren(spawned)
+		if len(queue) > 0 {
+			log.Printf("Batch %s: spawned %d child jobs", bp.ID, len(queue))
+		}
+	}
+
+	bp.mu.Lock()
+	bp.Status = "completed"
+	if context.Cause(run) == errBatchCancelled {
+		bp.Status = statusCancelled
+	}
+	bp.stop = nil
+	bp.EndTime = time.Now()
+	bp.mu.Unlock()
+	bp.buildVariantReport()
+	bp.buildSummary()
+	bp.buildSharedAssets()
+	bp.writeRelatedProducts()
+	bp.consolidate()
+	bp.evaluate()
+	bp.exportBatch()
+	bp.deliver()
+	bp.notifyClients()
+	bp.publishEvent(eventBatchCompleted)
+	notifications.batchFinished(bp)
+}
+
+// runRound runs queue on the worker pool, recording each finished job and
+// passing it to onDone before clients are notified
+func (bp *BatchProcess) runRound(ctx context.Context, workers int, limiter *adaptiveLimiter, queue []BatchJob, onDone func(BatchJob)) {
+	pool.Run(ctx, workers, queue, bp.jobFunc(limiter), bp.resultFunc(onDone))
+}
+
+// jobFunc runs one job on a pool worker
+func (bp *BatchProcess) jobFunc(limiter *adaptiveLimiter) func(context.Context, BatchJob) (BatchJob, error) {
+	return func(ctx context.Context, job BatchJob) (BatchJob, error) {
+		// Jobs that already failed in an earlier stage are passed straight through
+		if job.Status == "failed" {
+			return job, nil
+		}
+		return bp.runJob(ctx, job, limiter), nil
+	}
+}
+
+// resultFunc records a finished job and passes it to onDone before clients are notified
+func (bp *BatchProcess) resultFunc(onDone func(BatchJob)) func(pool.Result[BatchJob, BatchJob]) {
+	return func(r pool.Result[BatchJob, BatchJob]) {
+		job := r.Output
+		if errors.Is(r.Err, context.Canceled) {
+			// The batch was cancelled before the job started
+			job = r.Input
+			job.cancel()
+		} else if r.Err != nil {
+			// The job panicked or was never started
+			job = r.Input
+			job.Status = "failed"
+			job.Error = r.Err.Error()
+			job.ErrorCode = errCodeInternal
+			log.Printf("Batch %s: job %d failed: %v", bp.ID, job.Index, r.Err)
+		}
+		bp.updateJob(job)
+		onDone(job)
+		bp.notifyClients()
+	}
+}
+
+// runJob processes a single job under the watchdog and records its outcome
+func (bp *BatchProcess) runJob(ctx context.Context, job BatchJob, limiter *adaptiveLimiter) BatchJob {
+	job.log = bp.jobLog(job.Index)
+	job.logf("Picked up by a worker (status %s)", job.Status)
+
+	// Yield to higher-priority batches and respect the schedule window
+	turnErr := scheduler.waitTurn(ctx, bp)
+	if context.Cause(ctx) == errBatchCancelled {
+		job.cancel()
+		job.logf("Cancelled before it started")
+		return job
+	}
+	if turnErr != nil {
+		job.Status = "failed"
+		job.Error = turnErr.Error()
+		job.ErrorCode = errCodeTimeout
+		job.logf("Failed waiting for its turn: %v", turnErr)
+		return job
+	}
+
+	// Pause while the output volume is low on space
+	waitForDiskSpace(ctx, bp.DataDir, bp.minFreeDisk, func(free uint64) {
+		bp.mu.Lock()
+		bp.Status = "paused_disk_space"
+		bp.mu.Unlock()
+		bp.notifyClients()
+	})
+	bp.mu.Lock()
+	if bp.Status == "paused_disk_space" {
+		bp.Status = "processing"
+	}
+	bp.mu.Unlock()
+
+	// Replayed jobs make no requests and do not count against the budget
+	if !job.replay && job.simulation == nil && !crawlBudget.reserve(job.URL) {
+		job.Status = "failed"
+		job.Error = fmt.Sprintf("daily request budget for %s is exhausted", jobDomain(job.URL))
+		job.ErrorCode = errCodeBudget
+		job.logf("Failed: %s", job.Error)
+		bp.publishJobEvent(eventJobFailed, job)
+		return job
+	}
+
+	job.Status = "processing"
+	job.logf("Status processing")
+	bp.publishJobEvent(eventJobStarted, job)
+
+	// Wait until the batch's working set has room for another job
+	releaseMemory, err := bp.memory.acquire(ctx)
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		job.ErrorCode = errCodeTimeout
+		job.logf("Failed waiting for memory: %v", err)
+		return job
+	}
+	defer releaseMemory()
+
+	if limiter != nil {
+		limiter.acquire()
+	}
+	started := time.Now()
+	job, err = bp.watchdog.runWithWatchdog(ctx, job, bp.DataDir)
+	if limiter != nil {
+		limiter.release(time.Since(started), err != nil)
+	}
+	job.heartbeat = nil
+	if err == nil {
+		documentIndex.add(bp.ID, &job, indexText(job.content, job.extraction), bp.encryptionKey != nil)
+	}
+	job.content = ""
+	job.DurationMs = time.Since(started).Milliseconds()
+	if job.simulation == nil {
+		domainStats.record(job.URL, time.Since(started), job.BytesDownloaded, err != nil, job.blocked)
+	}
+
+	if err != nil && context.Cause(ctx) == errBatchCancelled {
+		job.cancel()
+	} else if err == errJobStuck || err == errJobHardTimeout {
+		job.Status = "timed_out"
+		job.Error = err.Error()
+		job.ErrorCode = errCodeTimeout
+	} else if errorCode(err) == errCodeLowQuality {
+		job.Status = "low_quality"
+		job.Error = err.Error()
+		job.ErrorCode = errCodeLowQuality
+	} else if errorCode(err) == errCodeNotFound {
+		job.Status = statusNotFound
+		job.Error = err.Error()
+		job.ErrorCode = errCodeNotFound
+	} else if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		job.ErrorCode = errorCode(err)
+	} else if job.notModified {
+		job.Status = "not_modified"
+		job.Progress = 100
+	} else {
+		job.Status = "completed"
+		job.Progress = 100
+	}
+	if job.Error != "" {
+		job.logf("Status %s after %dms: %s", job.Status, job.DurationMs, job.Error)
+	} else {
+		job.logf("Status %s after %dms", job.Status, job.DurationMs)
+	}
+	jobHistory.record(bp.ID, job)
+	if jobSucceeded(job.Status) {
+		bp.publishJobEvent(eventJobCompleted, job)
+	} else {
+		bp.publishJobEvent(eventJobFailed, job)
+	}
+	return job
+}
+
+// buildVariantReport attaches the prompt comparison report once all jobs are done
+func (bp *BatchProcess) buildVariantReport() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	var samples []variantSample
+	for _, job := range bp.Jobs {
+		if job.PromptVariant == "" {
+			continue
+		}
+		samples = append(samples, variantSample{
+			variant:      job.PromptVariant,
+			failed:       job.Status == "failed",
+			completeness: job.Completeness,
+			tokens:       job.TokensUsed,
+			cost:         job.Cost,
+		})
+	}
+	if len(samples) > 0 {
+		report := buildVariantReport(samples)
+		bp.VariantReport = &report
+	}
+}
+
+// buildSummary attaches batch statistics once all jobs are done
+func (bp *BatchProcess) buildSummary() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	summary := summarizeJobs(bp.Jobs)
+	bp.Summary = &summary
+}
+
+// consolidate merges the results of jobs sharing a model number when grouping is enabled
+func (bp *BatchProcess) consolidate() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	if !bp.GroupByModel {
+		return
+	}
+
+	bp.Consolidated = consolidateByModel(bp.Jobs, bp.ConflictResolution)
+	for _, record := range bp.Consolidated {
+		if err := saveModelRecord(bp.DataDir, record); err != nil {
+			log.Printf("Failed to save consolidated record for model %s: %v", record.ModelNumber, err)
+		}
+	}
+}
+
+// exportBatch writes batch-level exports once all jobs are done
+func (bp *BatchProcess) exportBatch() {
+	// Hooks run before taking the lock so they can read the batch through its methods
+	hookErr := hooks.beforeExport(context.Background(), bp)
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if hookErr != nil {
+		log.Printf("Skipping exports for batch %s: %v", bp.ID, hookErr)
+	} else if bp.export.wants(exportWideCSV) {
+		path := filepath.Join(bp.DataDir, bp.ID+"_results_wide.csv")
+		if err := writeWideCSV(path, bp.Jobs, bp.export); err != nil {
+			log.Printf("Failed to write wide export for batch %s: %v", bp.ID, err)
+		}
+	}
+
+	// Products the catalog hook could not link are listed for review
+	if hookErr == nil {
+		path := filepath.Join(bp.DataDir, bp.ID+"_unmatched.csv")
+		if n, err := writeUnmatchedCSV(path, bp.Jobs); err != nil {
+			log.Printf("Failed to write unmatched products for batch %s: %v", bp.ID, err)
+		} else if n > 0 {
+			log.Printf("Batch %s: %d products not found in the catalog", bp.ID, n)
+		}
+	}
+
+	// Checksum every artifact last, so the manifest covers the exports too
+	bp.writeManifest()
+}
+
+// handleBatchStatus returns the current state of a batch, including its summary when
+// finished. With ?view=tree, jobs are nested under the jobs that spawned them.
+func handleBatchStatus(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	process, exists := processes.get(batchID)
+	if !exists {
+		batchGC.notFound(w, batchID)
+		return
+	}
+	if r.URL.Query().Get("view") == "tree" {
+		writeJobTree(w, process)
+		return
+	}
+
+	process.mu.Lock()
+	defer process.mu.Unlock()
+	process.touch()
+	if process.watchdog != nil {
+		for i := range process.Jobs {
+			if beat, ok := process.watchdog.lastBeat(process.Jobs[i].Index); ok {
+				process.Jobs[i].LastHeartbeat = beat
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(process)
+}
+
+// registerRoutes adds the API's endpoints to a router, with batch routes
+// below the given path
+func registerRoutes(api *mux.Router, batches string) {
+	api.HandleFunc("/upload", handleFileUpload).Methods("POST")
+	api.HandleFunc("/ws/all", handleBatchFeed)
+	api.HandleFunc("/ws/{batch_id}", handleWebSocket)
+	api.HandleFunc(batches+"/import", handleImportBatch).Methods("POST")
+	api.HandleFunc(batches+"/bulk", handleBulkAction).Methods("POST")
+	api.HandleFunc(batches+"/{batch_id}", handleBatchStatus).Methods("GET")
+	api.HandleFunc(batches+"/{batch_id}/archive", handleArchiveBatch).Methods("POST")
+	api.HandleFunc(batches+"/{batch_id}/feed", handleStopFeedWatch).Methods("DELETE")
+	api.HandleFunc(batches+"/{batch_id}/jobs/{index}/logs", handleJobLogs).Methods("GET")
+	api.HandleFunc(batches+"/{batch_id}/results", handleBatchResults).Methods("GET")
+	api.HandleFunc(batches+"/{batch_id}/verify", handleVerifyBatch).Methods("GET")
+	api.HandleFunc("/manifests/verify", handleVerifyManifest).Methods("POST")
+	api.HandleFunc("/stats/domains", handleDomainStats).Methods("GET")
+	api.HandleFunc("/stats/memory", handleMemoryStats).Methods("GET")
+	api.HandleFunc("/reports/throughput", handleThroughputReport).Methods("GET")
+	api.HandleFunc("/search", handleSearch).Methods("GET")
+	api.HandleFunc("/admin/maintenance", handleMaintenance).Methods("GET", "POST")
+	api.HandleFunc("/audit", handleAudit).Methods("GET")
+	api.HandleFunc("/models/{model_number}", handleModel).Methods("GET")
+	api.HandleFunc("/results/{model}/versions", handleListVersions).Methods("GET")
+	api.HandleFunc("/results/{model}/versions/{version}", handleGetVersion).Methods("GET")
+}
+
+func main() {
+	if err := selectProfile(); err != nil {
+		log.Fatalf("Failed to load profile: %v", err)
+	}
+	dataDir = longPathDir(dataDir)
+
+	// Earlier versions named site folders after the hostname only
+	if n, err := migrateSiteFolders(dataDir); err != nil {
+		log.Printf("Failed to migrate site folders: %v", err)
+	} else if n > 0 {
+		log.Printf("Migrated %d site folders to per-page site IDs", n)
+	}
+
+	// Reload the search index kept by earlier runs
+	if err := documentIndex.open(filepath.Join(dataDir, searchIndexFile)); err != nil {
+		log.Printf("Search index is kept in memory only: %v", err)
+	}
+
+	router := mux.NewRouter()
+	api := apiRouter(router)
+
+	// Start the batch scheduler, the collector for stale batches and the notification digests
+	go scheduler.run()
+	go batchGC.run()
+	go notifications.run()
+
+	// Routes below /v1 with enveloped responses, and the unversioned ones
+	// existing clients use, which are deprecated
+	v1 := api.PathPrefix("/" + apiVersion).Subrouter()
+	v1.Use(envelope)
+	registerRoutes(v1, v1BatchPath)
+	legacy := api.NewRoute().Subrouter()
+	legacy.Use(deprecated)
+	registerRoutes(legacy, legacyBatchPath)
+
+	// Start server
+	log.Printf("Starting server on %s%s", listenAddr(), basePath())
+	// Proxy headers and access logs wrap the router so unmatched paths are logged too
+	log.Fatal(http.ListenAndServe(listenAddr(), proxyHeaders(accessLog(negotiateVersion(router)))))
+}
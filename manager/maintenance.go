@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter is suggested to clients while maintenance mode is on
+const defaultRetryAfter = 5 * time.Minute
+
+// maintenanceState stops new work so a deploy can wait for active jobs to finish
+type maintenanceState struct {
+	mu         sync.RWMutex
+	enabled    bool
+	since      time.Time
+	retryAfter time.Duration
+}
+
+var maintenance = &maintenanceState{}
+
+// active reports whether maintenance mode is on
+func (m *maintenanceState) active() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled
+}
+
+// set turns maintenance mode on or off
+func (m *maintenanceState) set(enabled bool, retryAfter time.Duration) {
+	m.mu.Lock()
+	if enabled && !m.enabled {
+		m.since = time.Now()
+	}
+	m.enabled = enabled
+	m.retryAfter = retryAfter
+	m.mu.Unlock()
+
+	// Let held batches and workers resume promptly
+	scheduler.signal()
+}
+
+// rejectUpload answers 503 with Retry-After while maintenance mode is on
+func (m *maintenanceState) rejectUpload(w http.ResponseWriter) bool {
+	m.mu.RLock()
+	enabled, retryAfter := m.enabled, m.retryAfter
+	m.mu.RUnlock()
+	if !enabled {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	http.Error(w, "Server is in maintenance mode and not accepting new batches; retry later", http.StatusServiceUnavailable)
+	return true
+}
+
+// activeJobs counts jobs currently running across all batches
+func activeJobs() int {
+	scheduler.mu.Lock()
+	running := make([]*BatchProcess, 0, len(scheduler.running))
+	for _, bp := range scheduler.running {
+		running = append(running, bp)
+	}
+	scheduler.mu.Unlock()
+
+	count := 0
+	for _, bp := range running {
+		bp.mu.Lock()
+		watchdog := bp.watchdog
+		bp.mu.Unlock()
+		if watchdog != nil {
+			count += watchdog.activeCount()
+		}
+	}
+	return count
+}
+
+// handleMaintenance turns maintenance mode on or off. The response reports how
+// many jobs are still running, so a deploy can poll until it reaches zero.
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var body struct {
+			Enabled    bool `json:"enabled"`
+			RetryAfter int  `json:"retry_after"` // Seconds
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		retryAfter := defaultRetryAfter
+		if body.RetryAfter > 0 {
+			retryAfter = time.Duration(body.RetryAfter) * time.Second
+		}
+		maintenance.set(body.Enabled, retryAfter)
+		audit.record(r, auditMaintenance, "", "enabled="+strconv.FormatBool(body.Enabled))
+	}
+
+	maintenance.mu.RLock()
+	response := map[string]interface{}{
+		"maintenance": maintenance.enabled,
+		"active_jobs": activeJobs(),
+	}
+	if maintenance.enabled {
+		response["since"] = maintenance.since
+		response["retry_after"] = int(maintenance.retryAfter.Seconds())
+	}
+	maintenance.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Manifests are signed with an Ed25519 private key (PKCS#8 PEM) from
+// MANIFEST_SIGNING_PRIVATE_KEY_FILE or, failing that, with HMAC-SHA256 using
+// the manifest_signing_key secret (MANIFEST_SIGNING_KEY with the default
+// secret provider). Consumers holding only the public key verify Ed25519
+// signatures with MANIFEST_VERIFY_PUBLIC_KEY_FILE set.
+const (
+	signingPrivateKeyEnv = "MANIFEST_SIGNING_PRIVATE_KEY_FILE"
+	verifyPublicKeyEnv   = "MANIFEST_VERIFY_PUBLIC_KEY_FILE"
+	secretManifestKey    = "manifest_signing_key"
+)
+
+// Manifest signature algorithms
+const (
+	signHMACSHA256 = "hmac-sha256"
+	signEd25519    = "ed25519"
+)
+
+// ManifestEntry is the checksum of one artifact, relative to the batch's data directory
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists every artifact of a batch with its checksum
+type Manifest struct {
+	BatchID   string          `json:"batch_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Files     []ManifestEntry `json:"files"`
+	// URL each downloaded document was fetched from, by manifest path
+	Sources map[string]string `json:"sources,omitempty"`
+
+	// Signature over the manifest with Signature left empty
+	Algorithm string `json:"algorithm,omitempty"`
+	KeyID     string `json:"key_id,omitempty"` // Identifies the Ed25519 public key
+	Signature string `json:"signature,omitempty"`
+}
+
+// fileSHA256 streams a file through SHA-256
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// batchArtifactRoots returns the directories and files produced by a batch
+func (bp *BatchProcess) batchArtifactRoots() []string {
+	seen := make(map[string]bool)
+	var roots []string
+	for _, job := range bp.Jobs {
+		for _, dir := range []string{
+			filepath.Join(modelDirFor(bp.DataDir, job.ModelNumber), "results"),
+			filepath.Join(modelDirFor(bp.DataDir, job.ModelNumber), "documents"),
+		} {
+			if !seen[dir] {
+				seen[dir] = true
+				roots = append(roots, dir)
+			}
+		}
+	}
+
+	// Batch-level exports are named after the batch
+	exports, _ := filepath.Glob(filepath.Join(bp.DataDir, bp.ID+"_*"))
+	for _, export := range exports {
+		if !strings.HasSuffix(export, "_manifest.json") {
+			roots = append(roots, export)
+		}
+	}
+	return roots
+}
+
+// buildManifest checksums every artifact under roots
+func buildManifest(batchID, baseDir string, roots []string) (*Manifest, error) {
+	manifest := &Manifest{BatchID: batchID, CreatedAt: time.Now().UTC()}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			// Skip directories and in-flight temp files from writeFileAtomic
+			if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return nil
+			}
+			sum, size, err := fileSHA256(path)
+			if err != nil {
+				return fmt.Errorf("failed to checksum %s: %w", path, err)
+			}
+			rel, err := filepath.Rel(baseDir, path)
+			if err != nil {
+				rel = path
+			}
+			manifest.Files = append(manifest.Files, ManifestEntry{Path: filepath.ToSlash(rel), Size: size, SHA256: sum})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	return manifest, nil
+}
+
+// manifestSigner signs and verifies manifest payloads
+type manifestSigner interface {
+	algorithm() string
+	keyID() string
+	sign(payload []byte) ([]byte, error)
+	verify(payload, signature []byte) bool
+}
+
+type hmacSigner struct {
+	key []byte
+}
+
+func (s hmacSigner) algorithm() string { return signHMACSHA256 }
+func (s hmacSigner) keyID() string     { return "" }
+
+func (s hmacSigner) sign(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
+
+func (s hmacSigner) verify(payload, signature []byte) bool {
+	expected, _ := s.sign(payload)
+	return hmac.Equal(expected, signature)
+}
+
+// ed25519Signer signs with a private key; with only a public key it verifies
+type ed25519Signer struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func (s ed25519Signer) algorithm() string { return signEd25519 }
+
+func (s ed25519Signer) keyID() string {
+	sum := sha256.Sum256(s.public)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s ed25519Signer) sign(payload []byte) ([]byte, error) {
+	if s.private == nil {
+		return nil, fmt.Errorf("no private key to sign with")
+	}
+	return ed25519.Sign(s.private, payload), nil
+}
+
+func (s ed25519Signer) verify(payload, signature []byte) bool {
+	return ed25519.Verify(s.public, payload, signature)
+}
+
+// loadEd25519Key reads a PKCS#8 private or PKIX public key from a PEM file
+func loadEd25519Key(path string) (ed25519Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ed25519Signer{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ed25519Signer{}, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if private, ok := key.(ed25519.PrivateKey); ok {
+			return ed25519Signer{private: private, public: private.Public().(ed25519.PublicKey)}, nil
+		}
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		if public, ok := key.(ed25519.PublicKey); ok {
+			return ed25519Signer{public: public}, nil
+		}
+	}
+	return ed25519Signer{}, fmt.Errorf("%s holds no Ed25519 key", path)
+}
+
+// manifestSigners returns the signers configured for the deployment, by
+// algorithm. The signing key is re-read each time so rotation takes effect.
+func manifestSigners() (map[string]manifestSigner, error) {
+	signers := make(map[string]manifestSigner)
+	for _, env := range []string{verifyPublicKeyEnv, signingPrivateKeyEnv} {
+		if path := os.Getenv(env); path != "" {
+			signer, err := loadEd25519Key(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", env, err)
+			}
+			signers[signEd25519] = signer
+		}
+	}
+	if key := secrets.get(secretManifestKey); key != "" {
+		signers[signHMACSHA256] = hmacSigner{key: []byte(key)}
+	}
+	return signers, nil
+}
+
+// signingManifestSigner returns the signer new manifests are signed with, or
+// nil when signing is not configured
+func signingManifestSigner() (manifestSigner, error) {
+	signers, err := manifestSigners()
+	if err != nil {
+		return nil, err
+	}
+	if signer, ok := signers[signEd25519].(ed25519Signer); ok && signer.private != nil {
+		return signer, nil
+	}
+	if signer, ok := signers[signHMACSHA256]; ok {
+		return signer, nil
+	}
+	return nil, nil
+}
+
+// signingPayload is the manifest as signed: without its signature
+func (m *Manifest) signingPayload() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	return json.Marshal(unsigned)
+}
+
+// sign sets the manifest's signature
+func (m *Manifest) sign(signer manifestSigner) error {
+	m.Algorithm, m.KeyID, m.Signature = signer.algorithm(), signer.keyID(), ""
+	payload, err := m.signingPayload()
+	if err != nil {
+		return err
+	}
+	signature, err := signer.sign(payload)
+	if err != nil {
+		return err
+	}
+	m.Signature = hex.EncodeToString(signature)
+	return nil
+}
+
+// verifySignature checks the manifest's signature with the configured keys
+func (m *Manifest) verifySignature(signers map[string]manifestSigner) error {
+	if m.Signature == "" {
+		return fmt.Errorf("manifest is not signed")
+	}
+	signer, ok := signers[m.Algorithm]
+	if !ok {
+		return fmt.Errorf("no key configured for %s signatures", m.Algorithm)
+	}
+	if m.KeyID != signer.keyID() {
+		return fmt.Errorf("manifest was signed with key %s, not %s", m.KeyID, signer.keyID())
+	}
+	signature, err := hex.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature")
+	}
+	payload, err := m.signingPayload()
+	if err != nil {
+		return err
+	}
+	if signer.verify(payload, signature) {
+		return nil
+	}
+	// Earlier HMAC manifests were signed with the algorithm left empty too
+	if m.Algorithm == signHMACSHA256 {
+		legacy := *m
+		legacy.Algorithm, legacy.KeyID = "", ""
+		if payload, err := legacy.signingPayload(); err == nil && signer.verify(payload, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature does not match the manifest")
+}
+
+// downloadSources maps the manifest path of each mirrored document to its URL
+func (bp *BatchProcess) downloadSources() map[string]string {
+	sources := make(map[string]string)
+	for _, job := range bp.Jobs {
+		if job.MirrorPath == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(bp.DataDir, job.MirrorPath); err == nil {
+			sources[filepath.ToSlash(rel)] = job.URL
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+	return sources
+}
+
+// writeManifest checksums the batch's artifacts into <DataDir>/<batchID>_manifest.json
+func (bp *BatchProcess) writeManifest() {
+	manifest, err := buildManifest(bp.ID, bp.DataDir, bp.batchArtifactRoots())
+	if err != nil {
+		log.Printf("Failed to build manifest for batch %s: %v", bp.ID, err)
+		return
+	}
+	manifest.Sources = bp.downloadSources()
+	signer, err := signingManifestSigner()
+	if err != nil {
+		log.Printf("Failed to sign manifest for batch %s: %v", bp.ID, err)
+		return
+	}
+	if signer != nil {
+		if err := manifest.sign(signer); err != nil {
+			log.Printf("Failed to sign manifest for batch %s: %v", bp.ID, err)
+			return
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal manifest for batch %s: %v", bp.ID, err)
+		return
+	}
+	path := filepath.Join(bp.DataDir, bp.ID+"_manifest.json")
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		log.Printf("Failed to write manifest for batch %s: %v", bp.ID, err)
+	}
+}
+
+// ManifestVerification reports whether a batch's artifacts still match its manifest
+type ManifestVerification struct {
+	BatchID        string   `json:"batch_id"`
+	Intact         bool     `json:"intact"` // Signature valid and every file unchanged
+	Signed         bool     `json:"signed"`
+	SignatureValid bool     `json:"signature_valid"`
+	SignatureError string   `json:"signature_error,omitempty"`
+	Verified       int      `json:"verified"`           // Files whose checksum matches
+	Modified       []string `json:"modified,omitempty"` // Size or checksum differs
+	Missing        []string `json:"missing,omitempty"`
+	Unlisted       []string `json:"unlisted,omitempty"` // In the batch's directories but not in the manifest
+}
+
+// verifyManifest checks the signature and re-checksums every listed file
+// below baseDir. Files added next to the listed ones are reported as well.
+func verifyManifest(manifest *Manifest, baseDir string, signers map[string]manifestSigner) ManifestVerification {
+	report := ManifestVerification{BatchID: manifest.BatchID, Signed: manifest.Signature != ""}
+	if err := manifest.verifySignature(signers); err != nil {
+		report.SignatureError = err.Error()
+	} else {
+		report.SignatureValid = true
+	}
+
+	listed := make(map[string]bool, len(manifest.Files))
+	dirs := make(map[string]bool)
+	for _, entry := range manifest.Files {
+		listed[entry.Path] = true
+		if dir := path.Dir(entry.Path); dir != "." {
+			dirs[dir] = true
+		}
+		sum, size, err := fileSHA256(filepath.Join(baseDir, filepath.FromSlash(entry.Path)))
+		switch {
+		case os.IsNotExist(err):
+			report.Missing = append(report.Missing, entry.Path)
+		case err != nil || sum != entry.SHA256 || size != entry.Size:
+			report.Modified = append(report.Modified, entry.Path)
+		default:
+			report.Verified++
+		}
+	}
+
+	var roots []string
+	for dir := range dirs {
+		roots = append(roots, filepath.Join(baseDir, filepath.FromSlash(dir)))
+	}
+	exports, _ := filepath.Glob(filepath.Join(baseDir, manifest.BatchID+"_*"))
+	for _, export := range exports {
+		if !strings.HasSuffix(export, "_manifest.json") {
+			roots = append(roots, export)
+		}
+	}
+	for _, root := range roots {
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				return nil
+			}
+			// Only direct contents of listed directories; subdirectories may belong to other batches
+			if rel, err := filepath.Rel(baseDir, p); err == nil && !listed[filepath.ToSlash(rel)] && (dirs[path.Dir(filepath.ToSlash(rel))] || p == root) {
+				report.Unlisted = append(report.Unlisted, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+	}
+	sort.Strings(report.Unlisted)
+
+	report.Intact = report.SignatureValid && len(report.Modified) == 0 && len(report.Missing) == 0
+	return report
+}
+
+// handleVerifyBatch checks a batch's artifacts against its signed manifest.
+// Batches no longer in memory are looked up in the data directory.
+func handleVerifyBatch(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	if strings.ContainsAny(batchID, "/\\") || strings.Contains(batchID, "..") {
+		http.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+	baseDir := dataDir
+	if process, exists := processes.get(batchID); exists {
+		process.mu.Lock()
+		baseDir = process.DataDir
+		process.mu.Unlock()
+	}
+
+	data, err := readArtifact(filepath.Join(baseDir, batchID+"_manifest.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "No manifest for this batch", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to read manifest", http.StatusInternalServerError)
+		return
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		http.Error(w, "Manifest is not valid JSON", http.StatusUnprocessableEntity)
+		return
+	}
+	signers, err := manifestSigners()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verifyManifest(&manifest, baseDir, signers))
+}
+
+// handleVerifyManifest checks the signature of a manifest sent in the body,
+// for consumers that copied a batch's results elsewhere and checksum the
+// files themselves
+func handleVerifyManifest(w http.ResponseWriter, r *http.Request) {
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<20)).Decode(&manifest); err != nil {
+		http.Error(w, "Invalid manifest", http.StatusBadRequest)
+		return
+	}
+	signers, err := manifestSigners()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report := map[string]interface{}{"batch_id": manifest.BatchID, "signature_valid": true}
+	if err := manifest.verifySignature(signers); err != nil {
+		report["signature_valid"] = false
+		report["signature_error"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
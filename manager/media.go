@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Video hosts and formats recognized as media links
+const (
+	mediaYouTube = "youtube"
+	mediaVimeo   = "vimeo"
+	mediaWistia  = "wistia"
+	mediaFile    = "video_file"
+)
+
+// Where on the page a media link was found
+const (
+	mediaFromAnchor = "anchor"
+	mediaFromEmbed  = "embed" // <iframe>, <video>, <source>, <embed> or <object>
+	mediaFromJSONLD = "json_ld"
+)
+
+// MediaConfig controls media link collection
+type MediaConfig struct {
+	Disabled bool `json:"disabled"`
+	// Keep only links whose title, link text or URL contains one of these,
+	// e.g. "install" or "setup"; empty keeps every video
+	Keywords []string `json:"keywords"`
+}
+
+// isZero reports whether the config is the default
+func (c MediaConfig) isZero() bool {
+	return !c.Disabled && len(c.Keywords) == 0
+}
+
+// MediaLink is a video a page links to or embeds, such as an install guide
+// or a product demo
+type MediaLink struct {
+	URL      string `json:"url"` // Canonical watch URL for known hosts
+	Provider string `json:"provider"`
+	VideoID  string `json:"video_id,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Source   string `json:"source"`
+}
+
+var (
+	youTubeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoIDPattern   = regexp.MustCompile(`^\d{6,}$`)
+	wistiaIDPattern  = regexp.MustCompile(`^[a-z0-9]{10}$`)
+)
+
+// videoExtensions marks links that point at video files
+var videoExtensions = []string{".mp4", ".webm", ".mov", ".m4v", ".ogv"}
+
+// classifyMedia reports the provider and video ID of a URL, and the URL to
+// record for it. ok is false for URLs that are not videos.
+func classifyMedia(u *url.URL) (provider, id, canonical string, ok bool) {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	last := segments[len(segments)-1]
+
+	switch {
+	case host == "youtu.be":
+		id = segments[0]
+	case host == "youtube.com" || host == "youtube-nocookie.com":
+		if len(segments) >= 2 && (segments[0] == "embed" || segments[0] == "shorts" || segments[0] == "live" || segments[0] == "v") {
+			id = segments[1]
+		} else if segments[0] == "watch" {
+			id = u.Query().Get("v")
+		}
+	case host == "vimeo.com" || host == "player.vimeo.com":
+		id = last
+		if !vimeoIDPattern.MatchString(id) {
+			return "", "", "", false
+		}
+		return mediaVimeo, id, "https://vimeo.com/" + id, true
+	case strings.HasSuffix(host, "wistia.com") || strings.HasSuffix(host, "wistia.net"):
+		if len(segments) >= 2 && (segments[0] == "medias" || segments[len(segments)-2] == "iframe") && wistiaIDPattern.MatchString(last) {
+			return mediaWistia, last, u.String(), true
+		}
+		return "", "", "", false
+	default:
+		if hasSuffix(strings.ToLower(path.Ext(u.Path)), videoExtensions) {
+			return mediaFile, "", u.String(), true
+		}
+		return "", "", "", false
+	}
+	if !youTubeIDPattern.MatchString(id) {
+		return "", "", "", false
+	}
+	return mediaYouTube, id, "https://www.youtube.com/watch?v=" + id, true
+}
+
+// mediaLinks returns the videos among a page's anchors and embeds and in its
+// JSON-LD VideoObjects, resolved against the page URL. A video linked or
+// embedded more than once is listed once, with the first title found.
+func mediaLinks(pageURL string, anchors, embeds []pageLink, jsonLD []string, config MediaConfig) []MediaLink {
+	if config.Disabled {
+		return nil
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	type candidate struct {
+		link   pageLink
+		source string
+	}
+	var candidates []candidate
+	for _, embed := range embeds {
+		candidates = append(candidates, candidate{embed, mediaFromEmbed})
+	}
+	for _, video := range jsonLDVideos(jsonLD) {
+		candidates = append(candidates, candidate{video, mediaFromJSONLD})
+	}
+	for _, anchor := range anchors {
+		candidates = append(candidates, candidate{anchor, mediaFromAnchor})
+	}
+
+	index := make(map[string]int)
+	var links []MediaLink
+	for _, c := range candidates {
+		ref, err := url.Parse(strings.TrimSpace(c.link.Href))
+		if err != nil {
+			continue
+		}
+		resolved := base.ResolveReference(ref)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			continue
+		}
+		provider, id, canonical, ok := classifyMedia(resolved)
+		if !ok {
+			continue
+		}
+		title := strings.Join(strings.Fields(c.link.Text), " ")
+		if i, seen := index[canonical]; seen {
+			if links[i].Title == "" {
+				links[i].Title = title
+			}
+			continue
+		}
+		index[canonical] = len(links)
+		links = append(links, MediaLink{URL: canonical, Provider: provider, VideoID: id, Title: title, Source: c.source})
+	}
+	return filterMedia(links, config.Keywords)
+}
+
+// filterMedia keeps the links whose title or URL contains one of the keywords
+func filterMedia(links []MediaLink, keywords []string) []MediaLink {
+	if len(keywords) == 0 {
+		return links
+	}
+	var kept []MediaLink
+	for _, link := range links {
+		haystack := strings.ToLower(link.Title + " " + link.URL)
+		for _, keyword := range keywords {
+			if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" && strings.Contains(haystack, keyword) {
+				kept = append(kept, link)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// jsonLDVideos returns the embed and content URLs of the VideoObjects in the
+// page's JSON-LD, named after the video
+func jsonLDVideos(blocks []string) []pageLink {
+	var videos []pageLink
+	for _, block := range blocks {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(block), &doc); err != nil {
+			continue
+		}
+		video := findJSONLDType(doc, "VideoObject")
+		if video == nil {
+			continue
+		}
+		name := scalarText(video["name"])
+		for _, key := range []string{"embedUrl", "contentUrl", "url"} {
+			if href := scalarText(video[key]); href != "" {
+				videos = append(videos, pageLink{Href: href, Text: name})
+			}
+		}
+	}
+	return videos
+}
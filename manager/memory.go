@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// maxResponseBytes is the default cap on a parser response held in memory for one job
+var maxResponseBytes int64 = 64 << 20
+
+var errResponseTooLarge = fmt.Errorf("parser response exceeds the per-job memory cap")
+
+// responseLimit is the parser response one job of the upload may hold
+func (c Config) responseLimit() int64 {
+	if c.MaxJobMemoryMB > 0 {
+		return int64(c.MaxJobMemoryMB) << 20
+	}
+	return maxResponseBytes
+}
+
+// responseLimit is the parser response the job may hold in memory
+func (job *BatchJob) responseLimit() int64 {
+	if job.maxResponse > 0 {
+		return job.maxResponse
+	}
+	return maxResponseBytes
+}
+
+// jobMemoryEstimate is what a running job may hold at once: the parser
+// response plus the page text kept for indexing
+func jobMemoryEstimate(responseBytes int64, contentBytes int) int64 {
+	return responseBytes + int64(contentBytes)
+}
+
+// memoryBudget limits the combined working set of a batch's running jobs
+type memoryBudget struct {
+	limit    int64
+	perJob   int64 // What each job reserves, its jobMemoryEstimate
+	sem      *semaphore.Weighted
+	mu       sync.Mutex
+	reserved int64
+}
+
+func newMemoryBudget(limit, perJob int64) *memoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &memoryBudget{limit: limit, perJob: perJob, sem: semaphore.NewWeighted(limit)}
+}
+
+// acquire blocks until a job's estimate fits in the budget. A job larger
+// than the whole budget reserves all of it, so it still runs alone.
+func (m *memoryBudget) acquire(ctx context.Context) (func(), error) {
+	if m == nil {
+		return func() {}, nil
+	}
+	size := min64(m.perJob, m.limit)
+	if err := m.sem.Acquire(ctx, size); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.reserved += size
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		m.reserved -= size
+		m.mu.Unlock()
+		m.sem.Release(size)
+	}, nil
+}
+
+// usage returns the bytes currently reserved
+func (m *memoryBudget) usage() int64 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reserved
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// BatchMemory reports one batch's reserved working set
+type BatchMemory struct {
+	BatchID       string `json:"batch_id"`
+	ReservedBytes int64  `json:"reserved_bytes"`
+	LimitBytes    int64  `json:"limit_bytes,omitempty"`
+}
+
+// handleMemoryStats returns process memory and per-batch reservations
+func handleMemoryStats(w http.ResponseWriter, r *http.Request) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	batches := []BatchMemory{}
+	for _, process := range processes.snapshot() {
+		if process.memory == nil {
+			continue
+		}
+		batches = append(batches, BatchMemory{
+			BatchID:       process.ID,
+			ReservedBytes: process.memory.usage(),
+			LimitBytes:    process.memory.limit,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"heap_alloc_bytes":    stats.HeapAlloc,
+		"heap_inuse_bytes":    stats.HeapInuse,
+		"sys_bytes":           stats.Sys,
+		"gc_cycles":           stats.NumGC,
+		"goroutines":          runtime.NumGoroutine(),
+		"max_response_bytes":  maxResponseBytes,
+		"job_memory_estimate": jobMemoryEstimate(maxResponseBytes, maxContentBytes),
+		"batches":             batches,
+	})
+}
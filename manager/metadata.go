@@ -0,0 +1,48 @@
+package main
+
+import "sort"
+
+// knownColumns are CSV columns consumed by the pipeline; anything else is metadata
+var knownColumns = map[string]bool{
+	"url":               true,
+	"model_number":      true,
+	"parse_description": true,
+}
+
+// metadataPrefix namespaces metadata columns in exports so they cannot clash with result fields
+const metadataPrefix = "meta_"
+
+// rowMetadata collects the extra columns of a CSV record
+func rowMetadata(headers []string, record []string) map[string]string {
+	metadata := make(map[string]string)
+	for i, header := range headers {
+		name := normalizeHeader(header)
+		if name == "" || knownColumns[name] || i >= len(record) {
+			continue
+		}
+		metadata[name] = record[i]
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// metadataKeys returns metadata keys in a stable order
+func metadataKeys(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendMetadata extends a CSV header and record with metadata columns
+func appendMetadata(header, record []string, metadata map[string]string) ([]string, []string) {
+	for _, key := range metadataKeys(metadata) {
+		header = append(header, metadataPrefix+key)
+		record = append(record, metadata[key])
+	}
+	return header, record
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ModelSource is one page a model's results were collected from
+type ModelSource struct {
+	URL        string        `json:"url"`
+	SiteID     string        `json:"site_id,omitempty"`
+	Latest     ResultVersion `json:"latest"`   // The version merged into the view
+	Versions   int           `json:"versions"` // Results stored for the page over time
+	SourceRank int           `json:"source_rank,omitempty"`
+}
+
+// ModelView is every result collected for a model number, across batches
+// and sites, merged into one record
+type ModelView struct {
+	ModelNumber string        `json:"model_number"`
+	Record      ModelRecord   `json:"record"`
+	Sources     []ModelSource `json:"sources"`
+	// Pages that reported each merged field's value
+	FieldSources map[string][]string `json:"field_sources"`
+}
+
+// collectModelSources reads the latest stored result of every page scraped
+// for a model, most recently scraped first
+func collectModelSources(modelDir string) ([]ModelSource, []extractionSource, error) {
+	entries, err := os.ReadDir(filepath.Join(modelDir, "versions"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	type collected struct {
+		source     ModelSource
+		extraction extractionSource
+	}
+	var all []collected
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		rawURL, err := os.ReadFile(filepath.Join(modelDir, "versions", entry.Name(), "url.txt"))
+		if err != nil {
+			continue
+		}
+		versions, err := listResultVersions(modelDir, string(rawURL))
+		if err != nil || len(versions) == 0 {
+			continue
+		}
+		latest := versions[len(versions)-1]
+		data, err := readArtifact(filepath.Join(versionsDir(modelDir, latest.URL), latest.Version+".json"))
+		if err != nil {
+			continue
+		}
+		var result ParseResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			continue
+		}
+		all = append(all, collected{
+			source: ModelSource{
+				URL:        latest.URL,
+				SiteID:     result.SiteID,
+				Latest:     latest,
+				Versions:   len(versions),
+				SourceRank: result.SourceRank,
+			},
+			extraction: extractionSource{URL: latest.URL, Result: result.GeminiResult, Rank: result.SourceRank},
+		})
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].source.Latest.Timestamp.After(all[j].source.Latest.Timestamp) })
+	sources := make([]ModelSource, len(all))
+	extractions := make([]extractionSource, len(all))
+	for i, c := range all {
+		sources[i], extractions[i] = c.source, c.extraction
+	}
+	return sources, extractions, nil
+}
+
+// fieldSources lists, for each merged field, the pages whose value matches it
+func fieldSources(record ModelRecord, extractions []extractionSource) map[string][]string {
+	bySource := make(map[string][]string)
+	for field, value := range record.Fields {
+		if value == "NO_MATCH" {
+			continue
+		}
+		for _, source := range extractions {
+			info, _ := source.Result.(map[string]interface{})
+			if found, ok := info[field].(string); ok && normalizeForMatch(found) == normalizeForMatch(value) {
+				bySource[field] = append(bySource[field], source.URL)
+			}
+		}
+	}
+	return bySource
+}
+
+// handleModel merges every result collected for a model number, in any batch
+// and from any site, into one record with the pages each value came from.
+// ?conflict_resolution=first_source prefers the most recently scraped page;
+// the default takes the value most pages agree on.
+func handleModel(w http.ResponseWriter, r *http.Request) {
+	model := mux.Vars(r)["model_number"]
+	if strings.TrimSpace(model) == "" {
+		http.Error(w, "Invalid model number", http.StatusBadRequest)
+		return
+	}
+	rule := r.URL.Query().Get("conflict_resolution")
+	if rule == "" {
+		rule = resolveMostCommon
+	}
+	if rule != resolveMostCommon && rule != resolveFirstSource {
+		http.Error(w, "conflict_resolution must be most_common or first_source", http.StatusBadRequest)
+		return
+	}
+
+	sources, extractions, err := collectModelSources(modelDirFor(dataDir, model))
+	if err != nil {
+		http.Error(w, "Failed to read model results", http.StatusInternalServerError)
+		return
+	}
+	if len(sources) == 0 {
+		http.Error(w, "No results for this model number", http.StatusNotFound)
+		return
+	}
+
+	record := mergeModelSources(model, extractions, rule)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ModelView{
+		ModelNumber:  model,
+		Record:       record,
+		Sources:      sources,
+		FieldSources: fieldSources(record, extractions),
+	})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Batch notifications go to a Slack-compatible incoming webhook, configured
+// with NOTIFY_WEBHOOK_URL. In the default "batch" mode every finished batch
+// sends a message; NOTIFY_MODE=digest collects them and sends one summary
+// every NOTIFY_DIGEST_MINUTES, or earlier once a threshold is crossed.
+const (
+	notifyModeBatch  = "batch"
+	notifyModeDigest = "digest"
+)
+
+// notifySettings holds the notification configuration read from the environment
+type notifySettings struct {
+	webhookURL string
+	mode       string
+	interval   time.Duration
+	maxBatches int     // Send the digest early once this many batches are waiting, 0 to disable
+	maxCost    float64 // Send early once the waiting batches cost this much, 0 to disable
+	spikeRate  float64 // A batch with at least this share of failed jobs is a failure spike
+	spikeNow   bool    // Send the digest as soon as a failure spike arrives
+}
+
+func notifySettingsFromEnv() notifySettings {
+	s := notifySettings{
+		webhookURL: os.Getenv("NOTIFY_WEBHOOK_URL"),
+		mode:       strings.ToLower(os.Getenv("NOTIFY_MODE")),
+		interval:   time.Duration(envInt("NOTIFY_DIGEST_MINUTES", 60)) * time.Minute,
+		maxBatches: envInt("NOTIFY_DIGEST_MAX_BATCHES", 0),
+		maxCost:    envFloat("NOTIFY_DIGEST_MAX_COST", 0),
+		spikeRate:  envFloat("NOTIFY_FAILURE_SPIKE_RATE", 0.5),
+		spikeNow:   os.Getenv("NOTIFY_FAILURE_SPIKE_IMMEDIATE") == "true",
+	}
+	if s.mode != notifyModeDigest {
+		s.mode = notifyModeBatch
+	}
+	if s.interval <= 0 {
+		s.interval = time.Hour
+	}
+	return s
+}
+
+// envFloat reads a non-negative number from the environment
+func envFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		log.Printf("Ignoring invalid %s %q", name, value)
+		return fallback
+	}
+	return f
+}
+
+// batchNotice is what a notification says about one finished batch
+type batchNotice struct {
+	ID        string
+	Total     int
+	Succeeded int
+	Failed    int
+	Cost      float64
+	Duration  time.Duration
+	Spike     bool // Failure rate at or above the spike threshold
+}
+
+func (n batchNotice) failureRate() float64 {
+	if n.Total == 0 {
+		return 0
+	}
+	return float64(n.Failed) / float64(n.Total)
+}
+
+// notifier sends batch notifications, one per batch or as digests
+type notifier struct {
+	settings notifySettings
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending []batchNotice
+	since   time.Time // When the oldest waiting notice arrived
+}
+
+var notifications = newNotifier(notifySettingsFromEnv())
+
+func newNotifier(settings notifySettings) *notifier {
+	return &notifier{settings: settings, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// run sends digests on schedule; only needed in digest mode
+func (n *notifier) run() {
+	if n.settings.webhookURL == "" || n.settings.mode != notifyModeDigest {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		n.mu.Lock()
+		due := len(n.pending) > 0 && time.Since(n.since) >= n.settings.interval
+		n.mu.Unlock()
+		if due {
+			n.flush("scheduled")
+		}
+	}
+}
+
+// batchFinished notifies about a finished batch, or adds it to the digest.
+// Simulated batches are not reported.
+func (n *notifier) batchFinished(bp *BatchProcess) {
+	if n.settings.webhookURL == "" {
+		return
+	}
+	bp.mu.Lock()
+	if bp.Simulated {
+		bp.mu.Unlock()
+		return
+	}
+	notice := batchNotice{ID: bp.ID, Duration: bp.EndTime.Sub(bp.StartTime)}
+	if bp.Summary != nil {
+		notice.Total = bp.Summary.Total - bp.Summary.SkippedBySampling
+		notice.Succeeded = bp.Summary.Succeeded + bp.Summary.NotModified
+		notice.Failed = bp.Summary.Failed
+		notice.Cost = bp.Summary.TotalCost
+	}
+	bp.mu.Unlock()
+	notice.Spike = notice.Total > 0 && notice.failureRate() >= n.settings.spikeRate
+
+	if n.settings.mode == notifyModeBatch {
+		n.send(notice.line())
+		return
+	}
+
+	n.mu.Lock()
+	if len(n.pending) == 0 {
+		n.since = time.Now()
+	}
+	n.pending = append(n.pending, notice)
+	reason := n.thresholdReached(notice)
+	n.mu.Unlock()
+	if reason != "" {
+		n.flush(reason)
+	}
+}
+
+// thresholdReached returns why the digest should go out now, or ""; the caller holds n.mu
+func (n *notifier) thresholdReached(latest batchNotice) string {
+	if latest.Spike && n.settings.spikeNow {
+		return "failure spike"
+	}
+	if n.settings.maxBatches > 0 && len(n.pending) >= n.settings.maxBatches {
+		return fmt.Sprintf("%d batches finished", len(n.pending))
+	}
+	if n.settings.maxCost > 0 {
+		cost := 0.0
+		for _, notice := range n.pending {
+			cost += notice.Cost
+		}
+		if cost >= n.settings.maxCost {
+			return fmt.Sprintf("cost reached $%.2f", cost)
+		}
+	}
+	return ""
+}
+
+// flush sends the waiting notices as one digest
+func (n *notifier) flush(reason string) {
+	n.mu.Lock()
+	notices := n.pending
+	since := n.since
+	n.pending = nil
+	n.mu.Unlock()
+	if len(notices) > 0 {
+		n.send(digestText(notices, since, reason))
+	}
+}
+
+func (n batchNotice) line() string {
+	line := fmt.Sprintf("Batch %s finished: %d/%d jobs succeeded, %d failed, cost $%.2f, took %s",
+		n.ID, n.Succeeded, n.Total, n.Failed, n.Cost, n.Duration.Round(time.Second))
+	if n.Spike {
+		line += fmt.Sprintf(" (failure spike: %.0f%% failed)", n.failureRate()*100)
+	}
+	return line
+}
+
+// digestText summarizes the batches finished since the last digest
+func digestText(notices []batchNotice, since time.Time, reason string) string {
+	var total, succeeded, failed int
+	var cost float64
+	var spikes []string
+	for _, notice := range notices {
+		total += notice.Total
+		succeeded += notice.Succeeded
+		failed += notice.Failed
+		cost += notice.Cost
+		if notice.Spike {
+			spikes = append(spikes, fmt.Sprintf("%s (%.0f%% failed)", notice.ID, notice.failureRate()*100))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scraper digest since %s (%s)\n", since.UTC().Format("15:04 MST"), reason)
+	fmt.Fprintf(&b, "%d batches finished: %d/%d jobs succeeded, %d failed, cost $%.2f\n", len(notices), succeeded, total, failed, cost)
+	if len(spikes) > 0 {
+		fmt.Fprintf(&b, "Failure spikes: %s\n", strings.Join(spikes, ", "))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// send posts a message to the webhook
+func (n *notifier) send(text string) {
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return
+	}
+	resp, err := n.client.Post(n.settings.webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Failed to send notification: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Notification webhook returned status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Normalized stock availability of an offer
+const (
+	availabilityInStock      = "in_stock"
+	availabilityOutOfStock   = "out_of_stock"
+	availabilityLimited      = "limited"
+	availabilityPreorder     = "preorder"
+	availabilityBackorder    = "backorder"
+	availabilityDiscontinued = "discontinued"
+	availabilityUnknown      = "unknown"
+)
+
+// Where an offer's values were read from
+const (
+	offerFromStructured = "structured_data"
+	offerFromExtraction = "extraction"
+	offerFromLLM        = "llm"
+)
+
+// OfferConfig controls the price and availability extractor
+type OfferConfig struct {
+	Disabled bool `json:"disabled"`
+	// Ask the LLM for the price and availability when neither the page's
+	// structured data nor the extraction has them
+	LLMFallback bool `json:"llm_fallback"`
+}
+
+// ProductOffer is the price and stock availability a page shows, typed for
+// price monitoring. Raw values are kept next to the parsed ones.
+type ProductOffer struct {
+	Price           *float64 `json:"price,omitempty"`
+	Currency        string   `json:"currency,omitempty"` // ISO 4217 code
+	Availability    string   `json:"availability"`       // An availability constant
+	RawPrice        string   `json:"raw_price,omitempty"`
+	RawAvailability string   `json:"raw_availability,omitempty"`
+	Source          string   `json:"source,omitempty"`
+}
+
+var (
+	amountPattern      = regexp.MustCompile(`\d[\d.,' \x{00a0}]*`)
+	currencyCodeRegexp = regexp.MustCompile(`\b(USD|EUR|GBP|JPY|CHF|CAD|AUD|SEK|NOK|DKK|PLN|CZK|CNY|INR)\b`)
+	// Checked in order; "kr" is ambiguous and taken as SEK
+	offerCurrencySigns = []struct{ sign, code string }{{"€", "EUR"}, {"£", "GBP"}, {"¥", "JPY"}, {"zł", "PLN"}, {"Fr.", "CHF"}, {"kr", "SEK"}, {"$", "USD"}}
+	availabilityWords  = []struct {
+		status  string
+		phrases []string
+	}{
+		// Negative phrases first: "not in stock" contains "in stock"
+		{availabilityOutOfStock, []string{"outofstock", "out of stock", "sold out", "soldout", "not in stock", "currently unavailable", "not available", "unavailable"}},
+		{availabilityDiscontinued, []string{"discontinued"}},
+		{availabilityPreorder, []string{"preorder", "pre-order", "pre order"}},
+		{availabilityBackorder, []string{"backorder", "back order", "back-order"}},
+		{availabilityLimited, []string{"limitedavailability", "limited availability", "limited stock", "only a few left", "low stock"}},
+		{availabilityInStock, []string{"instock", "in stock", "instoreonly", "onlineonly", "available", "ships today", "ready to ship"}},
+	}
+)
+
+// normalizeAvailability maps schema.org availability values and shop
+// wording to an availability constant
+func normalizeAvailability(raw string) string {
+	text := strings.ToLower(strings.TrimSpace(schemaEnum(raw)))
+	if text == "" {
+		return availabilityUnknown
+	}
+	for _, group := range availabilityWords {
+		for _, phrase := range group.phrases {
+			if strings.Contains(text, phrase) {
+				return group.status
+			}
+		}
+	}
+	return availabilityUnknown
+}
+
+// parsePrice reads an amount and, when the text names one, a currency from a
+// price such as "$1,299.99", "1.299,99 €" or "EUR 12.50". The last "." or ","
+// followed by one or two digits is the decimal separator.
+func parsePrice(raw string) (float64, string, bool) {
+	currency := ""
+	if code := currencyCodeRegexp.FindString(strings.ToUpper(raw)); code != "" {
+		currency = code
+	} else {
+		for _, sign := range offerCurrencySigns {
+			if strings.Contains(raw, sign.sign) {
+				currency = sign.code
+				break
+			}
+		}
+	}
+
+	match := strings.TrimRight(amountPattern.FindString(raw), ".,' \u00a0")
+	if match == "" {
+		return 0, currency, false
+	}
+	digits := strings.NewReplacer("'", "", " ", "", "\u00a0", "").Replace(match)
+	decimal := strings.LastIndexAny(digits, ".,")
+	if decimal != -1 && len(digits)-decimal-1 <= 2 {
+		digits = strings.NewReplacer(".", "", ",", "").Replace(digits[:decimal]) + "." + digits[decimal+1:]
+	} else {
+		digits = strings.NewReplacer(".", "", ",", "").Replace(digits)
+	}
+	amount, err := strconv.ParseFloat(digits, 64)
+	if err != nil || amount < 0 || math.IsInf(amount, 0) {
+		return 0, currency, false
+	}
+	return roundTo(amount, 2), currency, true
+}
+
+// newOffer builds an offer from raw values, or returns nil when neither a
+// price nor an availability could be read from them
+func newOffer(rawPrice, rawCurrency, rawAvailability, source string) *ProductOffer {
+	offer := &ProductOffer{
+		RawPrice:        strings.TrimSpace(rawPrice),
+		RawAvailability: strings.TrimSpace(rawAvailability),
+		Availability:    normalizeAvailability(rawAvailability),
+		Source:          source,
+	}
+	if amount, currency, ok := parsePrice(rawPrice); ok {
+		offer.Price = &amount
+		offer.Currency = currency
+	}
+	if code := strings.ToUpper(strings.TrimSpace(rawCurrency)); len(code) == 3 {
+		offer.Currency = code
+	}
+	if offer.Price == nil && offer.Availability == availabilityUnknown {
+		return nil
+	}
+	return offer
+}
+
+// offerFromFields reads price and availability fields from the extraction
+func offerFromFields(extraction interface{}) *ProductOffer {
+	info, ok := extraction.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	value := func(keywords ...string) string {
+		for _, keyword := range keywords {
+			if raw, ok := info[keyword].(string); ok && raw != "NO_MATCH" {
+				return raw
+			}
+		}
+		return ""
+	}
+	return newOffer(
+		value("price", "current_price", "sale_price", "price_info"),
+		value("currency", "price_currency"),
+		value("availability", "stock", "stock_status", "in_stock"),
+		offerFromExtraction,
+	)
+}
+
+const offerExtractPrompt = `
+		Find the product's current selling price and stock availability on the
+		page below. Ignore crossed-out list prices and prices of other products.
+
+		Title: {title}
+		Text:
+		{text}
+
+		Respond with a single JSON object:
+		{"price": "<price as shown, or empty>", "currency": "<ISO 4217 code, or empty>",
+		 "availability": "<in stock, out of stock, preorder, backorder, or empty>"}
+		Return only the JSON object.
+	`
+
+// offerTextChars caps the page text sent to the LLM for the offer
+const offerTextChars = 4000
+
+// extractOfferWithLLM asks the model for the offer; it returns the tokens used
+func (p *UnifiedParser) extractOfferWithLLM(ctx context.Context, page *pageContent) (*ProductOffer, int, error) {
+	prompt := strings.NewReplacer(
+		"{title}", page.Title,
+		"{text}", leadingText(page.text(), offerTextChars),
+	).Replace(offerExtractPrompt)
+
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: prompt,
+	}))
+	if err != nil {
+		return nil, 0, fmt.Errorf("offer extraction request failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, resp.Usage.TotalTokens, fmt.Errorf("empty offer extraction response")
+	}
+	var raw struct {
+		Price        string `json:"price"`
+		Currency     string `json:"currency"`
+		Availability string `json:"availability"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(resp.Choices[0].Message.Content)), &raw); err != nil {
+		return nil, resp.Usage.TotalTokens, fmt.Errorf("invalid offer extraction response: %w", err)
+	}
+	return newOffer(raw.Price, raw.Currency, raw.Availability, offerFromLLM), resp.Usage.TotalTokens, nil
+}
+
+// extractOffer reads the page's price and availability from its structured
+// data first, then from the extraction, and finally asks the LLM when the
+// config allows it. Values missing from one source are filled from the next.
+func (p *UnifiedParser) extractOffer(ctx context.Context, page *pageContent, structured *StructuredProduct, extraction interface{}) (*ProductOffer, int) {
+	config := p.config.Offer
+	if config.Disabled {
+		return nil, 0
+	}
+
+	var offer *ProductOffer
+	if structured != nil {
+		offer = newOffer(structured.Price, structured.Currency, structured.Availability, offerFromStructured)
+	}
+	offer = offer.fillFrom(offerFromFields(extraction))
+	if offer != nil && offer.Price != nil && offer.Availability != availabilityUnknown {
+		return offer, 0
+	}
+	if !config.LLMFallback {
+		return offer, 0
+	}
+
+	fallback, tokens, err := p.extractOfferWithLLM(ctx, page)
+	if err != nil {
+		log.Printf("Offer extraction by LLM failed: %v", err)
+		return offer, tokens
+	}
+	return offer.fillFrom(fallback), tokens
+}
+
+// fillFrom completes the offer with the values it lacks from other
+func (o *ProductOffer) fillFrom(other *ProductOffer) *ProductOffer {
+	if o == nil {
+		return other
+	}
+	if other == nil {
+		return o
+	}
+	if o.Price == nil && other.Price != nil {
+		o.Price, o.RawPrice = other.Price, other.RawPrice
+		if o.Currency == "" {
+			o.Currency = other.Currency
+		}
+	}
+	if o.Currency == "" {
+		o.Currency = other.Currency
+	}
+	if o.Availability == availabilityUnknown && other.Availability != availabilityUnknown {
+		o.Availability, o.RawAvailability = other.Availability, other.RawAvailability
+	}
+	return o
+}
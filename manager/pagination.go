@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// What happens to the product pages found on a listing
+const (
+	paginationAggregate = "aggregate" // Parse them within the listing's job
+	paginationSpawn     = "spawn"     // Add a job per product page to the batch
+)
+
+const (
+	defaultListingPages    = 10
+	defaultListingProducts = 200
+	minListingProducts     = 6 // Product links that make an arbitrary page a listing
+)
+
+var (
+	productPathPattern = regexp.MustCompile(`(?i)/(products?|produkte?|items?|p|dp|sku|artikel)/[^/]+`)
+	productSlugPattern = regexp.MustCompile(`(?i)/[a-z0-9]+(-[a-z0-9]+)*-[a-z]*\d+[a-z0-9]*/?$`)
+	listingPathPattern = regexp.MustCompile(`(?i)/(category|categories|collections?|catalog|catalogue|shop|search|products|kategorie)(/|$)`)
+	nonProductPattern  = regexp.MustCompile(`(?i)/(cart|basket|checkout|login|logout|account|register|wishlist|compare|help|support|contact|about|privacy|terms|blog|news|category|categories|collections?|tags?)(/|$)`)
+	nextLinkTexts      = []string{"next", "next page", "more products", "load more", "›", "»", ">", "weiter", "nächste seite", "suivant", "siguiente", "avanti"}
+)
+
+// PaginationConfig follows "next page" links on product listing pages
+type PaginationConfig struct {
+	Enabled     bool   `json:"enabled"`      // Detect listing pages heuristically
+	Listing     bool   `json:"listing"`      // Treat every URL as a listing page
+	MaxPages    int    `json:"max_pages"`    // Listing pages visited per URL, 10 by default
+	MaxProducts int    `json:"max_products"` // Product URLs collected per URL, 200 by default
+	Mode        string `json:"mode"`         // "aggregate" (default) or "spawn"
+	// Regular expression product URLs must match, instead of the path heuristics
+	ProductPattern string `json:"product_pattern,omitempty"`
+}
+
+// ListingProduct is one product page parsed as part of a listing
+type ListingProduct struct {
+	URL    string      `json:"url"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// ListingResult is what was collected from a listing and its following pages
+type ListingResult struct {
+	Mode        string           `json:"mode"`
+	Pages       []string         `json:"pages"`
+	ProductURLs []string         `json:"product_urls"`
+	Products    []ListingProduct `json:"products,omitempty"` // Aggregate mode only
+}
+
+func (c PaginationConfig) active() bool {
+	return c.Enabled || c.Listing
+}
+
+func (c PaginationConfig) validate() error {
+	switch c.Mode {
+	case "", paginationAggregate, paginationSpawn:
+	default:
+		return fmt.Errorf("unsupported pagination mode %q, expected %q or %q", c.Mode, paginationAggregate, paginationSpawn)
+	}
+	if c.ProductPattern != "" {
+		if _, err := regexp.Compile(c.ProductPattern); err != nil {
+			return fmt.Errorf("invalid product_pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c PaginationConfig) mode() string {
+	if c.Mode == "" {
+		return paginationAggregate
+	}
+	return c.Mode
+}
+
+func (c PaginationConfig) maxPages() int {
+	if c.MaxPages > 0 {
+		return c.MaxPages
+	}
+	return defaultListingPages
+}
+
+func (c PaginationConfig) maxProducts() int {
+	if c.MaxProducts > 0 {
+		return c.MaxProducts
+	}
+	return defaultListingProducts
+}
+
+// productMatcher returns the configured product pattern, or nil for the heuristics
+func (c PaginationConfig) productMatcher() *regexp.Regexp {
+	if c.ProductPattern == "" {
+		return nil
+	}
+	re, _ := regexp.Compile(c.ProductPattern) // Checked by validate
+	return re
+}
+
+// isProductURL reports whether u looks like a product detail page
+func isProductURL(u *url.URL, pattern *regexp.Regexp) bool {
+	if pattern != nil {
+		return pattern.MatchString(u.String())
+	}
+	if nonProductPattern.MatchString(u.Path) || hasSuffix(strings.ToLower(u.Path), documentExtensions) {
+		return false
+	}
+	return productPathPattern.MatchString(u.Path) || productSlugPattern.MatchString(u.Path)
+}
+
+// productURLs returns the page's internal product links in document order
+func productURLs(pageURL string, page *pageContent, pattern *regexp.Regexp) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var products []string
+	for _, link := range page.Links {
+		u, ok := resolveListingLink(base, link.Href)
+		if !ok || seen[u.String()] || !isProductURL(u, pattern) {
+			continue
+		}
+		seen[u.String()] = true
+		products = append(products, u.String())
+	}
+	return products
+}
+
+// isListingPage guesses whether a page lists products rather than describing one
+func isListingPage(pageURL string, page *pageContent, pattern *regexp.Regexp) bool {
+	products := len(productURLs(pageURL, page, pattern))
+	if products >= minListingProducts {
+		return true
+	}
+	u, err := url.Parse(pageURL)
+	return err == nil && products > 0 && listingPathPattern.MatchString(u.Path)
+}
+
+// nextPageURL finds the page's "next page" link, preferring rel="next"
+func nextPageURL(pageURL string, page *pageContent) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	var byText string
+	for _, link := range page.Links {
+		u, ok := resolveListingLink(base, link.Href)
+		if !ok || u.String() == base.String() {
+			continue
+		}
+		if containsField(strings.Fields(strings.ToLower(link.Rel)), "next") {
+			return u.String()
+		}
+		text := strings.ToLower(strings.TrimSpace(link.Text))
+		if byText == "" && containsField(nextLinkTexts, text) {
+			byText = u.String()
+		}
+	}
+	return byText
+}
+
+// resolveListingLink resolves href against the listing, keeping same-host HTTP links only
+func resolveListingLink(base *url.URL, href string) (*url.URL, bool) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, false
+	}
+	u := base.ResolveReference(ref)
+	u.Fragment = ""
+	if (u.Scheme != "http" && u.Scheme != "https") || !strings.EqualFold(u.Host, base.Host) {
+		return nil, false
+	}
+	return u, true
+}
+
+func containsField(fields []string, value string) bool {
+	for _, field := range fields {
+		if field == value {
+			return true
+		}
+	}
+	return false
+}
+
+// crawlListing collects product URLs from a listing page and the pages its
+// "next" links lead to, stopping at the page or product limit
+func (p *UnifiedParser) crawlListing(ctx context.Context, listingURL string, first *pageContent) *ListingResult {
+	config := p.config.Pagination
+	pattern := config.productMatcher()
+	listing := &ListingResult{Mode: config.mode()}
+	seen := make(map[string]bool)
+
+	pageURL, page := listingURL, first
+	visited := map[string]bool{listingURL: true}
+	for {
+		listing.Pages = append(listing.Pages, pageURL)
+		for _, product := range productURLs(pageURL, page, pattern) {
+			if !seen[product] && len(listing.ProductURLs) < config.maxProducts() {
+				seen[product] = true
+				listing.ProductURLs = append(listing.ProductURLs, product)
+			}
+		}
+
+		next := nextPageURL(pageURL, page)
+		if next == "" || visited[next] || len(listing.Pages) >= config.maxPages() || len(listing.ProductURLs) >= config.maxProducts() {
+			break
+		}
+		if err := ssrfPolicy.validateURL(ctx, next); err != nil {
+			log.Printf("Listing %s: not following %s: %v", listingURL, next, err)
+			break
+		}
+		visited[next] = true
+
+		nextPage, err := p.scrape(ctx, next)
+		if err != nil {
+			log.Printf("Listing %s: stopped at %s: %v", listingURL, next, err)
+			break
+		}
+		pageURL, page = next, nextPage
+	}
+	return listing
+}
+
+// parseListing handles a URL detected as a product listing. In aggregate mode
+// every product page is parsed here; in spawn mode only the URLs are returned
+// for the batch to schedule as jobs of their own.
+func (p *UnifiedParser) parseListing(ctx context.Context, listingURL, siteID string, page *pageContent, minConfidence float64, showAllImages bool, parseDescription, modelNumber string, variant PromptVariant) (ParseResult, error) {
+	listing := p.crawlListing(ctx, listingURL, page)
+	log.Printf("Listing %s: %d products on %d pages", listingURL, len(listing.ProductURLs), len(listing.Pages))
+
+	result := ParseResult{
+		SiteID:        siteID,
+		SourceURL:     listingURL,
+		PromptVariant: variant.Name,
+		Listing:       listing,
+		Locale:        p.siteScraper.locale.effective(listingURL),
+	}
+
+	if listing.Mode == paginationAggregate {
+		// Product pages are parsed as plain pages, never as further listings
+		productParser := *p
+		productParser.config.Pagination = PaginationConfig{}
+
+		var extractions []interface{}
+		for _, productURL := range listing.ProductURLs {
+			if ctx.Err() != nil {
+				break
+			}
+			product := ListingProduct{URL: productURL}
+			parsed, err := productParser.parseWebsite(ctx, productURL, minConfidence, showAllImages, parseDescription, modelNumber, variant)
+			if err != nil {
+				product.Error = err.Error()
+			} else if parsed.Quality != nil && parsed.Quality.LowQuality {
+				product.Error = parsed.Quality.describe()
+			} else {
+				product.Result = parsed.GeminiParseResult
+				result.TokensUsed += parsed.TokensUsed
+				result.Cost += parsed.Cost
+				extractions = append(extractions, parsed.GeminiParseResult)
+			}
+			listing.Products = append(listing.Products, product)
+		}
+		result.GeminiParseResult = extractions
+	}
+
+	if err := p.saveParseResult(result); err != nil {
+		return ParseResult{}, fmt.Errorf("failed to save parse result: %w", err)
+	}
+	return result, nil
+}
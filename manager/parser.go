@@ -1,660 +1,1193 @@
-package main
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"log"
-	"net/url"
-	"os"
-	"path"
-	"path/filepath"
-	"strings"
-	"sync"
-
-	"github.com/sashabaranov/go-openai"
-	"golang.org/x/net/html"
-	"golang.org/x/sync/semaphore"
-)
-
-// Configuration for the parser
-type ParserConfig struct {
-	APIKey        string `json:"api_key"`
-	ModelName     string `json:"model_name"`
-	DataDir       string `json:"data_dir"`
-	MaxConcurrent int    `json:"max_concurrent"`
-	Timeout       int    `json:"timeout"`
-}
-
-// ParseResult struct to hold the results of parsing a website
-type ParseResult struct {
-	SiteID            string      `json:"site_id"`
-	ContentAnalysis   interface{} `json:"content_analysis"` // Placeholder for ContentAnalyzer results
-	ImageMatches      interface{} `json:"image_matches"`    // Placeholder for ImageMatch results
-	RawContent        string      `json:"raw_content"`
-	GeminiParseResult interface{} `json:"gemini_parse_result"`
-	DownloadedFiles   []string    `json:"downloaded_files"`
-	PdfLinks          []string    `json:"pdf_links"`
-}
-
-// BatchProcessingResult struct for batch processing results
-type BatchProcessingResult struct {
-	Successful []ParseResult `json:"successful"`
-	Failed     []string      `json:"failed"`
-}
-
-// UnifiedParser main parsing struct
-type UnifiedParser struct {
-	config          ParserConfig
-	client          *openai.Client
-	contentAnalyzer *ContentAnalyzer  // Placeholder
-	siteScraper     *SiteScraper      // Placeholder
-	imageLoader     *ImageLoader      // Placeholder
-	resultManager   *CSVResultManager // Placeholder
-	dataDir         string
-	resultsDir      string
-	docDownloader   *DocumentDownloader // Placeholder
-
-	prompt string
-
-	// Add semaphore for concurrency control
-	sem *semaphore.Weighted
-}
-
-// NewUnifiedParser creates a new instance of the UnifiedParser.
-func NewUnifiedParser(config ParserConfig) (*UnifiedParser, error) {
-
-	client := openai.NewClient(config.APIKey)
-
-	dataDir := config.DataDir
-	resultsDir := filepath.Join(config.DataDir, "parse_results")
-	if err := os.MkdirAll(resultsDir, os.ModePerm); err != nil {
-		return nil, fmt.Errorf("failed to create results directory: %w", err)
-	}
-
-	prompt := `
-		Analyze the following website content and extract relevant information based on the query.
-
-		Website Content: {dom_content}
-
-		Query: {parse_description}
-
-		For product information queries, include details about:
-		- Product name
-		- Model number
-		- Serial number
-		- Warranty information
-		- User manuals (with URLs if available)
-		- Other relevant documents (with URLs if available)
-
-		For other queries:
-		- Provide relevant information from the content
-		- Include specific data points when found
-		- Return document/image URLs when relevant
-		- Indicate if information is not found
-
-		Please provide the information in a clear, structured format.
-	`
-
-	// Initialize the semaphore
-	sem := semaphore.NewWeighted(int64(config.MaxConcurrent))
-
-	return &UnifiedParser{
-		config:          config,
-		client:          client,
-		contentAnalyzer: NewContentAnalyzer(config.APIKey, config.DataDir), // Initialize placeholder
-		siteScraper:     NewSiteScraper(config.DataDir),                    // Initialize placeholder
-		imageLoader:     NewImageLoader(),                                  // Initialize placeholder
-		resultManager:   NewCSVResultManager(config.DataDir),               // Initialize placeholder
-		dataDir:         dataDir,
-		resultsDir:      resultsDir,
-		docDownloader:   NewDocumentDownloader("", config.DataDir), // Initialize placeholder
-		prompt:          prompt,
-		sem:             sem,
-	}, nil
-
-}
-
-// CreateBatchProcessor creates a BatchURLProcessor.
-func (p *UnifiedParser) CreateBatchProcessor(modelNumber string) *BatchURLProcessor {
-
-	return NewBatchURLProcessor(p.siteScraper, p, p.docDownloader, p.config.MaxConcurrent, p.config.Timeout, p.resultManager, modelNumber)
-}
-
-func (p *UnifiedParser) preprocessContent(htmlContent string) []string {
-	doc, err := html.Parse(strings.NewReader(htmlContent))
-	if err != nil {
-		log.Printf("Error parsing HTML: %v", err)
-		return nil
-	}
-
-	var texts []string
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.TextNode && strings.TrimSpace(n.Data) != "" {
-			texts = append(texts, strings.TrimSpace(n.Data))
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
-	}
-	f(doc)
-	return texts
-}
-
-// parseWithGemini sends a request to Gemini and parses the response.
-func (p *UnifiedParser) parseWithGemini(ctx context.Context, domChunks []string, parseDescription string) (interface{}, error) {
-	if err := p.sem.Acquire(ctx, 1); err != nil {
-		return nil, fmt.Errorf("failed to acquire semaphore: %w", err)
-	}
-	defer p.sem.Release(1)
-
-	foundResults := []interface{}{}
-	isProductInfo := containsAny(strings.ToLower(parseDescription), []string{"extract product", "product information", "product details"})
-
-	chunkSize := 3
-	for i := 0; i < len(domChunks); i += chunkSize {
-		chunkGroup := strings.Join(domChunks[i:min(i+chunkSize, len(domChunks))], " ")
-
-		req := openai.ChatCompletionRequest{
-			Model: p.config.ModelName,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: strings.ReplaceAll(strings.ReplaceAll(p.prompt, "{dom_content}", chunkGroup), "{parse_description}", parseDescription),
-				},
-			},
-		}
-
-		resp, err := p.client.CreateChatCompletion(ctx, req)
-		if err != nil {
-
-			return nil, fmt.Errorf("gemini request failed: %w", err)
-
-		}
-		content := resp.Choices[0].Message.Content
-
-		content = strings.TrimSpace(content)
-
-		if content == "" || strings.ToLower(content) == "no match" || strings.ToLower(content) == "not found" || strings.ToLower(content) == "no information" {
-			continue
-		}
-
-		if isProductInfo {
-			var result map[string]interface{}
-			if err := json.Unmarshal([]byte(content), &result); err == nil {
-
-				ensureKeyExists(result, "name", "NO_MATCH")
-				ensureKeyExists(result, "model_number", "NO_MATCH")
-				ensureKeyExists(result, "serial_number", "NO_MATCH")
-				ensureKeyExists(result, "warranty_info", "NO_MATCH")
-				ensureKeyExists(result, "user_manual", []string{})
-				ensureKeyExists(result, "other_documents", []string{})
-
-				for _, key := range []string{"user_manual", "other_documents"} {
-
-					if val, ok := result[key].(string); ok && val != "NO_MATCH" {
-						result[key] = []string{val}
-					}
-				}
-
-				foundResults = append(foundResults, result)
-			} else {
-				foundResults = append(foundResults, map[string]interface{}{"raw_content": content})
-			}
-		} else {
-			foundResults = append(foundResults, content)
-		}
-
-	}
-
-	if len(foundResults) == 0 {
-		return "NO_MATCH", nil
-	}
-
-	if isProductInfo {
-		combinedResults := map[string]interface{}{
-			"name":            "NO_MATCH",
-			"model_number":    "NO_MATCH",
-			"serial_number":   "NO_MATCH",
-			"warranty_info":   "NO_MATCH",
-			"user_manual":     []string{},
-			"other_documents": []string{},
-			"additional_info": []string{},
-		}
-		for _, result := range foundResults {
-			if rawContent, ok := result.(map[string]interface{})["raw_content"]; ok {
-
-				combinedResults["additional_info"] = append(combinedResults["additional_info"].([]string), rawContent.(string))
-				continue
-
-			}
-
-			for k, v := range result.(map[string]interface{}) {
-				switch k {
-
-				case "user_manual", "other_documents":
-					if list, ok := v.([]string); ok {
-						combinedResults[k] = append(combinedResults[k].([]string), list...)
-					} else if str, ok := v.(string); ok && str != "NO_MATCH" {
-						combinedResults[k] = append(combinedResults[k].([]string), str)
-					}
-
-				default:
-					if str, ok := v.(string); ok && str != "NO_MATCH" {
-
-						if _, ok := combinedResults[k].(string); ok && combinedResults[k].(string) == "NO_MATCH" {
-							combinedResults[k] = str
-						}
-					}
-				}
-			}
-		}
-		dedupeStringSlice(combinedResults, "user_manual")
-		dedupeStringSlice(combinedResults, "other_documents")
-		dedupeStringSlice(combinedResults, "additional_info")
-
-		return combinedResults, nil
-	}
-	combinedContent := strings.Join(interfaceSliceToStringSlice(foundResults), "\n")
-	return combinedContent, nil
-
-}
-
-func containsAny(s string, substrings []string) bool {
-	for _, substr := range substrings {
-		if strings.Contains(s, substr) {
-			return true
-		}
-	}
-	return false
-}
-
-func interfaceSliceToStringSlice(in []interface{}) []string {
-	out := make([]string, len(in))
-	for i, v := range in {
-		out[i] = v.(string)
-	}
-	return out
-}
-
-func ensureKeyExists(m map[string]interface{}, key string, defaultValue interface{}) {
-	if _, ok := m[key]; !ok {
-		m[key] = defaultValue
-	}
-}
-
-func dedupeStringSlice(m map[string]interface{}, key string) {
-	if slice, ok := m[key].([]string); ok {
-		allKeys := make(map[string]bool)
-		list := []string{}
-		for _, item := range slice {
-			if _, value := allKeys[item]; !value {
-				allKeys[item] = true
-				list = append(list, item)
-			}
-		}
-		m[key] = list
-	}
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-// findPdfLinks extracts PDF links from the provided HTML content.
-func (p *UnifiedParser) findPdfLinks(htmlContent string) ([]string, error) {
-	doc, err := html.Parse(strings.NewReader(htmlContent))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML content: %w", err)
-	}
-
-	allowedExtensions := []string{".pdf", ".docx"}
-	var links []string
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, a := range n.Attr {
-				if a.Key == "href" {
-					href := strings.TrimSpace(a.Val)
-					if href != "" {
-						if strings.HasPrefix(href, "#") {
-							continue
-						}
-
-						if hasSuffix(href, allowedExtensions) {
-							u, err := url.Parse(href)
-							if err != nil {
-								continue
-							}
-							if !u.IsAbs() {
-								base, err := url.Parse(p.siteScraper.baseURL)
-								if err != nil {
-									continue
-								}
-								u = base.ResolveReference(u)
-							}
-							links = append(links, u.String())
-						}
-					}
-				}
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
-	}
-
-	f(doc)
-	return removeDuplicates(links), nil
-}
-
-// Updated function with a comparable constraint
-func removeDuplicates[T comparable](slice []T) []T {
-	allKeys := make(map[T]bool)
-	list := []T{}
-
-	for _, item := range slice {
-		if _, exists := allKeys[item]; !exists {
-			allKeys[item] = true
-			list = append(list, item)
-		}
-	}
-	return list
-}
-
-func hasSuffix(s string, suffixes []string) bool {
-	s = strings.ToLower(s)
-	for _, suffix := range suffixes {
-		if strings.HasSuffix(s, strings.ToLower(suffix)) {
-			return true
-		}
-	}
-	return false
-}
-
-// downloadDocuments downloads documents from the provided links.
-func (p *UnifiedParser) downloadDocuments(ctx context.Context, docLinks []string, siteID string) (map[string][]string, error) {
-
-	docDir := filepath.Join(p.dataDir, siteID, "documents")
-
-	if err := os.MkdirAll(docDir, os.ModePerm); err != nil {
-		return nil, fmt.Errorf("failed to create documents directory: %w", err)
-	}
-
-	p.docDownloader.baseURL = p.siteScraper.baseURL
-	p.docDownloader.downloadDir = docDir
-	return p.docDownloader.downloadDocumentsAsync(ctx, docLinks)
-}
-
-func (p *UnifiedParser) parseWebsiteBatch(ctx context.Context, urls []string, parseDescription string, modelNumber string) (BatchProcessingResult, error) {
-	var result BatchProcessingResult
-	var wg sync.WaitGroup
-	var mutex sync.Mutex // Add mutex for thread safety
-
-	for _, u := range urls {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-
-			parseResult, err := p.parseWebsite(ctx, url, 0.7, false, parseDescription, modelNumber)
-			mutex.Lock()
-			if err != nil {
-				result.Failed = append(result.Failed, url)
-			} else {
-				result.Successful = append(result.Successful, parseResult)
-			}
-			mutex.Unlock()
-		}(u)
-	}
-
-	wg.Wait() // Wait for all goroutines to finish
-	return result, nil
-}
-
-func (p *UnifiedParser) parseWebsite(ctx context.Context, websiteURL string, minConfidence float64, showAllImages bool, parseDescription string, modelNumber string) (ParseResult, error) {
-
-	normalizedURL, err := validateAndNormalizeURL(websiteURL)
-	if err != nil {
-		return ParseResult{}, err
-	}
-
-	siteDir, siteID, err := p.siteScraper.createSiteFolder(websiteURL)
-	if err != nil {
-		return ParseResult{}, err
-	}
-	log.Printf("Site directory created: %s", siteDir)
-
-	htmlContent, err := p.siteScraper.scrapeWebsite(ctx, normalizedURL)
-	if err != nil {
-
-		return ParseResult{}, fmt.Errorf("failed to scrape website: %w", err)
-	}
-
-	cleanedContent := cleanContent(htmlContent) // Implement cleanContent
-
-	images, err := extractImages(htmlContent, websiteURL)
-
-	if err != nil {
-		return ParseResult{}, fmt.Errorf("failed to extract images: %w", err)
-	}
-
-	imageURLs := make([]string, len(images))
-	for i, img := range images {
-		imageURLs[i] = resolveRelativeURL(normalizedURL, img["url"])
-	}
-
-	downloadedImages, err := p.imageLoader.downloadImages(ctx, imageURLs, normalizedURL)
-
-	if err != nil {
-		log.Printf("Failed to download images: %v", err)
-
-	}
-
-	downloadedFiles := make([]string, len(downloadedImages))
-	for i, img := range downloadedImages {
-		downloadedFiles[i] = img
-	}
-
-	p.siteScraper.baseURL = websiteURL
-	pdfLinks, err := p.findPdfLinks(htmlContent)
-	if err != nil {
-		return ParseResult{}, fmt.Errorf("failed to find PDF links: %w", err)
-	}
-
-	contentAnalysis := p.contentAnalyzer.analyzeContent(cleanedContent)
-
-	imageMatches := p.contentAnalyzer.findMatchingImages(contentAnalysis, imageURLs, minConfidence, showAllImages) // Implement image matching
-
-	var geminiResult interface{}
-	if parseDescription != "" {
-
-		geminiResult, err = p.parseWithGemini(ctx, p.preprocessContent(cleanedContent), parseDescription)
-		if err != nil {
-			return ParseResult{}, fmt.Errorf("failed to parse with Gemini: %w", err)
-		}
-	}
-
-	result := ParseResult{
-		SiteID:            siteID,
-		ContentAnalysis:   contentAnalysis,
-		ImageMatches:      imageMatches,
-		RawContent:        cleanedContent,
-		GeminiParseResult: geminiResult,
-		DownloadedFiles:   downloadedFiles,
-		PdfLinks:          pdfLinks,
-	}
-
-	if p.resultManager != nil && modelNumber != "" {
-
-		p.resultManager.saveResult(result, modelNumber, websiteURL)
-	}
-
-	if err := p.saveParseResult(result); err != nil {
-		return ParseResult{}, fmt.Errorf("failed to save parse result: %w", err)
-	}
-
-	return result, nil
-}
-
-// saveParseResult saves the parse result to a JSON file.
-func (p *UnifiedParser) saveParseResult(result ParseResult) error {
-	resultPath := filepath.Join(p.resultsDir, fmt.Sprintf("%s.json", result.SiteID))
-	jsonData, err := json.MarshalIndent(result, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
-	}
-
-	if err := ioutil.WriteFile(resultPath, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write JSON file: %w", err)
-	}
-	return nil
-
-}
-
-// Placeholder functions to be implemented
-func cleanContent(html string) string {
-	return html
-}
-func NewImageLoader() *ImageLoader {
-
-	return &ImageLoader{}
-}
-
-func (l *ImageLoader) downloadImages(ctx context.Context, urls []string, normalizedURL string) ([]string, error) {
-	// Placeholder logic to use the parameters
-	if len(urls) == 0 {
-		log.Printf("No images to download from: %s", normalizedURL)
-	}
-	return []string{}, nil
-}
-
-func extractImages(content string, websiteURL string) ([]map[string]string, error) {
-	// Placeholder logic to use the parameters
-	log.Printf("Extracting images from website: %s", websiteURL)
-	return []map[string]string{}, nil
-}
-
-func resolveRelativeURL(baseURL, relativeURL string) string {
-
-	base, err := url.Parse(baseURL)
-	if err != nil {
-		return relativeURL // Handle error as needed
-	}
-
-	relative, err := url.Parse(relativeURL)
-	if err != nil {
-		return relativeURL // Handle error as needed
-	}
-
-	return base.ResolveReference(relative).String()
-
-}
-
-type ContentAnalyzer struct {
-	apiKey  string
-	dataDir string
-}
-
-func NewContentAnalyzer(apiKey, dataDir string) *ContentAnalyzer {
-	return &ContentAnalyzer{apiKey: apiKey, dataDir: dataDir}
-}
-
-func (ca *ContentAnalyzer) analyzeContent(content string) interface{} {
-
-	return nil
-}
-
-func (ca *ContentAnalyzer) findMatchingImages(contentAnalysis interface{}, availableImages []string, minConfidence float64, showAllImages bool) []map[string]interface{} {
-	// Placeholder for image matching logic
-	return nil
-}
-
-type ImageLoader struct {
-}
-
-type SiteScraper struct {
-	baseURL     string
-	downloadDir string
-}
-
-func NewSiteScraper(downloadDir string) *SiteScraper {
-
-	return &SiteScraper{downloadDir: downloadDir}
-}
-
-func (s *SiteScraper) createSiteFolder(websiteURL string) (string, string, error) {
-	parsedURL, err := url.Parse(websiteURL)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to parse URL: %w", err)
-	}
-
-	siteDir := filepath.Join(s.downloadDir, parsedURL.Host) // Use hostname for the folder name
-	if err := os.MkdirAll(siteDir, os.ModePerm); err != nil {
-		return "", "", fmt.Errorf("failed to create site directory: %w", err)
-	}
-	siteId := path.Base(siteDir)
-	return siteDir, siteId, nil
-
-}
-
-func (s *SiteScraper) scrapeWebsite(ctx context.Context, url string) (string, error) {
-
-	return "", nil
-}
-
-type DocumentDownloader struct {
-	baseURL     string
-	downloadDir string
-}
-
-func NewDocumentDownloader(baseURL, downloadDir string) *DocumentDownloader {
-	return &DocumentDownloader{baseURL: baseURL, downloadDir: downloadDir}
-}
-
-func (d *DocumentDownloader) downloadDocumentsAsync(ctx context.Context, docLinks []string) (map[string][]string, error) {
-
-	return make(map[string][]string), nil
-}
-
-type CSVResultManager struct {
-	dataDir string
-}
-
-func NewCSVResultManager(dataDir string) *CSVResultManager {
-	return &CSVResultManager{dataDir: dataDir}
-}
-
-func (rm *CSVResultManager) saveResult(result ParseResult, modelNumber string, url string) {
-
-}
-
-func validateAndNormalizeURL(u string) (string, error) {
-
-	return u, nil
-}
-
-// BatchURLProcessor handles batch processing of URLs.
-type BatchURLProcessor struct {
-	scraper       *SiteScraper
-	parser        *UnifiedParser
-	docDownloader *DocumentDownloader
-	maxConcurrent int
-	timeout       int
-	resultManager *CSVResultManager
-	modelNumber   string
-}
-
-func NewBatchURLProcessor(scraper *SiteScraper, parser *UnifiedParser, docDownloader *DocumentDownloader, maxConcurrent int, timeout int, resultManager *CSVResultManager, modelNumber string) *BatchURLProcessor {
-	return &BatchURLProcessor{scraper: scraper, parser: parser, docDownloader: docDownloader, maxConcurrent: maxConcurrent, timeout: timeout, resultManager: resultManager, modelNumber: modelNumber}
-}
-
-// ProcessURLs processes a batch of URLs.
-func (p *BatchURLProcessor) ProcessURLs(ctx context.Context, urls []string, parseDescription string) (BatchProcessingResult, error) {
-	return p.parser.parseWebsiteBatch(ctx, urls, parseDescription, p.modelNumber)
-
-}
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/semaphore"
+)
+
+// LLM providers
+const (
+	providerOpenAI = "openai"
+	providerGemini = "gemini"
+	providerLocal  = "local" // OpenAI-compatible server such as Ollama, llama.cpp or vLLM
+)
+
+// Configuration for the parser
+type ParserConfig struct {
+	APIKey        string `json:"api_key"`        // Deprecated: keys belong in the secret provider
+	APIKeySecret  string `json:"api_key_secret"` // Secret holding the provider's key; defaults per provider, e.g. openai_api_key
+	Provider      string `json:"provider"`       // "openai" (default), "gemini" or "local"
+	BaseURL       string `json:"base_url"`       // OpenAI-compatible endpoint for the "local" provider
+	ModelName     string `json:"model_name"`
+	DataDir       string `json:"data_dir"`
+	MaxConcurrent int    `json:"max_concurrent"`
+	Timeout       int    `json:"timeout"`
+
+	// Per-stage limits for page fetches, image and document downloads and LLM calls
+	Concurrency StageConcurrency `json:"concurrency"`
+
+	// Maximum follow-up requests used to repair malformed product JSON;
+	// 0 means the default of 2, so DisableRepair turns repair off
+	MaxRepairAttempts int  `json:"max_repair_attempts"`
+	DisableRepair     bool `json:"disable_repair"`
+
+	// Prompt A/B testing
+	ABTest          ABTestConfig `json:"ab_test"`
+	CostPer1KTokens float64      `json:"cost_per_1k_tokens"`
+
+	// Fields to extract; replaces the default product prompt when set
+	OutputSchema OutputSchema `json:"output_schema"`
+
+	// Language for extracted free-text fields, regardless of the page's language
+	OutputLanguage string `json:"output_language"`
+
+	// Re-run extraction against saved HTML snapshots without touching the network
+	Replay bool `json:"replay"`
+
+	// Personal data removed from stored page text, snapshots and raw LLM output
+	Redaction RedactionConfig `json:"redaction"`
+
+	// Sampling parameters and system prompt for every LLM request
+	LLM LLMParams `json:"llm"`
+
+	// Regional variant of pages to request: Accept-Language, proxy exit and query parameters
+	Locale LocaleConfig `json:"locale"`
+
+	// Follow "next page" links on product listings and collect the product pages
+	Pagination PaginationConfig `json:"pagination"`
+
+	// Skip a page's remaining chunks once the required schema fields are found
+	EarlyExit EarlyExitConfig `json:"early_exit"`
+
+	// Send a rendered screenshot of the page with the first chunk, for
+	// visually structured content such as spec tables
+	Vision bool `json:"vision"`
+
+	// Manufacturer domain prioritization for multi-URL models
+	SourceRanking SourceRankingConfig `json:"source_ranking"`
+
+	// Detection of error pages, login walls and near-empty pages
+	Quality QualityConfig `json:"quality"`
+
+	// Price and stock availability, read into typed fields
+	Offer OfferConfig `json:"offer"`
+
+	// Video links: install guides and demos on YouTube, Vimeo and the like
+	Media MediaConfig `json:"media"`
+
+	// Raw HTML and extracted text read from each page; zero for the defaults
+	PageLimits PageLimits `json:"page_limits"`
+
+	// Re-scrape mode: request pages conditionally with the validators saved
+	// next to their snapshots and skip extraction when they are unchanged
+	ConditionalGet bool `json:"conditional_get"`
+
+	// How site folders and parse results are named: "url" (default) gives
+	// every page its own, "host" keeps the old one-per-hostname layout
+	SiteIDMode string `json:"site_id_mode"`
+}
+
+// ParseResult struct to hold the results of parsing a website
+type ParseResult struct {
+	SiteID            string                     `json:"site_id"`
+	SourceURL         string                     `json:"source_url"`
+	SourceRank        int                        `json:"source_rank,omitempty"`
+	ContentAnalysis   interface{}                `json:"content_analysis"` // Placeholder for ContentAnalyzer results
+	ImageMatches      interface{}                `json:"image_matches"`    // Placeholder for ImageMatch results
+	RawContent        string                     `json:"raw_content"`
+	GeminiParseResult interface{}                `json:"gemini_parse_result"`
+	DownloadedFiles   []string                   `json:"downloaded_files"`
+	PdfLinks          []DocumentLink             `json:"pdf_links"`           // Classified and ranked, user manuals first
+	Truncated         bool                       `json:"truncated,omitempty"` // Page exceeded the HTML or text size cap
+	LinkCounts        LinkCounts                 `json:"link_counts"`
+	PromptVariant     string                     `json:"prompt_variant,omitempty"`
+	Provenance        map[string]FieldProvenance `json:"provenance,omitempty"`
+	Grounding         map[string]string          `json:"grounding,omitempty"`
+	UnverifiedFields  []string                   `json:"unverified_fields,omitempty"`
+	SchemaErrors      []string                   `json:"schema_errors,omitempty"`
+	ChunksSkipped     int                        `json:"chunks_skipped,omitempty"` // Not sent to the LLM because of early exit
+	Locale            *EffectiveLocale           `json:"locale,omitempty"`
+	Listing           *ListingResult             `json:"listing,omitempty"` // Set when the URL was a product listing
+	StructuredData    *StructuredProduct         `json:"structured_data,omitempty"`
+	Quality           *PageQuality               `json:"quality,omitempty"`
+	Lifecycle         *ProductLifecycle          `json:"lifecycle,omitempty"`
+	Offer             *ProductOffer              `json:"offer,omitempty"`
+	CategoryPath      []string                   `json:"category_path,omitempty"` // Breadcrumb categories, broadest first
+	CategorySource    string                     `json:"category_source,omitempty"`
+	Related           []RelatedProduct           `json:"related,omitempty"` // Related products, accessories and parts linked from the page
+	MediaLinks        []MediaLink                `json:"media_links,omitempty"`
+	Support           *SupportInfo               `json:"support,omitempty"`        // Support phone numbers, emails, warranty-claim and service-center pages
+	Certifications    []Certification            `json:"certifications,omitempty"` // CE, FCC, UL and other marks, with their certificate documents
+	Validators        *PageValidators            `json:"validators,omitempty"`
+	NotModified       bool                       `json:"not_modified,omitempty"` // Page answered 304; nothing was extracted
+	TokensUsed        int                        `json:"tokens_used"`
+	Cost              float64                    `json:"cost"`
+}
+
+// BatchProcessingResult struct for batch processing results
+type BatchProcessingResult struct {
+	Successful  []ParseResult `json:"successful"`
+	Failed      []string      `json:"failed"`
+	LowQuality  []string      `json:"low_quality,omitempty"`  // Error pages, login walls and empty pages, not extracted
+	NotFound    []string      `json:"not_found,omitempty"`    // Pages saying the product does not exist, not extracted
+	NotModified []string      `json:"not_modified,omitempty"` // Unchanged since the last scrape, not extracted
+
+	VariantReport *VariantReport `json:"variant_report,omitempty"`
+	Consolidated  *ModelRecord   `json:"consolidated,omitempty"`
+}
+
+// chatCompleter is the subset of the OpenAI client used by the parser
+type chatCompleter interface {
+	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// UnifiedParser main parsing struct
+type UnifiedParser struct {
+	config          ParserConfig
+	client          chatCompleter
+	contentAnalyzer *ContentAnalyzer  // Placeholder
+	siteScraper     *SiteScraper      // Placeholder
+	imageLoader     *ImageLoader      // Placeholder
+	resultManager   *CSVResultManager // Placeholder
+	dataDir         string
+	resultsDir      string
+	docDownloader   *DocumentDownloader // Placeholder
+
+	prompt   string
+	redactor *redactor // nil when redaction is disabled
+
+	// Limits concurrent LLM requests
+	sem *semaphore.Weighted
+	// Limits the fetch and download stages
+	stages stageLimits
+}
+
+// NewUnifiedParser creates a new instance of the UnifiedParser.
+func NewUnifiedParser(config ParserConfig) (*UnifiedParser, error) {
+
+	// The key is looked up on every request so rotated keys take effect
+	apiKey := config.apiKey()
+	var client chatCompleter
+	switch config.Provider {
+	case "", providerOpenAI:
+		clientConfig := openai.DefaultConfig("")
+		clientConfig.HTTPClient = &http.Client{Transport: &secretHeaderTransport{base: http.DefaultTransport, header: "Authorization", prefix: "Bearer ", secret: apiKey}}
+		client = openai.NewClientWithConfig(clientConfig)
+	case providerGemini:
+		client = newGeminiClient(apiKey)
+	case providerLocal:
+		if config.BaseURL == "" {
+			return nil, fmt.Errorf("the local provider needs a base_url, e.g. http://localhost:11434/v1")
+		}
+		// Ollama, llama.cpp server and vLLM ignore the key but the client requires one
+		clientConfig := openai.DefaultConfig("local")
+		clientConfig.HTTPClient = &http.Client{Transport: &secretHeaderTransport{base: http.DefaultTransport, header: "Authorization", prefix: "Bearer ", secret: apiKey}}
+		clientConfig.BaseURL = strings.TrimRight(config.BaseURL, "/")
+		client = openai.NewClientWithConfig(clientConfig)
+	default:
+		return nil, fmt.Errorf("unsupported LLM provider: %s", config.Provider)
+	}
+
+	// Share the server's output directory unless the parser is given its own
+	if config.DataDir == "" {
+		config.DataDir = dataDir
+	}
+	dataDir := config.DataDir
+	resultsDir := filepath.Join(config.DataDir, "parse_results")
+	if err := os.MkdirAll(resultsDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create results directory: %w", err)
+	}
+
+	prompt := `
+		Analyze the following website content and extract relevant information based on the query.
+
+		Website Content: {dom_content}
+
+		Query: {parse_description}
+
+		For product information queries, include details about:
+		- Product name
+		- Model number
+		- Serial number
+		- Warranty information
+		- Lifecycle status (current, discontinued, or replaced) and the successor model if one is named
+		- User manuals (with URLs if available)
+		- Other relevant documents (with URLs if available)
+
+		For other queries:
+		- Provide relevant information from the content
+		- Include specific data points when found
+		- Return document/image URLs when relevant
+		- Indicate if information is not found
+
+		Please provide the information in a clear, structured format.
+	`
+
+	if config.DisableRepair {
+		config.MaxRepairAttempts = 0
+	} else if config.MaxRepairAttempts == 0 {
+		config.MaxRepairAttempts = 2
+	}
+
+	if err := config.LLM.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Locale.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Pagination.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Concurrency.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateSiteIDMode(config.SiteIDMode); err != nil {
+		return nil, err
+	}
+	redactor, err := config.Redaction.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	siteScraper := NewSiteScraper(config.DataDir)
+	siteScraper.replay = config.Replay
+	siteScraper.redactor = redactor
+	siteScraper.locale = config.Locale
+	siteScraper.conditional = config.ConditionalGet
+	siteScraper.siteIDMode = config.SiteIDMode
+	siteScraper.limits = config.PageLimits
+
+	// Each stage gets its own semaphore, sized from max_concurrent unless set
+	sem := semaphore.NewWeighted(int64(stageLimit(config.Concurrency.LLM, config.MaxConcurrent)))
+
+	return &UnifiedParser{
+		config:          config,
+		client:          client,
+		contentAnalyzer: NewContentAnalyzer(config.DataDir), // Initialize placeholder
+		siteScraper:     siteScraper,
+		imageLoader:     NewImageLoader(siteScraper.client),  // Initialize placeholder
+		resultManager:   NewCSVResultManager(config.DataDir), // Initialize placeholder
+		dataDir:         dataDir,
+		resultsDir:      resultsDir,
+		docDownloader:   NewDocumentDownloader("", config.DataDir, siteScraper.client), // Initialize placeholder
+		prompt:          prompt,
+		redactor:        redactor,
+		sem:             sem,
+		stages:          newStageLimits(config.Concurrency, config.MaxConcurrent),
+	}, nil
+
+}
+
+// CreateBatchProcessor creates a BatchURLProcessor.
+func (p *UnifiedParser) CreateBatchProcessor(modelNumber string) *BatchURLProcessor {
+
+	return NewBatchURLProcessor(p.siteScraper, p, p.docDownloader, p.config.MaxConcurrent, p.config.Timeout, p.resultManager, modelNumber)
+}
+
+// parseWithGemini sends a request to Gemini using the default prompt and parses the response.
+func (p *UnifiedParser) parseWithGemini(ctx context.Context, domChunks []string, parseDescription string) (interface{}, error) {
+	result, err := p.parseWithPrompt(ctx, llmOptions{Prompt: p.prompt}, domChunks, parseDescription)
+	return result.Value, err
+}
+
+// llmOptions controls how a page is sent to the LLM
+type llmOptions struct {
+	Prompt     string       // Template with {dom_content} and {parse_description} placeholders
+	Schema     OutputSchema // When set, results are JSON objects with exactly these fields
+	Screenshot []byte       // PNG sent alongside the first chunk when set
+
+	EarlyExit     EarlyExitConfig
+	GroundingText string // Page text used to check values before exiting early
+}
+
+// llmResult holds the merged LLM output for a page along with its bookkeeping
+type llmResult struct {
+	Value         interface{}
+	TokensUsed    int
+	Provenance    map[string]FieldProvenance
+	SchemaErrors  []string // Fields of the final result that violate the output schema
+	ChunksSkipped int      // Chunk groups never sent because of early exit
+}
+
+// parseWithPrompt sends a request to Gemini using the given prompt template and
+// returns the parsed result together with the tokens consumed.
+func (p *UnifiedParser) parseWithPrompt(ctx context.Context, opts llmOptions, domChunks []string, parseDescription string) (llmResult, error) {
+	tokensUsed := 0
+	foundResults := []string{}
+	products := []ProductInfo{}
+	productChunks := []int{} // Chunk group index for each entry in products
+	chunkGroups := []string{}
+	schemaResults := []map[string]interface{}{}
+	isProductInfo := containsAny(strings.ToLower(parseDescription), []string{"extract product", "product information", "product details"})
+
+	chunkSize := 3
+	for i := 0; i < len(domChunks); i += chunkSize {
+		chunkGroups = append(chunkGroups, strings.Join(domChunks[i:min(i+chunkSize, len(domChunks))], " "))
+	}
+
+	// Send every chunk group at once, bounded by the parser's semaphore, and
+	// merge the answers in chunk order so results do not depend on timing.
+	// With early exit, chunk groups are sent in waves and the remaining
+	// waves are skipped once the wanted fields have been found.
+	outputs := make([]chunkOutput, len(chunkGroups))
+	wave := len(chunkGroups)
+	if opts.EarlyExit.active(opts.Schema) {
+		wave = stageLimit(p.config.Concurrency.LLM, p.config.MaxConcurrent)
+	}
+	sent := len(chunkGroups)
+	for start := 0; start < len(chunkGroups); start += wave {
+		end := min(start+wave, len(chunkGroups))
+		if !p.extractChunks(ctx, opts, chunkGroups, outputs, start, end, parseDescription, isProductInfo) {
+			break
+		}
+		if end < len(chunkGroups) && opts.EarlyExit.active(opts.Schema) && opts.EarlyExit.satisfied(outputs[:end], opts) {
+			sent = end
+			break
+		}
+	}
+	outputs = outputs[:sent]
+
+	for _, out := range outputs {
+		tokensUsed += out.tokens
+	}
+	for chunkIndex, out := range outputs {
+		if out.err != nil {
+			return llmResult{TokensUsed: tokensUsed}, out.err
+		}
+		if out.schema != nil {
+			schemaResults = append(schemaResults, out.schema)
+		}
+		if out.product != nil {
+			products = append(products, *out.product)
+			productChunks = append(productChunks, chunkIndex)
+		}
+		if out.value != "" {
+			foundResults = append(foundResults, out.value)
+		}
+	}
+
+	if len(opts.Schema) > 0 {
+		merged := mergeSchemaResults(schemaResults, opts.Schema)
+		_, missing := applySchema(merged, opts.Schema)
+		return llmResult{Value: merged, TokensUsed: tokensUsed, SchemaErrors: missing, ChunksSkipped: len(chunkGroups) - sent}, nil
+	}
+
+	if isProductInfo && len(products) > 0 {
+		merged, provenance := mergeProductInfo(products, productChunks, chunkGroups)
+		return llmResult{Value: merged.toMap(), TokensUsed: tokensUsed, Provenance: provenance}, nil
+	}
+
+	if len(foundResults) == 0 {
+		return llmResult{Value: "NO_MATCH", TokensUsed: tokensUsed}, nil
+	}
+	combinedContent := strings.Join(foundResults, "\n")
+	return llmResult{Value: combinedContent, TokensUsed: tokensUsed}, nil
+
+}
+
+// extractChunks sends chunk groups [start, end) concurrently and stores the
+// answers in outputs. It returns false if any of them failed.
+func (p *UnifiedParser) extractChunks(ctx context.Context, opts llmOptions, chunkGroups []string, outputs []chunkOutput, start, end int, parseDescription string, isProductInfo bool) bool {
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for chunkIndex := start; chunkIndex < end; chunkIndex++ {
+		wg.Add(1)
+		go func(chunkIndex int) {
+			defer wg.Done()
+			if err := p.sem.Acquire(chunkCtx, 1); err != nil {
+				outputs[chunkIndex].err = fmt.Errorf("failed to acquire semaphore: %w", err)
+				return
+			}
+			defer p.sem.Release(1)
+			outputs[chunkIndex] = p.extractChunk(chunkCtx, opts, chunkIndex, chunkGroups[chunkIndex], parseDescription, isProductInfo)
+			if outputs[chunkIndex].err != nil {
+				cancel()
+			}
+		}(chunkIndex)
+	}
+	wg.Wait()
+
+	for _, out := range outputs[start:end] {
+		if out.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkOutput is the LLM's answer for one chunk group
+type chunkOutput struct {
+	value   string                 // Free-text answer; empty when the chunk had nothing
+	product *ProductInfo           // Answer to a product information query
+	schema  map[string]interface{} // Coerced result when an output schema is set
+	tokens  int
+	err     error
+}
+
+// extractChunk sends one chunk group to the LLM and decodes the answer
+func (p *UnifiedParser) extractChunk(ctx context.Context, opts llmOptions, chunkIndex int, chunkGroup, parseDescription string, isProductInfo bool) chunkOutput {
+	message := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: fillTemplate(opts.Prompt, "{dom_content}", chunkGroup, "{parse_description}", parseDescription),
+	}
+	if chunkIndex == 0 && len(opts.Screenshot) > 0 {
+		message.MultiContent = []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: message.Content},
+			imagePart(opts.Screenshot),
+		}
+		message.Content = ""
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(message))
+	if err != nil {
+		return chunkOutput{err: fmt.Errorf("gemini request failed: %w", err)}
+	}
+	out := chunkOutput{tokens: resp.Usage.TotalTokens}
+	if len(resp.Choices) == 0 {
+		return out
+	}
+	content := strings.TrimSpace(resp.Choices[0].Message.Content)
+
+	if content == "" || strings.ToLower(content) == "no match" || strings.ToLower(content) == "not found" || strings.ToLower(content) == "no information" {
+		return out
+	}
+
+	if len(opts.Schema) > 0 {
+		var result map[string]interface{}
+		err := json.Unmarshal([]byte(stripCodeFence(content)), &result)
+		if err != nil {
+			var repairTokens int
+			result, repairTokens, err = p.repairJSON(ctx, content, opts.Schema.jsonShape())
+			out.tokens += repairTokens
+		}
+		if err == nil {
+			out.schema, _ = applySchema(result, opts.Schema)
+		}
+		return out
+	}
+
+	if !isProductInfo {
+		out.value = content
+		return out
+	}
+
+	var result map[string]interface{}
+	err = json.Unmarshal([]byte(stripCodeFence(content)), &result)
+	if err != nil {
+		// Ask the model to fix its own output before giving up on it
+		var repairTokens int
+		result, repairTokens, err = p.repairJSON(ctx, content, productInfoSchema)
+		out.tokens += repairTokens
+	}
+	var info ProductInfo
+	if err != nil {
+		info.AdditionalInfo = []string{p.redactor.redact(content)}
+	} else {
+		info = productInfoFromMap(result)
+	}
+	out.product = &info
+	return out
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substr := range substrings {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// findPdfLinks extracts PDF links from the anchors found on a page.
+func (p *UnifiedParser) findPdfLinks(pageLinks []pageLink) ([]string, error) {
+	base, err := url.Parse(p.siteScraper.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL: %w", err)
+	}
+
+	allowedExtensions := []string{".pdf", ".docx"}
+	var links []string
+	for _, link := range pageLinks {
+		href := link.Href
+		if href == "" || strings.HasPrefix(href, "#") || !hasSuffix(href, allowedExtensions) {
+			continue
+		}
+		u, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		links = append(links, base.ResolveReference(u).String())
+	}
+	return removeDuplicates(links), nil
+}
+
+// Updated function with a comparable constraint
+func removeDuplicates[T comparable](slice []T) []T {
+	allKeys := make(map[T]bool)
+	list := []T{}
+
+	for _, item := range slice {
+		if _, exists := allKeys[item]; !exists {
+			allKeys[item] = true
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func hasSuffix(s string, suffixes []string) bool {
+	s = strings.ToLower(s)
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadDocuments downloads documents from the provided links.
+func (p *UnifiedParser) downloadDocuments(ctx context.Context, docLinks []string, siteID string) (map[string][]string, error) {
+
+	docDir := filepath.Join(p.dataDir, siteID, "documents")
+
+	if err := os.MkdirAll(docDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create documents directory: %w", err)
+	}
+
+	if err := waitForDiskSpace(ctx, docDir, minFreeDiskBytes, nil); err != nil {
+		return nil, fmt.Errorf("interrupted while waiting for disk space: %w", err)
+	}
+
+	p.docDownloader.baseURL = p.siteScraper.baseURL
+	p.docDownloader.downloadDir = docDir
+	release, err := acquireStage(ctx, p.stages.documents, "document download")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	docLinks, _ = filterDocumentsBySize(ctx, p.docDownloader.httpClient(), docLinks, p.config.PageLimits)
+	downloads, err := p.docDownloader.downloadDocumentsAsync(ctx, docLinks)
+	if err != nil {
+		return downloads, err
+	}
+
+	// Vendors often bundle manuals in ZIPs
+	expandDownloadedArchives(downloads)
+	return downloads, nil
+}
+
+func (p *UnifiedParser) parseWebsiteBatch(ctx context.Context, urls []string, parseDescription string, modelNumber string) (BatchProcessingResult, error) {
+	var result BatchProcessingResult
+	var samples []variantSample
+	var wg sync.WaitGroup
+	var mutex sync.Mutex // Add mutex for thread safety
+
+	ranks := rankURLs(urls, modelNumber, p.config.SourceRanking)
+
+	for i, u := range urls {
+		variants := p.config.ABTest.variantsFor(i)
+		if len(variants) == 0 {
+			variants = []PromptVariant{{}}
+		}
+
+		for _, v := range variants {
+			wg.Add(1)
+			go func(url string, variant PromptVariant) {
+				defer wg.Done()
+
+				parseResult, err := p.parseWebsite(ctx, url, 0.7, false, parseDescription, modelNumber, variant)
+				parseResult.SourceRank = ranks[url]
+				mutex.Lock()
+				if err != nil {
+					result.Failed = append(result.Failed, url)
+				} else if parseResult.NotModified {
+					result.NotModified = append(result.NotModified, url)
+				} else if parseResult.Quality != nil && parseResult.Quality.NotFound != nil {
+					result.NotFound = append(result.NotFound, url)
+				} else if parseResult.Quality != nil && parseResult.Quality.LowQuality {
+					result.LowQuality = append(result.LowQuality, url)
+				} else {
+					result.Successful = append(result.Successful, parseResult)
+				}
+				if variant.Name != "" {
+					samples = append(samples, variantSample{
+						variant:      variant.Name,
+						failed:       err != nil,
+						completeness: extractionCompleteness(parseResult.GeminiParseResult),
+						tokens:       parseResult.TokensUsed,
+						cost:         parseResult.Cost,
+					})
+				}
+				mutex.Unlock()
+			}(u, v)
+		}
+	}
+
+	wg.Wait() // Wait for all goroutines to finish
+
+	if len(samples) > 0 {
+		report := buildVariantReport(samples)
+		result.VariantReport = &report
+	}
+
+	// Merge the extractions of all URLs for this model into one record
+	if modelNumber != "" && len(result.Successful) > 1 {
+		sources := make([]extractionSource, 0, len(result.Successful))
+		for _, r := range result.Successful {
+			sources = append(sources, extractionSource{URL: r.SourceURL, Result: r.GeminiParseResult, Rank: r.SourceRank})
+		}
+		record := mergeModelSources(modelNumber, sources, resolveMostCommon)
+		result.Consolidated = &record
+	}
+	return result, nil
+}
+
+// parseWebsite scrapes and parses a single URL. A zero-value variant uses the default prompt.
+func (p *UnifiedParser) parseWebsite(ctx context.Context, websiteURL string, minConfidence float64, showAllImages bool, parseDescription string, modelNumber string, variant PromptVariant) (ParseResult, error) {
+
+	normalizedURL, err := validateAndNormalizeURL(websiteURL)
+	if err != nil {
+		return ParseResult{}, err
+	}
+	if normalizedURL, err = p.siteScraper.locale.applyQuery(normalizedURL); err != nil {
+		return ParseResult{}, err
+	}
+
+	siteDir, siteID, err := p.siteScraper.createSiteFolder(normalizedURL)
+	if err != nil {
+		return ParseResult{}, err
+	}
+	debugf("Site directory created: %s", siteDir)
+
+	page, err := p.scrape(ctx, normalizedURL)
+	if errors.Is(err, errNotModified) {
+		log.Printf("%s not modified since the last scrape, skipping extraction", normalizedURL)
+		return ParseResult{SiteID: siteID, SourceURL: normalizedURL, NotModified: true}, nil
+	}
+	if err != nil {
+
+		return ParseResult{}, fmt.Errorf("failed to scrape website: %w", err)
+	}
+	if page.Truncated {
+		log.Printf("Content of %s truncated after %d bytes of HTML", normalizedURL, page.HTMLBytes)
+	}
+
+	// Listings are crawled for product pages instead of being extracted themselves
+	if pagination := p.config.Pagination; pagination.active() && (pagination.Listing || isListingPage(normalizedURL, page, pagination.productMatcher())) {
+		return p.parseListing(ctx, normalizedURL, siteID, page, minConfidence, showAllImages, parseDescription, modelNumber, variant)
+	}
+
+	cleanedContent := page.text()
+
+	// Error pages, login walls and empty pages are recorded without asking
+	// the LLM, which could only answer NO_MATCH for them
+	structured := extractStructuredProduct(page)
+	quality := assessPage(page, structured, p.config.Quality)
+	notFound, notFoundTokens := p.checkSoftNotFound(ctx, page, structured, modelNumber)
+	if notFound != nil {
+		quality.NotFound, quality.LowQuality = notFound, true
+	}
+	if quality.LowQuality {
+		log.Printf("Skipping extraction for %s: %s", normalizedURL, quality.describe())
+		result := ParseResult{
+			SiteID:     siteID,
+			SourceURL:  normalizedURL,
+			RawContent: p.redactor.redact(cleanedContent),
+			Truncated:  page.Truncated,
+			Quality:    quality,
+			Validators: page.Validators,
+			Locale:     p.siteScraper.locale.effective(normalizedURL),
+			TokensUsed: notFoundTokens,
+			Cost:       float64(notFoundTokens) / 1000 * p.config.CostPer1KTokens,
+		}
+		if err := p.saveParseResult(result); err != nil {
+			return ParseResult{}, fmt.Errorf("failed to save parse result: %w", err)
+		}
+		return result, nil
+	}
+
+	images, err := extractImages(page, websiteURL)
+
+	if err != nil {
+		return ParseResult{}, fmt.Errorf("failed to extract images: %w", err)
+	}
+
+	imageURLs := make([]string, len(images))
+	for i, img := range images {
+		imageURLs[i] = resolveRelativeURL(normalizedURL, img["url"])
+	}
+
+	if err := waitForDiskSpace(ctx, p.dataDir, minFreeDiskBytes, nil); err != nil {
+		return ParseResult{}, fmt.Errorf("interrupted while waiting for disk space: %w", err)
+	}
+
+	var downloadedImages []string
+	release, err := acquireStage(ctx, p.stages.images, "image download")
+	if err == nil {
+		downloadedImages, err = p.imageLoader.downloadImages(ctx, imageURLs, normalizedURL)
+		release()
+	}
+
+	if err != nil {
+		log.Printf("Failed to download images: %v", err)
+
+	}
+
+	downloadedFiles := make([]string, len(downloadedImages))
+	for i, img := range downloadedImages {
+		downloadedFiles[i] = img
+	}
+
+	p.siteScraper.baseURL = websiteURL
+	pdfLinks, err := p.findPdfLinks(page.Links)
+	if err != nil {
+		return ParseResult{}, fmt.Errorf("failed to find PDF links: %w", err)
+	}
+
+	// Keep every link on the page, followed or not, for later follow-up batches
+	links := collectLinks(normalizedURL, page.Links, pdfLinks)
+
+	// Classify documents so the most likely user manual comes first
+	documents, classifyTokens := p.classifyDocuments(ctx, pdfLinks, page.Links)
+	if err := writeLinksJSONL(siteDir, links); err != nil {
+		log.Printf("Failed to write links for %s: %v", normalizedURL, err)
+	}
+
+	contentAnalysis := p.contentAnalyzer.analyzeContent(page)
+
+	imageMatches := p.contentAnalyzer.findMatchingImages(contentAnalysis, imageURLs, minConfidence, showAllImages) // Implement image matching
+
+	var geminiResult interface{}
+	var tokensUsed int
+	var provenance map[string]FieldProvenance
+	var schemaErrors []string
+	var chunksSkipped int
+
+	// Product data the page declares itself is used as is; the LLM is only
+	// asked for the schema fields it leaves out
+	schemaLeft := p.config.OutputSchema.withoutFields(structured.fields())
+	if parseDescription != "" && len(p.config.OutputSchema) > 0 && len(schemaLeft) == 0 {
+		log.Printf("Structured data on %s covers every schema field, skipping the LLM", normalizedURL)
+		geminiResult = map[string]interface{}{}
+	} else if parseDescription != "" {
+		opts := llmOptions{Prompt: p.prompt, Schema: schemaLeft}
+		if len(opts.Schema) > 0 {
+			opts.Prompt = buildSchemaPrompt(opts.Schema)
+		}
+		if variant.Template != "" {
+			opts.Prompt = variant.Template
+		}
+		opts.Prompt = withOutputLanguage(opts.Prompt, p.config.OutputLanguage)
+		opts.EarlyExit = p.config.EarlyExit
+		opts.GroundingText = page.groundingText()
+		if p.config.Vision {
+			if opts.Screenshot, err = p.siteScraper.screenshot(ctx, normalizedURL); err != nil {
+				log.Printf("Continuing without a screenshot of %s: %v", normalizedURL, err)
+			}
+		}
+
+		// Tables are sent serialized, keeping each row's cells together
+		llm, err := p.parseWithPrompt(ctx, opts, page.llmTexts(), parseDescription)
+		if err != nil {
+			return ParseResult{}, fmt.Errorf("failed to parse with Gemini: %w", err)
+		}
+		geminiResult, tokensUsed, provenance, schemaErrors = llm.Value, llm.TokensUsed, llm.Provenance, llm.SchemaErrors
+		chunksSkipped = llm.ChunksSkipped
+		for field, source := range provenance {
+			source.URL = normalizedURL
+			provenance[field] = source
+		}
+	}
+	if parseDescription != "" && structured != nil {
+		geminiResult, provenance = applyStructured(geminiResult, structured, p.config.OutputSchema, normalizedURL, provenance)
+		if merged, ok := geminiResult.(map[string]interface{}); ok && len(p.config.OutputSchema) > 0 {
+			_, schemaErrors = applySchema(merged, p.config.OutputSchema)
+		}
+	}
+
+	// Flag values that cannot be found in the scraped page. Structured data
+	// sits in markup rather than visible text but is the page's own claim.
+	grounding := checkGrounding(geminiResult, page.groundingText())
+	for field, source := range provenance {
+		if source.Source != "" {
+			if _, checked := grounding[field]; checked {
+				grounding[field] = groundingVerified
+			}
+		}
+	}
+
+	offer, offerTokens := p.extractOffer(ctx, page, structured, geminiResult)
+	tokensUsed += offerTokens
+	categoryPath, categorySource := extractCategoryPath(page, structured, modelNumber)
+
+	result := ParseResult{
+		SiteID:            siteID,
+		SourceURL:         normalizedURL,
+		ContentAnalysis:   contentAnalysis,
+		ImageMatches:      imageMatches,
+		RawContent:        p.redactor.redact(cleanedContent),
+		Truncated:         page.Truncated,
+		LinkCounts:        countLinks(links),
+		GeminiParseResult: geminiResult,
+		DownloadedFiles:   downloadedFiles,
+		PdfLinks:          documents,
+		PromptVariant:     variant.Name,
+		TokensUsed:        tokensUsed + classifyTokens + notFoundTokens,
+		Cost:              float64(tokensUsed+classifyTokens+notFoundTokens) / 1000 * p.config.CostPer1KTokens,
+		Provenance:        provenance,
+		Grounding:         grounding,
+		UnverifiedFields:  unverifiedFields(grounding),
+		SchemaErrors:      schemaErrors,
+		ChunksSkipped:     chunksSkipped,
+		StructuredData:    structured,
+		Quality:           quality,
+		Lifecycle:         detectLifecycle(geminiResult, structured, cleanedContent, modelNumber),
+		Offer:             offer,
+		CategoryPath:      categoryPath,
+		CategorySource:    categorySource,
+		Related:           relatedProducts(normalizedURL, page.Links, modelNumber),
+		MediaLinks:        mediaLinks(normalizedURL, page.Links, page.Embeds, page.JSONLD, p.config.Media),
+		Support:           extractSupportInfo(normalizedURL, page),
+		Certifications:    detectCertifications(page, documents),
+		Locale:            p.siteScraper.locale.effective(normalizedURL),
+	}
+
+	if p.resultManager != nil && modelNumber != "" {
+
+		p.resultManager.saveResult(result, modelNumber, websiteURL)
+	}
+
+	if err := p.saveParseResult(result); err != nil {
+		return ParseResult{}, fmt.Errorf("failed to save parse result: %w", err)
+	}
+
+	return result, nil
+}
+
+// saveParseResult saves the parse result to a JSON file.
+func (p *UnifiedParser) saveParseResult(result ParseResult) error {
+	resultPath := filepath.Join(p.resultsDir, fmt.Sprintf("%s.json", result.SiteID))
+	jsonData, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	if err := writeFileAtomic(resultPath, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write JSON file: %w", err)
+	}
+	return nil
+
+}
+
+// Placeholder functions to be implemented
+func NewImageLoader(client *http.Client) *ImageLoader {
+
+	return &ImageLoader{client: client}
+}
+
+func (l *ImageLoader) downloadImages(ctx context.Context, urls []string, normalizedURL string) ([]string, error) {
+	// Placeholder logic to use the parameters
+	if len(urls) == 0 {
+		log.Printf("No images to download from: %s", normalizedURL)
+	}
+	return []string{}, nil
+}
+
+func extractImages(page *pageContent, websiteURL string) ([]map[string]string, error) {
+	debugf("Extracting images from website: %s", websiteURL)
+	images := make([]map[string]string, 0, len(page.Images))
+	for _, src := range removeDuplicates(page.Images) {
+		images = append(images, map[string]string{"url": src})
+	}
+	return images, nil
+}
+
+func resolveRelativeURL(baseURL, relativeURL string) string {
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return relativeURL // Handle error as needed
+	}
+
+	relative, err := url.Parse(relativeURL)
+	if err != nil {
+		return relativeURL // Handle error as needed
+	}
+
+	return base.ResolveReference(relative).String()
+
+}
+
+type ContentAnalyzer struct {
+	dataDir string
+}
+
+func NewContentAnalyzer(dataDir string) *ContentAnalyzer {
+	return &ContentAnalyzer{dataDir: dataDir}
+}
+
+// analyzeContent returns the page's tables as structured rows, or nil when
+// the page has none
+func (ca *ContentAnalyzer) analyzeContent(page *pageContent) interface{} {
+	if len(page.Tables) == 0 {
+		return nil
+	}
+	return &ContentAnalysis{Tables: page.Tables}
+}
+
+func (ca *ContentAnalyzer) findMatchingImages(contentAnalysis interface{}, availableImages []string, minConfidence float64, showAllImages bool) []map[string]interface{} {
+	// Placeholder for image matching logic
+	return nil
+}
+
+type ImageLoader struct {
+	client *http.Client
+}
+
+type SiteScraper struct {
+	baseURL     string
+	downloadDir string
+	client      *http.Client
+	replay      bool      // Read saved snapshots instead of fetching pages
+	redactor    *redactor // Applied to snapshots once they are saved
+	locale      LocaleConfig
+	conditional bool   // Send the validators saved with a page's snapshot
+	siteIDMode  string // siteIDByURL or siteIDByHost
+	limits      PageLimits
+}
+
+func NewSiteScraper(downloadDir string) *SiteScraper {
+
+	return &SiteScraper{downloadDir: downloadDir, client: sharedScrapeClient(timeout)}
+}
+
+// createSiteFolder creates the folder for a page's artifacts and returns it
+// with the page's site ID, recording the ID in the reverse index
+func (s *SiteScraper) createSiteFolder(websiteURL string) (string, string, error) {
+	parsedURL, err := url.Parse(websiteURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	siteId := siteID(s.siteIDMode, parsedURL)
+	siteDir := filepath.Join(s.downloadDir, siteId)
+	if err := os.MkdirAll(siteDir, os.ModePerm); err != nil {
+		return "", "", fmt.Errorf("failed to create site directory: %w", err)
+	}
+	if s.siteIDMode != siteIDByHost {
+		if err := siteIndexFor(s.downloadDir).add(siteId, SiteIndexEntry{URL: websiteURL, Host: parsedURL.Host}); err != nil {
+			log.Printf("Failed to update site index for %s: %v", websiteURL, err)
+		}
+	}
+	return siteDir, siteId, nil
+
+}
+
+// scrapeWebsite fetches a page and streams it through the tokenizer, so only
+// the capped text and links are kept in memory
+func (s *SiteScraper) scrapeWebsite(ctx context.Context, url string) (*pageContent, error) {
+	if s.replay {
+		return s.replayPage(url)
+	}
+	if script := domainScripts.forURL(url); script != nil && len(script.Interact) > 0 {
+		return s.renderInteractive(ctx, url, script.Interact)
+	}
+
+	// Check size and type first so huge or non-HTML responses are never downloaded
+	oversize, err := s.precheckPage(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if oversize {
+		log.Printf("%s declares more than %d bytes, content will be truncated", url, s.limits.pageBytes())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if language := s.locale.acceptLanguage(); language != "" {
+		req.Header.Set("Accept-Language", language)
+	}
+	if script := domainScripts.forURL(url); script != nil {
+		for key, value := range script.Headers {
+			req.Header.Set(key, value)
+		}
+	}
+	if s.conditional {
+		s.storedValidators(url).setConditional(req)
+	}
+
+	started := time.Now()
+	resp, err := s.pageClient().Do(req)
+	if err != nil {
+		domainStats.record(url, time.Since(started), 0, true, false)
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && s.conditional {
+		domainStats.record(url, time.Since(started), 0, false, false)
+		return nil, errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		domainStats.record(url, time.Since(started), 0, true, isBlockStatus(resp.StatusCode))
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	// Keep the raw HTML on disk so the page can be replayed without the network
+	var body io.Reader = resp.Body
+	var tee *teeSnapshot
+	snapshot, commit, snapErr := s.snapshotWriter(url)
+	if snapErr != nil {
+		log.Printf("Snapshot disabled for %s: %v", url, snapErr)
+	} else {
+		defer snapshot.Close()
+		tee = &teeSnapshot{r: resp.Body, w: snapshot}
+		body = tee
+	}
+
+	page, err := streamHTML(body, s.limits.pageBytes(), s.limits.contentBytes())
+	page.Validators = validatorsFrom(resp.Header)
+	domainStats.record(url, time.Since(started), page.HTMLBytes, err != nil, false)
+	if tee != nil {
+		if err == nil && !tee.failed {
+			if err := commit(); err != nil {
+				log.Printf("Failed to save snapshot for %s: %v", url, err)
+			} else if err := s.redactor.redactFile(s.snapshotPath(url)); err != nil {
+				log.Printf("Failed to redact snapshot for %s: %v", url, err)
+			} else if err := s.saveValidators(url, page.Validators); err != nil {
+				log.Printf("Failed to save validators for %s: %v", url, err)
+			}
+		} else {
+			os.Remove(snapshot.Name())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %w", url, err)
+	}
+	return page, nil
+}
+
+// pageClient is the client for page requests, exiting in the locale's country
+// when a proxy pool is configured
+func (s *SiteScraper) pageClient() *http.Client {
+	return scrapeClientFor(s.locale.country(), s.client)
+}
+
+type DocumentDownloader struct {
+	baseURL     string
+	downloadDir string
+	client      *http.Client
+}
+
+func NewDocumentDownloader(baseURL, downloadDir string, client *http.Client) *DocumentDownloader {
+	return &DocumentDownloader{baseURL: baseURL, downloadDir: downloadDir, client: client}
+}
+
+// httpClient returns the injected client, or one on the shared transport for
+// parsers built without NewUnifiedParser
+func (d *DocumentDownloader) httpClient() *http.Client {
+	if d == nil || d.client == nil {
+		return sharedScrapeClient(timeout)
+	}
+	return d.client
+}
+
+func (d *DocumentDownloader) downloadDocumentsAsync(ctx context.Context, docLinks []string) (map[string][]string, error) {
+
+	return make(map[string][]string), nil
+}
+
+type CSVResultManager struct {
+	dataDir string
+}
+
+func NewCSVResultManager(dataDir string) *CSVResultManager {
+	return &CSVResultManager{dataDir: dataDir}
+}
+
+func (rm *CSVResultManager) saveResult(result ParseResult, modelNumber string, url string) {
+
+}
+
+// validateAndNormalizeURL accepts only http(s) URLs with a host. URLs without a
+// scheme are assumed to be https; other schemes (ftp, file, javascript, data, ...)
+// are rejected.
+func validateAndNormalizeURL(u string) (string, error) {
+	u = strings.TrimSpace(u)
+	if u == "" {
+		return "", fmt.Errorf("URL is empty")
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	// "example.com/page" parses as a path, and "example.com:8080" as an opaque scheme
+	if parsed.Scheme == "" || (parsed.Opaque != "" && strings.Contains(parsed.Scheme, ".")) {
+		parsed, err = url.Parse("https://" + u)
+		if err != nil {
+			return "", fmt.Errorf("invalid URL: %w", err)
+		}
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("%w %q: only http and https are allowed", errUnsupportedScheme, scheme)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("URL has no host")
+	}
+	if parsed.User != nil {
+		return "", fmt.Errorf("URLs with embedded credentials are not allowed")
+	}
+
+	parsed.Scheme = scheme
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Fragment = ""
+	return parsed.String(), nil
+}
+
+// BatchURLProcessor handles batch processing of URLs.
+type BatchURLProcessor struct {
+	scraper       *SiteScraper
+	parser        *UnifiedParser
+	docDownloader *DocumentDownloader
+	maxConcurrent int
+	timeout       int
+	resultManager *CSVResultManager
+	modelNumber   string
+}
+
+func NewBatchURLProcessor(scraper *SiteScraper, parser *UnifiedParser, docDownloader *DocumentDownloader, maxConcurrent int, timeout int, resultManager *CSVResultManager, modelNumber string) *BatchURLProcessor {
+	return &BatchURLProcessor{scraper: scraper, parser: parser, docDownloader: docDownloader, maxConcurrent: maxConcurrent, timeout: timeout, resultManager: resultManager, modelNumber: modelNumber}
+}
+
+// ProcessURLs processes a batch of URLs.
+func (p *BatchURLProcessor) ProcessURLs(ctx context.Context, urls []string, parseDescription string) (BatchProcessingResult, error) {
+	return p.parser.parseWebsiteBatch(ctx, urls, parseDescription, p.modelNumber)
+
+}
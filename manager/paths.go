@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// batchDataDir returns the output directory for a batch's data_dir: a
+// relative path below the deployment's data directory, which uploads cannot
+// leave, or the data directory itself when it is empty
+func batchDataDir(rel string) (string, error) {
+	if rel == "" {
+		return dataDir, nil
+	}
+	if filepath.IsAbs(rel) || strings.HasPrefix(rel, "/") || strings.HasPrefix(rel, `\`) || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("data_dir must be a relative path below the data directory without '..'")
+	}
+	return filepath.Join(dataDir, rel), nil
+}
+
+// maxSegmentLength caps a directory name built from input, in bytes
+const maxSegmentLength = 100
+
+// windowsReservedNames are device names Windows refuses as file names, with
+// or without an extension
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// safePathSegment turns a model number or hostname into a single directory
+// name that is valid on Windows and Unix. Separators, characters Windows
+// forbids and control characters become "_", trailing dots and spaces are
+// dropped and device names are prefixed. Names that had to change get a
+// short hash of the original, so "A/B" and "A:B" stay apart; names that are
+// already safe are kept as they are.
+func safePathSegment(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	safe := strings.TrimRight(b.String(), ". ")
+	if safe == "" || strings.Trim(safe, ".") == "" {
+		safe = "_"
+	}
+	stem := strings.ToLower(strings.TrimSpace(strings.SplitN(safe, ".", 2)[0]))
+	if windowsReservedNames[stem] {
+		safe = "_" + safe
+	}
+	if safe == name && len(safe) <= maxSegmentLength {
+		return safe
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:fileHashLength]
+	if limit := maxSegmentLength - len(suffix); len(safe) > limit {
+		safe = truncateUTF8(safe, limit)
+	}
+	return safe + suffix
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// modelDirFor is the directory holding one model number's results below baseDir
+func modelDirFor(baseDir, modelNumber string) string {
+	return filepath.Join(baseDir, safePathSegment(modelNumber))
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// longPathDir returns dir unchanged; only Windows limits path length this way
+func longPathDir(dir string) string {
+	return dir
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafePathSegmentKeepsSafeNames(t *testing.T) {
+	for _, name := range []string{"WM-1234", "ABC.123", "model 5", "Modèle_7"} {
+		if got := safePathSegment(name); got != name {
+			t.Errorf("safePathSegment(%q) = %q, want it unchanged", name, got)
+		}
+	}
+}
+
+func TestSafePathSegmentWeirdModelNumbers(t *testing.T) {
+	for _, name := range []string{
+		"A/B", `A\B`, "A:B", "../etc", "..", ".", "", "model.", "model ",
+		"CON", "nul.txt", "Com1", `x<y>"z"|?*`, "tab\tname", strings.Repeat("x", 300),
+	} {
+		got := safePathSegment(name)
+		if got == "" || got == "." || got == ".." {
+			t.Errorf("safePathSegment(%q) = %q", name, got)
+		}
+		if strings.ContainsAny(got, `<>:"/\|?*`) || strings.ContainsAny(got, "\t\x00") {
+			t.Errorf("safePathSegment(%q) = %q contains a forbidden character", name, got)
+		}
+		if strings.HasSuffix(got, ".") || strings.HasSuffix(got, " ") {
+			t.Errorf("safePathSegment(%q) = %q ends in a dot or space", name, got)
+		}
+		if len(got) > maxSegmentLength {
+			t.Errorf("safePathSegment(%q) is %d bytes long", name, len(got))
+		}
+		stem := strings.ToLower(strings.SplitN(got, ".", 2)[0])
+		if windowsReservedNames[stem] {
+			t.Errorf("safePathSegment(%q) = %q is a Windows device name", name, got)
+		}
+		if dir := modelDirFor("data", name); filepath.Dir(dir) != "data" {
+			t.Errorf("modelDirFor(%q) = %q escapes the base directory", name, dir)
+		}
+	}
+}
+
+func TestSafePathSegmentKeepsNamesApart(t *testing.T) {
+	seen := make(map[string]string)
+	for _, name := range []string{"A/B", "A:B", "A_B", `A\B`, "A?B"} {
+		got := safePathSegment(name)
+		if other, ok := seen[got]; ok {
+			t.Errorf("%q and %q both map to %q", other, name, got)
+		}
+		seen[got] = name
+	}
+}
+
+func TestCreateSiteFolderHostnames(t *testing.T) {
+	base := t.TempDir()
+	s := NewSiteScraper(base)
+	for _, rawURL := range []string{
+		"https://example.com/page",
+		"http://example.com:8080/page",
+		"http://[::1]:8080/page",
+		"https://xn--mnchen-3ya.de/",
+		"https://con/",
+	} {
+		siteDir, siteID, err := s.createSiteFolder(rawURL)
+		if err != nil {
+			t.Errorf("createSiteFolder(%q): %v", rawURL, err)
+			continue
+		}
+		if filepath.Dir(siteDir) != base {
+			t.Errorf("createSiteFolder(%q) = %q, not directly below %q", rawURL, siteDir, base)
+		}
+		if strings.ContainsAny(siteID, `<>:"/\|?*`) {
+			t.Errorf("createSiteFolder(%q) site ID %q contains a forbidden character", rawURL, siteID)
+		}
+	}
+}
+
+func TestBatchDataDirStaysBelowDataDir(t *testing.T) {
+	for _, rel := range []string{"/etc", "../outside", "a/../../b", "..", `\\server\share`} {
+		if dir, err := batchDataDir(rel); err == nil {
+			t.Errorf("batchDataDir(%q) = %q, want an error", rel, dir)
+		}
+	}
+	for _, rel := range []string{"team-a", "team-a/run-1", "a/../b"} {
+		dir, err := batchDataDir(rel)
+		if err != nil {
+			t.Errorf("batchDataDir(%q): %v", rel, err)
+			continue
+		}
+		if within, err := filepath.Rel(dataDir, dir); err != nil || strings.HasPrefix(within, "..") {
+			t.Errorf("batchDataDir(%q) = %q is outside %q", rel, dir, dataDir)
+		}
+	}
+}
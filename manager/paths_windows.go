@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import "path/filepath"
+
+// longPathDir makes dir absolute. The os package only adds the \\?\ prefix
+// that lifts the 260 character MAX_PATH limit to absolute paths, so deep
+// result trees below a relative data directory would otherwise fail.
+func longPathDir(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	return abs
+}
@@ -0,0 +1,162 @@
+// Package pool runs a fixed set of inputs through a bounded number of workers.
+//
+// Run blocks until every input has produced exactly one Result, all workers
+// have exited and every callback has returned, so callers never observe a
+// partially finished pool and no goroutines outlive the call.
+package pool
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// Result is the outcome of one input
+type Result[I, O any] struct {
+	Index  int // Position of the input in the slice passed to Run
+	Input  I
+	Output O
+	Err    error
+}
+
+// PanicError is returned for an input whose function panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Run calls fn for every input using at most workers goroutines and returns
+// the results in input order.
+//
+// onResult, when not nil, is called once per input from a single goroutine as
+// results arrive. A panic in fn is recovered and reported as a *PanicError for
+// that input only. Once ctx is cancelled, inputs that have not started are
+// reported with ctx's error without calling fn; running calls see the
+// cancelled context and are waited for.
+func Run[I, O any](ctx context.Context, workers int, inputs []I, fn func(context.Context, I) (O, error), onResult func(Result[I, O])) []Result[I, O] {
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	results := make(chan Result[I, O])
+
+	// Feed input indexes until all are handed out or ctx is cancelled
+	go func() {
+		defer close(indexes)
+		for i := range inputs {
+			select {
+			case indexes <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results <- call(ctx, i, inputs[i], fn)
+			}
+		}()
+	}
+
+	// The results channel is closed by its producers' owner, never the consumer
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ordered := make([]Result[I, O], len(inputs))
+	done := make([]bool, len(inputs))
+	for r := range results {
+		ordered[r.Index] = r
+		done[r.Index] = true
+		if onResult != nil {
+			onResult(r)
+		}
+	}
+
+	// Inputs that were never handed out because ctx was cancelled
+	for i := range inputs {
+		if done[i] {
+			continue
+		}
+		r := Result[I, O]{Index: i, Input: inputs[i], Err: ctx.Err()}
+		ordered[i] = r
+		if onResult != nil {
+			onResult(r)
+		}
+	}
+	return ordered
+}
+
+// Stream calls fn for every input received from inputs using at most workers
+// goroutines, until inputs is closed. Workers take the next input only once
+// they are free, so an unbuffered or small channel makes the sender wait for
+// them instead of queueing work in memory.
+//
+// onResult, when not nil, is called once per input from a single goroutine in
+// completion order; Index is the input's position in the stream. Inputs
+// received after ctx is cancelled are reported with ctx's error without
+// calling fn, so the sender should also stop on ctx. Stream returns the
+// number of inputs once all of them have been reported.
+func Stream[I, O any](ctx context.Context, workers int, inputs <-chan I, fn func(context.Context, I) (O, error), onResult func(Result[I, O])) int {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var next int64
+	results := make(chan Result[I, O])
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for input := range inputs {
+				index := int(atomic.AddInt64(&next, 1) - 1)
+				results <- call(ctx, index, input, fn)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	count := 0
+	for r := range results {
+		count++
+		if onResult != nil {
+			onResult(r)
+		}
+	}
+	return count
+}
+
+// call runs fn for a single input, converting a panic into an error
+func call[I, O any](ctx context.Context, index int, input I, fn func(context.Context, I) (O, error)) (result Result[I, O]) {
+	result = Result[I, O]{Index: index, Input: input}
+	defer func() {
+		if v := recover(); v != nil {
+			result.Err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+	result.Output, result.Err = fn(ctx, input)
+	return result
+}
@@ -0,0 +1,140 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunOrderedResults(t *testing.T) {
+	inputs := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	var callbacks int
+
+	results := Run(context.Background(), 3, inputs, func(_ context.Context, n int) (int, error) {
+		time.Sleep(time.Duration(8-n) * time.Millisecond)
+		return n * n, nil
+	}, func(Result[int, int]) { callbacks++ })
+
+	if callbacks != len(inputs) {
+		t.Errorf("expected %d callbacks, got %d", len(inputs), callbacks)
+	}
+	for i, r := range results {
+		if r.Index != i || r.Output != inputs[i]*inputs[i] || r.Err != nil {
+			t.Errorf("result %d: unexpected %+v", i, r)
+		}
+	}
+}
+
+func TestRunBoundsWorkers(t *testing.T) {
+	var running, peak int32
+	Run(context.Background(), 2, make([]int, 10), func(context.Context, int) (int, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return 0, nil
+	}, nil)
+
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent calls, got %d", peak)
+	}
+}
+
+func TestRunRecoversPanics(t *testing.T) {
+	results := Run(context.Background(), 2, []int{1, 2, 3}, func(_ context.Context, n int) (int, error) {
+		if n == 2 {
+			panic("boom")
+		}
+		return n, nil
+	}, nil)
+
+	var panicErr *PanicError
+	if !errors.As(results[1].Err, &panicErr) || panicErr.Value != "boom" {
+		t.Fatalf("expected a PanicError for input 2, got %v", results[1].Err)
+	}
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("expected other inputs to succeed, got %v and %v", results[0].Err, results[2].Err)
+	}
+}
+
+func TestRunCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var started int32
+
+	results := Run(ctx, 1, make([]int, 5), func(ctx context.Context, _ int) (int, error) {
+		if atomic.AddInt32(&started, 1) == 2 {
+			cancel()
+		}
+		return 0, ctx.Err()
+	}, nil)
+
+	if len(results) != 5 {
+		t.Fatalf("expected a result for every input, got %d", len(results))
+	}
+	if results[0].Err != nil {
+		t.Errorf("expected first input to succeed, got %v", results[0].Err)
+	}
+	for _, r := range results[1:] {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("input %d: expected context.Canceled, got %v", r.Index, r.Err)
+		}
+	}
+	if started > 3 {
+		t.Errorf("expected inputs after cancellation not to run, %d started", started)
+	}
+}
+
+func TestStreamAppliesBackPressure(t *testing.T) {
+	inputs := make(chan int)
+	var running, peak, sent int32
+	release := make(chan struct{})
+
+	go func() {
+		defer close(inputs)
+		for i := 0; i < 10; i++ {
+			inputs <- i
+			atomic.AddInt32(&sent, 1)
+		}
+	}()
+	go func() {
+		// With both workers blocked the sender cannot get past the third input
+		time.Sleep(20 * time.Millisecond)
+		if n := atomic.LoadInt32(&sent); n > 3 {
+			t.Errorf("expected the sender to wait for free workers, %d inputs sent", n)
+		}
+		close(release)
+	}()
+
+	seen := make(map[int]bool)
+	count := Stream(context.Background(), 2, inputs, func(_ context.Context, n int) (int, error) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if current <= p || atomic.CompareAndSwapInt32(&peak, p, current) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return n * 2, nil
+	}, func(r Result[int, int]) {
+		if r.Err != nil || r.Output != r.Input*2 || seen[r.Index] {
+			t.Errorf("unexpected result %+v", r)
+		}
+		seen[r.Index] = true
+	})
+
+	if count != 10 || len(seen) != 10 {
+		t.Errorf("expected 10 results, got %d (%d distinct indexes)", count, len(seen))
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent calls, got %d", peak)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// maxDocumentBytes is the default size above which documents are not downloaded
+var maxDocumentBytes = int64(200 << 20)
+
+// documentBytes is the size above which the batch's documents are not downloaded
+func (l PageLimits) documentBytes() int64 {
+	if l.MaxDocumentBytes > 0 {
+		return l.MaxDocumentBytes
+	}
+	return maxDocumentBytes
+}
+
+// headInfo is what a HEAD request revealed about a resource
+type headInfo struct {
+	ContentLength int64 // -1 when unknown
+	ContentType   string
+}
+
+// headCheck asks the server for a resource's size and type without
+// downloading it. ok is false when the server does not support HEAD or the
+// request failed, in which case the caller proceeds without the check.
+func headCheck(ctx context.Context, client *http.Client, target string) (headInfo, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return headInfo{}, false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return headInfo{}, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return headInfo{}, false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return headInfo{ContentLength: resp.ContentLength, ContentType: mediaType}, true
+}
+
+// isHTMLType reports whether a media type can be tokenized as a page
+func isHTMLType(mediaType string) bool {
+	return mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml" || strings.HasPrefix(mediaType, "text/")
+}
+
+// precheckPage rejects pages that are not HTML, and oversized pages when the
+// batch skips them. It reports whether the page is known to exceed the cap.
+func (s *SiteScraper) precheckPage(ctx context.Context, target string) (bool, error) {
+	if s.limits.DisableHeadCheck {
+		return false, nil
+	}
+	info, ok := headCheck(ctx, s.pageClient(), target)
+	if !ok {
+		return false, nil
+	}
+	if !isHTMLType(info.ContentType) {
+		return false, fmt.Errorf("%s is %s, not an HTML page", target, info.ContentType)
+	}
+	oversize := info.ContentLength > s.limits.pageBytes()
+	if oversize && s.limits.SkipOversize {
+		return true, fmt.Errorf("%s is %d bytes, above the %d byte page limit", target, info.ContentLength, s.limits.pageBytes())
+	}
+	return oversize, nil
+}
+
+// filterDocumentsBySize drops document links whose declared size exceeds the
+// batch's document cap, returning the kept links and the skipped ones
+func filterDocumentsBySize(ctx context.Context, client *http.Client, links []string, limits PageLimits) ([]string, []string) {
+	if limits.DisableHeadCheck {
+		return links, nil
+	}
+	limit := limits.documentBytes()
+	var kept, skipped []string
+	for _, link := range links {
+		if info, ok := headCheck(ctx, client, link); ok && info.ContentLength > limit {
+			log.Printf("Skipping document %s: %d bytes exceeds the %d byte limit", link, info.ContentLength, limit)
+			skipped = append(skipped, link)
+			continue
+		}
+		kept = append(kept, link)
+	}
+	return kept, skipped
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ProductInfo is the typed result of a product information query
+type ProductInfo struct {
+	Name           string   `json:"name"`
+	ModelNumber    string   `json:"model_number"`
+	SerialNumber   string   `json:"serial_number"`
+	WarrantyInfo   string   `json:"warranty_info"`
+	UserManual     []string `json:"user_manual"`
+	OtherDocuments []string `json:"other_documents"`
+	AdditionalInfo []string `json:"additional_info"` // Chunk answers that could not be decoded
+}
+
+// productInfoFromMap decodes an LLM answer without trusting its shape:
+// strings may arrive as numbers, lists as single strings or with non-string
+// items, and "NO_MATCH" or null mean not found
+func productInfoFromMap(m map[string]interface{}) ProductInfo {
+	return ProductInfo{
+		Name:           scalarText(m["name"]),
+		ModelNumber:    scalarText(m["model_number"]),
+		SerialNumber:   scalarText(m["serial_number"]),
+		WarrantyInfo:   scalarText(m["warranty_info"]),
+		UserManual:     listText(m["user_manual"]),
+		OtherDocuments: listText(m["other_documents"]),
+	}
+}
+
+// scalarText converts a decoded JSON value to a string, "" when not found
+func scalarText(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		value = strings.TrimSpace(value)
+		if value == "NO_MATCH" {
+			return ""
+		}
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case []interface{}:
+		// A list where a single value was expected keeps its first usable item
+		for _, item := range value {
+			if text := scalarText(item); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// listText converts a decoded JSON value to a list of non-empty strings.
+// Objects inside lists are reduced to their "url" or "name" entry.
+func listText(v interface{}) []string {
+	var items []interface{}
+	switch value := v.(type) {
+	case []interface{}:
+		items = value
+	case []string:
+		for _, item := range value {
+			items = append(items, item)
+		}
+	case nil:
+		return nil
+	default:
+		items = []interface{}{value}
+	}
+
+	var out []string
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			item = object["url"]
+			if item == nil {
+				item = object["name"]
+			}
+		}
+		if text := scalarText(item); text != "" {
+			out = append(out, text)
+		}
+	}
+	return out
+}
+
+// mergeProductInfo combines per-chunk answers in chunk order: the first
+// non-empty value of each field wins and lists are unioned without duplicates.
+// Provenance is recorded for every value taken from a chunk.
+func mergeProductInfo(answers []ProductInfo, chunkIndexes []int, chunkGroups []string) (ProductInfo, map[string]FieldProvenance) {
+	var merged ProductInfo
+	provenance := make(map[string]FieldProvenance)
+
+	for i, answer := range answers {
+		chunkIndex := chunkIndexes[i]
+		chunk := chunkGroups[chunkIndex]
+
+		for _, field := range []struct {
+			name   string
+			target *string
+			value  string
+		}{
+			{"name", &merged.Name, answer.Name},
+			{"model_number", &merged.ModelNumber, answer.ModelNumber},
+			{"serial_number", &merged.SerialNumber, answer.SerialNumber},
+			{"warranty_info", &merged.WarrantyInfo, answer.WarrantyInfo},
+		} {
+			if *field.target == "" && field.value != "" {
+				*field.target = field.value
+				recordProvenance(provenance, field.name, chunkIndex, chunk, field.value)
+			}
+		}
+
+		for _, item := range answer.UserManual {
+			recordProvenance(provenance, "user_manual:"+item, chunkIndex, chunk, item)
+		}
+		for _, item := range answer.OtherDocuments {
+			recordProvenance(provenance, "other_documents:"+item, chunkIndex, chunk, item)
+		}
+		merged.UserManual = append(merged.UserManual, answer.UserManual...)
+		merged.OtherDocuments = append(merged.OtherDocuments, answer.OtherDocuments...)
+		merged.AdditionalInfo = append(merged.AdditionalInfo, answer.AdditionalInfo...)
+	}
+
+	merged.UserManual = removeDuplicates(merged.UserManual)
+	merged.OtherDocuments = removeDuplicates(merged.OtherDocuments)
+	merged.AdditionalInfo = removeDuplicates(merged.AdditionalInfo)
+	return merged, provenance
+}
+
+// toMap renders the product in the result shape used by grounding, exports
+// and consolidation, with "NO_MATCH" for missing values and empty lists
+func (info ProductInfo) toMap() map[string]interface{} {
+	text := func(s string) string {
+		if s == "" {
+			return "NO_MATCH"
+		}
+		return s
+	}
+	list := func(items []string) []string {
+		if items == nil {
+			return []string{}
+		}
+		return items
+	}
+	return map[string]interface{}{
+		"name":            text(info.Name),
+		"model_number":    text(info.ModelNumber),
+		"serial_number":   text(info.SerialNumber),
+		"warranty_info":   text(info.WarrantyInfo),
+		"user_manual":     list(info.UserManual),
+		"other_documents": list(info.OtherDocuments),
+		"additional_info": list(info.AdditionalInfo),
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/semaphore"
+)
+
+func decodeTestProduct(t *testing.T, raw string) ProductInfo {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		t.Fatalf("bad test input %s: %v", raw, err)
+	}
+	return productInfoFromMap(m)
+}
+
+func TestProductInfoFromMapToleratesMalformedShapes(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want ProductInfo
+	}{
+		{
+			name: "list given as a single string",
+			raw:  `{"name": "Widget", "user_manual": "https://x.test/manual.pdf"}`,
+			want: ProductInfo{Name: "Widget", UserManual: []string{"https://x.test/manual.pdf"}},
+		},
+		{
+			name: "numbers, nulls and NO_MATCH",
+			raw:  `{"name": null, "model_number": 3000, "serial_number": "NO_MATCH", "warranty_info": true}`,
+			want: ProductInfo{ModelNumber: "3000", WarrantyInfo: "true"},
+		},
+		{
+			name: "mixed list items",
+			raw:  `{"other_documents": ["a.pdf", 7, null, {"url": "b.pdf"}, {"name": "c"}, {"size": 1}, "NO_MATCH", ""]}`,
+			want: ProductInfo{OtherDocuments: []string{"a.pdf", "7", "b.pdf", "c"}},
+		},
+		{
+			name: "list where a string was expected",
+			raw:  `{"name": ["", "Widget", "Gadget"], "user_manual": {"url": "m.pdf"}}`,
+			want: ProductInfo{Name: "Widget", UserManual: []string{"m.pdf"}},
+		},
+		{
+			name: "object where a string was expected",
+			raw:  `{"name": {"en": "Widget"}, "model_number": " WM-1 "}`,
+			want: ProductInfo{ModelNumber: "WM-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeTestProduct(t, tt.raw); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeProductInfoIsDeterministic(t *testing.T) {
+	answers := []ProductInfo{
+		{ModelNumber: "WM-1", UserManual: []string{"a.pdf"}},
+		{Name: "Widget", ModelNumber: "WM-2", UserManual: []string{"b.pdf", "a.pdf"}},
+		{AdditionalInfo: []string{"unparsed"}},
+	}
+	chunks := []string{"model WM-1 manual a.pdf", "Widget WM-2 b.pdf", "noise"}
+
+	merged, provenance := mergeProductInfo(answers, []int{0, 1, 2}, chunks)
+	want := ProductInfo{
+		Name:           "Widget",
+		ModelNumber:    "WM-1",
+		UserManual:     []string{"a.pdf", "b.pdf"},
+		OtherDocuments: []string{},
+		AdditionalInfo: []string{"unparsed"},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("got %#v, want %#v", merged, want)
+	}
+	if provenance["model_number"].ChunkIndex != 0 || provenance["name"].ChunkIndex != 1 {
+		t.Errorf("unexpected provenance %#v", provenance)
+	}
+	if provenance["user_manual:a.pdf"].ChunkIndex != 0 {
+		t.Errorf("expected a.pdf to be attributed to the first chunk that listed it")
+	}
+}
+
+func TestProductInfoToMapKeepsResultShape(t *testing.T) {
+	m := ProductInfo{Name: "Widget"}.toMap()
+	if m["name"] != "Widget" || m["model_number"] != "NO_MATCH" {
+		t.Errorf("unexpected scalars %v", m)
+	}
+	for _, key := range []string{"user_manual", "other_documents", "additional_info"} {
+		if list, ok := m[key].([]string); !ok || list == nil {
+			t.Errorf("expected %s to be an empty []string, got %#v", key, m[key])
+		}
+	}
+}
+
+// promptCompleter answers by prompt, since chunk groups are sent concurrently
+type promptCompleter struct {
+	mu        sync.Mutex
+	responses map[string]string
+	fallback  string
+}
+
+func (c *promptCompleter) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	content, ok := c.responses[request.Messages[len(request.Messages)-1].Content]
+	if !ok {
+		content = c.fallback
+	}
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: content}}},
+		Usage:   openai.Usage{TotalTokens: 10},
+	}, nil
+}
+
+func TestParseWithPromptSurvivesMalformedProductAnswers(t *testing.T) {
+	client := &promptCompleter{
+		responses: map[string]string{
+			"a b c": `{"name": 42, "user_manual": [{"url": "m.pdf"}, null]}`,
+			"d":     "this is not json",
+		},
+		fallback: "still not json", // Repair attempts
+	}
+	p := &UnifiedParser{client: client, config: ParserConfig{MaxRepairAttempts: 1}, sem: semaphore.NewWeighted(2)}
+
+	result, err := p.parseWithPrompt(context.Background(), llmOptions{Prompt: "{dom_content}"}, []string{"a", "b", "c", "d"}, "extract product information")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info := result.Value.(map[string]interface{})
+	if info["name"] != "42" {
+		t.Errorf("expected numeric name to be kept as text, got %v", info["name"])
+	}
+	if manuals := info["user_manual"].([]string); !reflect.DeepEqual(manuals, []string{"m.pdf"}) {
+		t.Errorf("unexpected manuals %v", manuals)
+	}
+	if extra := info["additional_info"].([]string); !reflect.DeepEqual(extra, []string{"this is not json"}) {
+		t.Errorf("expected unparsed answer in additional_info, got %v", extra)
+	}
+}
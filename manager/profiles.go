@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Profiles name a set of deployment settings so one binary can run against
+// mock providers in development and staging and real ones in production.
+// The profile is chosen with --profile or SCRAPER_PROFILE; PROFILES_FILE, a
+// JSON object of profiles by name, adds profiles or replaces built-in ones.
+// Upload configs still override worker counts and limits per batch.
+const (
+	profileEnv      = "SCRAPER_PROFILE"
+	profilesFileEnv = "PROFILES_FILE"
+)
+
+// Log levels; Printf output counts as info
+const (
+	logLevelDebug = "debug"
+	logLevelInfo  = "info"
+	logLevelWarn  = "warn" // Only lines reporting failures, warnings and rejected input
+)
+
+// Profile is one environment's settings. Zero values keep the built-in defaults.
+type Profile struct {
+	Name string `json:"-"`
+
+	// Providers
+	ParserURL  string `json:"parser_url"`  // Parse service the jobs are sent to
+	MockParser bool   `json:"mock_parser"` // Answer parse requests in-process with synthetic results
+
+	// Rate limits
+	Workers           int `json:"workers"`             // Jobs run at once per batch
+	MaxBatches        int `json:"max_batches"`         // Batches run at once
+	DailyDomainBudget int `json:"daily_domain_budget"` // Requests per domain per day
+
+	// Storage backends
+	DataDir         string `json:"data_dir"`
+	ArchiveStoreURL string `json:"archive_store_url"` // Cold storage for batch archives; "" keeps archives local
+
+	// Logging
+	LogLevel        string   `json:"log_level"`         // debug, info (default) or warn
+	AccessLogSample *float64 `json:"access_log_sample"` // Fraction of successful requests logged
+}
+
+var builtinProfiles = map[string]Profile{
+	"dev": {
+		MockParser: true,
+		Workers:    2,
+		MaxBatches: 1,
+		DataDir:    "./data-dev",
+		LogLevel:   logLevelDebug,
+	},
+	"stage": {
+		MockParser:        true,
+		Workers:           5,
+		MaxBatches:        2,
+		DailyDomainBudget: 500,
+		DataDir:           "./data-stage",
+		LogLevel:          logLevelInfo,
+	},
+	"prod": {
+		ParserURL: defaultParserURL,
+		DataDir:   "./data",
+		LogLevel:  logLevelWarn,
+	},
+}
+
+var (
+	defaultParserURL = "http://your-python-service/parse"
+	parserURL        = defaultParserURL
+	mockParser       = false
+	logLevel         = logLevelInfo
+	activeProfile    = "" // Name of the applied profile, "" when none was chosen
+)
+
+func (p Profile) validate() error {
+	switch p.LogLevel {
+	case "", logLevelDebug, logLevelInfo, logLevelWarn:
+	default:
+		return fmt.Errorf("profile %s: unsupported log_level %q", p.Name, p.LogLevel)
+	}
+	if p.Workers < 0 || p.MaxBatches < 0 || p.DailyDomainBudget < 0 {
+		return fmt.Errorf("profile %s: limits must not be negative", p.Name)
+	}
+	if p.AccessLogSample != nil && (*p.AccessLogSample < 0 || *p.AccessLogSample > 1) {
+		return fmt.Errorf("profile %s: access_log_sample must be between 0 and 1", p.Name)
+	}
+	return nil
+}
+
+// loadProfile returns the named profile, looking in PROFILES_FILE first
+func loadProfile(name string) (Profile, error) {
+	profiles := builtinProfiles
+	if path := os.Getenv(profilesFileEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Profile{}, fmt.Errorf("failed to read %s: %v", profilesFileEnv, err)
+		}
+		var custom map[string]Profile
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return Profile{}, fmt.Errorf("invalid %s: %v", profilesFileEnv, err)
+		}
+		profiles = make(map[string]Profile, len(builtinProfiles)+len(custom))
+		for n, p := range builtinProfiles {
+			profiles[n] = p
+		}
+		for n, p := range custom {
+			profiles[n] = p
+		}
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	profile.Name = name
+	return profile, profile.validate()
+}
+
+// apply switches the process to the profile's settings
+func (p Profile) apply() {
+	activeProfile = p.Name
+	if p.ParserURL != "" {
+		parserURL = p.ParserURL
+	}
+	mockParser = p.MockParser
+	if p.Workers > 0 {
+		numWorkers = p.Workers
+	}
+	if p.MaxBatches > 0 {
+		scheduler.setLimit(p.MaxBatches)
+	}
+	if p.DailyDomainBudget > 0 {
+		crawlBudget.setDefault(p.DailyDomainBudget)
+	}
+	if p.DataDir != "" {
+		dataDir = p.DataDir
+	}
+	if p.ArchiveStoreURL != "" {
+		archiveStoreURL = strings.TrimSuffix(p.ArchiveStoreURL, "/")
+	}
+	if p.LogLevel != "" {
+		logLevel = p.LogLevel
+	}
+	if p.AccessLogSample != nil {
+		accessLogSample = *p.AccessLogSample
+	}
+	if logLevel == logLevelWarn {
+		log.SetOutput(&warnFilter{w: os.Stderr})
+	}
+}
+
+// selectProfile applies the profile named by --profile or SCRAPER_PROFILE.
+// Without either, the built-in defaults stay in effect.
+func selectProfile() error {
+	name := flag.String("profile", os.Getenv(profileEnv), "configuration profile: dev, stage, prod or one from "+profilesFileEnv)
+	flag.Parse()
+	if *name == "" {
+		return nil
+	}
+	profile, err := loadProfile(*name)
+	if err != nil {
+		return err
+	}
+	profile.apply()
+	log.Printf("Using profile %s (parser %s, data dir %s, log level %s)", profile.Name, profile.parserDescription(), dataDir, logLevel)
+	return nil
+}
+
+func (p Profile) parserDescription() string {
+	if p.MockParser {
+		return "mock"
+	}
+	return parserURL
+}
+
+// debugf logs only at the debug level
+func debugf(format string, args ...interface{}) {
+	if logLevel == logLevelDebug {
+		log.Printf(format, args...)
+	}
+}
+
+// warnFilter passes on log lines that report a problem and drops the rest
+type warnFilter struct {
+	w io.Writer
+}
+
+var warnMarkers = []string{"fail", "error", "warning", "invalid", "ignoring", "panic", "refus", "reject", "cancel", "exhausted", "timed out", "exceeded", "starting server", "using profile"}
+
+func (f *warnFilter) Write(p []byte) (int, error) {
+	line := strings.ToLower(string(p))
+	for _, marker := range warnMarkers {
+		if strings.Contains(line, marker) {
+			return f.w.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+)
+
+// excerptRadius is the number of characters kept on each side of a matched value
+const excerptRadius = 80
+
+// FieldProvenance records where an extracted field value came from
+type FieldProvenance struct {
+	URL        string `json:"url"`
+	ChunkIndex int    `json:"chunk_index"`      // -1 for values taken from structured data
+	Source     string `json:"source,omitempty"` // "json-ld", "microdata" or "opengraph"; empty for the LLM
+	Excerpt    string `json:"excerpt"`
+}
+
+// recordProvenance stores the source of a field unless an earlier chunk already provided it
+func recordProvenance(provenance map[string]FieldProvenance, field string, chunkIndex int, chunk string, value string) {
+	if _, exists := provenance[field]; exists {
+		return
+	}
+	provenance[field] = FieldProvenance{
+		ChunkIndex: chunkIndex,
+		Excerpt:    sourceExcerpt(chunk, value),
+	}
+}
+
+// sourceExcerpt returns the text surrounding value in chunk, or the start of
+// the chunk when the value does not appear literally.
+func sourceExcerpt(chunk, value string) string {
+	idx := strings.Index(strings.ToLower(chunk), strings.ToLower(value))
+	if idx == -1 {
+		return truncateRunes(chunk, 2*excerptRadius)
+	}
+
+	start := max(idx-excerptRadius, 0)
+	end := min(idx+len(value)+excerptRadius, len(chunk))
+	// Avoid cutting multi-byte characters in half
+	for start > 0 && !isRuneStart(chunk[start]) {
+		start--
+	}
+	for end < len(chunk) && !isRuneStart(chunk[end]) {
+		end++
+	}
+	return strings.TrimSpace(chunk[start:end])
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return strings.TrimSpace(s)
+	}
+	return strings.TrimSpace(string(runes[:n]))
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
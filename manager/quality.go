@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Reasons a scraped page is judged not worth extracting from
+const (
+	qualityEmpty        = "empty_page"
+	qualityErrorPage    = "error_page"
+	qualityLoginWall    = "login_wall"
+	qualityBotChallenge = "bot_challenge"
+)
+
+const (
+	defaultMinTextChars = 200  // Pages with less text are near-empty
+	goodTextChars       = 2000 // Text length at which length stops adding to the score
+	shortPageChars      = 1500 // Markers in the body only count on pages this short
+)
+
+// QualityConfig tunes the check run on every scraped page before extraction
+type QualityConfig struct {
+	Disabled     bool `json:"disabled"`       // Send every page to the LLM
+	MinTextChars int  `json:"min_text_chars"` // Default 200
+
+	// Soft 404s: pages answering 200 that say the product does not exist
+	SoftNotFoundDisabled bool `json:"soft_not_found_disabled"`
+	SoftNotFoundLLM      bool `json:"soft_not_found_llm"` // Ask the LLM about pages the heuristics are unsure of
+}
+
+func (c QualityConfig) validate() error {
+	if c.MinTextChars < 0 {
+		return fmt.Errorf("quality.min_text_chars must not be negative")
+	}
+	return nil
+}
+
+func (c QualityConfig) minTextChars() int {
+	if c.MinTextChars > 0 {
+		return c.MinTextChars
+	}
+	return defaultMinTextChars
+}
+
+// PageQuality rates how likely a scraped page is to hold the product's data,
+// from 0 to 1. Low-quality pages are not sent to the LLM.
+type PageQuality struct {
+	Score      float64  `json:"score"`
+	LowQuality bool     `json:"low_quality"`
+	Reasons    []string `json:"reasons,omitempty"`
+	TextChars  int      `json:"text_chars"`
+	Title      string   `json:"title,omitempty"`
+	// Set when the page does not show the product; such jobs end in status "not_found"
+	NotFound *SoftNotFound `json:"not_found,omitempty"`
+}
+
+var (
+	errorTitlePattern  = regexp.MustCompile(`(?i)(\b(40\d|50\d)\s*(error|not found|forbidden|-|:|\|)|\b(page|product|item) not found\b|^\s*(not found|error|oops)\b|access denied|\bforbidden\b|no longer available|does not exist)`)
+	errorTextPattern   = regexp.MustCompile(`(?i)(page (you requested |you are looking for )?(could not be found|cannot be found|was not found|does not exist|no longer exists)|404 not found|an error (has )?occurred|internal server error|service unavailable)`)
+	loginTitlePattern  = regexp.MustCompile(`(?i)\b(sign in|sign-in|log in|login|sign on|register to continue)\b`)
+	loginTextPattern   = regexp.MustCompile(`(?i)(please (sign|log) in|you must be (signed|logged) in|(sign|log) in to (continue|view)|members only)`)
+	botPattern         = regexp.MustCompile(`(?i)(captcha|are you a robot|verify you are (a )?human|checking your browser|enable javascript( and cookies)? to continue|access to this page has been denied|unusual traffic)`)
+	qualityPenalties   = map[string]float64{qualityEmpty: 0.5, qualityErrorPage: 0.8, qualityLoginWall: 0.7, qualityBotChallenge: 0.9}
+	qualityReasonOrder = []string{qualityBotChallenge, qualityErrorPage, qualityLoginWall, qualityEmpty}
+)
+
+// assessPage scores a scraped page by its text length, its title and the
+// error, login and bot-check markers short pages carry. A page with product
+// structured data is never near-empty, however little text it shows.
+func assessPage(page *pageContent, structured *StructuredProduct, config QualityConfig) *PageQuality {
+	text := page.text()
+	if page.Truncated {
+		text = strings.TrimSuffix(text, " "+truncationMarker)
+	}
+	q := &PageQuality{TextChars: len(text), Title: page.Title}
+	short := q.TextChars < shortPageChars
+
+	found := map[string]bool{
+		qualityEmpty:        q.TextChars < config.minTextChars() && structured == nil,
+		qualityErrorPage:    errorTitlePattern.MatchString(page.Title) || (short && errorTextPattern.MatchString(text)),
+		qualityLoginWall:    (page.PasswordFields > 0 || loginTitlePattern.MatchString(page.Title) || loginTextPattern.MatchString(text)) && short,
+		qualityBotChallenge: short && (botPattern.MatchString(page.Title) || botPattern.MatchString(text)),
+	}
+
+	q.Score = math.Min(1, float64(q.TextChars)/goodTextChars)
+	if structured != nil {
+		q.Score = math.Max(q.Score, 0.8)
+	}
+	for _, reason := range qualityReasonOrder {
+		if found[reason] {
+			q.Reasons = append(q.Reasons, reason)
+			q.Score *= 1 - qualityPenalties[reason]
+		}
+	}
+	q.Score = roundTo(q.Score, 3)
+	q.LowQuality = len(q.Reasons) > 0 && !config.Disabled
+	return q
+}
+
+// describe summarizes why a page was judged low quality
+func (q *PageQuality) describe() string {
+	if q.NotFound != nil {
+		return fmt.Sprintf("page does not show the product (%s, score %.2f by %s)", strings.Join(q.NotFound.Signals, ", "), q.NotFound.Score, q.NotFound.Method)
+	}
+	return fmt.Sprintf("low-quality page (%s, %d characters of text, score %.2f)", strings.Join(q.Reasons, ", "), q.TextChars, q.Score)
+}
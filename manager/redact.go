@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Built-in redaction categories
+const (
+	redactEmail  = "email"
+	redactPhone  = "phone"
+	redactSerial = "serial"
+)
+
+var builtinRedactions = map[string]string{
+	redactEmail:  `(?i)[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}`,
+	redactPhone:  `\+?\(?\d{1,4}\)?(?:[\s.-]?\(?\d{2,4}\)?){2,4}\d`,
+	redactSerial: `(?i)\b(?:s/?n|serial(?:\s+(?:number|no\.?))?)\s*[:#]?\s*[A-Z0-9][A-Z0-9-]{4,}`,
+}
+
+// RedactionRule replaces matches of Pattern with a marker naming Category
+type RedactionRule struct {
+	Category string `json:"category"`
+	Pattern  string `json:"pattern"`
+}
+
+// RedactionConfig removes personal data from stored page text, snapshots and raw LLM output
+type RedactionConfig struct {
+	Categories []string        `json:"categories,omitempty"` // Built-in categories: "email", "phone", "serial"
+	Rules      []RedactionRule `json:"rules,omitempty"`      // Custom regex rules
+}
+
+// enabled reports whether any redaction is configured
+func (c RedactionConfig) enabled() bool {
+	return len(c.Categories) > 0 || len(c.Rules) > 0
+}
+
+// redactor applies compiled redaction rules; a nil redactor leaves text alone
+type redactor struct {
+	rules []compiledRedaction
+}
+
+type compiledRedaction struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+// compile builds a redactor, or returns nil when nothing is configured
+func (c RedactionConfig) compile() (*redactor, error) {
+	if !c.enabled() {
+		return nil, nil
+	}
+	r := &redactor{}
+	for _, category := range c.Categories {
+		pattern, ok := builtinRedactions[category]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction category: %s", category)
+		}
+		r.rules = append(r.rules, compiledRedaction{category, regexp.MustCompile(pattern)})
+	}
+	for _, rule := range c.Rules {
+		if rule.Category == "" {
+			return nil, fmt.Errorf("redaction rule %q has no category", rule.Pattern)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern for %s: %v", rule.Category, err)
+		}
+		r.rules = append(r.rules, compiledRedaction{rule.Category, pattern})
+	}
+	return r, nil
+}
+
+// redact replaces every match with [REDACTED:<category>]
+func (r *redactor) redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.rules {
+		text = rule.pattern.ReplaceAllLiteralString(text, "[REDACTED:"+rule.category+"]")
+	}
+	return text
+}
+
+// redactRawOutput redacts unparsed LLM output kept under "raw_content" keys
+func (r *redactor) redactRawOutput(value interface{}) interface{} {
+	if r == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if s, ok := child.(string); ok && key == "raw_content" {
+				v[key] = r.redact(s)
+			} else {
+				v[key] = r.redactRawOutput(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.redactRawOutput(child)
+		}
+	}
+	return value
+}
+
+// redactFile rewrites a stored file with its contents redacted
+func (r *redactor) redactFile(path string) error {
+	if r == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(r.redact(string(data))), 0644)
+}
@@ -0,0 +1,67 @@
+package main
+
+import "sync"
+
+// batchRegistry holds the batches in memory by ID. Request handlers, the
+// scheduler, feed watchers and the collector all reach it concurrently, so
+// the map is only ever touched under its lock.
+type batchRegistry struct {
+	mu       sync.RWMutex
+	batches  map[string]*BatchProcess
+	reserved map[string]bool // IDs being restored, not yet visible
+}
+
+var processes = &batchRegistry{batches: make(map[string]*BatchProcess), reserved: make(map[string]bool)}
+
+// get returns the batch with the given ID
+func (r *batchRegistry) get(id string) (*BatchProcess, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	bp, ok := r.batches[id]
+	return bp, ok
+}
+
+// put adds a batch, replacing any batch with the same ID, and ends a
+// reservation of its ID
+func (r *batchRegistry) put(bp *BatchProcess) {
+	r.mu.Lock()
+	r.batches[bp.ID] = bp
+	delete(r.reserved, bp.ID)
+	r.mu.Unlock()
+}
+
+// reserve claims an ID that is neither in use nor reserved, so a batch can
+// be prepared under it before it is put. The returned release gives up the
+// reservation if the batch is never put.
+func (r *batchRegistry) reserve(id string) (release func(), ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.batches[id]; exists || r.reserved[id] {
+		return nil, false
+	}
+	r.reserved[id] = true
+	return func() {
+		r.mu.Lock()
+		delete(r.reserved, id)
+		r.mu.Unlock()
+	}, true
+}
+
+// remove drops the batch with the given ID
+func (r *batchRegistry) remove(id string) {
+	r.mu.Lock()
+	delete(r.batches, id)
+	r.mu.Unlock()
+}
+
+// snapshot returns the batches in memory at the time of the call, for
+// iterating without holding the registry's lock
+func (r *batchRegistry) snapshot() []*BatchProcess {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	batches := make([]*BatchProcess, 0, len(r.batches))
+	for _, bp := range r.batches {
+		batches = append(batches, bp)
+	}
+	return batches
+}
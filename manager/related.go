@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// How a linked product relates to the page's product
+const (
+	relationRelated     = "related"
+	relationAccessory   = "accessory"
+	relationReplacement = "replacement_part"
+)
+
+// maxSectionLinks caps the links a heading's section claims, so a heading
+// near the end of a page does not claim the footer
+const maxSectionLinks = 50
+
+var (
+	// Checked in order: "accessory" and "spare part" sections are often
+	// also marked as related
+	relationPatterns = []struct {
+		relation string
+		pattern  *regexp.Regexp
+	}{
+		{relationReplacement, regexp.MustCompile(`(?i)(spare[ _-]?parts?|replacement[ _-]?parts?|ersatzteile?|pi[eè]ces? d[eé]tach[eé]es)`)},
+		{relationAccessory, regexp.MustCompile(`(?i)(accessor(y|ies)|zubeh[oö]r|compatible (with|products)|goes well with)`)},
+		{relationRelated, regexp.MustCompile(`(?i)(related|similar|you (may|might) also like|customers (also|who) (bought|viewed)|recommend|cross[ _-]?sell|up[ _-]?sell|alternatives?|compare with)`)},
+	}
+	// Model numbers in link text: letters then digits, or digits then letters
+	linkModelPattern = regexp.MustCompile(`\b([A-Z]{1,6}[- ]?\d{2,}[A-Z0-9\-/.]*|\d{3,}[A-Z][A-Z0-9\-]*)\b`)
+	// A trailing slug token with a digit, e.g. "/bosch-drill-gsr18v-55"
+	slugModelPattern = regexp.MustCompile(`(?i)-([a-z]{1,6}\d{2,}[a-z0-9]*)/?$`)
+)
+
+// RelatedProduct is a link from a product page to a related product, an
+// accessory or a replacement part
+type RelatedProduct struct {
+	URL         string `json:"url"`
+	Text        string `json:"text,omitempty"`
+	Relation    string `json:"relation"`
+	ModelNumber string `json:"model_number,omitempty"` // When the link text or URL names one
+}
+
+// relationOf classifies text such as a heading or class name
+func relationOf(text string) string {
+	for _, r := range relationPatterns {
+		if r.pattern.MatchString(text) {
+			return r.relation
+		}
+	}
+	return ""
+}
+
+// sectionTracker knows which related-products section the tokenizer is in:
+// an element whose class or id names one, or the part of the page after a
+// heading that does
+type sectionTracker struct {
+	container      string // Relation of the open container element
+	containerTag   string
+	containerDepth int
+
+	inHeading    bool
+	heading      strings.Builder
+	headingRel   string // Relation of the last heading's section
+	headingLinks int
+}
+
+func (s *sectionTracker) start(token html.Token) {
+	if token.Type != html.StartTagToken {
+		return
+	}
+	if s.containerDepth > 0 {
+		if token.Data == s.containerTag {
+			s.containerDepth++
+		}
+	} else if relation := relationOf(attr(token, "class") + " " + attr(token, "id")); relation != "" {
+		s.container, s.containerTag, s.containerDepth = relation, token.Data, 1
+	}
+
+	switch token.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5:
+		s.inHeading = true
+		s.heading.Reset()
+	case atom.Footer, atom.Nav, atom.Header:
+		s.headingRel = ""
+	}
+}
+
+func (s *sectionTracker) end(token html.Token) {
+	if s.containerDepth > 0 && token.Data == s.containerTag {
+		if s.containerDepth--; s.containerDepth == 0 {
+			s.container = ""
+		}
+	}
+	switch token.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5:
+		if s.inHeading {
+			s.inHeading = false
+			s.headingRel, s.headingLinks = relationOf(s.heading.String()), 0
+		}
+	}
+}
+
+func (s *sectionTracker) text(text string) {
+	if s.inHeading && s.heading.Len() < 200 {
+		s.heading.WriteString(text)
+		s.heading.WriteString(" ")
+	}
+}
+
+// relation returns the section a link starting now belongs to
+func (s *sectionTracker) relation() string {
+	if s.container != "" {
+		return s.container
+	}
+	if s.headingRel != "" {
+		if s.headingLinks++; s.headingLinks > maxSectionLinks {
+			s.headingRel = ""
+		}
+	}
+	return s.headingRel
+}
+
+// relatedProducts returns the links found in related-products sections,
+// resolved against the page URL. Links to the page itself, to documents and
+// to other sites' pages without a model number are left out.
+func relatedProducts(pageURL string, anchors []pageLink, modelNumber string) []RelatedProduct {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var related []RelatedProduct
+	for _, anchor := range anchors {
+		if anchor.Relation == "" {
+			continue
+		}
+		ref, err := url.Parse(anchor.Href)
+		if err != nil {
+			continue
+		}
+		resolved := base.ResolveReference(ref)
+		resolved.Fragment = ""
+		target := resolved.String()
+		if (resolved.Scheme != "http" && resolved.Scheme != "https") || target == base.String() || seen[target] {
+			continue
+		}
+		if hasSuffix(strings.ToLower(resolved.Path), documentExtensions) || nonProductPattern.MatchString(resolved.Path) {
+			continue
+		}
+
+		model := linkModelNumber(anchor.Text, resolved)
+		if sameModel(model, modelNumber) {
+			continue
+		}
+		if model == "" && !strings.EqualFold(resolved.Host, base.Host) {
+			continue
+		}
+		seen[target] = true
+		related = append(related, RelatedProduct{URL: target, Text: anchor.Text, Relation: anchor.Relation, ModelNumber: model})
+	}
+	return related
+}
+
+// linkModelNumber reads a model number from a link's text or URL slug
+func linkModelNumber(text string, target *url.URL) string {
+	if match := linkModelPattern.FindString(text); match != "" {
+		return strings.TrimRight(match, ".-/")
+	}
+	if match := slugModelPattern.FindStringSubmatch(path.Clean(target.Path)); match != nil {
+		return strings.ToUpper(match[1])
+	}
+	return ""
+}
+
+// relatedProductsCSV lists the related products of a batch's jobs in the
+// upload format, so a follow-up batch can be started from it. Products
+// without a model number are named after the linking model and their URL,
+// as spawned product pages are; products already in the batch are skipped.
+func relatedProductsCSV(jobs []BatchJob) ([]byte, int, error) {
+	inBatch := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		inBatch[job.URL] = true
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"model_number", "url", "relation", "source_model_number", "source_url"})
+	rows := 0
+	for _, job := range jobs {
+		for _, product := range job.Related {
+			if inBatch[product.URL] {
+				continue
+			}
+			inBatch[product.URL] = true
+			model := product.ModelNumber
+			if model == "" {
+				model = job.ModelNumber + "_" + urlKey(product.URL)
+			}
+			w.Write([]string{model, product.URL, product.Relation, job.ModelNumber, job.URL})
+			rows++
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, 0, fmt.Errorf("failed to write related products: %v", err)
+	}
+	return buf.Bytes(), rows, nil
+}
+
+// writeRelatedProducts saves the batch's related products as
+// <id>_related_products.csv, ready to upload as a follow-up batch
+func (bp *BatchProcess) writeRelatedProducts() {
+	bp.mu.Lock()
+	data, rows, err := relatedProductsCSV(bp.Jobs)
+	bp.mu.Unlock()
+	if err != nil {
+		log.Printf("Batch %s: %v", bp.ID, err)
+		return
+	}
+	if rows == 0 {
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(bp.DataDir, bp.ID+"_related_products.csv"), data, 0644); err != nil {
+		log.Printf("Batch %s: failed to write related products: %v", bp.ID, err)
+		return
+	}
+	log.Printf("Batch %s: %d related products, accessories and parts listed for a follow-up batch", bp.ID, rows)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// productInfoSchema describes the JSON shape expected for product information queries
+const productInfoSchema = `{
+	"name": "string",
+	"model_number": "string",
+	"serial_number": "string",
+	"warranty_info": "string",
+	"user_manual": ["string"],
+	"other_documents": ["string"]
+}`
+
+const repairPrompt = `
+		The following text was supposed to be valid JSON but could not be parsed.
+		Fix it into valid JSON matching this schema. Use "NO_MATCH" for missing string values
+		and [] for missing lists. Return only the JSON object, without any explanation.
+
+		Schema: {schema}
+
+		Text: {content}
+	`
+
+// repairJSON asks the model to turn malformed output into valid JSON matching
+// schema, retrying up to MaxRepairAttempts times.
+func (p *UnifiedParser) repairJSON(ctx context.Context, content string, schema string) (map[string]interface{}, int, error) {
+	tokensUsed := 0
+	lastErr := fmt.Errorf("repair disabled")
+
+	for attempt := 0; attempt < p.config.MaxRepairAttempts; attempt++ {
+		req := p.chatRequest(openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: strings.ReplaceAll(strings.ReplaceAll(repairPrompt, "{schema}", schema), "{content}", content),
+		})
+
+		resp, err := p.client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return nil, tokensUsed, fmt.Errorf("repair request failed: %w", err)
+		}
+		tokensUsed += resp.Usage.TotalTokens
+		if len(resp.Choices) == 0 {
+			lastErr = fmt.Errorf("repair response had no choices")
+			continue
+		}
+
+		var result map[string]interface{}
+		repaired := stripCodeFence(resp.Choices[0].Message.Content)
+		if err := json.Unmarshal([]byte(repaired), &result); err != nil {
+			lastErr = err
+			// Feed the latest attempt back so each retry builds on the previous one
+			content = repaired
+			continue
+		}
+		return result, tokensUsed, nil
+	}
+
+	return nil, tokensUsed, fmt.Errorf("failed to repair JSON after %d attempts: %w", p.config.MaxRepairAttempts, lastErr)
+}
+
+// stripCodeFence removes a surrounding markdown code fence from model output
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimPrefix(content, "json")
+	content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/semaphore"
+)
+
+// fakeCompleter returns canned responses in order
+type fakeCompleter struct {
+	responses []string
+	calls     int
+}
+
+func (f *fakeCompleter) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if f.calls >= len(f.responses) {
+		return openai.ChatCompletionResponse{}, errors.New("unexpected call")
+	}
+	content := f.responses[f.calls]
+	f.calls++
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: content}}},
+		Usage:   openai.Usage{TotalTokens: 10},
+	}, nil
+}
+
+func TestRepairJSONSucceedsOnRetry(t *testing.T) {
+	client := &fakeCompleter{responses: []string{"still {broken", "```json\n{\"name\": \"Widget\"}\n```"}}
+	p := &UnifiedParser{client: client, config: ParserConfig{MaxRepairAttempts: 2}}
+
+	result, tokens, err := p.repairJSON(context.Background(), "{name: Widget", productInfoSchema)
+	if err != nil {
+		t.Fatalf("expected repair to succeed, got %v", err)
+	}
+	if result["name"] != "Widget" {
+		t.Errorf("expected repaired name, got %v", result["name"])
+	}
+	if tokens != 20 || client.calls != 2 {
+		t.Errorf("expected 2 calls and 20 tokens, got %d calls and %d tokens", client.calls, tokens)
+	}
+}
+
+func TestRepairJSONGivesUpAfterMaxAttempts(t *testing.T) {
+	client := &fakeCompleter{responses: []string{"nope", "still nope", "never called"}}
+	p := &UnifiedParser{client: client, config: ParserConfig{MaxRepairAttempts: 2}}
+
+	if _, _, err := p.repairJSON(context.Background(), "{", productInfoSchema); err == nil {
+		t.Fatal("expected repair to fail")
+	}
+	if client.calls != 2 {
+		t.Errorf("expected repair to stop after 2 attempts, got %d", client.calls)
+	}
+}
+
+func TestParseWithPromptRepairsMalformedProductJSON(t *testing.T) {
+	client := &fakeCompleter{responses: []string{"{name: Widget", "{\"name\": \"Widget\"}"}}
+	p := &UnifiedParser{client: client, config: ParserConfig{MaxRepairAttempts: 1}, sem: semaphore.NewWeighted(1)}
+
+	result, err := p.parseWithPrompt(context.Background(), llmOptions{Prompt: "{dom_content}"}, []string{"page"}, "extract product information")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info := result.Value.(map[string]interface{})
+	if info["name"] != "Widget" {
+		t.Errorf("expected repaired name, got %v", info["name"])
+	}
+	if extra := info["additional_info"].([]string); len(extra) != 0 {
+		t.Errorf("expected no raw content fallback, got %v", extra)
+	}
+}
+
+func TestNewUnifiedParserRepairAttempts(t *testing.T) {
+	for _, tc := range []struct {
+		config ParserConfig
+		want   int
+	}{
+		{ParserConfig{}, 2},
+		{ParserConfig{MaxRepairAttempts: 3}, 3},
+		{ParserConfig{MaxRepairAttempts: 3, DisableRepair: true}, 0},
+	} {
+		p, err := NewUnifiedParser(tc.config)
+		if err != nil {
+			t.Fatalf("NewUnifiedParser: %v", err)
+		}
+		if p.config.MaxRepairAttempts != tc.want {
+			t.Errorf("%+v: repair attempts = %d, want %d", tc.config, p.config.MaxRepairAttempts, tc.want)
+		}
+	}
+}
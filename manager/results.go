@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// resultsKeepAlive is how often a followed results stream writes a blank line
+// while no job finishes, so proxies keep the connection open
+var resultsKeepAlive = time.Second * 30
+
+// JobResult is one finished job in the results stream. Cursor numbers jobs
+// in the order they finished; pass the last one seen as ?since to resume.
+type JobResult struct {
+	Cursor      int                        `json:"cursor"`
+	Index       int                        `json:"index"`
+	ModelNumber string                     `json:"model_number"`
+	URL         string                     `json:"url"`
+	Status      string                     `json:"status"`
+	Error       string                     `json:"error,omitempty"`
+	ErrorCode   string                     `json:"error_code,omitempty"`
+	Result      interface{}                `json:"result,omitempty"`
+	Normalized  map[string]NormalizedValue `json:"normalized,omitempty"`
+	Metadata    map[string]string          `json:"metadata,omitempty"`
+}
+
+// recordFinished appends a job that reached a final status to the batch's
+// completion order, once; the caller holds bp.mu
+func (bp *BatchProcess) recordFinished(job BatchJob) {
+	if !jobFinished(job.Status) || bp.finishedSet[job.Index] {
+		return
+	}
+	if bp.finishedSet == nil {
+		bp.finishedSet = make(map[int]bool)
+	}
+	bp.finishedSet[job.Index] = true
+	bp.finished = append(bp.finished, job.Index)
+	bp.rate.add(time.Now())
+}
+
+// resultsSince returns the jobs that finished after cursor, and whether the
+// batch has finished so no more will follow
+func (bp *BatchProcess) resultsSince(cursor int) ([]JobResult, bool) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	byIndex := make(map[int]int, len(bp.Jobs))
+	for i := range bp.Jobs {
+		byIndex[bp.Jobs[i].Index] = i
+	}
+	var results []JobResult
+	for pos := cursor; pos < len(bp.finished); pos++ {
+		i, ok := byIndex[bp.finished[pos]]
+		if !ok {
+			continue
+		}
+		job := bp.Jobs[i]
+		result := JobResult{
+			Cursor:      pos + 1,
+			Index:       job.Index,
+			ModelNumber: job.ModelNumber,
+			URL:         job.URL,
+			Status:      job.Status,
+			Error:       job.Error,
+			ErrorCode:   job.ErrorCode,
+			Metadata:    job.Metadata,
+		}
+		if jobSucceeded(job.Status) {
+			result.Result = job.extraction
+			result.Normalized = job.Normalized
+		}
+		results = append(results, result)
+	}
+	return results, batchDone(bp.Status)
+}
+
+// handleBatchResults returns the results of finished jobs as JSON lines while
+// the batch is still running. ?since=<cursor> skips the results already
+// read; with ?follow=true the response stays open and streams each job as it
+// finishes until the batch completes. Otherwise X-Results-Cursor carries the
+// cursor to pass next and X-Batch-Complete tells whether more will follow.
+func handleBatchResults(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	process, exists := processes.get(batchID)
+	if !exists {
+		batchGC.notFound(w, batchID)
+		return
+	}
+
+	cursor := 0
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+
+	results, complete := process.resultsSince(cursor)
+	if len(results) > 0 {
+		cursor = results[len(results)-1].Cursor
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if !follow {
+		w.Header().Set("X-Results-Cursor", strconv.Itoa(cursor))
+		w.Header().Set("X-Batch-Complete", strconv.FormatBool(complete))
+	}
+
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	write := func(results []JobResult) bool {
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return false
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+	if !write(results) || !follow || complete {
+		return
+	}
+
+	// Follow the batch the way WebSocket clients do
+	updates := make(chan bool, 1)
+	process.mu.Lock()
+	process.clients = append(process.clients, updates)
+	process.touch()
+	process.mu.Unlock()
+	defer func() {
+		process.mu.Lock()
+		process.touch()
+		for i, ch := range process.clients {
+			if ch == updates {
+				process.clients = append(process.clients[:i], process.clients[i+1:]...)
+				break
+			}
+		}
+		process.mu.Unlock()
+	}()
+
+	keepAlive := time.NewTicker(resultsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			continue
+		case <-updates:
+		}
+		results, complete := process.resultsSince(cursor)
+		if len(results) > 0 {
+			cursor = results[len(results)-1].Cursor
+		}
+		if !write(results) || complete {
+			return
+		}
+	}
+}
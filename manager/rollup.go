@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Progress rollups replace per-job snapshots on batch WebSockets by default:
+// a large batch changes on every finished job, and a full snapshot of it can
+// be megabytes.
+var (
+	progressRollupInterval = time.Second * 5 // Default time between rollups
+	minRollupInterval      = time.Second
+	maxRollupInterval      = time.Minute * 5
+)
+
+// Finished jobs are counted in buckets of rateBucketWidth, enough of them to
+// cover the longest throughput window
+const (
+	rateBucketWidth = time.Second * 10
+	rateBuckets     = 90
+)
+
+// throughputWindows are the resolutions throughput is reported at
+var throughputWindows = []struct {
+	name   string
+	window time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", time.Minute * 5},
+	{"15m", time.Minute * 15},
+}
+
+// maxDetailJobs caps the jobs sent in reply to one detail request
+const maxDetailJobs = 500
+
+// completionRate counts finished jobs per time bucket
+type completionRate struct {
+	counts [rateBuckets]int
+	latest int64 // Bucket number of the newest count
+}
+
+// rateBucket returns the number of the bucket t falls in
+func rateBucket(t time.Time) int64 {
+	return t.UnixNano() / int64(rateBucketWidth)
+}
+
+// advance clears the buckets between the newest one and now
+func (c *completionRate) advance(now int64) {
+	if c.latest == 0 {
+		c.latest = now
+		return
+	}
+	for b := c.latest + 1; b <= now && b <= c.latest+rateBuckets; b++ {
+		c.counts[b%rateBuckets] = 0
+	}
+	if now > c.latest {
+		c.latest = now
+	}
+}
+
+// add counts a job finished at t
+func (c *completionRate) add(t time.Time) {
+	b := rateBucket(t)
+	c.advance(b)
+	if c.latest-b < rateBuckets {
+		c.counts[b%rateBuckets]++
+	}
+}
+
+// perMinute returns the jobs finished per minute over the window ending at
+// now, counting the current, partly elapsed bucket
+func (c *completionRate) perMinute(now time.Time, window time.Duration) float64 {
+	b := rateBucket(now)
+	c.advance(b)
+	n := int64(window / rateBucketWidth)
+	total := 0
+	for i := int64(0); i < n && i < rateBuckets; i++ {
+		total += c.counts[(b-i)%rateBuckets]
+	}
+	return float64(total) / window.Minutes()
+}
+
+// ProgressRollup is the aggregated progress of a batch, sent on its WebSocket
+// at a fixed interval instead of a snapshot per job change
+type ProgressRollup struct {
+	Type     string         `json:"type"` // "rollup"
+	BatchID  string         `json:"batch_id"`
+	Status   string         `json:"status"`
+	Progress int            `json:"progress"`
+	Sequence int64          `json:"sequence"`
+	Total    int            `json:"total"`
+	Finished int            `json:"finished"`
+	Jobs     map[string]int `json:"jobs"` // Job counts by status
+	// Finished jobs per minute over the last minute, 5 and 15 minutes
+	Throughput map[string]float64 `json:"throughput"`
+	// Estimated time the batch finishes, from the 5-minute throughput or the
+	// average since the start when that is not yet known
+	ETA        *time.Time `json:"eta,omitempty"`
+	ETASeconds int64      `json:"eta_seconds,omitempty"`
+	Time       time.Time  `json:"time"`
+}
+
+// rollup aggregates the batch's progress under its lock
+func (bp *BatchProcess) rollup() ProgressRollup {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	now := time.Now()
+	r := ProgressRollup{
+		Type:       "rollup",
+		BatchID:    bp.ID,
+		Status:     bp.Status,
+		Progress:   bp.Progress,
+		Sequence:   bp.Sequence,
+		Total:      len(bp.Jobs),
+		Jobs:       make(map[string]int),
+		Throughput: make(map[string]float64, len(throughputWindows)),
+		Time:       now,
+	}
+	for _, job := range bp.Jobs {
+		r.Jobs[job.Status]++
+		if jobFinished(job.Status) {
+			r.Finished++
+		}
+	}
+	for _, w := range throughputWindows {
+		r.Throughput[w.name] = bp.rate.perMinute(now, w.window)
+	}
+
+	remaining := r.Total - r.Finished
+	if remaining == 0 || batchDone(bp.Status) {
+		return r
+	}
+	rate := r.Throughput["5m"]
+	if elapsed := now.Sub(bp.StartTime); rate == 0 && r.Finished > 0 && elapsed > 0 && !bp.StartTime.IsZero() {
+		rate = float64(r.Finished) / elapsed.Minutes()
+	}
+	if rate > 0 {
+		eta := now.Add(time.Duration(float64(remaining) / rate * float64(time.Minute))).Truncate(time.Second)
+		r.ETA = &eta
+		r.ETASeconds = int64(eta.Sub(now).Seconds())
+	}
+	return r
+}
+
+// detailRequest asks a rollup connection for the jobs behind the counts:
+// {"type": "jobs", "status": "failed", "offset": 0, "limit": 100}, or
+// {"type": "jobs", "indexes": [3, 17]} for particular jobs
+type detailRequest struct {
+	Type    string `json:"type"`
+	Status  string `json:"status,omitempty"`
+	Indexes []int  `json:"indexes,omitempty"`
+	Offset  int    `json:"offset,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// jobDetail answers a detail request with the matching jobs, at most
+// maxDetailJobs of them, and how many matched in total
+func (bp *BatchProcess) jobDetail(request detailRequest) ([]byte, error) {
+	limit := request.Limit
+	if limit <= 0 || limit > maxDetailJobs {
+		limit = maxDetailJobs
+	}
+	wanted := make(map[int]bool, len(request.Indexes))
+	for _, index := range request.Indexes {
+		wanted[index] = true
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	jobs := []BatchJob{}
+	matched := 0
+	for _, job := range bp.Jobs {
+		if (len(wanted) > 0 && !wanted[job.Index]) || (request.Status != "" && job.Status != request.Status) {
+			continue
+		}
+		if matched >= request.Offset && len(jobs) < limit {
+			jobs = append(jobs, job)
+		}
+		matched++
+	}
+	return json.Marshal(map[string]interface{}{
+		"type":   "jobs",
+		"total":  matched,
+		"offset": request.Offset,
+		"jobs":   jobs,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusSkippedBySampling marks rows a sampled batch records but does not run
+const statusSkippedBySampling = "skipped_by_sampling"
+
+// SamplingConfig selects the subset of a batch's rows that is processed,
+// for trying prompts on a large CSV. Count takes the first rows; percent
+// picks rows at random, and with both the random pick stops at count.
+type SamplingConfig struct {
+	Count   int     `json:"sample_count,omitempty"`
+	Percent float64 `json:"sample_percent,omitempty"`
+	Seed    int64   `json:"sample_seed,omitempty"` // Makes a random sample repeatable
+}
+
+func (c *SamplingConfig) enabled() bool {
+	return c != nil && (c.Count > 0 || c.Percent > 0)
+}
+
+// samplingFromForm reads the sample_count, sample_percent and sample_seed
+// upload options. It returns nil when the batch is not sampled.
+func samplingFromForm(r *http.Request) (*SamplingConfig, error) {
+	var c SamplingConfig
+	if value := r.FormValue("sample_count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("sample_count must be a positive integer")
+		}
+		c.Count = n
+	}
+	if value := r.FormValue("sample_percent"); value != "" {
+		p, err := strconv.ParseFloat(value, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("sample_percent must be greater than 0 and at most 100")
+		}
+		c.Percent = p
+	}
+	if value := r.FormValue("sample_seed"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("sample_seed must be an integer")
+		}
+		c.Seed = seed
+	}
+	if !c.enabled() {
+		return nil, nil
+	}
+	if c.Percent > 0 && c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	return &c, nil
+}
+
+// rowSampler decides row by row whether a row is in the sample, so streamed
+// uploads can be sampled without knowing their length
+type rowSampler struct {
+	config SamplingConfig
+	rng    *rand.Rand
+	taken  int
+}
+
+// newRowSampler returns nil for an unsampled batch; a nil sampler takes every row
+func newRowSampler(config *SamplingConfig) *rowSampler {
+	if !config.enabled() {
+		return nil
+	}
+	return &rowSampler{config: *config, rng: rand.New(rand.NewSource(config.Seed))}
+}
+
+// take reports whether the next accepted row is processed
+func (s *rowSampler) take() bool {
+	if s == nil {
+		return true
+	}
+	if s.config.Count > 0 && s.taken >= s.config.Count {
+		return false
+	}
+	if s.config.Percent > 0 && s.rng.Float64()*100 >= s.config.Percent {
+		return false
+	}
+	s.taken++
+	return true
+}
+
+// sample marks the jobs outside the sample as skipped; they stay in the batch
+// so the report still accounts for every row
+func (s *rowSampler) sample(jobs []BatchJob) int {
+	skipped := 0
+	for i := range jobs {
+		if !s.take() {
+			jobs[i].Status = statusSkippedBySampling
+			skipped++
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Downloaded documents are checked before they are saved: the content must
+// match the type its extension and Content-Type claim, executables are never
+// kept, and when AV_CLAMD_ADDR (host:port or a unix socket path) or
+// AV_ICAP_URL (icap://host:1344/service) is set the bytes are scanned.
+// Files failing a check are moved to the batch's quarantine directory and
+// the job fails with error code "quarantined". A scanner that cannot be
+// reached fails the job too, unless AV_FAIL_OPEN=true.
+const quarantineDirName = "quarantine"
+
+// Reasons a download was quarantined
+const (
+	quarantineExecutable   = "executable"
+	quarantineTypeMismatch = "type_mismatch"
+	quarantineInfected     = "infected"
+)
+
+// Quarantine records why a download was not saved with the batch's results
+type Quarantine struct {
+	Reason       string `json:"reason"`
+	DetectedType string `json:"detected_type,omitempty"`
+	ClaimedType  string `json:"claimed_type,omitempty"`
+	Threat       string `json:"threat,omitempty"` // Signature name reported by the scanner
+	Scanner      string `json:"scanner,omitempty"`
+	Path         string `json:"path,omitempty"`
+}
+
+// executableMagic are the leading bytes of native executables and scripts
+var executableMagic = []struct {
+	magic []byte
+	kind  string
+}{
+	{[]byte("MZ"), "application/x-msdownload"},
+	{[]byte("\x7fELF"), "application/x-elf"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "application/x-mach-binary"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "application/x-mach-binary"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xca, 0xfe, 0xba, 0xbe}, "application/x-mach-binary"},
+	{[]byte("#!"), "text/x-shellscript"},
+}
+
+// documentTypes maps document extensions to the content types they may hold.
+// Office formats are zip containers and legacy ones OLE files, which the
+// sniffer reports as zip and octet-stream.
+var documentTypes = map[string][]string{
+	".pdf":  {"application/pdf"},
+	".zip":  {"application/zip"},
+	".docx": {"application/zip"},
+	".xlsx": {"application/zip"},
+	".pptx": {"application/zip"},
+	".doc":  {"application/octet-stream"},
+	".xls":  {"application/octet-stream"},
+	".ppt":  {"application/octet-stream"},
+	".txt":  {"text/plain"},
+	".csv":  {"text/plain"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+}
+
+// sniffContentType returns the type of data judged by its bytes alone
+func sniffContentType(data []byte) string {
+	for _, exe := range executableMagic {
+		if bytes.HasPrefix(data, exe.magic) {
+			return exe.kind
+		}
+	}
+	kind, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return kind
+}
+
+// checkDownloadType compares a download's bytes with the type claimed by its
+// URL's extension and Content-Type header. It returns nil when the content
+// may be saved.
+func checkDownloadType(data []byte, rawURL, contentType string) *Quarantine {
+	detected := sniffContentType(data)
+	for _, exe := range executableMagic {
+		if detected == exe.kind {
+			return &Quarantine{Reason: quarantineExecutable, DetectedType: detected, ClaimedType: claimedType(rawURL, contentType)}
+		}
+	}
+
+	claimed := claimedType(rawURL, contentType)
+	var allowed []string
+	if ext := documentExtension(rawURL); ext != "" {
+		allowed = documentTypes[ext]
+	}
+	if allowed == nil && claimed == "application/pdf" {
+		allowed = documentTypes[".pdf"]
+	}
+	if allowed == nil {
+		return nil // Nothing specific was claimed
+	}
+	for _, kind := range allowed {
+		if detected == kind || (kind == "text/plain" && strings.HasPrefix(detected, "text/")) {
+			return nil
+		}
+	}
+	return &Quarantine{Reason: quarantineTypeMismatch, DetectedType: detected, ClaimedType: claimed}
+}
+
+// claimedType is the type a download says it is, preferring its extension
+func claimedType(rawURL, contentType string) string {
+	if ext := documentExtension(rawURL); ext != "" {
+		if kind := mime.TypeByExtension(ext); kind != "" {
+			kind, _, _ = mime.ParseMediaType(kind)
+			return kind
+		}
+	}
+	kind, _, _ := mime.ParseMediaType(contentType)
+	return kind
+}
+
+// virusScanner checks a download's bytes, returning the name of the threat
+// found or "" when the content is clean
+type virusScanner interface {
+	name() string
+	scan(ctx context.Context, data []byte) (string, error)
+}
+
+// configuredScanner returns the scanner set in the environment, or nil
+func configuredScanner() virusScanner {
+	if addr := os.Getenv("AV_CLAMD_ADDR"); addr != "" {
+		return clamdScanner{addr: addr}
+	}
+	if rawURL := os.Getenv("AV_ICAP_URL"); rawURL != "" {
+		return icapScanner{url: rawURL}
+	}
+	return nil
+}
+
+const scanTimeout = 30 * time.Second
+
+// clamdScanner streams the bytes to clamd with the INSTREAM command
+type clamdScanner struct {
+	addr string
+}
+
+func (s clamdScanner) name() string { return "clamd" }
+
+func (s clamdScanner) scan(ctx context.Context, data []byte) (string, error) {
+	network := "tcp"
+	if strings.HasPrefix(s.addr, "/") {
+		network = "unix"
+	}
+	dialer := net.Dialer{Timeout: scanTimeout}
+	conn, err := dialer.DialContext(ctx, network, s.addr)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach clamd: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(scanTimeout))
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	const chunkSize = 64 << 10
+	var size [4]byte
+	for start := 0; start < len(data); start += chunkSize {
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.BigEndian.PutUint32(size[:], uint32(end-start))
+		w.Write(size[:])
+		w.Write(data[start:end])
+	}
+	w.Write([]byte{0, 0, 0, 0})
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("failed to send to clamd: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+	reply = strings.TrimRight(reply, "\x00\n")
+	// "stream: OK", "stream: Eicar-Signature FOUND" or "... ERROR"
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		threat := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(threat, ": "); i != -1 {
+			threat = threat[i+2:]
+		}
+		return threat, nil
+	}
+	return "", fmt.Errorf("clamd: %s", reply)
+}
+
+// icapScanner sends the bytes to an ICAP server as an HTTP response to modify
+// (RFC 3507). A 204 reply means clean; servers report threats in the
+// X-Infection-Found or X-Virus-ID headers or by rewriting the response.
+type icapScanner struct {
+	url string
+}
+
+func (s icapScanner) name() string { return "icap" }
+
+func (s icapScanner) scan(ctx context.Context, data []byte) (string, error) {
+	u, err := url.Parse(s.url)
+	if err != nil || u.Scheme != "icap" {
+		return "", fmt.Errorf("invalid AV_ICAP_URL %q", s.url)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "1344")
+	}
+	dialer := net.Dialer{Timeout: scanTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach ICAP server: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(scanTimeout))
+
+	resHeader := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\nHost: %s\r\nAllow: 204\r\nEncapsulated: res-hdr=0, res-body=%d\r\n\r\n", s.url, u.Host, len(resHeader))
+	w.WriteString(resHeader)
+	if len(data) > 0 {
+		fmt.Fprintf(w, "%x\r\n", len(data))
+		w.Write(data)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("0\r\n\r\n")
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("failed to send to ICAP server: %v", err)
+	}
+
+	// ICAP replies are close enough to HTTP for the status line and headers
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read ICAP reply: %v", err)
+	}
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ICAP/") {
+		return "", fmt.Errorf("unexpected ICAP reply %q", strings.TrimSpace(status))
+	}
+	header := make(http.Header)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read ICAP reply: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if i := strings.Index(line, ":"); i != -1 {
+			header.Add(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+		}
+	}
+
+	if threat := header.Get("X-Virus-ID"); threat != "" {
+		return threat, nil
+	}
+	if found := header.Get("X-Infection-Found"); found != "" {
+		// "Type=0; Resolution=2; Threat=Eicar-Signature;"
+		for _, part := range strings.Split(found, ";") {
+			if name, ok := strings.CutPrefix(strings.TrimSpace(part), "Threat="); ok {
+				return name, nil
+			}
+		}
+		return found, nil
+	}
+	switch fields[1] {
+	case "204":
+		return "", nil
+	case "200":
+		// The server replaced the response, typically with a block page
+		return "unnamed threat", nil
+	}
+	return "", fmt.Errorf("ICAP server returned %s", strings.Join(fields[1:], " "))
+}
+
+// screenDownload runs the type check and the configured scanner on a
+// download. It returns nil when the content may be saved.
+func screenDownload(ctx context.Context, data []byte, rawURL, contentType string) (*Quarantine, error) {
+	if q := checkDownloadType(data, rawURL, contentType); q != nil {
+		return q, nil
+	}
+	scanner := configuredScanner()
+	if scanner == nil {
+		return nil, nil
+	}
+	threat, err := scanner.scan(ctx, data)
+	if err != nil {
+		if os.Getenv("AV_FAIL_OPEN") == "true" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if threat != "" {
+		return &Quarantine{Reason: quarantineInfected, Threat: threat, Scanner: scanner.name()}, nil
+	}
+	return nil, nil
+}
+
+// quarantine moves a rejected download to the batch's quarantine directory
+// with a sidecar describing why, and records it on the job
+func (job *BatchJob) quarantine(baseDir string, data []byte, q *Quarantine) error {
+	dir := filepath.Join(baseDir, quarantineDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return newJobError(errCodeIO, "failed to create quarantine directory: %v", err)
+	}
+	// A suffix keeps quarantined files from being opened by their extension
+	target := filepath.Join(dir, assetFileName(job.title, job.URL)+".quarantined")
+	if err := writeFileAtomic(target, data, 0600); err != nil {
+		return newJobError(errCodeIO, "failed to quarantine download: %v", err)
+	}
+	q.Path = target
+	sidecar, _ := json.MarshalIndent(struct {
+		URL         string `json:"url"`
+		ModelNumber string `json:"model_number"`
+		*Quarantine
+	}{job.URL, job.ModelNumber, q}, "", "  ")
+	writeFileAtomic(target+".json", sidecar, 0600)
+
+	job.Quarantine = q
+	detail := q.Reason
+	switch q.Reason {
+	case quarantineInfected:
+		detail = fmt.Sprintf("%s (%s)", q.Reason, q.Threat)
+	case quarantineExecutable, quarantineTypeMismatch:
+		detail = fmt.Sprintf("%s: content is %s, claimed %s", q.Reason, q.DetectedType, q.ClaimedType)
+	}
+	return newJobError(errCodeQuarantined, "download quarantined: %s", detail)
+}
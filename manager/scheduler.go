@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	schedulerInterval = time.Second * 30 // How often queued batches are re-checked
+	turnPollInterval  = time.Second * 2  // How often a yielding batch checks whether it may continue
+)
+
+// ScheduleWindow restricts processing to a daily local-time window, e.g. 22:00-06:00
+type ScheduleWindow struct {
+	Start string `json:"start"` // "HH:MM"
+	End   string `json:"end"`   // "HH:MM", may be earlier than Start to wrap past midnight
+}
+
+// parseClock converts "HH:MM" to minutes after midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validate checks that both ends of the window parse
+func (w *ScheduleWindow) validate() error {
+	if w == nil {
+		return nil
+	}
+	if _, err := parseClock(w.Start); err != nil {
+		return fmt.Errorf("schedule window start: %v", err)
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return fmt.Errorf("schedule window end: %v", err)
+	}
+	return nil
+}
+
+// open reports whether now falls inside the window; a nil window is always open
+func (w *ScheduleWindow) open(now time.Time) bool {
+	if w == nil {
+		return true
+	}
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	minute := now.Hour()*60 + now.Minute()
+
+	if start == end {
+		return true
+	}
+	if start < end {
+		return minute >= start && minute < end
+	}
+	// Window wraps past midnight
+	return minute >= start || minute < end
+}
+
+// batchScheduler starts queued batches by priority and within their windows,
+// keeping at most maxRunning batches processing at once
+type batchScheduler struct {
+	mu         sync.Mutex
+	queued     []*BatchProcess
+	running    map[string]*BatchProcess
+	maxRunning int // 0 for no limit
+	wake       chan struct{}
+}
+
+// scheduler runs at most MAX_BATCHES batches at once; a deployment profile
+// may set the limit at startup
+var scheduler = newBatchScheduler(envInt("MAX_BATCHES", 0))
+
+func newBatchScheduler(maxRunning int) *batchScheduler {
+	return &batchScheduler{
+		running:    make(map[string]*BatchProcess),
+		maxRunning: maxRunning,
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// submit queues a batch for processing
+func (s *batchScheduler) submit(bp *BatchProcess) {
+	s.mu.Lock()
+	s.queued = append(s.queued, bp)
+	s.mu.Unlock()
+	s.signal()
+}
+
+// remove drops a batch that has not started from the queue, reporting
+// whether it was still queued
+func (s *batchScheduler) remove(bp *BatchProcess) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, queued := range s.queued {
+		if queued == bp {
+			s.queued = append(s.queued[:i], s.queued[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// setLimit changes the number of batches allowed to process at once
+func (s *batchScheduler) setLimit(n int) {
+	s.mu.Lock()
+	s.maxRunning = n
+	s.mu.Unlock()
+	s.signal()
+}
+
+// signal asks the scheduler loop to re-check the queue
+func (s *batchScheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run dispatches batches until the process exits
+func (s *batchScheduler) run() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatch(time.Now())
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch starts queued batches whose window is open, highest priority first,
+// while processing slots are free. Batches left waiting get their queue position.
+func (s *batchScheduler) dispatch(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Nothing new starts during maintenance
+	if maintenance.active() {
+		return
+	}
+
+	sort.SliceStable(s.queued, func(i, j int) bool {
+		if s.queued[i].Priority != s.queued[j].Priority {
+			return s.queued[i].Priority > s.queued[j].Priority
+		}
+		return s.queued[i].StartTime.Before(s.queued[j].StartTime)
+	})
+
+	remaining := s.queued[:0]
+	for _, bp := range s.queued {
+		if !bp.Window.open(now) {
+			remaining = append(remaining, bp)
+			bp.setQueued("scheduled", len(remaining))
+			continue
+		}
+		if s.maxRunning > 0 && len(s.running) >= s.maxRunning {
+			remaining = append(remaining, bp)
+			bp.setQueued("queued", len(remaining))
+			continue
+		}
+		bp.setQueued(bp.Status, 0)
+		s.running[bp.ID] = bp
+		go s.execute(bp)
+	}
+	s.queued = remaining
+}
+
+// execute processes a batch and frees its slot afterwards
+func (s *batchScheduler) execute(bp *BatchProcess) {
+	log.Printf("Scheduler: starting batch %s (priority %d)", bp.ID, bp.Priority)
+	bp.startProcessing()
+
+	s.mu.Lock()
+	delete(s.running, bp.ID)
+	s.mu.Unlock()
+	s.signal()
+}
+
+// mustYield reports whether a running batch should hold off dispatching its next
+// job, because of maintenance, a closed window or a higher-priority batch that
+// is making progress itself
+func (s *batchScheduler) mustYield(bp *BatchProcess, now time.Time) bool {
+	if maintenance.active() || !bp.Window.open(now) {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.running {
+		if other != bp && other.Priority > bp.Priority && other.progressing(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// progressing reports whether a running batch can dispatch jobs now: its
+// window is open and it is not paused, whether for a window, another batch
+// or disk space. Batches only yield to those, so a higher-priority batch
+// that is stuck waiting never holds the others up.
+func (bp *BatchProcess) progressing(now time.Time) bool {
+	if !bp.Window.open(now) {
+		return false
+	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return bp.Status == "processing" || bp.Status == "discovering"
+}
+
+// waitTurn blocks a batch's worker until the batch may process its next job,
+// or until ctx is done
+func (s *batchScheduler) waitTurn(ctx context.Context, bp *BatchProcess) error {
+	paused := false
+	for s.mustYield(bp, time.Now()) {
+		if !paused {
+			bp.setStatus("paused")
+			bp.notifyClients()
+			paused = true
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(turnPollInterval):
+		}
+	}
+	if paused {
+		bp.setStatus("processing")
+		bp.notifyClients()
+	}
+	return nil
+}
+
+// setQueued records why a batch is waiting and where it is in the queue
+func (bp *BatchProcess) setQueued(status string, position int) {
+	bp.mu.Lock()
+	changed := bp.Status != status || bp.QueuePosition != position
+	bp.Status = status
+	bp.QueuePosition = position
+	bp.mu.Unlock()
+	if changed {
+		bp.notifyClients()
+		bp.publishEvent(eventBatchStage)
+	}
+}
+
+// setStatus updates the batch status under its lock
+func (bp *BatchProcess) setStatus(status string) {
+	bp.mu.Lock()
+	bp.Status = status
+	bp.mu.Unlock()
+}
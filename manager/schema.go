@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Supported output field types
+const (
+	fieldString  = "string"
+	fieldNumber  = "number"
+	fieldBoolean = "boolean"
+	fieldList    = "list"
+)
+
+// OutputField declares one field a batch wants extracted
+type OutputField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // "string" (default), "number", "boolean" or "list"
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// OutputSchema is the ordered list of fields a batch wants extracted
+type OutputSchema []OutputField
+
+// validate checks field names and types
+func (s OutputSchema) validate() error {
+	seen := make(map[string]bool)
+	for _, field := range s {
+		if field.Name == "" {
+			return fmt.Errorf("output schema field without a name")
+		}
+		if seen[field.Name] {
+			return fmt.Errorf("duplicate output schema field: %s", field.Name)
+		}
+		seen[field.Name] = true
+		switch field.fieldType() {
+		case fieldString, fieldNumber, fieldBoolean, fieldList:
+		default:
+			return fmt.Errorf("unsupported type %q for output schema field %s", field.Type, field.Name)
+		}
+	}
+	return nil
+}
+
+func (f OutputField) fieldType() string {
+	if f.Type == "" {
+		return fieldString
+	}
+	return f.Type
+}
+
+// jsonShape renders the schema as an example JSON object for prompts
+func (s OutputSchema) jsonShape() string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	for i, field := range s {
+		shape := map[string]string{
+			fieldString:  `"string"`,
+			fieldNumber:  `number`,
+			fieldBoolean: `true | false`,
+			fieldList:    `["string"]`,
+		}[field.fieldType()]
+		fmt.Fprintf(&b, "\t%q: %s", field.Name, shape)
+		if i < len(s)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// buildSchemaPrompt generates an extraction prompt that asks for exactly the schema fields
+func buildSchemaPrompt(schema OutputSchema) string {
+	var fields strings.Builder
+	for _, field := range schema {
+		required := "optional"
+		if field.Required {
+			required = "required"
+		}
+		fmt.Fprintf(&fields, "\t\t- %s (%s, %s): %s\n", field.Name, field.fieldType(), required, field.Description)
+	}
+
+	return `
+		Analyze the following website content and extract the requested fields.
+
+		Website Content: {dom_content}
+
+		Query: {parse_description}
+
+		Fields:
+` + fields.String() + `
+		Respond with a single JSON object using exactly these keys:
+		` + schema.jsonShape() + `
+
+		Use "NO_MATCH" for string fields that are not found, null for numbers and booleans,
+		and [] for lists. Return only the JSON object.
+	`
+}
+
+// applySchema coerces an LLM result to the schema and reports missing required fields.
+// Keys not in the schema are dropped.
+func applySchema(result map[string]interface{}, schema OutputSchema) (map[string]interface{}, []string) {
+	out := make(map[string]interface{}, len(schema))
+	var problems []string
+
+	for _, field := range schema {
+		value, present := result[field.Name]
+		coerced, ok := coerceField(value, field.fieldType())
+		if present && value != nil && !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected %s", field.Name, field.fieldType()))
+		}
+		out[field.Name] = coerced
+		if field.Required && isEmptyField(coerced) {
+			problems = append(problems, fmt.Sprintf("%s: required field missing", field.Name))
+		}
+	}
+	return out, problems
+}
+
+// coerceField converts a decoded JSON value to the declared type, returning
+// the type's empty value and false when it cannot be converted
+func coerceField(value interface{}, fieldType string) (interface{}, bool) {
+	switch fieldType {
+	case fieldNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return n, true
+			}
+		}
+		return nil, false
+	case fieldBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, true
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, true
+			}
+		}
+		return nil, false
+	case fieldList:
+		if _, isList := value.([]interface{}); isList || value == nil {
+			return stringList(value), true
+		}
+		if list := stringList(value); list != nil {
+			return list, true
+		}
+		return []string{}, false
+	default:
+		switch v := value.(type) {
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return "NO_MATCH", true
+			}
+			return v, true
+		case float64, bool:
+			return fmt.Sprint(v), true
+		}
+		return "NO_MATCH", value == nil
+	}
+}
+
+// isEmptyField reports whether a coerced value carries no information
+func isEmptyField(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == "NO_MATCH"
+	case []string:
+		return len(v) == 0
+	}
+	return false
+}
+
+// mergeSchemaResults combines per-chunk schema results: the first non-empty
+// scalar wins and lists are unioned
+func mergeSchemaResults(results []map[string]interface{}, schema OutputSchema) map[string]interface{} {
+	merged := make(map[string]interface{}, len(schema))
+	for _, field := range schema {
+		empty, _ := coerceField(nil, field.fieldType())
+		merged[field.Name] = empty
+	}
+
+	for _, result := range results {
+		for _, field := range schema {
+			value := result[field.Name]
+			if isEmptyField(value) {
+				continue
+			}
+			if field.fieldType() == fieldList {
+				merged[field.Name] = removeDuplicates(append(stringList(merged[field.Name]), stringList(value)...))
+			} else if isEmptyField(merged[field.Name]) {
+				merged[field.Name] = value
+			}
+		}
+	}
+	return merged
+}
+
+// writeSchemaCSV exports a result with exactly the schema's columns, followed by the job's metadata
+func writeSchemaCSV(resultsDir string, schema OutputSchema, result interface{}, metadata map[string]string) error {
+	info, _ := result.(map[string]interface{})
+
+	header := make([]string, len(schema))
+	record := make([]string, len(schema))
+	for i, field := range schema {
+		header[i] = field.Name
+		record[i] = formatCell(info[field.Name])
+	}
+	header, record = appendMetadata(header, record, metadata)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(header)
+	writer.Write(record)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write schema CSV: %v", err)
+	}
+	if err := writeFileAtomic(filepath.Join(resultsDir, "results.csv"), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write schema CSV: %v", err)
+	}
+	return nil
+}
+
+// formatCell renders a field value for a CSV cell; lists are pipe-delimited
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, "|")
+	case []interface{}:
+		return strings.Join(stringList(v), "|")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// EarlyExitConfig stops sending a page's remaining chunks to the LLM once
+// the wanted schema fields have been found
+type EarlyExitConfig struct {
+	Enabled         bool     `json:"enabled"`
+	Fields          []string `json:"fields,omitempty"`           // Fields that must be found, the schema's required fields when empty
+	MinChunks       int      `json:"min_chunks,omitempty"`       // Chunk groups always sent before exiting
+	AllowUngrounded bool     `json:"allow_ungrounded,omitempty"` // Accept text values that do not appear in the page
+}
+
+// active reports whether early exit applies; it needs an output schema
+func (c EarlyExitConfig) active(schema OutputSchema) bool {
+	return c.Enabled && len(schema) > 0
+}
+
+// wantedFields returns the fields that must be found before exiting
+func (c EarlyExitConfig) wantedFields(schema OutputSchema) []OutputField {
+	var fields []OutputField
+	for _, field := range schema {
+		if (len(c.Fields) == 0 && field.Required) || slices.Contains(c.Fields, field.Name) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// satisfied reports whether the answers so far contain every wanted field,
+// with text values found verbatim in the page unless ungrounded values are allowed
+func (c EarlyExitConfig) satisfied(outputs []chunkOutput, opts llmOptions) bool {
+	if len(outputs) < c.MinChunks {
+		return false
+	}
+	wanted := c.wantedFields(opts.Schema)
+	if len(wanted) == 0 {
+		return false
+	}
+	var results []map[string]interface{}
+	for _, out := range outputs {
+		if out.schema != nil {
+			results = append(results, out.schema)
+		}
+	}
+	merged := mergeSchemaResults(results, opts.Schema)
+	content := normalizeForMatch(opts.GroundingText)
+	for _, field := range wanted {
+		value := merged[field.Name]
+		if isEmptyField(value) {
+			return false
+		}
+		if text, ok := value.(string); ok && !c.AllowUngrounded && !isGroundedText(content, text) {
+			return false
+		}
+	}
+	return true
+}
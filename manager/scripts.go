@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scriptsDir holds per-domain scripts, one "<domain>.json" file each. Files are
+// re-read when they change, so behaviour can be adjusted without a rebuild.
+// Scripts are declarative: headers, a URL rewrite, browser interactions and
+// a list of post-processing steps, rather than code in an embedded language.
+var scriptsDir = os.Getenv("SCRAPER_SCRIPTS_DIR")
+
+// DomainScript adjusts how one domain is scraped and post-processes its results
+type DomainScript struct {
+	Headers     map[string]string `json:"headers,omitempty"`      // Sent with every page request
+	WaitMs      int               `json:"wait_ms,omitempty"`      // Delay before the page is requested
+	RewriteURL  *ScriptReplace    `json:"rewrite_url,omitempty"`  // Applied to the job URL before scraping
+	PostProcess []ScriptStep      `json:"post_process,omitempty"` // Applied in order to the extracted JSON
+
+	// Run in order in a headless browser once the page loaded; the page is
+	// then read from the browser instead of being fetched directly
+	Interact []ScriptAction `json:"interact,omitempty"`
+}
+
+// Browser interactions
+const (
+	scriptClick   = "click"    // Click the first element matching the selector
+	scriptWaitFor = "wait_for" // Wait until an element matches the selector
+	scriptWait    = "wait"     // Wait a fixed time
+)
+
+// ScriptAction is one browser interaction
+type ScriptAction struct {
+	Action    string `json:"action"`
+	Selector  string `json:"selector,omitempty"`   // CSS selector for click and wait_for
+	TimeoutMs int    `json:"timeout_ms,omitempty"` // wait_for: how long to wait, 10s by default; wait: the delay
+}
+
+// maxInteractionMs caps a single wait, so a script cannot hold a job forever
+const maxInteractionMs = 60000
+
+// ScriptReplace is a regular expression replacement
+type ScriptReplace struct {
+	Pattern string `json:"pattern"`
+	With    string `json:"with"`
+
+	re *regexp.Regexp
+}
+
+// Post-processing operations
+const (
+	scriptSet     = "set"
+	scriptDelete  = "delete"
+	scriptRename  = "rename"
+	scriptReplace = "replace"
+	scriptTrim    = "trim"
+)
+
+// ScriptStep is one post-processing operation on a top-level field
+type ScriptStep struct {
+	Op      string      `json:"op"`
+	Field   string      `json:"field"`
+	To      string      `json:"to,omitempty"`      // rename
+	Value   interface{} `json:"value,omitempty"`   // set
+	Pattern string      `json:"pattern,omitempty"` // replace
+	With    string      `json:"with,omitempty"`    // replace
+
+	re *regexp.Regexp
+}
+
+// compile validates the script and prepares its regular expressions
+func (s *DomainScript) compile() error {
+	if s.RewriteURL != nil {
+		re, err := regexp.Compile(s.RewriteURL.Pattern)
+		if err != nil {
+			return fmt.Errorf("rewrite_url: %v", err)
+		}
+		s.RewriteURL.re = re
+	}
+	for i, action := range s.Interact {
+		switch action.Action {
+		case scriptClick, scriptWaitFor:
+			if action.Selector == "" {
+				return fmt.Errorf("interact %d: %s needs a selector", i, action.Action)
+			}
+		case scriptWait:
+			if action.TimeoutMs <= 0 {
+				return fmt.Errorf("interact %d: wait needs timeout_ms", i)
+			}
+		default:
+			return fmt.Errorf("interact %d: unsupported action %q", i, action.Action)
+		}
+		if action.TimeoutMs > maxInteractionMs {
+			return fmt.Errorf("interact %d: timeout_ms is above %d", i, maxInteractionMs)
+		}
+	}
+	for i := range s.PostProcess {
+		step := &s.PostProcess[i]
+		switch step.Op {
+		case scriptSet, scriptDelete, scriptTrim:
+		case scriptRename:
+			if step.To == "" {
+				return fmt.Errorf("post_process %d: rename needs \"to\"", i)
+			}
+		case scriptReplace:
+			re, err := regexp.Compile(step.Pattern)
+			if err != nil {
+				return fmt.Errorf("post_process %d: %v", i, err)
+			}
+			step.re = re
+		default:
+			return fmt.Errorf("post_process %d: unsupported op %q", i, step.Op)
+		}
+		if step.Field == "" {
+			return fmt.Errorf("post_process %d: missing field", i)
+		}
+	}
+	return nil
+}
+
+// apply runs the post-processing steps on a copy of result
+func (s *DomainScript) apply(result interface{}) interface{} {
+	info, ok := result.(map[string]interface{})
+	if !ok || len(s.PostProcess) == 0 {
+		return result
+	}
+	out := make(map[string]interface{}, len(info))
+	for k, v := range info {
+		out[k] = v
+	}
+
+	for _, step := range s.PostProcess {
+		switch step.Op {
+		case scriptSet:
+			out[step.Field] = step.Value
+		case scriptDelete:
+			delete(out, step.Field)
+		case scriptRename:
+			if v, ok := out[step.Field]; ok {
+				out[step.To] = v
+				delete(out, step.Field)
+			}
+		case scriptReplace:
+			out[step.Field] = mapStrings(out[step.Field], func(s string) string {
+				return step.re.ReplaceAllString(s, step.With)
+			})
+		case scriptTrim:
+			out[step.Field] = mapStrings(out[step.Field], strings.TrimSpace)
+		}
+	}
+	return out
+}
+
+// mapStrings applies fn to a string or to every string in a list
+func mapStrings(value interface{}, fn func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case []interface{}, []string:
+		items := stringList(v)
+		for i := range items {
+			items[i] = fn(items[i])
+		}
+		return items
+	}
+	return value
+}
+
+// scriptCache loads domain scripts lazily and reloads them when the file changes
+type scriptCache struct {
+	mu      sync.Mutex
+	scripts map[string]cachedScript
+}
+
+type cachedScript struct {
+	modified time.Time
+	script   *DomainScript
+}
+
+var domainScripts = &scriptCache{scripts: make(map[string]cachedScript)}
+
+// forURL returns the script for rawURL's domain, or nil when there is none
+func (c *scriptCache) forURL(rawURL string) *DomainScript {
+	if scriptsDir == "" {
+		return nil
+	}
+	domain := strings.TrimPrefix(strings.ToLower(jobDomain(rawURL)), "www.")
+	if domain == "" || strings.ContainsAny(domain, `/\`) || strings.HasPrefix(domain, ".") {
+		return nil
+	}
+	path := filepath.Join(scriptsDir, domain+".json")
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.scripts[domain]; ok && cached.modified.Equal(info.ModTime()) {
+		return cached.script
+	}
+
+	script, err := loadDomainScript(path)
+	if err != nil {
+		log.Printf("Ignoring script for %s: %v", domain, err)
+		script = nil
+	}
+	c.scripts[domain] = cachedScript{modified: info.ModTime(), script: script}
+	return script
+}
+
+// loadDomainScript reads and compiles one script file
+func loadDomainScript(path string) (*DomainScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var script DomainScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("invalid script: %v", err)
+	}
+	if err := script.compile(); err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+// BeforeScrape applies the domain's URL rewrite and wait
+func (c *scriptCache) BeforeScrape(ctx context.Context, job *BatchJob) error {
+	script := c.forURL(job.URL)
+	if script == nil {
+		return nil
+	}
+	if script.RewriteURL != nil {
+		job.URL = script.RewriteURL.re.ReplaceAllString(job.URL, script.RewriteURL.With)
+	}
+	if script.WaitMs > 0 {
+		select {
+		case <-time.After(time.Duration(script.WaitMs) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// AfterExtract applies the domain's post-processing steps
+func (c *scriptCache) AfterExtract(ctx context.Context, job *BatchJob, result interface{}) (interface{}, error) {
+	if script := c.forURL(job.URL); script != nil {
+		return script.apply(result), nil
+	}
+	return result, nil
+}
+
+func init() {
+	RegisterHook(domainScripts)
+}
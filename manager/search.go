@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	searchTextBytes    = 256 << 10 // Text indexed and kept per page or document
+	searchDefaultLimit = 20
+	searchIndexFile    = "search_index.jsonl"
+)
+
+// SearchHit is a scraped page matching a search query
+type SearchHit struct {
+	BatchID     string `json:"batch_id"`
+	JobIndex    int    `json:"job_index"`
+	ModelNumber string `json:"model_number"`
+	URL         string `json:"url"`
+	Score       int    `json:"score"`
+	Snippet     string `json:"snippet,omitempty"`
+}
+
+// indexedDoc is one scraped page or mirrored document in the search index
+type indexedDoc struct {
+	BatchID     string `json:"batch_id"`
+	JobIndex    int    `json:"job_index"`
+	ModelNumber string `json:"model_number,omitempty"`
+	URL         string `json:"url"`
+	Text        string `json:"text"` // What was indexed, at most searchTextBytes
+
+	private bool // Of a batch encrypted at rest, so never written to the index file
+}
+
+// indexRecord is one line of the index file: a document added, replacing any
+// earlier version of its job, or a batch whose documents were removed
+type indexRecord struct {
+	Add         *indexedDoc `json:"add,omitempty"`
+	RemoveBatch string      `json:"remove_batch,omitempty"`
+}
+
+// searchIndex is an inverted index over page content, document text and
+// extracted values. Changes are appended to a JSONL file in the data
+// directory and replayed at startup; the file is rewritten once most of its
+// records are stale.
+type searchIndex struct {
+	mu       sync.RWMutex
+	docs     map[int]*indexedDoc
+	postings map[string]map[int]int // term -> doc -> occurrences
+	byJob    map[string]int         // batch/job key -> doc, so re-processed jobs replace their entry
+	nextID   int
+
+	path    string   // Index file; empty keeps the index in memory only
+	file    *os.File // Open for appending
+	records int      // Lines in the file
+}
+
+var documentIndex = newSearchIndex()
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     make(map[int]*indexedDoc),
+		postings: make(map[string]map[int]int),
+		byJob:    make(map[string]int),
+	}
+}
+
+// tokenize splits text into lowercase letter/digit terms
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// open loads the index file at path and appends later changes to it
+func (s *searchIndex) open(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64<<10), 2*searchTextBytes)
+		for scanner.Scan() {
+			var record indexRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				continue // A torn last line from a crash
+			}
+			s.apply(record)
+			s.records++
+		}
+		err := scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read search index: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to open search index: %w", err)
+	}
+
+	s.path = path
+	if err := s.compact(); err != nil {
+		s.path = ""
+		return err
+	}
+	log.Printf("Search index: %d documents loaded from %s", len(s.docs), path)
+	return nil
+}
+
+// apply changes the in-memory index; the caller holds s.mu
+func (s *searchIndex) apply(record indexRecord) {
+	switch {
+	case record.Add != nil:
+		doc := record.Add
+		key := doc.BatchID + "/" + strconv.Itoa(doc.JobIndex)
+		if id, exists := s.byJob[key]; exists {
+			s.drop(id)
+		}
+		id := s.nextID
+		s.nextID++
+		s.docs[id] = doc
+		s.byJob[key] = id
+		for _, term := range tokenize(doc.Text) {
+			docs, ok := s.postings[term]
+			if !ok {
+				docs = make(map[int]int)
+				s.postings[term] = docs
+			}
+			docs[id]++
+		}
+	case record.RemoveBatch != "":
+		for key, id := range s.byJob {
+			if s.docs[id].BatchID == record.RemoveBatch {
+				s.drop(id)
+				delete(s.byJob, key)
+			}
+		}
+	}
+}
+
+// drop removes one document and its postings; the caller holds s.mu
+func (s *searchIndex) drop(id int) {
+	doc, ok := s.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range tokenize(doc.Text) {
+		if docs, ok := s.postings[term]; ok {
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(s.postings, term)
+			}
+		}
+	}
+	delete(s.docs, id)
+}
+
+// persist appends a change to the index file, compacting it once it holds
+// more than twice the live documents; the caller holds s.mu
+func (s *searchIndex) persist(record indexRecord) {
+	if s.file == nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Search index: failed to write %s: %v", s.path, err)
+		return
+	}
+	s.records++
+	if s.records > 2*len(s.docs)+1000 {
+		if err := s.compact(); err != nil {
+			log.Printf("Search index: %v", err)
+		}
+	}
+}
+
+// compact rewrites the index file with only the live documents and reopens
+// it for appending; the caller holds s.mu
+func (s *searchIndex) compact() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	ids := make([]int, 0, len(s.docs))
+	for id := range s.docs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, id := range ids {
+		if s.docs[id].private {
+			continue
+		}
+		if err := encoder.Encode(indexRecord{Add: s.docs[id]}); err != nil {
+			return fmt.Errorf("failed to encode search index: %w", err)
+		}
+	}
+	if err := writeFileAtomic(s.path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open search index: %w", err)
+	}
+	s.file = f
+	s.records = len(ids)
+	return nil
+}
+
+// add indexes the content of a processed job, replacing any earlier version.
+// Private content is only indexed in memory.
+func (s *searchIndex) add(batchID string, job *BatchJob, content string, private bool) {
+	doc := &indexedDoc{
+		BatchID:     batchID,
+		JobIndex:    job.Index,
+		ModelNumber: job.ModelNumber,
+		URL:         job.URL,
+		Text:        truncateUTF8(content, searchTextBytes),
+		private:     private,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := indexRecord{Add: doc}
+	s.apply(record)
+	if !private {
+		s.persist(record)
+	}
+}
+
+// removeBatch drops the documents of a deleted or evicted batch
+func (s *searchIndex) removeBatch(batchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := indexRecord{RemoveBatch: batchID}
+	s.apply(record)
+	s.persist(record)
+}
+
+// search returns documents containing every query term, best matches first.
+// An empty batchID searches all batches.
+func (s *searchIndex) search(query, batchID string, limit int) []SearchHit {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := make(map[int]int)
+	for i, term := range terms {
+		docs := s.postings[term]
+		next := make(map[int]int)
+		for id, count := range docs {
+			if batchID != "" && s.docs[id].BatchID != batchID {
+				continue
+			}
+			if _, ok := scores[id]; i == 0 || ok {
+				next[id] = scores[id] + count
+			}
+		}
+		scores = next
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for id, score := range scores {
+		doc := s.docs[id]
+		hits = append(hits, SearchHit{
+			BatchID:     doc.BatchID,
+			JobIndex:    doc.JobIndex,
+			ModelNumber: doc.ModelNumber,
+			URL:         doc.URL,
+			Score:       score,
+			Snippet:     sourceExcerpt(doc.Text, terms[0]),
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].BatchID != hits[j].BatchID {
+			return hits[i].BatchID < hits[j].BatchID
+		}
+		return hits[i].JobIndex < hits[j].JobIndex
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// indexText collects the searchable text of a job: the page content plus every extracted value
+func indexText(content string, extraction interface{}) string {
+	values := make(map[string]string)
+	flattenResult("", extraction, ExportConfig{ListMode: listModePipe}, values)
+
+	var b strings.Builder
+	b.WriteString(content)
+	for _, value := range values {
+		b.WriteString("\n")
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// handleSearch finds scraped pages mentioning the query, optionally within one batch
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+	batchID := r.URL.Query().Get("batch")
+	if batchID != "" {
+		if _, exists := processes.get(batchID); !exists {
+			http.Error(w, "Batch not found", http.StatusNotFound)
+			return
+		}
+	}
+	limit := searchDefaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query": query,
+		"hits":  documentIndex.search(query, batchID, limit),
+	})
+}
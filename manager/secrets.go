@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API keys are read from a secret provider instead of config files or batch
+// uploads. SECRETS_PROVIDER selects it:
+//
+//	env   (default) the upper-cased secret name, e.g. OPENAI_API_KEY
+//	file  one file per secret in SECRETS_DIR, as mounted by Kubernetes
+//	vault a HashiCorp Vault KV v2 secret at VAULT_ADDR, VAULT_SECRET_PATH
+//	      ("<mount>/<path>"), authenticated with VAULT_TOKEN
+//	aws   AWS Secrets Manager in AWS_REGION, one secret per name, signed
+//	      with AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//
+// Values are cached for SECRETS_REFRESH_SECONDS (300 by default) and then
+// read again, so rotated keys are picked up without a restart.
+const (
+	secretsProviderEnv = "SECRETS_PROVIDER"
+	defaultSecretsTTL  = 5 * time.Minute
+)
+
+// Secret names used by the scraper
+const (
+	secretOpenAIKey = "openai_api_key"
+	secretGeminiKey = "gemini_api_key"
+	secretLocalKey  = "local_llm_api_key"
+	secretSearchKey = "search_api_key"
+	secretJWTKey    = "jwt_signing_key"
+)
+
+// secretProvider looks up the current value of a named secret
+type secretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// newSecretProvider builds the provider named by SECRETS_PROVIDER
+func newSecretProvider() (secretProvider, error) {
+	switch provider := os.Getenv(secretsProviderEnv); provider {
+	case "", "env":
+		return envSecrets{}, nil
+	case "file":
+		dir := os.Getenv("SECRETS_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("the file secret provider needs SECRETS_DIR")
+		}
+		return fileSecrets{dir: dir}, nil
+	case "vault":
+		addr, path := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_SECRET_PATH")
+		mount, secretPath, ok := strings.Cut(strings.Trim(path, "/"), "/")
+		if addr == "" || !ok {
+			return nil, fmt.Errorf("the vault secret provider needs VAULT_ADDR and VAULT_SECRET_PATH as <mount>/<path>")
+		}
+		return &vaultSecrets{
+			url:    strings.TrimRight(addr, "/") + "/v1/" + mount + "/data/" + secretPath,
+			token:  os.Getenv("VAULT_TOKEN"),
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "aws":
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			return nil, fmt.Errorf("the aws secret provider needs AWS_REGION")
+		}
+		return &awsSecrets{region: region, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported %s %q", secretsProviderEnv, provider)
+	}
+}
+
+// envSecrets reads secrets from environment variables
+type envSecrets struct{}
+
+func (envSecrets) Secret(ctx context.Context, name string) (string, error) {
+	return os.Getenv(strings.ToUpper(name)), nil
+}
+
+// fileSecrets reads each secret from a file named after it
+type fileSecrets struct {
+	dir string
+}
+
+func (s fileSecrets) Secret(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, safePathSegment(name)))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// vaultSecrets reads the keys of one Vault KV v2 secret
+type vaultSecrets struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s *vaultSecrets) Secret(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", s.token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+	return body.Data.Data[name], nil
+}
+
+// awsSecrets reads secrets from AWS Secrets Manager. Requests are signed
+// with Signature Version 4 directly, as the AWS SDK is not a dependency.
+type awsSecrets struct {
+	region string
+	client *http.Client
+}
+
+func (s *awsSecrets) Secret(ctx context.Context, name string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", err
+	}
+	host := "secretsmanager." + s.region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, payload, s.region, "secretsmanager", time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if bytes.Contains(body, []byte("ResourceNotFoundException")) {
+			return "", nil
+		}
+		return "", fmt.Errorf("secrets manager returned status 400: %s", body)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secrets manager returned status %d", resp.StatusCode)
+	}
+	var body struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	return body.SecretString, nil
+}
+
+// signAWSRequest adds a Signature Version 4 Authorization header using the
+// credentials in the environment
+func signAWSRequest(req *http.Request, payload []byte, region, service string, now time.Time) {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	req.Header.Set("Host", req.URL.Host)
+
+	payloadHash := sha256.Sum256(payload)
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders.String(), signedHeaders, hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{day, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// secretStore caches secrets from a provider and re-reads them after the
+// refresh interval. When a refresh fails the last value is kept.
+type secretStore struct {
+	provider secretProvider
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	values map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value   string
+	fetched time.Time
+}
+
+var secrets = newSecretStore()
+
+func newSecretStore() *secretStore {
+	provider, err := newSecretProvider()
+	if err != nil {
+		log.Printf("Falling back to environment secrets: %v", err)
+		provider = envSecrets{}
+	}
+	ttl := time.Duration(envInt("SECRETS_REFRESH_SECONDS", int(defaultSecretsTTL/time.Second))) * time.Second
+	return &secretStore{provider: provider, ttl: ttl, values: make(map[string]cachedSecret)}
+}
+
+// get returns the current value of a secret, or "" when it is not set
+func (s *secretStore) get(name string) string {
+	s.mu.Lock()
+	cached, ok := s.values[name]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetched) < s.ttl {
+		return cached.value
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	value, err := s.provider.Secret(ctx, name)
+	if err != nil {
+		log.Printf("Failed to refresh secret %s, keeping the previous value: %v", name, err)
+		value = cached.value
+	}
+	if ok && value != cached.value && err == nil {
+		log.Printf("Secret %s was rotated", name)
+	}
+	s.mu.Lock()
+	s.values[name] = cachedSecret{value: value, fetched: time.Now()}
+	s.mu.Unlock()
+	return value
+}
+
+// apiKey returns a function yielding the LLM provider's current key. A key
+// given inline in the config still works but is reported as deprecated.
+func (c ParserConfig) apiKey() func() string {
+	if c.APIKey != "" {
+		log.Printf("Warning: api_key in the parser config is deprecated, store it in the %s secret provider", secrets.providerName())
+		key := c.APIKey
+		return func() string { return key }
+	}
+	name := c.APIKeySecret
+	if name == "" {
+		switch c.Provider {
+		case providerGemini:
+			name = secretGeminiKey
+		case providerLocal:
+			name = secretLocalKey
+		default:
+			name = secretOpenAIKey
+		}
+	}
+	return func() string { return secrets.get(name) }
+}
+
+// providerName names the configured provider for messages
+func (s *secretStore) providerName() string {
+	if name := os.Getenv(secretsProviderEnv); name != "" {
+		return name
+	}
+	return "env"
+}
+
+// secretRefPrefix marks a config value that names a secret instead of holding it
+const secretRefPrefix = "secret:"
+
+// resolveSecretRef returns the secret named by a "secret:<name>" value, or
+// the value itself. Refs come from uploads, so only the names in allowed,
+// taken from deployment config, are resolved; anything else could read any
+// variable of the server's environment.
+func resolveSecretRef(value string, allowed []string) (string, error) {
+	name, ok := strings.CutPrefix(value, secretRefPrefix)
+	if !ok {
+		return value, nil
+	}
+	for _, permitted := range allowed {
+		if name == permitted {
+			return secrets.get(name), nil
+		}
+	}
+	return "", fmt.Errorf("secret %q is not configured for this destination", name)
+}
+
+// secretHeaderTransport sets a header from a secret on every request, so a
+// client built once keeps working after the key is rotated
+type secretHeaderTransport struct {
+	base   http.RoundTripper
+	header string
+	prefix string // e.g. "Bearer "
+	secret func() string
+}
+
+func (t *secretHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	value := t.secret()
+	if value == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(t.header, t.prefix+value)
+	return t.base.RoundTrip(req)
+}
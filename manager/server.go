@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Server settings are read from the environment at startup:
+//
+//	LISTEN_ADDR      address to bind, default ":8080"
+//	BASE_PATH        URL prefix when served below the root, e.g. "/scraper"
+//	TRUSTED_PROXIES  comma-separated IPs or CIDRs whose X-Forwarded-* headers are believed
+//	TRUSTED_USER_HEADER  header a trusted proxy sets to the user it authenticated, e.g. "X-Forwarded-User"
+const (
+	listenAddrEnv        = "LISTEN_ADDR"
+	basePathEnv          = "BASE_PATH"
+	trustedProxiesEnv    = "TRUSTED_PROXIES"
+	trustedUserHeaderEnv = "TRUSTED_USER_HEADER"
+)
+
+// listenAddr returns the address to bind
+func listenAddr() string {
+	if addr := os.Getenv(listenAddrEnv); addr != "" {
+		return addr
+	}
+	return ":8080"
+}
+
+// basePath returns the URL prefix without a trailing slash, "" for the root
+func basePath() string {
+	path := strings.TrimRight(os.Getenv(basePathEnv), "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// apiRouter returns the router routes are registered on, below the base path
+func apiRouter(router *mux.Router) *mux.Router {
+	if prefix := basePath(); prefix != "" {
+		return router.PathPrefix(prefix).Subrouter()
+	}
+	return router
+}
+
+// parseTrustedProxies parses TRUSTED_PROXIES into networks; single IPs become /32 or /128
+func parseTrustedProxies(value string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+var trustedProxies = parseTrustedProxies(os.Getenv(trustedProxiesEnv))
+
+var trustedUserHeader = http.CanonicalHeaderKey(strings.TrimSpace(os.Getenv(trustedUserHeaderEnv)))
+
+// trustedUser returns the user a trusted proxy authenticated, or "". The
+// header is dropped from other peers' requests by proxyHeaders.
+func trustedUser(r *http.Request) string {
+	if trustedUserHeader == "" {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(trustedUserHeader))
+}
+
+// isTrustedProxy reports whether ip belongs to a configured proxy
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyHeaders replaces the remote address with the client's when the request
+// came through a trusted proxy, walking X-Forwarded-For from the right and
+// stopping at the first address that is not a trusted proxy. r.URL.Scheme is
+// set from the connection or a trusted X-Forwarded-Proto. The trusted user
+// header is removed when the peer is not a trusted proxy.
+func proxyHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if peer := net.ParseIP(host); peer != nil && isTrustedProxy(peer) {
+			hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					break
+				}
+				host = ip.String()
+				if !isTrustedProxy(ip) {
+					break
+				}
+			}
+			if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+				scheme = proto
+			}
+			r.RemoteAddr = net.JoinHostPort(host, "0")
+		} else if trustedUserHeader != "" {
+			r.Header.Del(trustedUserHeader)
+		}
+
+		r.URL.Scheme = scheme
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the client address, after proxy headers were applied
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+)
+
+// Kinds of assets listed in the shared asset report
+const (
+	assetDocument = "document"
+	assetImage    = "image"
+)
+
+// SharedAsset is a document or image URL extracted for more than one model
+// number. Downstream storage can keep one copy and link it from each model
+// instead of storing the same manual per model.
+type SharedAsset struct {
+	URL        string   `json:"url"`
+	Kind       string   `json:"kind"`
+	Models     []string `json:"models"`
+	Jobs       []int    `json:"jobs"`                  // Jobs that extracted the URL
+	MirrorPath string   `json:"mirror_path,omitempty"` // The one mirrored copy, when documents are mirrored
+}
+
+// sharedAssets lists the extracted URLs that several model numbers have in
+// common, those shared by the most models first
+func sharedAssets(jobs []BatchJob) []SharedAsset {
+	byURL := make(map[string]*SharedAsset)
+	models := make(map[string]map[string]bool)
+	var order []string
+	add := func(kind, assetURL string, job BatchJob) {
+		asset, ok := byURL[assetURL]
+		if !ok {
+			asset = &SharedAsset{URL: assetURL, Kind: kind}
+			byURL[assetURL] = asset
+			models[assetURL] = make(map[string]bool)
+			order = append(order, assetURL)
+		}
+		if !models[assetURL][job.ModelNumber] {
+			models[assetURL][job.ModelNumber] = true
+			asset.Models = append(asset.Models, job.ModelNumber)
+		}
+		asset.Jobs = append(asset.Jobs, job.Index)
+	}
+
+	mirrors := make(map[string]string)
+	for _, job := range jobs {
+		if job.Kind == jobKindDocumentMirror {
+			if job.MirrorPath != "" {
+				mirrors[job.URL] = job.MirrorPath
+			}
+			continue
+		}
+		if !jobSucceeded(job.Status) {
+			continue
+		}
+		for _, documentURL := range removeDuplicates(job.documents) {
+			add(assetDocument, documentURL, job)
+		}
+		for _, imageURL := range removeDuplicates(job.images) {
+			add(assetImage, imageURL, job)
+		}
+	}
+
+	var shared []SharedAsset
+	for _, assetURL := range order {
+		asset := byURL[assetURL]
+		if len(asset.Models) < 2 {
+			continue
+		}
+		sort.Strings(asset.Models)
+		asset.MirrorPath = mirrors[assetURL]
+		shared = append(shared, *asset)
+	}
+	sort.SliceStable(shared, func(i, j int) bool {
+		return len(shared[i].Models) > len(shared[j].Models)
+	})
+	return shared
+}
+
+// buildSharedAssets attaches the shared asset report once all jobs are done
+// and writes it next to the batch's other exports
+func (bp *BatchProcess) buildSharedAssets() {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	bp.SharedAssets = sharedAssets(bp.Jobs)
+	if len(bp.SharedAssets) == 0 {
+		return
+	}
+	if err := writeSharedAssets(filepath.Join(bp.DataDir, bp.ID+"_shared_assets.json"), bp.SharedAssets); err != nil {
+		log.Printf("Failed to write shared assets for batch %s: %v", bp.ID, err)
+		return
+	}
+	log.Printf("Batch %s: %d documents and images shared between model numbers", bp.ID, len(bp.SharedAssets))
+}
+
+// imageURLs returns the URLs of matched images
+func imageURLs(matches []ImageMatch) []string {
+	urls := make([]string, 0, len(matches))
+	for _, match := range matches {
+		urls = append(urls, match.URL)
+	}
+	return urls
+}
+
+func writeSharedAssets(path string, assets []SharedAsset) error {
+	data, err := encodeJSON(assets, "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal shared assets: %v", err)
+	}
+	defer putBuffer(data)
+	return writeFileAtomic(path, data.Bytes(), 0644)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Synthetic latencies used when a simulation leaves them unset
+const (
+	defaultScrapeLatencyMs = 300
+	defaultLLMLatencyMs    = 1200
+)
+
+// SimulationConfig runs a batch through the whole pipeline (queueing,
+// progress events, exports and notifications) with fake scrape and LLM
+// results, so no target site or provider is contacted. Output goes to the
+// simulations directory below the data directory.
+type SimulationConfig struct {
+	Enabled bool `json:"enabled"` // Same as the simulate=true form value
+
+	// Each stage takes a random time within its range; a zero range uses the default
+	ScrapeLatency LatencyRange `json:"scrape_latency"`
+	LLMLatency    LatencyRange `json:"llm_latency"`
+
+	FailureRate    float64 `json:"failure_rate"`     // Share of jobs answered with a parser error
+	LowQualityRate float64 `json:"low_quality_rate"` // Share of jobs whose page is judged low quality
+}
+
+// LatencyRange is a synthetic latency, drawn uniformly between its bounds
+type LatencyRange struct {
+	MinMs int `json:"min_ms"`
+	MaxMs int `json:"max_ms"`
+}
+
+func (c SimulationConfig) validate() error {
+	for name, r := range map[string]LatencyRange{"scrape_latency": c.ScrapeLatency, "llm_latency": c.LLMLatency} {
+		if r.MinMs < 0 || r.MaxMs < 0 || (r.MaxMs > 0 && r.MaxMs < r.MinMs) {
+			return fmt.Errorf("simulation.%s needs 0 <= min_ms <= max_ms", name)
+		}
+		if time.Duration(max(r.MinMs, r.MaxMs))*time.Millisecond >= heartbeatTimeout {
+			return fmt.Errorf("simulation.%s must stay below the %s heartbeat timeout", name, heartbeatTimeout)
+		}
+	}
+	if c.FailureRate < 0 || c.LowQualityRate < 0 || c.FailureRate+c.LowQualityRate > 1 {
+		return fmt.Errorf("simulation failure_rate and low_quality_rate must be between 0 and 1 together")
+	}
+	return nil
+}
+
+// simulation returns the batch's simulation, or nil when it runs for real
+func (c Config) simulation() *SimulationConfig {
+	if !c.Simulation.Enabled {
+		return nil
+	}
+	sim := c.Simulation
+	return &sim
+}
+
+// draw picks a latency within the range, or around fallback when it is unset
+func (r LatencyRange) draw(fallback int) time.Duration {
+	lo, hi := r.MinMs, r.MaxMs
+	if lo == 0 && hi == 0 {
+		lo, hi = fallback/2, fallback*3/2
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return time.Duration(lo+rand.Intn(hi-lo+1)) * time.Millisecond
+}
+
+// parserClient returns the client for parse requests. Simulated jobs, and
+// every job when the profile mocks the parser, are answered in-process.
+func parserClient(simulation *SimulationConfig) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if simulation != nil {
+		client.Transport = &mockParserTransport{simulation: simulation}
+	} else if mockParser {
+		client.Transport = &mockParserTransport{}
+	}
+	return client
+}
+
+// mockParserTransport answers parse requests with synthetic results: every
+// schema field, or a name and the model number, filled in. With a simulation
+// it waits out the scrape and LLM latencies and fails or rejects a share of
+// the pages as configured.
+type mockParserTransport struct {
+	simulation *SimulationConfig // nil answers at once and always succeeds
+}
+
+func (t *mockParserTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var request ParseRequest
+	if req.Body != nil {
+		defer req.Body.Close()
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			return nil, fmt.Errorf("mock parser: %v", err)
+		}
+	}
+
+	response := ParseResponse{
+		SiteID:     jobDomain(request.URL),
+		Status:     "success",
+		RawContent: "Simulated page for " + request.URL,
+	}
+	if sim := t.simulation; sim != nil {
+		if err := sleepContext(req, sim.ScrapeLatency.draw(defaultScrapeLatencyMs)); err != nil {
+			return nil, err
+		}
+		switch roll := rand.Float64(); {
+		case roll < sim.FailureRate:
+			return mockResponse(req, http.StatusBadGateway, map[string]string{"error": "simulated parser failure"})
+		case roll < sim.FailureRate+sim.LowQualityRate:
+			response.Quality = &PageQuality{LowQuality: true, Reasons: []string{qualityEmpty}, TextChars: len(response.RawContent)}
+			return mockResponse(req, http.StatusOK, response)
+		}
+		if err := sleepContext(req, sim.LLMLatency.draw(defaultLLMLatencyMs)); err != nil {
+			return nil, err
+		}
+	}
+
+	result := map[string]interface{}{
+		"name":         "Mock product " + request.ModelNumber,
+		"model_number": request.ModelNumber,
+	}
+	if len(request.OutputSchema) > 0 {
+		result = make(map[string]interface{}, len(request.OutputSchema))
+		for _, field := range request.OutputSchema {
+			result[field.Name] = "mock " + field.Name
+		}
+	}
+	response.GeminiResult = result
+	return mockResponse(req, http.StatusOK, response)
+}
+
+// sleepContext waits for d unless the request is cancelled first
+func sleepContext(req *http.Request, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func mockResponse(req *http.Request, status int, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Ways of naming a page's site folder and parse result
+const (
+	siteIDByURL  = "url"  // Hostname plus a hash of the URL, one folder per page (default)
+	siteIDByHost = "host" // Hostname only; pages on the same host share and overwrite a folder
+)
+
+// siteIndexFile maps site IDs back to the page they were created for
+const siteIndexFile = "site_index.json"
+
+// SiteIndexEntry is the page a site folder belongs to
+type SiteIndexEntry struct {
+	URL  string `json:"url"`
+	Host string `json:"host"`
+}
+
+// siteIndex is the reverse index of one data directory's site folders,
+// written to <dir>/site_index.json whenever a folder is added
+type siteIndex struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]SiteIndexEntry
+}
+
+var (
+	siteIndexesMu sync.Mutex
+	siteIndexes   = make(map[string]*siteIndex) // By data directory
+)
+
+// siteIndexFor returns the index of dir, loading it on first use
+func siteIndexFor(dir string) *siteIndex {
+	siteIndexesMu.Lock()
+	defer siteIndexesMu.Unlock()
+	if index, ok := siteIndexes[dir]; ok {
+		return index
+	}
+	index := &siteIndex{path: filepath.Join(dir, siteIndexFile), entries: make(map[string]SiteIndexEntry)}
+	if data, err := os.ReadFile(index.path); err == nil {
+		if err := json.Unmarshal(data, &index.entries); err != nil {
+			log.Printf("Ignoring invalid %s: %v", index.path, err)
+		}
+	}
+	siteIndexes[dir] = index
+	return index
+}
+
+// add records the page of a site ID, writing the index if it changed
+func (x *siteIndex) add(siteID string, entry SiteIndexEntry) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.entries[siteID] == entry {
+		return nil
+	}
+	x.entries[siteID] = entry
+	data, err := json.MarshalIndent(x.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(x.path, data, 0644)
+}
+
+// lookup returns the page a site ID was created for
+func (x *siteIndex) lookup(siteID string) (SiteIndexEntry, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	entry, ok := x.entries[siteID]
+	return entry, ok
+}
+
+// siteID names the folder and parse result of a page
+func siteID(mode string, parsedURL *url.URL) string {
+	host := safePathSegment(parsedURL.Host)
+	if mode == siteIDByHost {
+		return host
+	}
+	page := *parsedURL
+	page.Fragment = ""
+	return host + "-" + urlKey(page.String())
+}
+
+// validateSiteIDMode rejects unknown site_id_mode values
+func validateSiteIDMode(mode string) error {
+	switch mode {
+	case "", siteIDByURL, siteIDByHost:
+		return nil
+	}
+	return fmt.Errorf("unsupported site_id_mode %q: use %q or %q", mode, siteIDByURL, siteIDByHost)
+}
+
+// migrateSiteFolders moves results written under hostname-only site IDs to
+// per-page IDs. The stored parse result says which page a folder belongs to;
+// folders whose result is missing or unreadable are left in place.
+func migrateSiteFolders(dir string) (int, error) {
+	resultsDir := filepath.Join(dir, "parse_results")
+	files, err := filepath.Glob(filepath.Join(resultsDir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	index := siteIndexFor(dir)
+	migrated := 0
+	for _, file := range files {
+		oldID := strings.TrimSuffix(filepath.Base(file), ".json")
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var result struct {
+			SiteID    string `json:"site_id"`
+			SourceURL string `json:"source_url"`
+		}
+		if json.Unmarshal(data, &result) != nil || result.SourceURL == "" || result.SiteID != oldID {
+			continue
+		}
+		parsed, err := url.Parse(result.SourceURL)
+		if err != nil || oldID != safePathSegment(parsed.Host) {
+			continue // Already a per-page ID
+		}
+
+		newID := siteID(siteIDByURL, parsed)
+		var updated map[string]interface{}
+		if err := json.Unmarshal(data, &updated); err != nil {
+			continue
+		}
+		updated["site_id"] = newID
+		rewritten, err := json.MarshalIndent(updated, "", "  ")
+		if err != nil {
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(resultsDir, newID+".json"), rewritten, 0644); err != nil {
+			return migrated, err
+		}
+		if err := os.Rename(filepath.Join(dir, oldID), filepath.Join(dir, newID)); err != nil && !os.IsNotExist(err) {
+			return migrated, err
+		}
+		if err := os.Remove(file); err != nil {
+			return migrated, err
+		}
+		if err := index.add(newID, SiteIndexEntry{URL: result.SourceURL, Host: parsed.Host}); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
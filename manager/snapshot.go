@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// snapshotPath returns where the raw HTML of pageURL is stored for replay
+func (s *SiteScraper) snapshotPath(pageURL string) string {
+	return filepath.Join(s.downloadDir, "snapshots", urlKey(pageURL)+".html")
+}
+
+// snapshotWriter creates the snapshot file for pageURL. The caller closes it
+// and calls commit once the page was read completely.
+func (s *SiteScraper) snapshotWriter(pageURL string) (*os.File, func() error, error) {
+	path := s.snapshotPath(pageURL)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	commit := func() error {
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		return os.Rename(tmp.Name(), path)
+	}
+	return tmp, commit, nil
+}
+
+// replayPage tokenizes a previously saved snapshot instead of fetching the page
+func (s *SiteScraper) replayPage(pageURL string) (*pageContent, error) {
+	f, err := os.Open(s.snapshotPath(pageURL))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no snapshot stored for %s", pageURL)
+		}
+		return nil, fmt.Errorf("failed to open snapshot for %s: %w", pageURL, err)
+	}
+	defer f.Close()
+	return streamHTML(f, s.limits.pageBytes(), s.limits.contentBytes())
+}
+
+// teeSnapshot copies what the tokenizer reads into the snapshot file; a failed
+// snapshot write never fails the scrape
+type teeSnapshot struct {
+	r      io.Reader
+	w      io.Writer
+	failed bool
+}
+
+func (t *teeSnapshot) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 && !t.failed {
+		if _, werr := t.w.Write(p[:n]); werr != nil {
+			t.failed = true
+		}
+	}
+	return n, err
+}
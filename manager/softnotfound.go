@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// statusNotFound is the job status of a page answering 200 that says the
+// product does not exist, such as a "product not found" page or a search
+// results page the site redirected to. Nothing is extracted from it.
+const statusNotFound = "not_found"
+
+const (
+	softNotFoundThreshold = 0.7 // Signal score at which a page is judged not found
+	softNotFoundUncertain = 0.4 // Scores from here up are sent to the LLM when enabled
+	softNotFoundTextChars = 1000
+)
+
+var (
+	notFoundTitlePattern = regexp.MustCompile(`(?i)(\b(product|item|page)s? not found\b|\bno longer available\b|\bno (products|results) found\b|\b0 results\b|\bsearch results\b)`)
+	notFoundTextPattern  = regexp.MustCompile(`(?i)((product|item|page|model)s? (you are looking for |you requested |you searched for )?(is |was )?(no longer available|could not be found|cannot be found|can't be found|was not found|not found|does not exist|has been removed)|no (products|results|items) (were )?found|(your search|search for) .{0,60} (did not match|returned no|returned 0)|sorry,? (but )?(we )?(couldn't|could not|can't|cannot) find)`)
+	discontinuedPattern  = regexp.MustCompile(`(?i)\b(has been |is |was )?discontinued\b`)
+	searchPagePattern    = regexp.MustCompile(`(?i)(search results|results for|did you mean|showing \d+ (of|-) \d+ results|refine your search)`)
+	modelNumberStrip     = strings.NewReplacer(" ", "", "-", "", "_", "", ".", "", "/", "")
+)
+
+// SoftNotFound explains why a page answering 200 was judged not to hold the product
+type SoftNotFound struct {
+	Score   float64  `json:"score"`
+	Signals []string `json:"signals"`
+	Method  string   `json:"method"` // "heuristic" or "llm"
+}
+
+// detectSoftNotFound scores a page's not-found signals. A page is only ever
+// flagged with an explicit message in its title or text; a missing model
+// number or product markup adds weight to one. It returns nil for pages
+// without any signal.
+func detectSoftNotFound(page *pageContent, structured *StructuredProduct, modelNumber string) *SoftNotFound {
+	text := page.text()
+	short := len(text) < shortPageChars*2
+
+	var signals []string
+	score := 0.0
+	add := func(signal string, weight float64) {
+		signals = append(signals, signal)
+		score += weight
+	}
+	if notFoundTitlePattern.MatchString(page.Title) {
+		add("not_found_title", 0.6)
+	}
+	if notFoundTextPattern.MatchString(leadingText(text, softNotFoundTextChars)) {
+		add("not_found_text", 0.5)
+	}
+	// Discontinued product pages usually still carry the product's data,
+	// so the word only counts on short pages without product markup
+	if short && structured == nil && (discontinuedPattern.MatchString(page.Title) || discontinuedPattern.MatchString(leadingText(text, softNotFoundTextChars))) {
+		add("discontinued_stub", 0.4)
+	}
+	if len(signals) == 0 {
+		return nil
+	}
+
+	if searchPagePattern.MatchString(page.Title) || searchPagePattern.MatchString(leadingText(text, softNotFoundTextChars)) {
+		add("search_page", 0.2)
+	}
+	if modelNumber != "" && !mentionsModel(page.Title+" "+text, modelNumber) {
+		add("model_number_absent", 0.3)
+	}
+	if structured == nil {
+		add("no_product_markup", 0.1)
+	} else if modelNumber != "" && mentionsModel(structured.Model+" "+structured.SKU+" "+structured.MPN, modelNumber) {
+		// The page declares this very product
+		add("product_markup_matches", -0.6)
+	}
+
+	return &SoftNotFound{Score: roundTo(math.Max(0, math.Min(1, score)), 3), Signals: signals, Method: "heuristic"}
+}
+
+// mentionsModel reports whether text contains the model number, ignoring
+// case, spaces and the separators sites format model numbers with
+func mentionsModel(text, modelNumber string) bool {
+	model := strings.ToLower(modelNumberStrip.Replace(modelNumber))
+	if model == "" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(modelNumberStrip.Replace(text)), model)
+}
+
+// leadingText returns at most n bytes from the start of text, where error
+// messages sit
+func leadingText(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	return truncateUTF8(text, n)
+}
+
+const notFoundClassifyPrompt = `
+		A product page was requested for model number {model}. Decide whether the
+		page below actually shows that product, or is a "not found" page, a search
+		results page, a discontinued-product stub or another page without it.
+
+		Title: {title}
+		Text (beginning):
+		{text}
+
+		Respond with a single JSON object: {"not_found": true or false}.
+		Return only the JSON object.
+	`
+
+// classifyNotFound asks the LLM whether a page with uncertain signals holds
+// the product. Only the title and the beginning of the text are sent.
+func (p *UnifiedParser) classifyNotFound(ctx context.Context, page *pageContent, modelNumber string) (bool, int, error) {
+	prompt := strings.NewReplacer(
+		"{model}", modelNumber,
+		"{title}", page.Title,
+		"{text}", leadingText(page.text(), softNotFoundTextChars),
+	).Replace(notFoundClassifyPrompt)
+
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: prompt,
+	}))
+	if err != nil {
+		return false, 0, fmt.Errorf("not-found classification request failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return false, resp.Usage.TotalTokens, fmt.Errorf("empty not-found classification response")
+	}
+	var answer struct {
+		NotFound bool `json:"not_found"`
+	}
+	if err := json.Unmarshal([]byte(stripCodeFence(resp.Choices[0].Message.Content)), &answer); err != nil {
+		return false, resp.Usage.TotalTokens, fmt.Errorf("invalid not-found classification response: %w", err)
+	}
+	return answer.NotFound, resp.Usage.TotalTokens, nil
+}
+
+// checkSoftNotFound returns the page's not-found verdict, or nil when the
+// page is taken to show the product. Uncertain pages are classified by the
+// LLM when the quality config enables it; the tokens it used are returned.
+func (p *UnifiedParser) checkSoftNotFound(ctx context.Context, page *pageContent, structured *StructuredProduct, modelNumber string) (*SoftNotFound, int) {
+	config := p.config.Quality
+	if config.Disabled || config.SoftNotFoundDisabled {
+		return nil, 0
+	}
+	verdict := detectSoftNotFound(page, structured, modelNumber)
+	if verdict == nil || verdict.Score < softNotFoundUncertain {
+		return nil, 0
+	}
+	if verdict.Score >= softNotFoundThreshold {
+		return verdict, 0
+	}
+	if !config.SoftNotFoundLLM {
+		return nil, 0
+	}
+
+	notFound, tokens, err := p.classifyNotFound(ctx, page, modelNumber)
+	if err != nil {
+		log.Printf("Not-found classification failed, keeping the page: %v", err)
+		return nil, tokens
+	}
+	if !notFound {
+		return nil, tokens
+	}
+	verdict.Method = "llm"
+	return verdict, tokens
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// SourceRankingConfig lists what makes a source authoritative
+type SourceRankingConfig struct {
+	ManufacturerDomains []string `json:"manufacturer_domains"` // Official vendor domains, subdomains included
+	PreferredPaths      []string `json:"preferred_paths"`      // Path keywords, defaults to support/manual pages
+	PenalizedDomains    []string `json:"penalized_domains"`    // Resellers and aggregators, defaults to common marketplaces
+}
+
+var (
+	defaultPreferredPaths   = []string{"support", "manual", "manuals", "download", "downloads", "docs", "documentation", "specs", "product"}
+	defaultPenalizedDomains = []string{"amazon.com", "ebay.com", "aliexpress.com", "walmart.com", "manualslib.com", "manualzz.com"}
+)
+
+// scoreSource rates how authoritative a URL is for a model number; higher is better
+func scoreSource(rawURL, modelNumber string, config SourceRankingConfig) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	host := strings.ToLower(u.Hostname())
+	path := strings.ToLower(u.Path)
+	score := 0
+
+	for _, domain := range config.ManufacturerDomains {
+		if hostMatches(host, strings.ToLower(domain)) {
+			score += 100
+			break
+		}
+	}
+
+	penalized := config.PenalizedDomains
+	if len(penalized) == 0 {
+		penalized = defaultPenalizedDomains
+	}
+	for _, domain := range penalized {
+		if hostMatches(host, strings.ToLower(domain)) {
+			score -= 50
+			break
+		}
+	}
+
+	preferred := config.PreferredPaths
+	if len(preferred) == 0 {
+		preferred = defaultPreferredPaths
+	}
+	for _, keyword := range preferred {
+		if strings.Contains(path, strings.ToLower(keyword)) || strings.HasPrefix(host, strings.ToLower(keyword)+".") {
+			score += 10
+		}
+	}
+
+	if modelNumber != "" && strings.Contains(stripSeparators(path), stripSeparators(strings.ToLower(modelNumber))) {
+		score += 15
+	}
+	if u.Scheme == "https" {
+		score++
+	}
+	return score
+}
+
+// rankSources assigns source_rank (1 = most authoritative) to jobs within each model number
+func rankSources(jobs []BatchJob, config SourceRankingConfig) {
+	byModel := make(map[string][]int)
+	for i := range jobs {
+		jobs[i].SourceScore = scoreSource(jobs[i].URL, jobs[i].ModelNumber, config)
+		byModel[jobs[i].ModelNumber] = append(byModel[jobs[i].ModelNumber], i)
+	}
+
+	for _, indexes := range byModel {
+		sort.SliceStable(indexes, func(a, b int) bool {
+			return jobs[indexes[a]].SourceScore > jobs[indexes[b]].SourceScore
+		})
+		for rank, i := range indexes {
+			jobs[i].SourceRank = rank + 1
+		}
+	}
+}
+
+// rankURLs returns the source rank for each URL of a single model
+func rankURLs(urls []string, modelNumber string, config SourceRankingConfig) map[string]int {
+	jobs := make([]BatchJob, len(urls))
+	for i, u := range urls {
+		jobs[i] = BatchJob{URL: u, ModelNumber: modelNumber}
+	}
+	rankSources(jobs, config)
+
+	ranks := make(map[string]int, len(urls))
+	for _, job := range jobs {
+		ranks[job.URL] = job.SourceRank
+	}
+	return ranks
+}
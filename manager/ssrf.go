@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SSRFPolicy controls which hosts and addresses the scraper may connect to
+type SSRFPolicy struct {
+	AllowPrivate bool     // Permit private, loopback and link-local addresses
+	AllowHosts   []string // If set, only these hosts (and their subdomains) are allowed
+	DenyHosts    []string // Hosts (and their subdomains) that are always rejected
+	DNSServer    string   // Optional "host:port" resolver used instead of the system one
+}
+
+// ssrfPolicy is configured once per deployment from the environment
+var ssrfPolicy = loadSSRFPolicy()
+
+// blockedNetworks lists ranges that must never be reached from user-supplied URLs
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// loadSSRFPolicy reads the policy from SCRAPER_* environment variables
+func loadSSRFPolicy() SSRFPolicy {
+	return SSRFPolicy{
+		AllowPrivate: os.Getenv("SCRAPER_ALLOW_PRIVATE") == "true",
+		AllowHosts:   splitList(os.Getenv("SCRAPER_ALLOW_HOSTS")),
+		DenyHosts:    splitList(os.Getenv("SCRAPER_DENY_HOSTS")),
+		DNSServer:    os.Getenv("SCRAPER_DNS_SERVER"),
+	}
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// hostMatches reports whether host equals pattern or is a subdomain of it
+func hostMatches(host, pattern string) bool {
+	pattern = strings.TrimPrefix(pattern, "*.")
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+// checkHost applies the allow and deny lists to a hostname
+func (p SSRFPolicy) checkHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, denied := range p.DenyHosts {
+		if hostMatches(host, denied) {
+			return fmt.Errorf("host %s is denied", host)
+		}
+	}
+	if len(p.AllowHosts) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowHosts {
+		if hostMatches(host, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s is not in the allow list", host)
+}
+
+// checkIP rejects addresses in blocked ranges unless private access is allowed
+func (p SSRFPolicy) checkIP(ip net.IP) error {
+	if p.AllowPrivate {
+		return nil
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("address %s is in blocked range %s", ip, network)
+		}
+	}
+	return nil
+}
+
+// resolver returns the DNS resolver configured for the policy
+func (p SSRFPolicy) resolver() *net.Resolver {
+	if p.DNSServer == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: time.Second * 5}
+			return d.DialContext(ctx, network, p.DNSServer)
+		},
+	}
+}
+
+// resolve looks up host and returns only addresses permitted by the policy
+func (p SSRFPolicy) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if err := p.checkHost(host); err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if err := p.checkIP(ip); err != nil {
+			return nil, err
+		}
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := p.resolver().LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		// Every record must be safe, otherwise DNS rebinding could pick the bad one later
+		if err := p.checkIP(addr.IP); err != nil {
+			return nil, fmt.Errorf("host %s resolves to a blocked address: %w", host, err)
+		}
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	return ips, nil
+}
+
+// validateURL checks the host of a user-supplied URL against the policy
+func (p SSRFPolicy) validateURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	_, err = p.resolve(ctx, u.Hostname())
+	return err
+}
+
+// dialContext resolves the target once and connects to the pinned, validated IP
+func (p SSRFPolicy) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := p.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: time.Second * 30, KeepAlive: time.Second * 30}
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// newScrapeClient returns an HTTP client for fetching user-supplied URLs.
+// Redirects are re-checked against the policy by the dialer on every hop.
+// Scraping goes through sharedScrapeClient; this builds a separate pool for
+// a policy other than the deployment's.
+func newScrapeClient(policy SSRFPolicy, timeout time.Duration) *http.Client {
+	return scrapeClientWith(newScrapeTransport(policy.dialContext), policy, timeout)
+}
+
+// scrapeClientWith returns a client on transport that checks every redirect against policy
+func scrapeClientWith(transport http.RoundTripper, policy SSRFPolicy, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return policy.checkHost(req.URL.Hostname())
+		},
+	}
+}
+
+// policyProxy is a forward proxy that dials every request through the
+// policy. Programs that fetch pages themselves, such as the headless browser
+// taking screenshots, are pointed at it so the page's redirects, subresources
+// and frames are held to the same policy as the scraper's own requests.
+type policyProxy struct {
+	policy    SSRFPolicy
+	transport http.RoundTripper
+}
+
+// startPolicyProxy serves a policyProxy on a loopback port until stop is called
+func startPolicyProxy(policy SSRFPolicy, transport http.RoundTripper) (addr string, stop func(), err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to start proxy: %w", err)
+	}
+	server := &http.Server{Handler: policyProxy{policy: policy, transport: transport}, ReadHeaderTimeout: time.Second * 10}
+	go server.Serve(listener)
+	return listener.Addr().String(), func() { server.Close() }, nil
+}
+
+func (p policyProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		http.Error(w, "only absolute http URLs are proxied", http.StatusBadRequest)
+		return
+	}
+	if err := p.policy.checkHost(r.URL.Hostname()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel relays a CONNECT request, dialing the target through the policy
+func (p policyProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.policy.dialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Stage limit used when neither the stage nor max_concurrent sets one
+const defaultStageConcurrency = 4
+
+// StageConcurrency limits each parser stage separately. Page fetches, image
+// downloads, document downloads and LLM calls load different resources, so
+// one shared limit is either too low for cheap stages or too high for the
+// LLM's rate limit. Unset stages fall back to max_concurrent.
+type StageConcurrency struct {
+	Scrape    int `json:"scrape"`    // Concurrent page fetches, listing pages included
+	Images    int `json:"images"`    // Concurrent image downloads
+	Documents int `json:"documents"` // Concurrent document size checks and downloads
+	LLM       int `json:"llm"`       // Concurrent chunk requests to the LLM provider
+}
+
+func (c StageConcurrency) validate() error {
+	for stage, limit := range map[string]int{"scrape": c.Scrape, "images": c.Images, "documents": c.Documents, "llm": c.LLM} {
+		if limit < 0 {
+			return fmt.Errorf("concurrency for stage %s must not be negative", stage)
+		}
+	}
+	return nil
+}
+
+// stageLimit returns a stage's limit, falling back to the shared max_concurrent
+func stageLimit(stage, shared int) int {
+	if stage > 0 {
+		return stage
+	}
+	if shared > 0 {
+		return shared
+	}
+	return defaultStageConcurrency
+}
+
+// stageLimits are the semaphores of a parser's stages
+type stageLimits struct {
+	scrape    *semaphore.Weighted
+	images    *semaphore.Weighted
+	documents *semaphore.Weighted
+}
+
+func newStageLimits(c StageConcurrency, shared int) stageLimits {
+	return stageLimits{
+		scrape:    semaphore.NewWeighted(int64(stageLimit(c.Scrape, shared))),
+		images:    semaphore.NewWeighted(int64(stageLimit(c.Images, shared))),
+		documents: semaphore.NewWeighted(int64(stageLimit(c.Documents, shared))),
+	}
+}
+
+// acquireStage takes a slot of sem and returns the function releasing it. A
+// nil semaphore, as in parsers built without NewUnifiedParser, never blocks.
+func acquireStage(ctx context.Context, sem *semaphore.Weighted, stage string) (func(), error) {
+	if sem == nil {
+		return func() {}, nil
+	}
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, fmt.Errorf("interrupted while waiting for a %s slot: %w", stage, err)
+	}
+	return func() { sem.Release(1) }, nil
+}
+
+// scrape fetches a page within the scrape stage's limit
+func (p *UnifiedParser) scrape(ctx context.Context, pageURL string) (*pageContent, error) {
+	release, err := acquireStage(ctx, p.stages.scrape, "scrape")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return p.siteScraper.scrapeWebsite(ctx, pageURL)
+}
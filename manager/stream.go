@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"manager/pool"
+)
+
+// rowStream is the unread part of a streamed upload
+type rowStream struct {
+	reader  rowReader
+	builder *rowBuilder
+	abTest  ABTestConfig
+	sampler *rowSampler // nil when every row is processed
+	close   func()      // Removes the spooled upload
+}
+
+// uploadsDir holds streamed uploads until their rows have been read
+func uploadsDir() string {
+	return filepath.Join(dataDir, "uploads")
+}
+
+// spoolUpload copies an uploaded CSV to disk so its rows can be read after
+// the request has ended. The copy is positioned at its start.
+func spoolUpload(file io.Reader) (*os.File, error) {
+	if err := os.MkdirAll(uploadsDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create uploads directory: %v", err)
+	}
+	spool, err := os.CreateTemp(uploadsDir(), "upload_*.csv")
+	if err != nil {
+		return nil, fmt.Errorf("failed to spool upload: %v", err)
+	}
+	if _, err := io.Copy(spool, file); err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("failed to spool upload: %v", err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, fmt.Errorf("failed to spool upload: %v", err)
+	}
+	return spool, nil
+}
+
+// runStream reads the upload's rows and hands their jobs to the workers as
+// they free up. The channel holds one job per worker, so reading stops while
+// every worker is busy and only the jobs in flight are queued in memory.
+// admitted is called for each job before it is queued.
+func (bp *BatchProcess) runStream(ctx context.Context, workers int, limiter *adaptiveLimiter, admitted func(BatchJob), onDone func(BatchJob)) {
+	stream := bp.stream
+	defer stream.close()
+
+	jobs := make(chan BatchJob, workers)
+	go func() {
+		defer close(jobs)
+		accepted := 0
+		for ctx.Err() == nil {
+			record, err := stream.reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Printf("Batch %s: stopped reading upload: %v", bp.ID, err)
+				break
+			}
+
+			rowReport := &ValidationReport{}
+			job, ok := stream.builder.build(ctx, record, rowReport)
+			var batch, skipped []BatchJob
+			if ok && !stream.sampler.take() {
+				job.Status = statusSkippedBySampling
+				skipped = append(skipped, job)
+			} else if ok {
+				for _, variant := range stream.abTest.variantsFor(accepted) {
+					j := job
+					j.PromptVariant = variant.Name
+					j.promptTemplate = variant.Template
+					batch = append(batch, j)
+				}
+				if len(batch) == 0 {
+					batch = append(batch, job)
+				}
+				accepted++
+			}
+
+			bp.mu.Lock()
+			bp.Validation.merge(rowReport)
+			for i := range batch {
+				batch[i].Index = len(bp.Jobs)
+				bp.Jobs = append(bp.Jobs, batch[i])
+			}
+			for _, j := range skipped {
+				j.Index = len(bp.Jobs)
+				bp.Jobs = append(bp.Jobs, j)
+				bp.Validation.SkippedBySampling++
+			}
+			bp.mu.Unlock()
+
+			for _, j := range batch {
+				admitted(j)
+				select {
+				case jobs <- j:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	pool.Stream(ctx, workers, jobs, bp.jobFunc(limiter), bp.resultFunc(onDone))
+
+	bp.mu.Lock()
+	bp.Streaming = false
+	bp.stream = nil
+	report := *bp.Validation
+	bp.mu.Unlock()
+	log.Printf("Batch %s: read %d rows from the upload, %d accepted", bp.ID, report.Rows, report.Accepted)
+}
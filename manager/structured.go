@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Structured data sources, in order of precedence
+const (
+	sourceJSONLD    = "json-ld"
+	sourceMicrodata = "microdata"
+	sourceOpenGraph = "opengraph"
+)
+
+// StructuredProduct is the schema.org Product (and its Offer) a page declares
+type StructuredProduct struct {
+	Name         string `json:"name,omitempty"`
+	Brand        string `json:"brand,omitempty"`
+	Model        string `json:"model,omitempty"`
+	SKU          string `json:"sku,omitempty"`
+	MPN          string `json:"mpn,omitempty"`
+	GTIN         string `json:"gtin,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Image        string `json:"image,omitempty"`
+	Price        string `json:"price,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	Availability string `json:"availability,omitempty"`
+
+	// Where each value came from, keyed by JSON field name
+	Sources map[string]string `json:"sources"`
+}
+
+// set fills a field unless a source with higher precedence already did
+func (s *StructuredProduct) set(field *string, name, value, source string) {
+	value = strings.TrimSpace(value)
+	if *field != "" || value == "" {
+		return
+	}
+	*field = value
+	s.Sources[name] = source
+}
+
+// extractStructuredProduct reads the page's JSON-LD, microdata and OpenGraph
+// product data, preferring them in that order. It returns nil when the page
+// declares no product.
+func extractStructuredProduct(page *pageContent) *StructuredProduct {
+	s := &StructuredProduct{Sources: make(map[string]string)}
+
+	for _, block := range page.JSONLD {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(block), &doc); err != nil {
+			continue
+		}
+		if product := findJSONLDProduct(doc); product != nil {
+			s.fromJSONLD(product)
+			break
+		}
+	}
+
+	if page.ProductMicrodata {
+		m := page.Microdata
+		s.set(&s.Name, "name", m["name"], sourceMicrodata)
+		s.set(&s.Brand, "brand", m["brand"], sourceMicrodata)
+		s.set(&s.Model, "model", m["model"], sourceMicrodata)
+		s.set(&s.SKU, "sku", m["sku"], sourceMicrodata)
+		s.set(&s.MPN, "mpn", m["mpn"], sourceMicrodata)
+		s.set(&s.GTIN, "gtin", firstNonEmpty(m["gtin13"], m["gtin12"], m["gtin14"], m["gtin8"], m["gtin"]), sourceMicrodata)
+		s.set(&s.Description, "description", m["description"], sourceMicrodata)
+		s.set(&s.Image, "image", m["image"], sourceMicrodata)
+		s.set(&s.Price, "price", firstNonEmpty(m["price"], m["lowPrice"]), sourceMicrodata)
+		s.set(&s.Currency, "currency", m["priceCurrency"], sourceMicrodata)
+		s.set(&s.Availability, "availability", schemaEnum(m["availability"]), sourceMicrodata)
+	}
+
+	// OpenGraph describes any page, so it only counts on product pages
+	meta := page.Meta
+	if strings.EqualFold(meta["og:type"], "product") || len(s.Sources) > 0 || meta["product:price:amount"] != "" {
+		s.set(&s.Name, "name", meta["og:title"], sourceOpenGraph)
+		s.set(&s.Brand, "brand", meta["product:brand"], sourceOpenGraph)
+		s.set(&s.SKU, "sku", meta["product:retailer_item_id"], sourceOpenGraph)
+		s.set(&s.Description, "description", meta["og:description"], sourceOpenGraph)
+		s.set(&s.Image, "image", meta["og:image"], sourceOpenGraph)
+		s.set(&s.Price, "price", meta["product:price:amount"], sourceOpenGraph)
+		s.set(&s.Currency, "currency", meta["product:price:currency"], sourceOpenGraph)
+		s.set(&s.Availability, "availability", meta["product:availability"], sourceOpenGraph)
+	}
+
+	if len(s.Sources) == 0 {
+		return nil
+	}
+	return s
+}
+
+// findJSONLDProduct returns the first Product object in a JSON-LD document,
+// looking inside lists, @graph and mainEntity
+func findJSONLDProduct(doc interface{}) map[string]interface{} {
+	switch v := doc.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if product := findJSONLDProduct(item); product != nil {
+				return product
+			}
+		}
+	case map[string]interface{}:
+		for _, t := range listText(v["@type"]) {
+			if strings.EqualFold(schemaEnum(t), "Product") || strings.EqualFold(schemaEnum(t), "ProductModel") {
+				return v
+			}
+		}
+		for _, key := range []string{"@graph", "mainEntity", "itemListElement", "item"} {
+			if product := findJSONLDProduct(v[key]); product != nil {
+				return product
+			}
+		}
+	}
+	return nil
+}
+
+func (s *StructuredProduct) fromJSONLD(product map[string]interface{}) {
+	s.set(&s.Name, "name", scalarText(product["name"]), sourceJSONLD)
+	s.set(&s.Brand, "brand", firstNonEmpty(listText(product["brand"])...), sourceJSONLD)
+	s.set(&s.Model, "model", firstNonEmpty(listText(product["model"])...), sourceJSONLD)
+	s.set(&s.SKU, "sku", scalarText(product["sku"]), sourceJSONLD)
+	s.set(&s.MPN, "mpn", scalarText(product["mpn"]), sourceJSONLD)
+	s.set(&s.GTIN, "gtin", firstNonEmpty(scalarText(product["gtin13"]), scalarText(product["gtin12"]),
+		scalarText(product["gtin14"]), scalarText(product["gtin8"]), scalarText(product["gtin"])), sourceJSONLD)
+	s.set(&s.Description, "description", scalarText(product["description"]), sourceJSONLD)
+	s.set(&s.Image, "image", firstNonEmpty(listText(product["image"])...), sourceJSONLD)
+
+	// offers may be one Offer, a list of them or an AggregateOffer
+	var offer map[string]interface{}
+	switch offers := product["offers"].(type) {
+	case map[string]interface{}:
+		offer = offers
+	case []interface{}:
+		if len(offers) > 0 {
+			offer, _ = offers[0].(map[string]interface{})
+		}
+	}
+	if offer != nil {
+		s.set(&s.Price, "price", firstNonEmpty(scalarText(offer["price"]), scalarText(offer["lowPrice"])), sourceJSONLD)
+		s.set(&s.Currency, "currency", scalarText(offer["priceCurrency"]), sourceJSONLD)
+		s.set(&s.Availability, "availability", schemaEnum(scalarText(offer["availability"])), sourceJSONLD)
+	}
+}
+
+// schemaEnum strips the schema.org prefix from values such as
+// "https://schema.org/InStock"
+func schemaEnum(value string) string {
+	if i := strings.LastIndex(value, "/"); i != -1 && strings.Contains(value, "schema.org") {
+		return value[i+1:]
+	}
+	return value
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// fields maps the product onto extraction field names. model_number prefers
+// the declared model over the manufacturer part number.
+func (s *StructuredProduct) fields() map[string]string {
+	if s == nil {
+		return nil
+	}
+	fields := map[string]string{
+		"name":         s.Name,
+		"brand":        s.Brand,
+		"model_number": firstNonEmpty(s.Model, s.MPN),
+		"sku":          s.SKU,
+		"mpn":          s.MPN,
+		"gtin":         s.GTIN,
+		"description":  s.Description,
+		"image":        s.Image,
+		"price":        s.Price,
+		"currency":     s.Currency,
+		"availability": s.Availability,
+	}
+	for name, value := range fields {
+		if value == "" {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
+
+// fieldSource returns where the value of an extraction field came from
+func (s *StructuredProduct) fieldSource(field string) string {
+	if field == "model_number" {
+		if s.Model != "" {
+			return s.Sources["model"]
+		}
+		return s.Sources["mpn"]
+	}
+	return s.Sources[field]
+}
+
+// withoutFields returns the schema fields structured data did not provide,
+// the only ones left for the LLM
+func (schema OutputSchema) withoutFields(known map[string]string) OutputSchema {
+	var rest OutputSchema
+	for _, field := range schema {
+		if _, ok := known[field.Name]; !ok {
+			rest = append(rest, field)
+		}
+	}
+	return rest
+}
+
+// applyStructured puts structured values over the LLM result, which only
+// fills the fields structured data left empty, and records their provenance
+func applyStructured(result interface{}, s *StructuredProduct, schema OutputSchema, pageURL string, provenance map[string]FieldProvenance) (interface{}, map[string]FieldProvenance) {
+	known := s.fields()
+	if len(known) == 0 {
+		return result, provenance
+	}
+	merged, ok := result.(map[string]interface{})
+	if !ok && result != nil {
+		return result, provenance // Free-text answers are left as they are
+	}
+	if merged == nil {
+		merged = make(map[string]interface{})
+	}
+
+	// Without a schema, only the product fields the prompt asks for are set
+	allowed := map[string]bool{"name": true, "model_number": true}
+	if len(schema) > 0 {
+		allowed = make(map[string]bool, len(schema))
+		for _, field := range schema {
+			allowed[field.Name] = true
+		}
+	}
+
+	if provenance == nil {
+		provenance = make(map[string]FieldProvenance)
+	}
+	for field, value := range known {
+		if !allowed[field] {
+			continue
+		}
+		merged[field] = value
+		provenance[field] = FieldProvenance{URL: pageURL, ChunkIndex: -1, Source: s.fieldSource(field), Excerpt: value}
+	}
+	return merged, provenance
+}
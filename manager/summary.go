@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Job error codes used in batch summaries
+const (
+	errCodeTimeout     = "timeout"
+	errCodeNetwork     = "network"
+	errCodeParse       = "parse_error"
+	errCodeProcessing  = "processing_failed"
+	errCodeIO          = "io_error"
+	errCodeInternal    = "internal"
+	errCodeDiscovery   = "discovery_failed"
+	errCodeHook        = "hook_failed"
+	errCodeBudget      = "budget_exhausted"
+	errCodeLowQuality  = "low_quality"
+	errCodeQuarantined = "quarantined"
+	errCodeNotFound    = "not_found"
+	errCodeScan        = "scan_failed"
+	errCodeCancelled   = "cancelled"
+	errCodeUnknown     = "unknown"
+)
+
+// topFailingDomainsLimit caps the number of domains listed in a summary
+const topFailingDomainsLimit = 5
+
+// jobError tags a processing error with a code for summary statistics
+type jobError struct {
+	code string
+	err  error
+}
+
+func (e *jobError) Error() string { return e.err.Error() }
+func (e *jobError) Unwrap() error { return e.err }
+
+// newJobError formats an error and tags it with code
+func newJobError(code string, format string, args ...interface{}) error {
+	return &jobError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// errorCode returns the code attached to err, or errCodeUnknown
+func errorCode(err error) string {
+	var je *jobError
+	if errors.As(err, &je) {
+		return je.code
+	}
+	return errCodeUnknown
+}
+
+// networkErrorCode distinguishes timeouts from other transport failures
+func networkErrorCode(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errCodeTimeout
+	}
+	return errCodeNetwork
+}
+
+// DomainFailures counts failed jobs for a single domain
+type DomainFailures struct {
+	Domain   string `json:"domain"`
+	Failures int    `json:"failures"`
+}
+
+// BatchSummary holds the statistics attached to a finished batch
+type BatchSummary struct {
+	Total                int              `json:"total"`
+	Succeeded            int              `json:"succeeded"`
+	Failed               int              `json:"failed"`
+	LowQuality           int              `json:"low_quality"`  // Error pages, login walls and empty pages
+	NotModified          int              `json:"not_modified"` // Unchanged pages whose prior result was reused
+	NotFound             int              `json:"not_found"`    // Pages answering 200 that say the product does not exist
+	SkippedBySampling    int              `json:"skipped_by_sampling,omitempty"`
+	FailuresByCode       map[string]int   `json:"failures_by_code"`
+	AverageJobDurationMs int64            `json:"average_job_duration_ms"`
+	TotalTokens          int              `json:"total_tokens"`
+	TotalCost            float64          `json:"total_cost"`
+	BytesDownloaded      int64            `json:"bytes_downloaded"`
+	TopFailingDomains    []DomainFailures `json:"top_failing_domains"`
+}
+
+// summarizeJobs computes batch statistics from the final job states
+func summarizeJobs(jobs []BatchJob) BatchSummary {
+	summary := BatchSummary{
+		Total:             len(jobs),
+		FailuresByCode:    make(map[string]int),
+		TopFailingDomains: []DomainFailures{},
+	}
+	failuresByDomain := make(map[string]int)
+	var totalDuration time.Duration
+	timed := 0
+
+	for _, job := range jobs {
+		switch job.Status {
+		case "completed":
+			summary.Succeeded++
+		case "low_quality":
+			summary.LowQuality++
+		case "not_modified":
+			summary.NotModified++
+		case statusNotFound:
+			summary.NotFound++
+		case statusSkippedBySampling:
+			summary.SkippedBySampling++
+		case "failed", "timed_out":
+			summary.Failed++
+			code := job.ErrorCode
+			if code == "" {
+				code = errCodeUnknown
+			}
+			summary.FailuresByCode[code]++
+			failuresByDomain[jobDomain(job.URL)]++
+		}
+		if job.DurationMs > 0 {
+			totalDuration += time.Duration(job.DurationMs) * time.Millisecond
+			timed++
+		}
+		summary.TotalTokens += job.TokensUsed
+		summary.TotalCost += job.Cost
+		summary.BytesDownloaded += job.BytesDownloaded
+	}
+
+	if timed > 0 {
+		summary.AverageJobDurationMs = (totalDuration / time.Duration(timed)).Milliseconds()
+	}
+
+	for domain, failures := range failuresByDomain {
+		summary.TopFailingDomains = append(summary.TopFailingDomains, DomainFailures{Domain: domain, Failures: failures})
+	}
+	sort.Slice(summary.TopFailingDomains, func(i, j int) bool {
+		a, b := summary.TopFailingDomains[i], summary.TopFailingDomains[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.Domain < b.Domain
+	})
+	if len(summary.TopFailingDomains) > topFailingDomainsLimit {
+		summary.TopFailingDomains = summary.TopFailingDomains[:topFailingDomainsLimit]
+	}
+	return summary
+}
+
+// jobDomain returns the host of a job URL, or the raw URL if it cannot be parsed
+func jobDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Hostname()
+}
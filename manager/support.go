@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxSupportEntries caps each list of a SupportInfo block
+const maxSupportEntries = 10
+
+// SupportInfo is the after-sales contact information a page publishes. It is
+// the manufacturer's or retailer's own, so redaction does not apply to it.
+type SupportInfo struct {
+	Phones []SupportPhone `json:"phones,omitempty"`
+	Emails []string       `json:"emails,omitempty"`
+	// Pages for filing a warranty claim or requesting a repair or return
+	WarrantyClaimURLs []string `json:"warranty_claim_urls,omitempty"`
+	// Service center, repair partner and dealer locators
+	ServiceLocatorURLs []string `json:"service_locator_urls,omitempty"`
+}
+
+// SupportPhone is a support phone number with the label it was found under
+type SupportPhone struct {
+	Number string `json:"number"` // Digits, with a leading + for international numbers
+	Raw    string `json:"raw"`
+	Label  string `json:"label,omitempty"` // e.g. "hotline" or a JSON-LD contactType
+}
+
+var (
+	// Phone numbers in text; only taken near a support keyword
+	supportPhonePattern = regexp.MustCompile(`(?:\+|\b)\d[\d\s().\-/]{5,20}\d\b`)
+	// Words that mark a number as a support line, checked in the text just before it
+	supportPhoneKeywords = regexp.MustCompile(`(?i)(hotline|helpline|help line|customer (care|service|support)|technical support|tech support|support|service|toll[ -]free|phone|telephone|tel\.?|call|kundendienst|servicetelefon|telefon|téléphone|assistance)`)
+	supportEmailPattern  = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+	// Looks like a date or a time, not a phone number
+	notPhonePattern = regexp.MustCompile(`^\d{1,4}[./-]\d{1,2}[./-]\d{1,4}$|^\d{1,2}:\d{2}`)
+
+	warrantyClaimPattern  = regexp.MustCompile(`(?i)(warranty[ _-]?claims?|claim[ _-]?(a[ _-]|your[ _-])?warranty|file[ _-]a[ _-]claim|\brma\b|return[ _-]authori[sz]ation|repair[ _-]request|request[ _-]a[ _-]repair|garantieantrag|garantie[ _-]?(anmelden|fall)|demande[ _-]de[ _-]garantie)`)
+	serviceLocatorPattern = regexp.MustCompile(`(?i)(service[ _-]?(center|centre|partner|locator|point|location)s?|repair[ _-]?(center|centre|shop|partner)s?|authori[sz]ed[ _-](service|repair)|find[ _-]a[ _-](service|repair|dealer)|dealer[ _-]?locator|where[ _-]to[ _-](repair|buy)|servicepartner|kundendienst[ _-]?suche|point[ _-]de[ _-]service)`)
+)
+
+// ignoredEmailDomains are placeholder domains and image names such as
+// "logo@2x.png" that the email pattern matches
+var ignoredEmailDomains = []string{"example.com", "example.org", "domain.com", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+
+// extractSupportInfo collects support phone numbers, emails, warranty-claim
+// pages and service-center locators from a page's links, text and JSON-LD
+// ContactPoints. It returns nil when the page has none.
+func extractSupportInfo(pageURL string, page *pageContent) *SupportInfo {
+	info := &SupportInfo{}
+	phones := make(map[string]bool)
+	emails := make(map[string]bool)
+	addPhone := func(raw, label string) {
+		number := normalizePhone(raw)
+		if number == "" || phones[number] || len(info.Phones) >= maxSupportEntries {
+			return
+		}
+		phones[number] = true
+		info.Phones = append(info.Phones, SupportPhone{Number: number, Raw: strings.TrimSpace(raw), Label: label})
+	}
+	addEmail := func(email string) {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" || emails[email] || len(info.Emails) >= maxSupportEntries || hasSuffix(email, ignoredEmailDomains) {
+			return
+		}
+		emails[email] = true
+		info.Emails = append(info.Emails, email)
+	}
+
+	for _, point := range jsonLDContactPoints(page.JSONLD) {
+		addPhone(point.telephone, point.contactType)
+		addEmail(strings.TrimPrefix(point.email, "mailto:"))
+	}
+
+	base, _ := url.Parse(pageURL)
+	claims := make(map[string]bool)
+	locators := make(map[string]bool)
+	for _, anchor := range page.Links {
+		href := strings.TrimSpace(anchor.Href)
+		lower := strings.ToLower(href)
+		switch {
+		case strings.HasPrefix(lower, "tel:"):
+			label := ""
+			if normalizePhone(anchor.Text) == "" {
+				label = anchor.Text
+			}
+			addPhone(strings.TrimPrefix(href[len("tel:"):], "//"), label)
+			continue
+		case strings.HasPrefix(lower, "mailto:"):
+			address, _, _ := strings.Cut(href[len("mailto:"):], "?")
+			if unescaped, err := url.PathUnescape(address); err == nil {
+				address = unescaped
+			}
+			for _, email := range strings.Split(address, ",") {
+				addEmail(email)
+			}
+			continue
+		}
+		if base == nil {
+			continue
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		resolved := base.ResolveReference(ref)
+		resolved.Fragment = ""
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			continue
+		}
+		target := resolved.String()
+		described := anchor.Text + " " + resolved.Path
+		switch {
+		case warrantyClaimPattern.MatchString(described):
+			if !claims[target] && len(info.WarrantyClaimURLs) < maxSupportEntries {
+				claims[target] = true
+				info.WarrantyClaimURLs = append(info.WarrantyClaimURLs, target)
+			}
+		case serviceLocatorPattern.MatchString(described):
+			if !locators[target] && len(info.ServiceLocatorURLs) < maxSupportEntries {
+				locators[target] = true
+				info.ServiceLocatorURLs = append(info.ServiceLocatorURLs, target)
+			}
+		}
+	}
+
+	// Numbers and addresses written out in the text. Labels often sit in
+	// their own text node, so each node is read with the one before it.
+	for i, text := range page.Texts {
+		for _, email := range supportEmailPattern.FindAllString(text, -1) {
+			addEmail(email)
+		}
+		window := text
+		if i > 0 {
+			window = page.Texts[i-1] + " " + text
+		}
+		offset := len(window) - len(text)
+		for _, loc := range supportPhonePattern.FindAllStringIndex(text, -1) {
+			before := window[max(0, offset+loc[0]-60) : offset+loc[0]]
+			if keywords := supportPhoneKeywords.FindAllString(before, -1); len(keywords) > 0 {
+				addPhone(text[loc[0]:loc[1]], strings.ToLower(keywords[len(keywords)-1]))
+			}
+		}
+	}
+
+	if len(info.Phones) == 0 && len(info.Emails) == 0 && len(info.WarrantyClaimURLs) == 0 && len(info.ServiceLocatorURLs) == 0 {
+		return nil
+	}
+	return info
+}
+
+// normalizePhone reduces a phone number to its digits, keeping a leading +
+// or turning a leading 00 into one. It returns "" for text that is not a
+// plausible phone number.
+func normalizePhone(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if notPhonePattern.MatchString(raw) {
+		return ""
+	}
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && digits.Len() == 0:
+		case strings.ContainsRune(" ().-/\u00a0", r):
+		default:
+			return ""
+		}
+	}
+	number := digits.String()
+	if len(number) < 7 || len(number) > 15 {
+		return ""
+	}
+	if strings.HasPrefix(raw, "+") {
+		return "+" + number
+	}
+	if strings.HasPrefix(number, "00") {
+		return "+" + number[2:]
+	}
+	return number
+}
+
+// contactPoint is the part of a schema.org ContactPoint the extractor reads
+type contactPoint struct {
+	telephone, email, contactType string
+}
+
+// jsonLDContactPoints returns the ContactPoints of the organizations in the
+// page's JSON-LD, and the organizations' own telephone and email
+func jsonLDContactPoints(blocks []string) []contactPoint {
+	var points []contactPoint
+	for _, block := range blocks {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(block), &doc); err != nil {
+			continue
+		}
+		for _, schemaType := range []string{"Organization", "Corporation", "LocalBusiness"} {
+			org := findJSONLDType(doc, schemaType)
+			if org == nil {
+				continue
+			}
+			points = append(points, contactPoint{scalarText(org["telephone"]), scalarText(org["email"]), ""})
+			var raw []interface{}
+			switch v := org["contactPoint"].(type) {
+			case []interface{}:
+				raw = v
+			case map[string]interface{}:
+				raw = []interface{}{v}
+			}
+			for _, item := range raw {
+				if point, ok := item.(map[string]interface{}); ok {
+					points = append(points, contactPoint{scalarText(point["telephone"]), scalarText(point["email"]), scalarText(point["contactType"])})
+				}
+			}
+			break
+		}
+	}
+	return points
+}
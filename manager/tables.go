@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Limits that tell spec and data tables from tables used for page layout,
+// whose structure is dropped while their text is kept
+const (
+	maxPageTables     = 50
+	maxTableRows      = 500
+	maxTableColumns   = 30
+	maxTableCellChars = 300
+)
+
+// PageTable is an HTML table reduced to its text. Two-column tables, the
+// usual layout of spec sheets, become key/value pairs; others keep their
+// header row and data rows.
+type PageTable struct {
+	Caption string      `json:"caption,omitempty"`
+	Headers []string    `json:"headers,omitempty"`
+	Rows    [][]string  `json:"rows,omitempty"`
+	Pairs   []TablePair `json:"pairs,omitempty"`
+
+	// Range of the page's text nodes the table's cells are, so the LLM can
+	// be sent the serialized table in their place
+	textStart, textEnd int
+}
+
+// TablePair is one row of a key/value table
+type TablePair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ContentAnalysis holds what the parser derived from a page's markup
+type ContentAnalysis struct {
+	Tables []PageTable `json:"tables,omitempty"`
+}
+
+// tableRow is a row of cells with whether each one was a <th>
+type tableRow struct {
+	cells  []string
+	header []bool
+}
+
+// tableBuilder collects one <table> while the page is streamed
+type tableBuilder struct {
+	caption   strings.Builder
+	inCaption bool
+	rows      []tableRow
+	row       *tableRow
+	cell      *strings.Builder
+	cellTH    bool
+	layout    bool // Exceeded a limit; only the text is kept
+	textStart int
+}
+
+// tableStack tracks the tables open at the current position. Text belongs to
+// the innermost one.
+type tableStack struct {
+	open []*tableBuilder
+}
+
+// tag handles table markup; texts is the number of text nodes kept so far
+func (s *tableStack) tag(token html.Token, page *pageContent, texts int) {
+	start := token.Type != html.EndTagToken
+	if token.DataAtom == atom.Table {
+		if start && token.Type == html.StartTagToken {
+			// A table holding another one is laid out with it, not data
+			if len(s.open) > 0 {
+				s.open[len(s.open)-1].layout = true
+			}
+			s.open = append(s.open, &tableBuilder{textStart: texts})
+		} else if !start && len(s.open) > 0 {
+			b := s.open[len(s.open)-1]
+			s.open = s.open[:len(s.open)-1]
+			b.endRow()
+			if table, ok := b.build(); ok && len(page.Tables) < maxPageTables && !page.Truncated {
+				table.textStart, table.textEnd = b.textStart, texts
+				page.Tables = append(page.Tables, table)
+			}
+		}
+		return
+	}
+	if len(s.open) == 0 {
+		return
+	}
+	b := s.open[len(s.open)-1]
+	switch token.DataAtom {
+	case atom.Caption:
+		b.inCaption = start
+	case atom.Tr:
+		b.endRow()
+		if start {
+			b.row = &tableRow{}
+		}
+	case atom.Td, atom.Th:
+		b.endCell()
+		if start && token.Type == html.StartTagToken {
+			if b.row == nil {
+				b.row = &tableRow{} // Cells without a <tr>, which browsers accept
+			}
+			b.cell = &strings.Builder{}
+			b.cellTH = token.DataAtom == atom.Th
+		}
+	}
+}
+
+// text adds a text node to the innermost open table
+func (s *tableStack) text(text string) {
+	if len(s.open) == 0 {
+		return
+	}
+	b := s.open[len(s.open)-1]
+	switch {
+	case b.inCaption:
+		if b.caption.Len() > 0 {
+			b.caption.WriteString(" ")
+		}
+		b.caption.WriteString(text)
+	case b.cell != nil && !b.layout:
+		if b.cell.Len() > 0 {
+			b.cell.WriteString(" ")
+		}
+		b.cell.WriteString(text)
+		if b.cell.Len() > maxTableCellChars {
+			b.layout = true
+		}
+	}
+}
+
+func (b *tableBuilder) endCell() {
+	if b.cell == nil || b.row == nil {
+		b.cell = nil
+		return
+	}
+	b.row.cells = append(b.row.cells, strings.TrimSpace(b.cell.String()))
+	b.row.header = append(b.row.header, b.cellTH)
+	b.cell = nil
+	if len(b.row.cells) > maxTableColumns {
+		b.layout = true
+	}
+}
+
+func (b *tableBuilder) endRow() {
+	b.endCell()
+	if b.row == nil {
+		return
+	}
+	if len(b.row.cells) > 0 && !allEmpty(b.row.cells) {
+		b.rows = append(b.rows, *b.row)
+	}
+	b.row = nil
+	if len(b.rows) > maxTableRows {
+		b.layout = true
+	}
+}
+
+// build turns the collected rows into a table. Layout tables and tables
+// without a row of at least two cells are dropped.
+func (b *tableBuilder) build() (PageTable, bool) {
+	if b.layout || len(b.rows) == 0 {
+		return PageTable{}, false
+	}
+	table := PageTable{Caption: strings.TrimSpace(b.caption.String())}
+	rows := b.rows
+	if len(rows) > 1 && allTrue(rows[0].header) {
+		table.Headers = rows[0].cells
+		rows = rows[1:]
+	}
+
+	pairs := len(table.Headers) <= 2
+	wide := false
+	for _, row := range rows {
+		if len(row.cells) != 2 {
+			pairs = false
+		}
+		if len(row.cells) >= 2 {
+			wide = true
+		}
+	}
+	if !wide {
+		return PageTable{}, false
+	}
+	if pairs {
+		for _, row := range rows {
+			table.Pairs = append(table.Pairs, TablePair{Key: strings.TrimSuffix(row.cells[0], ":"), Value: row.cells[1]})
+		}
+		return table, true
+	}
+	for _, row := range rows {
+		table.Rows = append(table.Rows, row.cells)
+	}
+	return table, true
+}
+
+// serialize writes the table compactly for the LLM: "key: value" lines for
+// pairs, " | "-separated cells otherwise
+func (t PageTable) serialize() string {
+	var b strings.Builder
+	b.WriteString("[Table")
+	if t.Caption != "" {
+		b.WriteString(": ")
+		b.WriteString(t.Caption)
+	}
+	b.WriteString("]\n")
+	if len(t.Pairs) > 0 {
+		for _, pair := range t.Pairs {
+			fmt.Fprintf(&b, "%s: %s\n", pair.Key, pair.Value)
+		}
+		return b.String()
+	}
+	if len(t.Headers) > 0 {
+		b.WriteString(strings.Join(t.Headers, " | "))
+		b.WriteString("\n")
+	}
+	for _, row := range t.Rows {
+		b.WriteString(strings.Join(row, " | "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// llmTexts returns the page's text nodes with each table's cells replaced by
+// the serialized table, which keeps rows and columns together for the LLM
+func (c *pageContent) llmTexts() []string {
+	if len(c.Tables) == 0 {
+		return c.Texts
+	}
+	tables := append([]PageTable(nil), c.Tables...)
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].textStart < tables[j].textStart })
+
+	texts := make([]string, 0, len(c.Texts))
+	next := 0
+	for _, table := range tables {
+		if table.textStart < next || table.textEnd > len(c.Texts) {
+			continue
+		}
+		texts = append(texts, c.Texts[next:table.textStart]...)
+		texts = append(texts, table.serialize())
+		next = table.textEnd
+	}
+	return append(texts, c.Texts[next:]...)
+}
+
+func allEmpty(values []string) bool {
+	for _, v := range values {
+		if v != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func allTrue(values []bool) bool {
+	for _, v := range values {
+		if !v {
+			return false
+		}
+	}
+	return len(values) > 0
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jobHistoryFile is the append-only record of finished jobs below the data
+// directory. It outlives the batches, which are collected when idle.
+const jobHistoryFile = "job_history.jsonl"
+
+// defaultReportPeriod is the span a throughput report covers without ?from
+const defaultReportPeriod = time.Hour * 24 * 7
+
+// JobRecord is one finished job in the job history
+type JobRecord struct {
+	Time       time.Time `json:"time"` // When the job finished
+	BatchID    string    `json:"batch_id"`
+	Index      int       `json:"index"`
+	Domain     string    `json:"domain,omitempty"`
+	Status     string    `json:"status"`
+	ErrorCode  string    `json:"error_code,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Tokens     int       `json:"tokens,omitempty"`
+	Cost       float64   `json:"cost,omitempty"`
+}
+
+// jobHistoryLog appends finished jobs to <dataDir>/job_history.jsonl
+type jobHistoryLog struct {
+	mu sync.Mutex
+}
+
+var jobHistory = &jobHistoryLog{}
+
+func jobHistoryPath() string {
+	return filepath.Join(dataDir, jobHistoryFile)
+}
+
+// record appends a finished job. Simulated jobs are left out, as they are
+// from the domain statistics.
+func (h *jobHistoryLog) record(batchID string, job BatchJob) {
+	if job.simulation != nil || !jobFinished(job.Status) {
+		return
+	}
+	line, err := json.Marshal(JobRecord{
+		Time:       time.Now().UTC(),
+		BatchID:    batchID,
+		Index:      job.Index,
+		Domain:     jobDomain(job.URL),
+		Status:     job.Status,
+		ErrorCode:  job.ErrorCode,
+		DurationMs: job.DurationMs,
+		Tokens:     job.TokensUsed,
+		Cost:       job.Cost,
+	})
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		log.Printf("Failed to record job %d of batch %s in the job history: %v", job.Index, batchID, err)
+		return
+	}
+	f, err := os.OpenFile(jobHistoryPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		log.Printf("Failed to record job %d of batch %s in the job history: %v", job.Index, batchID, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to record job %d of batch %s in the job history: %v", job.Index, batchID, err)
+	}
+}
+
+// read calls fn for every record that finished in [from, to)
+func (h *jobHistoryLog) read(from, to time.Time, fn func(JobRecord)) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.Open(jobHistoryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record JobRecord
+		if json.Unmarshal(scanner.Bytes(), &record) != nil || record.Time.Before(from) || !record.Time.Before(to) {
+			continue
+		}
+		fn(record)
+	}
+	return scanner.Err()
+}
+
+// ThroughputStats summarizes the jobs that finished in one period
+type ThroughputStats struct {
+	Start          time.Time      `json:"start"`
+	End            time.Time      `json:"end"`
+	Jobs           int            `json:"jobs"`
+	JobsPerHour    float64        `json:"jobs_per_hour"`
+	Succeeded      int            `json:"succeeded"`
+	Failed         int            `json:"failed"` // Failed and timed out
+	FailureRate    float64        `json:"failure_rate"`
+	FailuresByCode map[string]int `json:"failures_by_code,omitempty"`
+	MedianMs       int64          `json:"median_duration_ms"`
+	P95Ms          int64          `json:"p95_duration_ms"`
+	// Share of jobs finishing within ?sla_ms=, when given
+	WithinSLA *float64 `json:"within_sla,omitempty"`
+	Tokens    int      `json:"tokens"`
+	Cost      float64  `json:"cost"`
+
+	durations []int64
+}
+
+// add counts one finished job
+func (s *ThroughputStats) add(record JobRecord) {
+	s.Jobs++
+	switch record.Status {
+	case "completed", "not_modified":
+		s.Succeeded++
+	case "failed", "timed_out":
+		s.Failed++
+		code := record.ErrorCode
+		if code == "" {
+			code = errCodeUnknown
+		}
+		if s.FailuresByCode == nil {
+			s.FailuresByCode = make(map[string]int)
+		}
+		s.FailuresByCode[code]++
+	}
+	s.durations = append(s.durations, record.DurationMs)
+	s.Tokens += record.Tokens
+	s.Cost += record.Cost
+}
+
+// finish computes the rates and duration percentiles
+func (s *ThroughputStats) finish(slaMs int64) {
+	if hours := s.End.Sub(s.Start).Hours(); hours > 0 {
+		s.JobsPerHour = float64(s.Jobs) / hours
+	}
+	if s.Jobs == 0 {
+		return
+	}
+	s.FailureRate = float64(s.Failed) / float64(s.Jobs)
+	sort.Slice(s.durations, func(i, j int) bool { return s.durations[i] < s.durations[j] })
+	s.MedianMs = percentileMs(s.durations, 50)
+	s.P95Ms = percentileMs(s.durations, 95)
+	if slaMs > 0 {
+		within := sort.Search(len(s.durations), func(i int) bool { return s.durations[i] > slaMs })
+		share := float64(within) / float64(s.Jobs)
+		s.WithinSLA = &share
+	}
+}
+
+// percentileMs returns the nearest-rank percentile of sorted durations
+func percentileMs(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// ThroughputReport is the response of GET /reports/throughput
+type ThroughputReport struct {
+	From    time.Time         `json:"from"`
+	To      time.Time         `json:"to"`
+	Bucket  string            `json:"bucket"`
+	Total   ThroughputStats   `json:"total"`
+	Buckets []ThroughputStats `json:"buckets"`
+}
+
+// reportBuckets are the period lengths a report can be broken down by
+var reportBuckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  time.Hour * 24,
+	"week": time.Hour * 24 * 7,
+}
+
+// buildThroughputReport summarizes the job history between from and to,
+// overall and per bucket
+func buildThroughputReport(from, to time.Time, bucket string, slaMs int64) (ThroughputReport, error) {
+	width := reportBuckets[bucket]
+	report := ThroughputReport{From: from, To: to, Bucket: bucket, Total: ThroughputStats{Start: from, End: to}}
+	start := from.Truncate(width)
+	for t := start; t.Before(to); t = t.Add(width) {
+		// The first and last buckets are cut to the report's span, so their
+		// rates are not diluted by time outside it
+		bucketStats := ThroughputStats{Start: t, End: t.Add(width)}
+		if bucketStats.Start.Before(from) {
+			bucketStats.Start = from
+		}
+		if bucketStats.End.After(to) {
+			bucketStats.End = to
+		}
+		report.Buckets = append(report.Buckets, bucketStats)
+	}
+
+	err := jobHistory.read(from, to, func(record JobRecord) {
+		report.Total.add(record)
+		if i := int(record.Time.Sub(start) / width); i >= 0 && i < len(report.Buckets) {
+			report.Buckets[i].add(record)
+		}
+	})
+	if err != nil {
+		return ThroughputReport{}, err
+	}
+	report.Total.finish(slaMs)
+	for i := range report.Buckets {
+		report.Buckets[i].finish(slaMs)
+	}
+	return report, nil
+}
+
+// handleThroughputReport summarizes finished jobs over time: jobs per hour,
+// median and p95 duration, failure rates and cost. ?from= and ?to= take RFC
+// 3339 times (the last 7 days by default), ?bucket= is hour (default), day
+// or week, and ?sla_ms= adds the share of jobs finishing within that time.
+func handleThroughputReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		to = parsed.UTC()
+	}
+	from := to.Add(-defaultReportPeriod)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		from = parsed.UTC()
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	bucket := query.Get("bucket")
+	if bucket == "" {
+		bucket = "hour"
+	}
+	width, ok := reportBuckets[bucket]
+	if !ok {
+		http.Error(w, "bucket must be hour, day or week", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from)/width > 10000 {
+		http.Error(w, fmt.Sprintf("Too many %s buckets between from and to; use a larger bucket", bucket), http.StatusBadRequest)
+		return
+	}
+
+	var slaMs int64
+	if value := query.Get("sla_ms"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			http.Error(w, "sla_ms must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		slaMs = parsed
+	}
+
+	report, err := buildThroughputReport(from, to, bucket, slaMs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read job history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
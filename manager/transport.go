@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Connection pool settings for scraping, overridable from the environment
+var (
+	scrapeMaxIdleConns        = envInt("SCRAPE_MAX_IDLE_CONNS", 512)
+	scrapeMaxIdleConnsPerHost = envInt("SCRAPE_MAX_IDLE_CONNS_PER_HOST", 32)
+	scrapeMaxConnsPerHost     = envInt("SCRAPE_MAX_CONNS_PER_HOST", 0) // 0 means unlimited
+	scrapeIdleConnTimeout     = time.Second * 90
+	scrapeTLSSessionCacheSize = 1024
+)
+
+// scrapeTransport is shared by every client fetching pages, images and
+// documents under the deployment's SSRF policy, so connections and TLS
+// sessions to a site are reused across jobs instead of being set up per
+// request. Clients stay cheap and carry their own timeout.
+var scrapeTransport = newScrapeTransport(func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return ssrfPolicy.dialContext(ctx, network, addr)
+})
+
+// newScrapeTransport returns a transport tuned for many concurrent requests
+// to a limited set of hosts. A custom dialer disables HTTP/2 unless it is
+// forced. Responses are requested gzip-compressed and decompressed
+// transparently, which the transport only does while DisableCompression is
+// false and no Accept-Encoding header is set by hand.
+func newScrapeTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	return &http.Transport{
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          scrapeMaxIdleConns,
+		MaxIdleConnsPerHost:   scrapeMaxIdleConnsPerHost,
+		MaxConnsPerHost:       scrapeMaxConnsPerHost,
+		IdleConnTimeout:       scrapeIdleConnTimeout,
+		TLSHandshakeTimeout:   time.Second * 10,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig: &tls.Config{
+			ClientSessionCache: tls.NewLRUClientSessionCache(scrapeTLSSessionCacheSize),
+		},
+	}
+}
+
+// sharedScrapeClient returns a client on the shared transport, checking
+// redirects against the deployment's SSRF policy
+func sharedScrapeClient(timeout time.Duration) *http.Client {
+	return scrapeClientWith(scrapeTransport, ssrfPolicy, timeout)
+}
+
+// envSeconds reads a positive number of seconds from the environment
+func envSeconds(name string, fallback int) time.Duration {
+	if n := envInt(name, fallback); n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return time.Duration(fallback) * time.Second
+}
+
+// envInt reads a non-negative integer from the environment
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Ignoring invalid %s %q", name, value)
+		return fallback
+	}
+	return n
+}
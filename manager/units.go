@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Unit systems for normalization
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+)
+
+// NormalizationConfig converts units and currencies in extracted values
+type NormalizationConfig struct {
+	Units    string             `json:"units,omitempty"`    // "metric" or "imperial", empty to leave units alone
+	Currency string             `json:"currency,omitempty"` // Target ISO code, e.g. "EUR"
+	Rates    map[string]float64 `json:"rates,omitempty"`    // Value of one unit of each currency in the target currency
+	Fields   []string           `json:"fields,omitempty"`   // Fields to normalize, all free-text fields when empty
+}
+
+// NormalizedValue keeps an extracted value next to its normalized form
+type NormalizedValue struct {
+	Raw        string `json:"raw"`
+	Normalized string `json:"normalized"`
+}
+
+// unitConversion maps a unit to its dimension and its factor to the metric base unit
+type unitConversion struct {
+	dimension string
+	toBase    float64 // mm for length, g for weight
+}
+
+var units = map[string]unitConversion{
+	"mm": {"length", 1}, "cm": {"length", 10}, "m": {"length", 1000},
+	"in": {"length", 25.4}, "inch": {"length", 25.4}, "inches": {"length", 25.4}, `"`: {"length", 25.4},
+	"ft": {"length", 304.8}, "feet": {"length", 304.8},
+	"g": {"weight", 1}, "kg": {"weight", 1000},
+	"lb": {"weight", 453.59237}, "lbs": {"weight", 453.59237}, "oz": {"weight", 28.349523125},
+}
+
+// Target unit per dimension and system
+var targetUnits = map[string]map[string]string{
+	unitsMetric:   {"length": "mm", "weight": "kg"},
+	unitsImperial: {"length": "in", "weight": "lb"},
+}
+
+var currencySymbols = map[string]string{"$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY"}
+
+var (
+	// A number, optionally a dimension list like "10 x 20 x 5", followed by a unit
+	quantityPattern    = regexp.MustCompile(`(?i)(\d+(?:[.,]\d+)?(?:\s*[x×]\s*\d+(?:[.,]\d+)?)*)\s*(mm|cm|inches|inch|ft|feet|kg|lbs|lb|oz|g|m|")(?:\b|$|\s)`)
+	dimensionSeparator = regexp.MustCompile(`\s*[x×]\s*`)
+	currencyPattern    = regexp.MustCompile(`(?i)([$€£¥])\s*(\d[\d,]*(?:\.\d+)?)|(\d[\d,]*(?:\.\d+)?)\s*(USD|EUR|GBP|JPY)\b`)
+	// Fields that identify a product and must never be rewritten
+	identifierFields = map[string]bool{"name": true, "model_number": true, "serial_number": true}
+)
+
+// validate checks the target system and that conversion rates exist for the target currency
+func (c NormalizationConfig) validate() error {
+	if c.Units != "" && c.Units != unitsMetric && c.Units != unitsImperial {
+		return fmt.Errorf("unsupported units: %s", c.Units)
+	}
+	for code, rate := range c.Rates {
+		if rate <= 0 {
+			return fmt.Errorf("invalid rate for %s", code)
+		}
+	}
+	return nil
+}
+
+func (c NormalizationConfig) enabled() bool {
+	return c.Units != "" || c.Currency != ""
+}
+
+// normalizeExtraction converts units and currencies in the free-text fields of
+// an extraction, returning only the fields that changed
+func normalizeExtraction(result interface{}, config NormalizationConfig) map[string]NormalizedValue {
+	info, ok := result.(map[string]interface{})
+	if !ok || !config.enabled() {
+		return nil
+	}
+	selected := make(map[string]bool, len(config.Fields))
+	for _, field := range config.Fields {
+		selected[field] = true
+	}
+
+	normalized := make(map[string]NormalizedValue)
+	for field, value := range info {
+		raw, ok := value.(string)
+		if !ok || raw == "NO_MATCH" || identifierFields[field] {
+			continue
+		}
+		if len(selected) > 0 && !selected[field] {
+			continue
+		}
+		out := normalizeText(raw, config)
+		if out != raw {
+			normalized[field] = NormalizedValue{Raw: raw, Normalized: out}
+		}
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	return normalized
+}
+
+// normalizeText rewrites every quantity and price in text to the configured targets
+func normalizeText(text string, config NormalizationConfig) string {
+	if config.Units != "" {
+		text = quantityPattern.ReplaceAllStringFunc(text, func(match string) string {
+			parts := quantityPattern.FindStringSubmatch(match)
+			trailing := match[len(strings.TrimRight(match, " \t")):]
+			converted, ok := convertQuantity(parts[1], parts[2], config.Units)
+			if !ok {
+				return match
+			}
+			return converted + trailing
+		})
+	}
+	if config.Currency != "" {
+		text = currencyPattern.ReplaceAllStringFunc(text, func(match string) string {
+			parts := currencyPattern.FindStringSubmatch(match)
+			code, amount := currencySymbols[parts[1]], parts[2]
+			if code == "" {
+				code, amount = strings.ToUpper(parts[4]), parts[3]
+			}
+			converted, ok := convertCurrency(amount, code, config)
+			if !ok {
+				return match
+			}
+			return converted
+		})
+	}
+	return text
+}
+
+// convertQuantity converts "10 x 20" of unit to the target system's unit
+func convertQuantity(numbers, unit, system string) (string, bool) {
+	conversion, ok := units[strings.ToLower(unit)]
+	if !ok {
+		return "", false
+	}
+	target := targetUnits[system][conversion.dimension]
+	factor := conversion.toBase / units[target].toBase
+
+	values := dimensionSeparator.Split(numbers, -1)
+	for i, value := range values {
+		n, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+		if err != nil {
+			return "", false
+		}
+		values[i] = strconv.FormatFloat(roundTo(n*factor, 2), 'f', -1, 64)
+	}
+	return strings.Join(values, " x ") + " " + target, true
+}
+
+// convertCurrency converts amount in code to the target currency using the configured rates
+func convertCurrency(amount, code string, config NormalizationConfig) (string, bool) {
+	n, err := strconv.ParseFloat(strings.ReplaceAll(amount, ",", ""), 64)
+	if err != nil {
+		return "", false
+	}
+	target := strings.ToUpper(config.Currency)
+	rate := 1.0
+	if code != target {
+		var ok bool
+		if rate, ok = config.Rates[code]; !ok {
+			return "", false
+		}
+	}
+	return strconv.FormatFloat(roundTo(n*rate, 2), 'f', 2, 64) + " " + target, true
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := 1.0
+	for i := 0; i < places; i++ {
+		scale *= 10
+	}
+	if v < 0 {
+		return float64(int64(v*scale-0.5)) / scale
+	}
+	return float64(int64(v*scale+0.5)) / scale
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Row diagnostic codes
+const (
+	rowInvalidURL         = "invalid_url"
+	rowUnsupportedScheme  = "unsupported_scheme"
+	rowBlockedHost        = "blocked_host"
+	rowMissingModelNumber = "missing_model_number"
+	rowDuplicate          = "duplicate"
+	rowSchemeAssumed      = "scheme_assumed"
+	rowURLNormalized      = "url_normalized"
+	rowMissingURL         = "missing_url"
+	rowInvalidLocale      = "invalid_locale"
+)
+
+var errUnsupportedScheme = errors.New("unsupported URL scheme")
+
+// RowError describes why a CSV row was rejected or flagged
+type RowError struct {
+	Row         int    `json:"row"` // 1-based line number, the header is row 1
+	URL         string `json:"url,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Error       string `json:"error"`
+	DuplicateOf int    `json:"duplicate_of,omitempty"` // Row that first listed the same model and URL
+}
+
+// ValidationReport lists every problem found in an uploaded CSV
+type ValidationReport struct {
+	Rows     int `json:"rows"`
+	Accepted int `json:"accepted"`
+	Skipped  int `json:"skipped"`
+	// Valid rows left out by sample_count or sample_percent
+	SkippedBySampling int        `json:"skipped_by_sampling,omitempty"`
+	Strict            bool       `json:"strict"` // Invalid rows reject the whole batch instead of being skipped
+	Errors            []RowError `json:"errors,omitempty"`
+	Duplicates        []RowError `json:"duplicates,omitempty"`
+	Warnings          []RowError `json:"warnings,omitempty"`
+	// Set when a streamed upload had more issues than the report keeps
+	Truncated bool `json:"truncated,omitempty"`
+	capped    bool
+}
+
+// hasIssues reports whether anything worth returning to the client was found
+func (r *ValidationReport) hasIssues() bool {
+	return len(r.Errors) > 0 || len(r.Duplicates) > 0 || len(r.Warnings) > 0
+}
+
+// urlErrorCode classifies a URL validation failure
+func urlErrorCode(err error) string {
+	if errors.Is(err, errUnsupportedScheme) {
+		return rowUnsupportedScheme
+	}
+	return rowInvalidURL
+}
+
+// writeRowErrors responds with every rejected row so the whole file can be fixed at once
+func writeRowErrors(w http.ResponseWriter, report *ValidationReport) {
+	response := map[string]interface{}{
+		"status":     "rejected",
+		"error":      "CSV contains invalid rows",
+		"row_errors": report.Errors,
+		"validation": report,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(response)
+}
+
+// maxReportedIssues caps each issue list of a streamed upload's report, so a
+// file with a problem on every row does not hold one entry per row
+const maxReportedIssues = 1000
+
+// rowBuilder validates CSV records one at a time and turns them into jobs
+type rowBuilder struct {
+	config   Config
+	headers  []string
+	urlIdx   int // -1 when the URL column is absent
+	modelIdx int
+	redactor *redactor
+	seen     map[string]int // Model and URL -> first row
+	row      int
+}
+
+func newRowBuilder(config Config, headers []string, urlIdx, modelIdx int, redactor *redactor) *rowBuilder {
+	return &rowBuilder{
+		config:   config,
+		headers:  headers,
+		urlIdx:   urlIdx,
+		modelIdx: modelIdx,
+		redactor: redactor,
+		seen:     make(map[string]int),
+		row:      1, // The header
+	}
+}
+
+// build validates the next record, recording its problems in report, and
+// returns its job unless the row is invalid or a duplicate
+func (b *rowBuilder) build(ctx context.Context, record []string, report *ValidationReport) (BatchJob, bool) {
+	b.row++
+	report.Rows++
+	row, config := b.row, b.config
+
+	modelNumber := ""
+	if b.modelIdx < len(record) {
+		modelNumber = strings.TrimSpace(record[b.modelIdx])
+	}
+	if modelNumber == "" {
+		report.add(&report.Errors, RowError{Row: row, Code: rowMissingModelNumber, Error: "model number is empty"})
+		return BatchJob{}, false
+	}
+
+	// Reject non-http(s) schemes and URLs that point at internal or denied hosts.
+	// Rows without a URL are left for the discovery stage when it is enabled.
+	rawURL := ""
+	if b.urlIdx != -1 && b.urlIdx < len(record) {
+		rawURL = strings.TrimSpace(record[b.urlIdx])
+	}
+	normalizedURL := ""
+	if rawURL != "" || !config.Discovery.enabled() {
+		var err error
+		normalizedURL, err = validateAndNormalizeURL(rawURL)
+		if err != nil {
+			report.add(&report.Errors, RowError{Row: row, URL: rawURL, Code: urlErrorCode(err), Error: err.Error()})
+			return BatchJob{}, false
+		}
+		if config.Simulation.Enabled {
+			// Simulated jobs never connect, so any host will do
+		} else if err := ssrfPolicy.validateURL(ctx, normalizedURL); err != nil {
+			report.add(&report.Errors, RowError{Row: row, URL: rawURL, Code: rowBlockedHost, Error: err.Error()})
+			return BatchJob{}, false
+		}
+		if !strings.Contains(rawURL, "://") {
+			report.add(&report.Warnings, RowError{Row: row, URL: rawURL, Code: rowSchemeAssumed, Error: "no scheme given, using https"})
+		} else if normalizedURL != rawURL {
+			report.add(&report.Warnings, RowError{Row: row, URL: rawURL, Code: rowURLNormalized, Error: "URL normalized to " + normalizedURL})
+		}
+	} else {
+		report.add(&report.Warnings, RowError{Row: row, Code: rowMissingURL, Error: "no URL, one will be discovered"})
+	}
+
+	// The same model and URL is only scraped once
+	key := modelNumber + "\x00" + normalizedURL
+	if first, ok := b.seen[key]; ok && normalizedURL != "" {
+		report.add(&report.Duplicates, RowError{Row: row, URL: rawURL, Code: rowDuplicate, Error: "same model number and URL as an earlier row", DuplicateOf: first})
+		return BatchJob{}, false
+	}
+	b.seen[key] = row
+
+	locale := config.Locale.forRow(b.headers, record)
+	if err := locale.validate(); err != nil {
+		report.add(&report.Errors, RowError{Row: row, URL: rawURL, Code: rowInvalidLocale, Error: err.Error()})
+		return BatchJob{}, false
+	}
+
+	// Create job from CSV record
+	job := BatchJob{
+		ModelNumber:    modelNumber,
+		URL:            normalizedURL,
+		Status:         "pending",
+		Progress:       0,
+		exportConfig:   config.Export,
+		outputSchema:   config.OutputSchema,
+		outputLanguage: config.OutputLanguage,
+		normalization:  config.Normalization,
+		replay:         config.Replay,
+		redaction:      config.Redaction,
+		llm:            config.LLM,
+		earlyExit:      config.EarlyExit,
+		locale:         locale,
+		pagination:     config.Pagination,
+		quality:        config.Quality,
+		offer:          config.Offer,
+		media:          config.Media,
+		pageLimits:     config.pageLimits(),
+		maxResponse:    config.responseLimit(),
+		conditional:    config.ConditionalGet,
+		simulation:     config.simulation(),
+		childJobs:      config.ChildJobs,
+		redactor:       b.redactor,
+		Metadata:       rowMetadata(b.headers, record),
+	}
+
+	// Optional: Parse description if present
+	descriptionIdx := getColumnIndex(b.headers, "parse_description")
+	if descriptionIdx != -1 && descriptionIdx < len(record) {
+		description := record[descriptionIdx]
+		if description != "" {
+			job.ParseDescription = &description
+		}
+	}
+	report.Accepted++
+	return job, true
+}
+
+// add records an issue, dropping it once a capped list is full
+func (r *ValidationReport) add(list *[]RowError, issue RowError) {
+	if r.capped && len(*list) >= maxReportedIssues {
+		r.Truncated = true
+		return
+	}
+	*list = append(*list, issue)
+}
+
+// merge adds the counts and issues of a single row's report
+func (r *ValidationReport) merge(row *ValidationReport) {
+	r.Rows += row.Rows
+	r.Accepted += row.Accepted
+	r.Skipped += row.Rows - row.Accepted
+	for _, issue := range row.Errors {
+		r.add(&r.Errors, issue)
+	}
+	for _, issue := range row.Duplicates {
+		r.add(&r.Duplicates, issue)
+	}
+	for _, issue := range row.Warnings {
+		r.add(&r.Warnings, issue)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Batch routes are "/batch/{batch_id}" on the unversioned API and
+// "/batches/{batch_id}" below /v1
+const (
+	legacyBatchPath = "/batch"
+	v1BatchPath     = "/batches"
+)
+
+// Version negotiation and the retirement of the unversioned routes are
+// configured from the environment and per request:
+//
+//	API_LEGACY_SUNSET  HTTP date after which the unversioned routes may be
+//	                   removed, sent as the Sunset header on their responses
+//
+// Clients of the unversioned routes can opt into v1 without changing their
+// URLs by sending "X-API-Version: 1" or "Accept: application/vnd.llm-scraper.v1+json".
+const (
+	apiVersionHeader = "X-API-Version"
+	apiMediaType     = "application/vnd.llm-scraper"
+)
+
+var legacySunset = os.Getenv("API_LEGACY_SUNSET")
+
+// supportedAPIVersions are the versions a client can ask for
+var supportedAPIVersions = []string{apiVersion}
+
+// v1Path returns the /v1 equivalent of an unversioned path below the base path
+func v1Path(path string) string {
+	if path == legacyBatchPath || strings.HasPrefix(path, legacyBatchPath+"/") {
+		path = v1BatchPath + strings.TrimPrefix(path, legacyBatchPath)
+	}
+	return "/" + apiVersion + path
+}
+
+// deprecated marks the responses of the unversioned routes as deprecated and
+// points clients at the /v1 route that replaces each
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Deprecation", "true")
+		if legacySunset != "" {
+			header.Set("Sunset", legacySunset)
+		}
+		successor := basePath() + v1Path(strings.TrimPrefix(r.URL.Path, basePath()))
+		header.Add("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestedVersion returns the API version a request asks for with the
+// X-API-Version header or a versioned Accept media type, "" when it names
+// none. Versions are given as "1" or "v1".
+func requestedVersion(r *http.Request) string {
+	version := r.Header.Get(apiVersionHeader)
+	if version == "" {
+		for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+			if err != nil || !strings.HasPrefix(mediaType, apiMediaType+".") {
+				continue
+			}
+			version, _, _ = strings.Cut(strings.TrimPrefix(mediaType, apiMediaType+"."), "+")
+			break
+		}
+	}
+	version = strings.ToLower(strings.TrimSpace(version))
+	if version != "" && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version
+}
+
+// negotiateVersion serves unversioned requests that ask for a version with
+// the routes of that version, and rejects versions the server does not have
+func negotiateVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", apiVersionHeader+", Accept")
+		version := requestedVersion(r)
+		if version == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		supported := false
+		for _, v := range supportedAPIVersions {
+			supported = supported || v == version
+		}
+		if !supported {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotAcceptable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":              "unsupported API version " + version,
+				"supported_versions": supportedAPIVersions,
+			})
+			return
+		}
+
+		prefix := basePath()
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+		if !strings.HasPrefix(r.URL.Path, prefix) || rest == "/"+version || strings.HasPrefix(rest, "/"+version+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rewritten := r.Clone(r.Context())
+		rewritten.URL.Path = prefix + v1Path(rest)
+		rewritten.URL.RawPath = ""
+		next.ServeHTTP(w, rewritten)
+	})
+}
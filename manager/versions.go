@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// versionTimeFormat names version files so they sort chronologically
+const versionTimeFormat = "20060102T150405.000000000Z"
+
+var versionIDPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z$`)
+
+// ResultVersion describes one stored parse_results.json
+type ResultVersion struct {
+	Version   string    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	URL       string    `json:"url"`
+	Size      int64     `json:"size"`
+}
+
+// urlKey returns a short stable directory name for a URL
+func urlKey(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:8])
+}
+
+// versionsDir is where every historical result for (model, URL) is kept
+func versionsDir(modelDir, rawURL string) string {
+	return filepath.Join(modelDir, "versions", urlKey(rawURL))
+}
+
+// saveResultVersion keeps a timestamped copy of a job's results next to the
+// latest parse_results.json, recording the URL once per directory. It returns
+// the new version's ID.
+func saveResultVersion(modelDir, rawURL string, data []byte) (string, error) {
+	dir := versionsDir(modelDir, rawURL)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create versions directory: %v", err)
+	}
+	urlFile := filepath.Join(dir, "url.txt")
+	if _, err := os.Stat(urlFile); os.IsNotExist(err) {
+		if err := writeFileAtomic(urlFile, []byte(rawURL), 0644); err != nil {
+			return "", fmt.Errorf("failed to record version URL: %v", err)
+		}
+	}
+
+	version := time.Now().UTC().Format(versionTimeFormat)
+	if err := writeFileAtomic(filepath.Join(dir, version+".json"), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write result version: %v", err)
+	}
+	return version, nil
+}
+
+// listResultVersions returns the stored versions for (model, URL), oldest first
+func listResultVersions(modelDir, rawURL string) ([]ResultVersion, error) {
+	entries, err := os.ReadDir(versionsDir(modelDir, rawURL))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []ResultVersion
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !versionIDPattern.MatchString(id) {
+			continue
+		}
+		timestamp, err := time.Parse(versionTimeFormat, id)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, ResultVersion{Version: id, Timestamp: timestamp, URL: rawURL, Size: info.Size()})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// versionRequest resolves the model directory and URL of a versions request
+func versionRequest(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	model := mux.Vars(r)["model"]
+	if model == "" {
+		http.Error(w, "Invalid model number", http.StatusBadRequest)
+		return "", "", false
+	}
+	rawURL, err := validateAndNormalizeURL(r.URL.Query().Get("url"))
+	if err != nil {
+		http.Error(w, "Invalid or missing url parameter", http.StatusBadRequest)
+		return "", "", false
+	}
+	return modelDirFor(dataDir, model), rawURL, true
+}
+
+// handleListVersions lists every stored result for a model and URL
+func handleListVersions(w http.ResponseWriter, r *http.Request) {
+	modelDir, rawURL, ok := versionRequest(w, r)
+	if !ok {
+		return
+	}
+	versions, err := listResultVersions(modelDir, rawURL)
+	if err != nil {
+		http.Error(w, "Failed to list versions", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"model_number": mux.Vars(r)["model"],
+		"url":          rawURL,
+		"versions":     versions,
+	})
+}
+
+// handleGetVersion returns one stored parse_results.json
+func handleGetVersion(w http.ResponseWriter, r *http.Request) {
+	modelDir, rawURL, ok := versionRequest(w, r)
+	if !ok {
+		return
+	}
+	version := mux.Vars(r)["version"]
+	if !versionIDPattern.MatchString(version) {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+	data, err := readArtifact(filepath.Join(versionsDir(modelDir, rawURL), version+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Version not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to read version", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
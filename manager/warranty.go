@@ -0,0 +1,210 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Warranty types, from the wording of the extracted text
+const (
+	warrantyLifetime     = "lifetime"
+	warrantyExtended     = "extended"
+	warrantyLimited      = "limited"
+	warrantyFull         = "full"
+	warrantyManufacturer = "manufacturer"
+	warrantyStandard     = "standard" // A duration without further qualification
+)
+
+// ParsedWarranty is warranty text reduced to a duration and a type
+type ParsedWarranty struct {
+	Raw            string `json:"raw"`
+	Field          string `json:"field"`
+	DurationMonths int    `json:"duration_months,omitempty"` // Longest duration mentioned; 0 for lifetime
+	Type           string `json:"type"`
+}
+
+// ParsedDate keeps an extracted date next to its ISO 8601 form
+type ParsedDate struct {
+	Raw string `json:"raw"`
+	// "2006-01-02", or "2006-01" when the text only names a month
+	ISO string `json:"iso"`
+}
+
+var (
+	numberWords = map[string]int{
+		"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+		"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+		"fifteen": 15, "eighteen": 18, "twenty": 20, "twenty-four": 24, "thirty": 30,
+		"thirty-six": 36, "forty-eight": 48, "sixty": 60, "ninety": 90,
+	}
+	warrantyDurationPattern = regexp.MustCompile(`(?i)\b(\d+|twenty-four|thirty-six|forty-eight|[a-z]+)[\s-]*(years?|yrs?|months?|mos?|weeks?|days?)\b`)
+	warrantyTypes           = []struct {
+		kind     string
+		keywords []string
+	}{
+		{warrantyLifetime, []string{"lifetime", "life-time"}},
+		{warrantyExtended, []string{"extended"}},
+		{warrantyLimited, []string{"limited"}},
+		{warrantyFull, []string{"full warranty"}},
+		{warrantyManufacturer, []string{"manufacturer"}},
+	}
+)
+
+// parseWarranty reads a duration and a type from warranty text. It returns
+// nil when the text names neither a duration nor a lifetime warranty.
+func parseWarranty(field, raw string) *ParsedWarranty {
+	text := strings.ToLower(raw)
+	parsed := &ParsedWarranty{Raw: raw, Field: field}
+
+	for _, match := range warrantyDurationPattern.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			var ok bool
+			if n, ok = numberWords[match[1]]; !ok {
+				continue
+			}
+		}
+		if months := durationMonths(n, match[2]); months > parsed.DurationMonths {
+			parsed.DurationMonths = months
+		}
+	}
+
+	for _, t := range warrantyTypes {
+		for _, keyword := range t.keywords {
+			if strings.Contains(text, keyword) {
+				parsed.Type = t.kind
+				break
+			}
+		}
+		if parsed.Type != "" {
+			break
+		}
+	}
+	if parsed.Type == warrantyLifetime {
+		parsed.DurationMonths = 0
+		return parsed
+	}
+	if parsed.DurationMonths == 0 {
+		return nil
+	}
+	if parsed.Type == "" {
+		parsed.Type = warrantyStandard
+	}
+	return parsed
+}
+
+// durationMonths converts n units to whole months, rounding days and weeks
+func durationMonths(n int, unit string) int {
+	switch {
+	case strings.HasPrefix(unit, "y"):
+		return n * 12
+	case strings.HasPrefix(unit, "mo"):
+		return n
+	case strings.HasPrefix(unit, "w"):
+		return max(1, (n*7+15)/30)
+	default:
+		return max(1, (n+15)/30)
+	}
+}
+
+// Date layouts tried in order. Numeric day/month dates are read as
+// month/day unless the first number cannot be a month.
+var (
+	dayLayouts = []string{
+		"2006-01-02", "2006/01/02", "20060102", "02.01.2006", "2.1.2006",
+		"January 2, 2006", "January 2 2006", "Jan 2, 2006", "Jan 2 2006", "Jan. 2, 2006",
+		"2 January 2006", "2 Jan 2006", "02-Jan-2006", "Mon, 02 Jan 2006", "Monday, January 2, 2006",
+		time.RFC3339, time.RFC1123, time.RFC1123Z, "2006-01-02T15:04:05", "2006-01-02 15:04:05",
+	}
+	monthLayouts     = []string{"January 2006", "Jan 2006", "2006-01", "01/2006"}
+	slashDatePattern = regexp.MustCompile(`^(\d{1,2})[/-](\d{1,2})[/-](\d{4})$`)
+	ordinalPattern   = regexp.MustCompile(`(?i)\b(\d{1,2})(st|nd|rd|th)\b`)
+	datePattern      = regexp.MustCompile(`(?i)\b(\d{4}-\d{2}-\d{2}|\d{1,2}[./-]\d{1,2}[./-]\d{4}|(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+\d{1,2}(?:st|nd|rd|th)?,?\s+\d{4}|\d{1,2}(?:st|nd|rd|th)?\s+(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+\d{4}|(?:jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+\d{4})\b`)
+)
+
+// parseDate converts a date written in one of the common forms to ISO 8601
+func parseDate(raw string) (string, bool) {
+	text := strings.TrimSpace(ordinalPattern.ReplaceAllString(raw, "$1"))
+	text = strings.Replace(text, "Sept", "Sep", 1)
+	if text == "" {
+		return "", false
+	}
+
+	if m := slashDatePattern.FindStringSubmatch(text); m != nil {
+		first, _ := strconv.Atoi(m[1])
+		second, _ := strconv.Atoi(m[2])
+		year, _ := strconv.Atoi(m[3])
+		month, day := first, second
+		if first > 12 {
+			month, day = second, first
+		}
+		t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		if month < 1 || month > 12 || t.Day() != day {
+			return "", false
+		}
+		return t.Format("2006-01-02"), true
+	}
+	for _, layout := range dayLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.Format("2006-01-02"), true
+		}
+	}
+	for _, layout := range monthLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.Format("2006-01"), true
+		}
+	}
+	return "", false
+}
+
+// isDateField reports whether a field's name says it holds a date
+func isDateField(field string) bool {
+	field = strings.ToLower(field)
+	return strings.Contains(field, "date") || strings.HasSuffix(field, "_on") || strings.HasSuffix(field, "_at")
+}
+
+// parseFieldValues finds the warranty and the dates in an extraction. Fields
+// named like dates may embed the date in a sentence; any other field counts
+// only when its whole value is a date.
+func parseFieldValues(result interface{}) (*ParsedWarranty, map[string]ParsedDate) {
+	info, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	fields := make([]string, 0, len(info))
+	for field := range info {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields) // Deterministic choice when several fields mention a warranty
+
+	var warranty *ParsedWarranty
+	dates := make(map[string]ParsedDate)
+	for _, field := range fields {
+		raw, ok := info[field].(string)
+		if !ok || raw == "NO_MATCH" || identifierFields[field] {
+			continue
+		}
+		if strings.Contains(strings.ToLower(field), "warranty") {
+			if parsed := parseWarranty(field, raw); parsed != nil && (warranty == nil || field == "warranty_info") {
+				warranty = parsed
+			}
+			continue
+		}
+		if iso, ok := parseDate(raw); ok {
+			dates[field] = ParsedDate{Raw: raw, ISO: iso}
+		} else if isDateField(field) {
+			if match := datePattern.FindString(raw); match != "" {
+				if iso, ok := parseDate(match); ok {
+					dates[field] = ParsedDate{Raw: raw, ISO: iso}
+				}
+			}
+		}
+	}
+	if len(dates) == 0 {
+		dates = nil
+	}
+	return warranty, dates
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"manager/pool"
+)
+
+var (
+	jobHardLimit      = time.Minute * 10 // Default wall-clock limit for a single job
+	heartbeatTimeout  = time.Minute * 2  // Silence after which a job is considered stuck
+	watchdogInterval  = time.Second * 10
+	errJobStuck       = newJobError(errCodeTimeout, "job stopped sending heartbeats")
+	errJobHardTimeout = newJobError(errCodeTimeout, "job exceeded hard time limit")
+)
+
+// activeJob tracks a running job for the watchdog
+type activeJob struct {
+	started   time.Time
+	lastBeat  time.Time
+	cancel    context.CancelCauseFunc
+	cancelled bool
+}
+
+// jobWatchdog cancels jobs that exceed the hard limit or stop sending heartbeats
+type jobWatchdog struct {
+	mu        sync.Mutex
+	active    map[int]*activeJob
+	hardLimit time.Duration
+}
+
+// newJobWatchdog returns a watchdog that cancels jobs running longer than
+// hardLimit, or jobHardLimit when it is zero
+func newJobWatchdog(hardLimit time.Duration) *jobWatchdog {
+	if hardLimit <= 0 {
+		hardLimit = jobHardLimit
+	}
+	return &jobWatchdog{active: make(map[int]*activeJob), hardLimit: hardLimit}
+}
+
+// start registers a job and returns a context the watchdog can cancel
+func (w *jobWatchdog) start(parent context.Context, index int) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	now := time.Now()
+
+	w.mu.Lock()
+	w.active[index] = &activeJob{started: now, lastBeat: now, cancel: cancel}
+	w.mu.Unlock()
+
+	return ctx, func() {
+		w.mu.Lock()
+		delete(w.active, index)
+		w.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// beat records that a job is still making progress
+func (w *jobWatchdog) beat(index int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if job, ok := w.active[index]; ok {
+		job.lastBeat = time.Now()
+	}
+}
+
+// activeCount returns the number of jobs currently running
+func (w *jobWatchdog) activeCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.active)
+}
+
+// lastBeat returns the time of the latest heartbeat for a running job
+func (w *jobWatchdog) lastBeat(index int) (time.Time, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if job, ok := w.active[index]; ok {
+		return job.lastBeat, true
+	}
+	return time.Time{}, false
+}
+
+// run checks active jobs until ctx is done
+func (w *jobWatchdog) run(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+func (w *jobWatchdog) check(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for index, job := range w.active {
+		if job.cancelled {
+			continue
+		}
+		switch {
+		case now.Sub(job.started) > w.hardLimit:
+			log.Printf("Watchdog: job %d exceeded hard limit of %s, cancelling", index, w.hardLimit)
+			job.cancel(errJobHardTimeout)
+			job.cancelled = true
+		case now.Sub(job.lastBeat) > heartbeatTimeout:
+			log.Printf("Watchdog: job %d sent no heartbeat for %s, cancelling", index, heartbeatTimeout)
+			job.cancel(errJobStuck)
+			job.cancelled = true
+		}
+	}
+}
+
+// runWithWatchdog executes a job under watchdog supervision. If the job is
+// cancelled the worker returns immediately, abandoning the stuck goroutine,
+// which only ever touches its own copy of the job.
+func (w *jobWatchdog) runWithWatchdog(parent context.Context, job BatchJob, baseDir string) (BatchJob, error) {
+	ctx, done := w.start(parent, job.Index)
+	defer done()
+
+	job.heartbeat = func() { w.beat(job.Index) }
+
+	type outcome struct {
+		job BatchJob
+		err error
+	}
+	finished := make(chan outcome, 1)
+	go func(j BatchJob) {
+		// Report a panic as this job's failure instead of crashing the server
+		defer func() {
+			if v := recover(); v != nil {
+				finished <- outcome{job: j, err: &pool.PanicError{Value: v, Stack: debug.Stack()}}
+			}
+		}()
+		err := j.processURL(ctx, baseDir)
+		finished <- outcome{job: j, err: err}
+	}(job)
+
+	select {
+	case out := <-finished:
+		return out.job, out.err
+	case <-ctx.Done():
+		return job, context.Cause(ctx)
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	wsPingInterval = envSeconds("WS_PING_INTERVAL_SECONDS", 30) // How often idle connections are pinged
+	wsWriteTimeout = envSeconds("WS_WRITE_TIMEOUT_SECONDS", 10) // Deadline for a single write
+	jobEventBuffer = 1000                                       // Job events kept per batch for reconnecting clients
+)
+
+// JobEvent records one job state change, numbered per batch
+type JobEvent struct {
+	Sequence  int64     `json:"sequence"`
+	Index     int       `json:"index"`
+	Status    string    `json:"status"`
+	Progress  int       `json:"progress"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"error_code,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// recordJobEvent appends a job event to the batch's ring buffer; the caller holds bp.mu
+func (bp *BatchProcess) recordJobEvent(job BatchJob) {
+	bp.Sequence++
+	bp.jobEvents = append(bp.jobEvents, JobEvent{
+		Sequence:  bp.Sequence,
+		Index:     job.Index,
+		Status:    job.Status,
+		Progress:  job.Progress,
+		Error:     job.Error,
+		ErrorCode: job.ErrorCode,
+		Time:      time.Now(),
+	})
+	if len(bp.jobEvents) > jobEventBuffer {
+		bp.jobEvents = append([]JobEvent(nil), bp.jobEvents[len(bp.jobEvents)-jobEventBuffer:]...)
+	}
+}
+
+// missedEvents returns the job events after since, and false when some of
+// them have already been dropped from the buffer
+func (bp *BatchProcess) missedEvents(since int64) ([]JobEvent, bool) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	complete := len(bp.jobEvents) == 0 || bp.jobEvents[0].Sequence <= since+1
+	var missed []JobEvent
+	for _, event := range bp.jobEvents {
+		if event.Sequence > since {
+			missed = append(missed, event)
+		}
+	}
+	return missed, complete
+}
+
+// snapshot marshals the batch under its lock
+func (bp *BatchProcess) snapshot() ([]byte, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return json.Marshal(bp)
+}
+
+// handleWebSocket streams a batch's progress. By default a {"type": "rollup"}
+// message with job counts, throughput and ETA is sent every ?interval=
+// (e.g. "10s") while the batch changes, and clients ask for the jobs they
+// want to see with detail requests. ?detail=jobs streams a full batch
+// snapshot on every change instead. Clients reconnecting after a drop pass
+// ?since=<sequence of the last message they saw> and first receive a
+// {"type": "resume"} message with the job events they missed.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	batchID := mux.Vars(r)["batch_id"]
+	process, exists := processes.get(batchID)
+	if !exists {
+		batchGC.notFound(w, batchID)
+		return
+	}
+
+	var since int64 = -1
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid since sequence", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	fullSnapshots := false
+	switch detail := r.URL.Query().Get("detail"); detail {
+	case "", "rollup":
+	case "jobs":
+		fullSnapshots = true
+	default:
+		http.Error(w, "Invalid detail, expected rollup or jobs", http.StatusBadRequest)
+		return
+	}
+	interval := progressRollupInterval
+	if value := r.URL.Query().Get("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < minRollupInterval || parsed > maxRollupInterval {
+			http.Error(w, fmt.Sprintf("Invalid interval, expected a duration between %v and %v", minRollupInterval, maxRollupInterval), http.StatusBadRequest)
+			return
+		}
+		interval = parsed
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Buffered so an update arriving during a write is coalesced, not dropped
+	updates := make(chan bool, 1)
+	process.mu.Lock()
+	process.clients = append(process.clients, updates)
+	process.touch()
+	process.mu.Unlock()
+
+	defer func() {
+		process.mu.Lock()
+		process.touch() // The inactivity period starts when the last client leaves
+		for i, ch := range process.clients {
+			if ch == updates {
+				process.clients = append(process.clients[:i], process.clients[i+1:]...)
+				break
+			}
+		}
+		process.mu.Unlock()
+	}()
+
+	// Pongs extend the read deadline; a client that stops answering is dropped
+	closed := make(chan struct{})
+	requests := make(chan detailRequest, 8)
+	go readPongs(conn, closed, requests)
+
+	write := func(messageType int, data []byte) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteMessage(messageType, data) == nil
+	}
+
+	if since >= 0 {
+		missed, complete := process.missedEvents(since)
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":     "resume",
+			"since":    since,
+			"events":   missed,
+			"complete": complete, // false when older events were dropped; the next snapshot is authoritative
+		})
+		if !write(websocket.TextMessage, data) {
+			return
+		}
+	}
+
+	sendSnapshot := func() bool {
+		data, err := process.snapshot()
+		if err != nil {
+			log.Printf("Failed to marshal batch %s: %v", process.ID, err)
+			return false
+		}
+		return write(websocket.TextMessage, data)
+	}
+
+	sendRollup := func() bool {
+		data, err := json.Marshal(process.rollup())
+		if err != nil {
+			log.Printf("Failed to marshal rollup of batch %s: %v", process.ID, err)
+			return false
+		}
+		return write(websocket.TextMessage, data)
+	}
+	sendState := sendRollup
+	if fullSnapshots {
+		sendState = sendSnapshot
+	}
+
+	// Send initial state
+	if !sendState() {
+		return
+	}
+
+	var rollups <-chan time.Time
+	if !fullSnapshots {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		rollups = ticker.C
+	}
+	changed := false
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-updates:
+			if !fullSnapshots {
+				changed = true // Reported with the next rollup
+			} else if !sendSnapshot() {
+				return
+			}
+		case <-rollups:
+			if changed {
+				changed = false
+				if !sendRollup() {
+					return
+				}
+			}
+		case request := <-requests:
+			if request.Type != "jobs" {
+				continue
+			}
+			data, err := process.jobDetail(request)
+			if err != nil {
+				log.Printf("Failed to marshal jobs of batch %s: %v", process.ID, err)
+				return
+			}
+			if !write(websocket.TextMessage, data) {
+				return
+			}
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// readPongs consumes client frames so control messages are processed, and
+// closes done once the client disconnects or misses two pings. Detail
+// requests are passed to requests when it is not nil; requests sent faster
+// than they are answered are dropped.
+func readPongs(conn *websocket.Conn, done chan struct{}, requests chan<- detailRequest) {
+	defer close(done)
+	pongWait := 2 * wsPingInterval
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var request detailRequest
+		if requests == nil || json.Unmarshal(data, &request) != nil {
+			continue
+		}
+		select {
+		case requests <- request:
+		default:
+		}
+	}
+}
+
+// BatchFeedEvent summarizes one batch for the global feed
+type BatchFeedEvent struct {
+	BatchID       string         `json:"batch_id"`
+	Status        string         `json:"status"`
+	Progress      int            `json:"progress"`
+	QueuePosition int            `json:"queue_position,omitempty"`
+	Sequence      int64          `json:"sequence"`
+	Jobs          map[string]int `json:"jobs"` // Job counts by status
+	Time          time.Time      `json:"time"`
+}
+
+// feedEvent summarizes the batch under its lock
+func (bp *BatchProcess) feedEvent() BatchFeedEvent {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	counts := make(map[string]int)
+	for _, job := range bp.Jobs {
+		counts[job.Status]++
+	}
+	return BatchFeedEvent{
+		BatchID:       bp.ID,
+		Status:        bp.Status,
+		Progress:      bp.Progress,
+		QueuePosition: bp.QueuePosition,
+		Sequence:      bp.Sequence,
+		Jobs:          counts,
+		Time:          time.Now(),
+	}
+}
+
+// feedClient is one /ws/all connection with its filters and pending batches
+type feedClient struct {
+	owner    string          // Caller identity; other callers' batches are never sent
+	batches  map[string]bool // Empty for every batch
+	statuses map[string]bool // Empty for every status
+
+	mu    sync.Mutex
+	dirty map[string]bool
+	wake  chan struct{}
+}
+
+// visible reports whether the client's caller owns a batch
+func (c *feedClient) visible(process *BatchProcess) bool {
+	return process.Owner == c.owner
+}
+
+// wants reports whether an event passes the client's filters
+func (c *feedClient) wants(event BatchFeedEvent) bool {
+	return (len(c.batches) == 0 || c.batches[event.BatchID]) && (len(c.statuses) == 0 || c.statuses[event.Status])
+}
+
+// batchFeed fans batch updates out to every /ws/all client
+type batchFeed struct {
+	mu      sync.Mutex
+	clients map[*feedClient]bool
+}
+
+var feed = &batchFeed{clients: make(map[*feedClient]bool)}
+
+// publish marks a batch as changed for every client; repeated changes
+// before the client catches up are coalesced into one event
+func (f *batchFeed) publish(batchID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for client := range f.clients {
+		if len(client.batches) > 0 && !client.batches[batchID] {
+			continue
+		}
+		client.mu.Lock()
+		client.dirty[batchID] = true
+		client.mu.Unlock()
+		select {
+		case client.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *batchFeed) add(client *feedClient) {
+	f.mu.Lock()
+	f.clients[client] = true
+	f.mu.Unlock()
+}
+
+func (f *batchFeed) remove(client *feedClient) {
+	f.mu.Lock()
+	delete(f.clients, client)
+	f.mu.Unlock()
+}
+
+// filterSet parses a comma-separated query parameter into a set
+func filterSet(value string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
+
+// handleBatchFeed streams summarized events for every batch on one
+// connection, optionally filtered with ?batch=id1,id2 and ?status=processing,failed.
+// Only batches uploaded by the same caller, identified as in the audit log,
+// are sent; anonymous callers see only anonymous uploads.
+func handleBatchFeed(w http.ResponseWriter, r *http.Request) {
+	client := &feedClient{
+		owner:    auditActor(r),
+		batches:  filterSet(r.URL.Query().Get("batch")),
+		statuses: filterSet(r.URL.Query().Get("status")),
+		dirty:    make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	feed.add(client)
+	defer feed.remove(client)
+
+	closed := make(chan struct{})
+	go readPongs(conn, closed, nil)
+
+	send := func(event BatchFeedEvent) bool {
+		if !client.wants(event) {
+			return true
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return false
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteMessage(websocket.TextMessage, data) == nil
+	}
+
+	// Start with the current state of every unfinished batch
+	for _, process := range processes.snapshot() {
+		if !client.visible(process) {
+			continue
+		}
+		if event := process.feedEvent(); !batchDone(event.Status) && !send(event) {
+			return
+		}
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-client.wake:
+			client.mu.Lock()
+			dirty := client.dirty
+			client.dirty = make(map[string]bool)
+			client.mu.Unlock()
+			for batchID := range dirty {
+				process, ok := processes.get(batchID)
+				if ok && client.visible(process) && !send(process.feedEvent()) {
+					return
+				}
+			}
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}